@@ -1,17 +1,58 @@
 package api
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/sam-berry/ecfr-analyzer/server/httpresponse"
 	"github.com/sam-berry/ecfr-analyzer/server/service"
 )
 
 type AgencyAPI struct {
-	Router        fiber.Router
-	AgencyService *service.AgencyService
+	Router              fiber.Router
+	AgencyService       *service.AgencyService
+	AgencyMetricService *service.AgencyMetricService
 }
 
 func (api *AgencyAPI) Register() {
+	// Registered before /agencies/:slug so "compare" is not treated as a slug
+	api.Router.Get(
+		"/agencies/compare", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			slugA := c.Query("a")
+			slugB := c.Query("b")
+			if slugA == "" || slugB == "" {
+				return httpresponse.ApplyErrorToResponse(c, "a and b agency slug parameters are required", nil)
+			}
+
+			comparison, err := api.AgencyMetricService.CompareAgencies(ctx, slugA, slugB)
+
+			if err != nil {
+				if errors.Is(err, service.ErrAgencyNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, comparison)
+		},
+	)
+
+	// Public endpoint to get the agency hierarchy, registered before /agencies/:slug like compare
+	api.Router.Get(
+		"/agencies/tree", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			tree, err := api.AgencyService.GetAgencyTree(ctx)
+
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, tree)
+		},
+	)
+
 	api.Router.Get(
 		"/agencies/:slug", func(c *fiber.Ctx) error {
 			ctx := c.UserContext()
@@ -27,4 +68,23 @@ func (api *AgencyAPI) Register() {
 			return httpresponse.ApplySuccessToResponse(c, data)
 		},
 	)
+
+	api.Router.Get(
+		"/agencies/:slug/references", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			slug := c.Params("slug")
+
+			data, err := api.AgencyMetricService.ResolveAgencyReferences(ctx, slug)
+
+			if err != nil {
+				if errors.Is(err, service.ErrAgencyNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, data)
+		},
+	)
 }
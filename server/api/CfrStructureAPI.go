@@ -1,10 +1,18 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
+	"github.com/sam-berry/ecfr-analyzer/server/config"
+	"github.com/sam-berry/ecfr-analyzer/server/dao"
 	"github.com/sam-berry/ecfr-analyzer/server/httpresponse"
+	"github.com/sam-berry/ecfr-analyzer/server/parser"
 	"github.com/sam-berry/ecfr-analyzer/server/service"
+	"math"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type CfrStructureAPI struct {
@@ -12,6 +20,11 @@ type CfrStructureAPI struct {
 	CfrStructureService *service.CfrStructureService
 }
 
+type structureBatchRequest struct {
+	Title int      `json:"title"`
+	Paths []string `json:"paths"`
+}
+
 func (api *CfrStructureAPI) Register() {
 	// Admin endpoint to parse and store CFR structure for all titles
 	api.Router.Post(
@@ -25,13 +38,421 @@ func (api *CfrStructureAPI) Register() {
 				titlesFilter = []string{}
 			}
 
-			err := api.CfrStructureService.ProcessAllTitles(ctx, titlesFilter)
+			// Reparse titles even if their content is unchanged since the last parse
+			force := c.QueryBool("force", false)
+
+			// Store the inner XML of each section, off by default to avoid bloating storage
+			captureRawXML := c.QueryBool("captureRawXml", false)
+
+			// Store only the sections, without the hierarchy above them
+			leavesOnly := c.QueryBool("leavesOnly", false)
+
+			summaries, err := api.CfrStructureService.ProcessAllTitles(
+				ctx,
+				titlesFilter,
+				force,
+				captureRawXML,
+				leavesOnly,
+			)
+
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, summaries)
+		},
+	)
+
+	// Admin endpoint to parse and store CFR structure for a single title
+	api.Router.Post(
+		"/parse/cfr-structure/:number", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			captureRawXML := c.QueryBool("captureRawXml", false)
+			leavesOnly := c.QueryBool("leavesOnly", false)
+
+			stats, err := api.CfrStructureService.ProcessTitle(ctx, titleNumber, captureRawXML, leavesOnly)
 
 			if err != nil {
+				if errors.Is(err, dao.ErrTitleNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, fmt.Sprintf("Title %d not found", titleNumber))
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, stats)
+		},
+	)
+
+	// Admin endpoint to recount the words of a title's stored structure elements without reparsing it
+	api.Router.Post(
+		"/titles/:number/recompute-words", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			err = api.CfrStructureService.RecomputeWordCounts(ctx, titleNumber)
+
+			if err != nil {
+				if errors.Is(err, dao.ErrTitleNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, fmt.Sprintf("Title %d not found", titleNumber))
+				}
 				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
 			}
 
 			return httpresponse.ApplySuccessToResponse(c, nil)
 		},
 	)
+
+	// Admin endpoint to reparse a single part of a title, replacing only the stored structure of that part
+	api.Router.Post(
+		"/titles/:number/parts/:id/reparse", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			partIdentifier := c.Params("id")
+
+			err = api.CfrStructureService.ReparsePart(ctx, titleNumber, partIdentifier)
+
+			if err != nil {
+				if errors.Is(err, dao.ErrTitleNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, fmt.Sprintf("Title %d not found", titleNumber))
+				}
+				if errors.Is(err, parser.ErrSubtreeNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(
+						c, fmt.Sprintf("Part %s of title %d not found", partIdentifier, titleNumber),
+					)
+				}
+				if errors.Is(err, service.ErrLeavesOnlyTitle) {
+					return httpresponse.ApplyErrorToResponse(c, err.Error(), err)
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, nil)
+		},
+	)
+
+	// Admin endpoint to store the hierarchy of a title from the eCFR structure JSON, without text or word counts
+	api.Router.Post(
+		"/import/cfr-structure/:number", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			summary, err := api.CfrStructureService.ImportFromStructureJSON(ctx, titleNumber)
+
+			if err != nil {
+				if errors.Is(err, dao.ErrTitleNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, fmt.Sprintf("Title %d not found", titleNumber))
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, summary)
+		},
+	)
+
+	// Endpoint to fetch several structure elements of a title by path in one request
+	api.Router.Post(
+		"/structures/batch", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			var req structureBatchRequest
+			if err := parseJSONBody(c, &req, config.RequestBodyLimit); err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid request body", err)
+			}
+
+			if req.Title <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "title is required", nil)
+			}
+
+			structures, err := api.CfrStructureService.GetStructuresByPaths(ctx, req.Title, req.Paths)
+
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, structures)
+		},
+	)
+
+	// Endpoint to get the sections of a title with the highest word counts
+	api.Router.Get(
+		"/titles/:number/largest-sections", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			// Get optional limit parameter (default: 25)
+			limit := c.QueryInt("limit", 25)
+			if limit <= 0 {
+				limit = 25
+			}
+
+			sections, err := api.CfrStructureService.GetLargestSections(ctx, titleNumber, limit)
+
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, sections)
+		},
+	)
+
+	// Endpoint to find groups of sections of a title with identical or similar text
+	api.Router.Get(
+		"/titles/:number/duplicates", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			// Get optional similarity threshold (default: 0.9), 1 finds identical text only
+			threshold := c.QueryFloat("threshold", 0.9)
+
+			duplicates, err := api.CfrStructureService.FindDuplicateSections(ctx, titleNumber, threshold)
+
+			if err != nil {
+				if errors.Is(err, dao.ErrTitleNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, fmt.Sprintf("Title %d not found", titleNumber))
+				}
+				if errors.Is(err, service.ErrInvalidSimilarityThreshold) {
+					return httpresponse.ApplyErrorToResponse(c, err.Error(), err)
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, duplicates)
+		},
+	)
+
+	// Endpoint to list when each title was last parsed and how many structure elements were stored
+	api.Router.Get(
+		"/parse/status", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			states, err := api.CfrStructureService.GetParseStatus(ctx)
+
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, states)
+		},
+	)
+
+	// Endpoint to list the imported titles that have no stored structure yet
+	api.Router.Get(
+		"/parse/pending", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titles, err := api.CfrStructureService.GetPendingTitles(ctx)
+
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, titles)
+		},
+	)
+
+	// Endpoint to list the recorded parse errors of titles that are currently failing
+	api.Router.Get(
+		"/parse/errors", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			parseErrors, err := api.CfrStructureService.GetParseErrors(ctx)
+
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, parseErrors)
+		},
+	)
+
+	// Endpoint to get the number of structure elements of a title at each div level
+	api.Router.Get(
+		"/titles/:number/level-distribution", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			distribution, err := api.CfrStructureService.GetLevelDistribution(ctx, titleNumber)
+
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, distribution)
+		},
+	)
+
+	// Endpoint to compare a fresh parse of a title with its stored structure metrics
+	api.Router.Get(
+		"/titles/:number/verify", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			report, err := api.CfrStructureService.VerifyMetricsConsistency(ctx, titleNumber)
+
+			if err != nil {
+				if errors.Is(err, dao.ErrTitleNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, fmt.Sprintf("Title %d not found", titleNumber))
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, report)
+		},
+	)
+
+	// Admin endpoint to parse and store the CFR structure of a stored title version
+	api.Router.Post(
+		"/parse/cfr-structure/:number/versions/:date", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			versionDate, err := time.Parse(dateLayout, c.Params("date"))
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid date format. Use YYYY-MM-DD", err)
+			}
+
+			summary, err := api.CfrStructureService.ProcessTitleVersion(ctx, titleNumber, versionDate)
+
+			if err != nil {
+				if errors.Is(err, service.ErrVersionNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, summary)
+		},
+	)
+
+	// Endpoint to get the structure parsed from a title version
+	api.Router.Get(
+		"/titles/:number/versions/:date/structures", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			versionDate, err := time.Parse(dateLayout, c.Params("date"))
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid date format. Use YYYY-MM-DD", err)
+			}
+
+			structures, err := api.CfrStructureService.GetStructuresByVersion(ctx, titleNumber, versionDate)
+
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, structures)
+		},
+	)
+
+	// Endpoint to find the structure elements of a title within a word count range, either bound may be omitted
+	api.Router.Get(
+		"/titles/:number/structures/by-words", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			minWords := c.QueryInt("min", 0)
+			maxWords := c.QueryInt("max", math.MaxInt32)
+			if minWords < 0 || maxWords < minWords {
+				return httpresponse.ApplyErrorToResponse(c, "min must be at least 0 and no greater than max", nil)
+			}
+
+			structures, err := api.CfrStructureService.GetStructuresByWordCount(ctx, titleNumber, minWords, maxWords)
+
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, structures)
+		},
+	)
+
+	// Endpoint to count the sections of a title in word count buckets, for a distribution chart
+	api.Router.Get(
+		"/titles/:number/word-histogram", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			// Get optional bucket upper bounds, e.g., edges=50,100,250
+			bucketEdges := service.DefaultWordCountBucketEdges
+			if edges := c.Query("edges"); len(edges) > 0 {
+				bucketEdges, err = parseBucketEdges(edges)
+				if err != nil {
+					return httpresponse.ApplyErrorToResponse(c, err.Error(), err)
+				}
+			}
+
+			histogram, err := api.CfrStructureService.GetWordCountHistogram(ctx, titleNumber, bucketEdges)
+
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, histogram)
+		},
+	)
+}
+
+// parseBucketEdges parses comma separated word count bucket edges, which must be ascending and not negative
+func parseBucketEdges(value string) ([]int, error) {
+	var edges []int
+	for _, part := range strings.Split(value, ",") {
+		edge, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || edge < 0 || (len(edges) > 0 && edge <= edges[len(edges)-1]) {
+			return nil, fmt.Errorf("edges must be ascending whole numbers, at least 0: %q", value)
+		}
+		edges = append(edges, edge)
+	}
+	return edges, nil
 }
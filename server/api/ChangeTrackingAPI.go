@@ -1,16 +1,38 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
+	"github.com/sam-berry/ecfr-analyzer/server/data"
 	"github.com/sam-berry/ecfr-analyzer/server/httpresponse"
 	"github.com/sam-berry/ecfr-analyzer/server/service"
 	"strings"
-	"time"
 )
 
+const markdownContentType = "text/markdown; charset=utf-8"
+
+// maxDiffBodySize bounds the JSON body of /diff, enough for hand crafted samples and small titles
+const maxDiffBodySize = 20 * 1024 * 1024
+
+type xmlDiffRequest struct {
+	Title    int    `json:"title"`
+	StartXML string `json:"startXml"`
+	EndXML   string `json:"endXml"`
+	MatchBy  string `json:"matchBy"`
+}
+
+// xmlDiffResponse is the change and section diff between the two documents of an xmlDiffRequest
+type xmlDiffResponse struct {
+	Change   *service.TitleChange `json:"change"`
+	Sections *service.SectionDiff `json:"sections"`
+}
+
 type ChangeTrackingAPI struct {
 	Router                fiber.Router
 	ChangeTrackingService *service.ChangeTrackingService
+	JobService            *service.JobService
 }
 
 func (api *ChangeTrackingAPI) Register() {
@@ -19,22 +41,14 @@ func (api *ChangeTrackingAPI) Register() {
 		"/compute/changes", func(c *fiber.Ctx) error {
 			ctx := c.UserContext()
 
-			// Get date parameters (required)
-			startDateStr := c.Query("startDate") // Format: YYYY-MM-DD
-			endDateStr := c.Query("endDate")     // Format: YYYY-MM-DD
-
-			if startDateStr == "" || endDateStr == "" {
-				return httpresponse.ApplyErrorToResponse(c, "startDate and endDate parameters are required (format: YYYY-MM-DD)", nil)
-			}
-
-			startDate, err := time.Parse("2006-01-02", startDateStr)
-			if err != nil {
-				return httpresponse.ApplyErrorToResponse(c, "Invalid startDate format. Use YYYY-MM-DD", err)
+			startDate, ok, err := parseDateQuery(c, "startDate", true)
+			if !ok {
+				return err
 			}
 
-			endDate, err := time.Parse("2006-01-02", endDateStr)
-			if err != nil {
-				return httpresponse.ApplyErrorToResponse(c, "Invalid endDate format. Use YYYY-MM-DD", err)
+			endDate, ok, err := parseDateQuery(c, "endDate", true)
+			if !ok {
+				return err
 			}
 
 			// Get optional titles filter
@@ -46,7 +60,16 @@ func (api *ChangeTrackingAPI) Register() {
 				titlesFilter = []string{}
 			}
 
-			err = api.ChangeTrackingService.ComputeChangesForDateRange(ctx, startDate, endDate, titlesFilter)
+			// Leave reserved sections out of section counts (default: false)
+			excludeReserved := c.QueryBool("excludeReserved", false)
+
+			err = api.ChangeTrackingService.ComputeChangesForDateRange(
+				ctx,
+				startDate,
+				endDate,
+				titlesFilter,
+				excludeReserved,
+			)
 
 			if err != nil {
 				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
@@ -56,70 +79,213 @@ func (api *ChangeTrackingAPI) Register() {
 		},
 	)
 
+	// Admin endpoint to compute the changes between every pair of consecutive stored versions of a title
+	api.Router.Post(
+		"/compute/changes/backfill", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber := c.QueryInt("title", 0)
+			if titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "title parameter is required", nil)
+			}
+
+			// Run in the background as a job that can be canceled and resumed, see JobAPI
+			if c.QueryBool("async", false) {
+				name := fmt.Sprintf("Change Backfill (%d)", titleNumber)
+				job := api.JobService.StartResumable(ctx, name, func(ctx context.Context) (any, error) {
+					return api.ChangeTrackingService.BackfillAdjacentChanges(ctx, titleNumber)
+				})
+				return httpresponse.ApplySuccessToResponse(c, job)
+			}
+
+			summary, err := api.ChangeTrackingService.BackfillAdjacentChanges(ctx, titleNumber)
+			if err != nil {
+				if errors.Is(err, service.ErrNotEnoughVersions) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, summary)
+		},
+	)
+
 	// Public endpoint to get change summary
 	api.Router.Get(
 		"/changes/summary", func(c *fiber.Ctx) error {
 			ctx := c.UserContext()
 
-			// Get date parameters (required)
-			startDateStr := c.Query("startDate") // Format: YYYY-MM-DD
-			endDateStr := c.Query("endDate")     // Format: YYYY-MM-DD
+			startDate, ok, err := parseDateQuery(c, "startDate", true)
+			if !ok {
+				return err
+			}
 
-			if startDateStr == "" || endDateStr == "" {
-				return httpresponse.ApplyErrorToResponse(c, "startDate and endDate parameters are required (format: YYYY-MM-DD)", nil)
+			endDate, ok, err := parseDateQuery(c, "endDate", true)
+			if !ok {
+				return err
 			}
 
-			startDate, err := time.Parse("2006-01-02", startDateStr)
+			// Get optional minimum absolute percent word change (default: 0, all titles)
+			minPercentWordChange := c.QueryFloat("minPercentWordChange", 0)
+
+			changes, computedAt, err := api.ChangeTrackingService.GetChangeSummary(ctx, startDate, endDate, minPercentWordChange)
 			if err != nil {
-				return httpresponse.ApplyErrorToResponse(c, "Invalid startDate format. Use YYYY-MM-DD", err)
+				if errors.Is(err, service.ErrNotComputed) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
 			}
 
-			endDate, err := time.Parse("2006-01-02", endDateStr)
-			if err != nil {
-				return httpresponse.ApplyErrorToResponse(c, "Invalid endDate format. Use YYYY-MM-DD", err)
+			return httpresponse.ApplyCacheableResponse(c, changes, computedAt)
+		},
+	)
+
+	// Public endpoint to get top changing titles
+	api.Router.Get(
+		"/changes/top", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			startDate, ok, err := parseDateQuery(c, "startDate", true)
+			if !ok {
+				return err
+			}
+
+			endDate, ok, err := parseDateQuery(c, "endDate", true)
+			if !ok {
+				return err
+			}
+
+			// Get optional limit parameter (default: 10)
+			limit := c.QueryInt("limit", 10)
+
+			// Get optional minimum absolute percent word change (default: 0, all titles)
+			minPercentWordChange := c.QueryFloat("minPercentWordChange", 0)
+
+			// Get optional change score weights (default: absolute word change only)
+			weights := service.ScoreWeights{
+				Words:    c.QueryFloat("wordWeight", service.DefaultScoreWeights.Words),
+				Sections: c.QueryFloat("sectionWeight", service.DefaultScoreWeights.Sections),
 			}
 
-			changes, err := api.ChangeTrackingService.GetChangeSummary(ctx, startDate, endDate)
+			topChanges, computedAt, err := api.ChangeTrackingService.GetTopChangingTitles(
+				ctx,
+				startDate,
+				endDate,
+				limit,
+				minPercentWordChange,
+				weights,
+			)
 			if err != nil {
+				if errors.Is(err, service.ErrNotComputed) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				if errors.Is(err, service.ErrInvalidScoreWeights) {
+					return httpresponse.ApplyErrorToResponse(c, err.Error(), err)
+				}
 				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
 			}
 
-			return httpresponse.ApplySuccessToResponse(c, changes)
+			return httpresponse.ApplyCacheableResponse(c, topChanges, computedAt)
 		},
 	)
 
-	// Public endpoint to get top changing titles
+	// Public endpoint to get added, removed, and modified sections of a title
 	api.Router.Get(
-		"/changes/top", func(c *fiber.Ctx) error {
+		"/changes/sections", func(c *fiber.Ctx) error {
 			ctx := c.UserContext()
 
-			// Get date parameters (required)
-			startDateStr := c.Query("startDate") // Format: YYYY-MM-DD
-			endDateStr := c.Query("endDate")     // Format: YYYY-MM-DD
+			titleNumber := c.QueryInt("title", 0)
+			if titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "title parameter is required", nil)
+			}
+
+			startDate, ok, err := parseDateQuery(c, "startDate", true)
+			if !ok {
+				return err
+			}
 
-			if startDateStr == "" || endDateStr == "" {
-				return httpresponse.ApplyErrorToResponse(c, "startDate and endDate parameters are required (format: YYYY-MM-DD)", nil)
+			endDate, ok, err := parseDateQuery(c, "endDate", true)
+			if !ok {
+				return err
 			}
 
-			startDate, err := time.Parse("2006-01-02", startDateStr)
+			// Compare the stored structures of the versions when available instead of parsing them
+			preferStored := c.QueryBool("fast", false)
+
+			// Match sections by node id (default), falling back to path, or by path only
+			matchBy := c.Query("matchBy", data.MatchByNodeId)
+
+			// Include the change of the number of structure elements of each div type
+			typeCounts := c.QueryBool("typeCounts", false)
+
+			diff, err := api.ChangeTrackingService.ComputeSectionDiff(
+				ctx, titleNumber, startDate, endDate, preferStored, matchBy, typeCounts,
+			)
 			if err != nil {
-				return httpresponse.ApplyErrorToResponse(c, "Invalid startDate format. Use YYYY-MM-DD", err)
+				if errors.Is(err, service.ErrVersionNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				if errors.Is(err, service.ErrInvalidMatchBy) {
+					return httpresponse.ApplyErrorToResponse(c, err.Error(), err)
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
 			}
 
-			endDate, err := time.Parse("2006-01-02", endDateStr)
+			return httpresponse.ApplySuccessToResponse(c, diff)
+		},
+	)
+
+	// Public endpoint to get aggregate statistics of the changes of all titles
+	api.Router.Get(
+		"/changes/stats", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			startDate, ok, err := parseDateQuery(c, "startDate", true)
+			if !ok {
+				return err
+			}
+
+			endDate, ok, err := parseDateQuery(c, "endDate", true)
+			if !ok {
+				return err
+			}
+
+			stats, err := api.ChangeTrackingService.GetChangeStatistics(ctx, startDate, endDate)
 			if err != nil {
-				return httpresponse.ApplyErrorToResponse(c, "Invalid endDate format. Use YYYY-MM-DD", err)
+				if errors.Is(err, service.ErrNotComputed) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
 			}
 
-			// Get optional limit parameter (default: 10)
-			limit := c.QueryInt("limit", 10)
+			return httpresponse.ApplyCacheableResponse(c, stats, stats.ComputedAt)
+		},
+	)
+
+	// Public endpoint to get the agency whose words grew the most between two dates
+	api.Router.Get(
+		"/changes/agencies/top-growth", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
 
-			topChanges, err := api.ChangeTrackingService.GetTopChangingTitles(ctx, startDate, endDate, limit)
+			startDate, ok, err := parseDateQuery(c, "startDate", true)
+			if !ok {
+				return err
+			}
+
+			endDate, ok, err := parseDateQuery(c, "endDate", true)
+			if !ok {
+				return err
+			}
+
+			agency, err := api.ChangeTrackingService.TopGrowingAgency(ctx, startDate, endDate)
 			if err != nil {
+				if errors.Is(err, service.ErrNoAgencyGrowth) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
 				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
 			}
 
-			return httpresponse.ApplySuccessToResponse(c, topChanges)
+			return httpresponse.ApplySuccessToResponse(c, agency)
 		},
 	)
 
@@ -128,32 +294,240 @@ func (api *ChangeTrackingAPI) Register() {
 		"/changes/report", func(c *fiber.Ctx) error {
 			ctx := c.UserContext()
 
-			// Get date parameters (required)
-			startDateStr := c.Query("startDate") // Format: YYYY-MM-DD
-			endDateStr := c.Query("endDate")     // Format: YYYY-MM-DD
+			startDate, ok, err := parseDateQuery(c, "startDate", true)
+			if !ok {
+				return err
+			}
 
-			if startDateStr == "" || endDateStr == "" {
-				return httpresponse.ApplyErrorToResponse(c, "startDate and endDate parameters are required (format: YYYY-MM-DD)", nil)
+			endDate, ok, err := parseDateQuery(c, "endDate", true)
+			if !ok {
+				return err
 			}
 
-			startDate, err := time.Parse("2006-01-02", startDateStr)
+			// Get optional minimum absolute percent word change (default: 0, all titles)
+			minPercentWordChange := c.QueryFloat("minPercentWordChange", 0)
+
+			report, err := api.ChangeTrackingService.GenerateChangeReport(ctx, startDate, endDate, minPercentWordChange)
 			if err != nil {
-				return httpresponse.ApplyErrorToResponse(c, "Invalid startDate format. Use YYYY-MM-DD", err)
+				if errors.Is(err, service.ErrNotComputed) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			if c.Query("format") == "markdown" {
+				return httpresponse.ApplyTextResponse(c, markdownContentType, report.Markdown(), report.ComputedAt)
+			}
+
+			// Plain text by default, JSON with Accept: application/json
+			return httpresponse.ApplyNegotiatedResponse(c, report, report.Text, report.ComputedAt)
+		},
+	)
+
+	// Public endpoint to get the change of a title between its two most recent stored versions
+	api.Router.Get(
+		"/changes/latest", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber := c.QueryInt("title", 0)
+			if titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "title parameter is required", nil)
 			}
 
-			endDate, err := time.Parse("2006-01-02", endDateStr)
+			change, err := api.ChangeTrackingService.GetLatestChange(ctx, titleNumber)
 			if err != nil {
-				return httpresponse.ApplyErrorToResponse(c, "Invalid endDate format. Use YYYY-MM-DD", err)
+				if errors.Is(err, service.ErrNotEnoughVersions) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, change)
+		},
+	)
+
+	// Public endpoint to get the change of a title over each week, month, or quarter of a year
+	api.Router.Get(
+		"/changes/periods", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber := c.QueryInt("title", 0)
+			if titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "title parameter is required", nil)
+			}
+
+			year := c.QueryInt("year", 0)
+			if year <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "year parameter is required", nil)
+			}
+
+			period := c.Query("period", "quarter")
+
+			changes, err := api.ChangeTrackingService.ComputePeriodChanges(ctx, titleNumber, period, year)
+			if err != nil {
+				if errors.Is(err, service.ErrInvalidPeriod) {
+					return httpresponse.ApplyErrorToResponse(c, err.Error(), err)
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, changes)
+		},
+	)
+
+	// Endpoint to get the average absolute word change per month of a title, to flag titles under active revision
+	api.Router.Get(
+		"/titles/:number/velocity", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			// Get optional window in months, ending now (default: 12)
+			months := c.QueryInt("months", 12)
+			if months <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "months must be at least 1", nil)
+			}
+
+			velocity, err := api.ChangeTrackingService.ChangeVelocity(ctx, titleNumber, service.MonthsDuration(months))
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, velocity)
+		},
+	)
+
+	// Endpoint to flag the changes between consecutive versions of a title that are far from its usual change
+	api.Router.Get(
+		"/titles/:number/anomalies", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			anomalies, err := api.ChangeTrackingService.DetectAnomalies(ctx, titleNumber)
+			if err != nil {
+				if errors.Is(err, service.ErrNotEnoughVersions) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, anomalies)
+		},
+	)
+
+	// Endpoint to compare a title between two dates on demand, without storing the change
+	api.Router.Get(
+		"/titles/:number/compare", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			fromDate, ok, err := parseDateQuery(c, "from", true)
+			if !ok {
+				return err
+			}
+
+			toDate, ok, err := parseDateQuery(c, "to", true)
+			if !ok {
+				return err
+			}
+
+			if toDate.Before(fromDate) {
+				return httpresponse.ApplyErrorToResponse(c, "to must not be before from", nil)
 			}
 
-			report, err := api.ChangeTrackingService.GenerateChangeReport(ctx, startDate, endDate)
+			// Leave reserved sections out of section counts (default: false)
+			excludeReserved := c.QueryBool("excludeReserved", false)
+
+			change, err := api.ChangeTrackingService.CompareVersions(ctx, titleNumber, fromDate, toDate, excludeReserved)
 			if err != nil {
+				if errors.Is(err, service.ErrVersionNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
 				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
 			}
 
-			// Return as plain text
-			c.Set("Content-Type", "text/plain")
-			return c.SendString(report)
+			return httpresponse.ApplySuccessToResponse(c, change)
+		},
+	)
+
+	// Endpoint to compare the structure tree of a title between two dates, for a tree diff view
+	api.Router.Get(
+		"/titles/:number/tree/compare", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			fromDate, ok, err := parseDateQuery(c, "from", true)
+			if !ok {
+				return err
+			}
+
+			toDate, ok, err := parseDateQuery(c, "to", true)
+			if !ok {
+				return err
+			}
+
+			if toDate.Before(fromDate) {
+				return httpresponse.ApplyErrorToResponse(c, "to must not be before from", nil)
+			}
+
+			// Match elements by node id (default), falling back to path, or by path only
+			matchBy := c.Query("matchBy", data.MatchByNodeId)
+
+			comparison, err := api.ChangeTrackingService.CompareTitleTrees(ctx, titleNumber, fromDate, toDate, matchBy)
+			if err != nil {
+				if errors.Is(err, service.ErrVersionNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				if errors.Is(err, service.ErrInvalidMatchBy) {
+					return httpresponse.ApplyErrorToResponse(c, err.Error(), err)
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, comparison)
+		},
+	)
+
+	// Admin endpoint to diff two posted XML documents without storing them, for checking the diff logic
+	api.Router.Post(
+		"/diff", func(c *fiber.Ctx) error {
+			var req xmlDiffRequest
+			if err := parseJSONBody(c, &req, maxDiffBodySize); err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid request body", err)
+			}
+
+			if req.StartXML == "" || req.EndXML == "" {
+				return httpresponse.ApplyErrorToResponse(c, "startXml and endXml are required", nil)
+			}
+
+			if req.MatchBy == "" {
+				req.MatchBy = data.MatchByNodeId
+			}
+
+			change, sections, err := api.ChangeTrackingService.DiffXML(req.StartXML, req.EndXML, req.Title, req.MatchBy)
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, err.Error(), err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, &xmlDiffResponse{
+				Change:   change,
+				Sections: sections,
+			})
 		},
 	)
 }
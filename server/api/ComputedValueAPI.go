@@ -1,7 +1,9 @@
 package api
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v2"
+	"github.com/sam-berry/ecfr-analyzer/server/dao"
 	"github.com/sam-berry/ecfr-analyzer/server/httpresponse"
 	"github.com/sam-berry/ecfr-analyzer/server/service"
 	"strings"
@@ -10,6 +12,13 @@ import (
 type ComputedValueAPI struct {
 	Router               fiber.Router
 	ComputedValueService *service.ComputedValueService
+
+	ComputedValueServiceRefactored *service.ComputedValueServiceRefactored
+}
+
+// computedValuePurgeResponse is the number of computed values deleted by a purge
+type computedValuePurgeResponse struct {
+	Deleted int64 `json:"deleted"`
 }
 
 func (api *ComputedValueAPI) Register() {
@@ -27,6 +36,42 @@ func (api *ComputedValueAPI) Register() {
 		},
 	)
 
+	api.Router.Post(
+		"/compute/global-snapshot", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			options := parseCountOptionsQuery(c)
+
+			err := api.ComputedValueService.ProcessGlobalSnapshot(ctx, options)
+
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, nil)
+		},
+	)
+
+	api.Router.Post(
+		"/compute/global-timeseries", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			// Get optional comma separated dates (default: every date a version is stored for)
+			dates, ok, err := parseDateListQuery(c, "dates")
+			if !ok {
+				return err
+			}
+
+			err = api.ComputedValueService.ProcessGlobalTimeSeries(ctx, dates)
+
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, nil)
+		},
+	)
+
 	api.Router.Post(
 		"/compute/agency-metrics", func(c *fiber.Ctx) error {
 			ctx := c.UserContext()
@@ -37,8 +82,9 @@ func (api *ComputedValueAPI) Register() {
 			} else {
 				agencyFilter = []string{}
 			}
+			options := parseCountOptionsQuery(c)
 
-			err := api.ComputedValueService.ProcessAgencyMetrics(ctx, false, agencyFilter)
+			err := api.ComputedValueService.ProcessAgencyMetrics(ctx, false, agencyFilter, options)
 
 			if err != nil {
 				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
@@ -52,9 +98,66 @@ func (api *ComputedValueAPI) Register() {
 		"/compute/sub-agency-metrics", func(c *fiber.Ctx) error {
 			ctx := c.UserContext()
 
-			err := api.ComputedValueService.ProcessAgencyMetrics(ctx, true, []string{})
+			options := parseCountOptionsQuery(c)
+
+			err := api.ComputedValueService.ProcessAgencyMetrics(ctx, true, []string{}, options)
+
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, nil)
+		},
+	)
+
+	// Admin endpoint to compute title, agency, and sub-agency metrics in one call, e.g., for a new database
+	api.Router.Post(
+		"/compute/all-metrics", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+			agencies := c.Query("agencies")
+			var agencyFilter []string
+			if len(agencies) > 0 {
+				agencyFilter = strings.Split(agencies, ",")
+			} else {
+				agencyFilter = []string{}
+			}
+			options := parseCountOptionsQuery(c)
+
+			summary := api.ComputedValueServiceRefactored.ProcessAllMetrics(ctx, agencyFilter, options)
+
+			return httpresponse.ApplySuccessToResponse(c, summary)
+		},
+	)
+
+	// Admin endpoint to purge the computed values whose key starts with a prefix, e.g., the metrics of an agency
+	api.Router.Delete(
+		"/computed-values", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			deleted, err := api.ComputedValueService.PurgeComputedValues(ctx, c.Query("prefix"))
+
+			if err != nil {
+				if errors.Is(err, service.ErrEmptyKeyPrefix) {
+					return httpresponse.ApplyErrorToResponse(c, "prefix parameter is required", err)
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, &computedValuePurgeResponse{Deleted: deleted})
+		},
+	)
+
+	// Admin endpoint to delete a stale or corrupt computed value, so it is computed again
+	api.Router.Delete(
+		"/computed-values/:key", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			err := api.ComputedValueService.DeleteComputedValue(ctx, c.Params("key"))
 
 			if err != nil {
+				if errors.Is(err, dao.ErrComputedValueNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
 				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
 			}
 
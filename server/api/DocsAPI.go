@@ -0,0 +1,231 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sam-berry/ecfr-analyzer/server/data"
+	"github.com/sam-berry/ecfr-analyzer/server/openapi"
+	"github.com/sam-berry/ecfr-analyzer/server/service"
+	"strings"
+	"sync"
+)
+
+type DocsAPI struct {
+	Router     fiber.Router
+	App        *fiber.App
+	PathPrefix string // The prefix of Router, which the documented routes are relative to
+
+	// PublicRoutes are the routes that do not require the admin token, keyed by openapi.RouteKey
+	PublicRoutes map[string]bool
+
+	buildDocument sync.Once
+	document      *openapi.Document
+}
+
+// Query parameters shared by several of the change endpoints
+var (
+	startDateQuery = openapi.Query("startDate", "string", true, "Start date, YYYY-MM-DD")
+	endDateQuery   = openapi.Query("endDate", "string", true, "End date, YYYY-MM-DD")
+	titleQuery     = openapi.Query("title", "integer", true, "Title number")
+)
+
+// documentedRoutes are the query parameters and response data of the routes consumers build clients for,
+// keyed by openapi.RouteKey relative to the PathPrefix. Keep them in step with the handlers.
+var documentedRoutes = map[string]openapi.Route{
+	openapi.RouteKey(fiber.MethodGet, "/health"): {
+		Summary: "Readiness of the server and its dependencies, 503 when any is unavailable",
+		Data:    service.HealthStatus{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/metrics/titles"): {
+		Summary: "Computed word and section counts of every title",
+		Data:    data.TitleMetricResponse{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/metrics/snapshot"): {
+		Summary: "Computed totals across all titles and agencies",
+		Data:    data.GlobalSnapshot{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/metrics/global-timeseries"): {
+		Summary: "Computed total words and sections across all titles at each date",
+		Data:    []*data.GlobalPoint{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/metrics/agencies"): {
+		Summary: "Computed metrics of every agency",
+		Query: []openapi.Parameter{
+			openapi.Query("sortBy", "string", false, "Metric to sort by, largest first"),
+			openapi.Query("limit", "integer", false, "Number of agencies, 0 for all"),
+		},
+		Data: []*data.AgencyMetrics{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/metrics/agencies/:slug"): {
+		Summary: "Computed metrics of an agency",
+		Data:    data.AgencyMetrics{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/metrics/agencies/:slug/sub-agencies"): {
+		Summary: "Computed metrics of the sub-agencies of an agency",
+		Data:    []*data.AgencyMetrics{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/agencies/compare"): {
+		Summary: "Compare the metrics of two agencies",
+		Query: []openapi.Parameter{
+			openapi.Query("a", "string", true, "Slug of the first agency"),
+			openapi.Query("b", "string", true, "Slug of the second agency"),
+		},
+		Data: data.AgencyComparison{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/agencies/tree"): {
+		Summary: "Agency hierarchy",
+		Data:    []*data.AgencyTreeNode{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/agencies/:slug"): {
+		Summary: "Agency with its sub-agencies and CFR references",
+		Data:    data.Agency{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/agencies/:slug/references"): {
+		Summary: "CFR references counted toward an agency's metrics",
+		Data:    []*data.CfrReference{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/changes/summary"): {
+		Summary: "Computed changes of every title between two dates",
+		Query: []openapi.Parameter{
+			startDateQuery,
+			endDateQuery,
+			openapi.Query("minPercentWordChange", "number", false, "Minimum absolute percent word change"),
+		},
+		Data: []service.TitleChange{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/changes/top"): {
+		Summary: "Titles with the highest change score between two dates",
+		Query: []openapi.Parameter{
+			startDateQuery,
+			endDateQuery,
+			openapi.Query("limit", "integer", false, "Number of titles, default 10"),
+			openapi.Query("minPercentWordChange", "number", false, "Minimum absolute percent word change"),
+			openapi.Query("wordWeight", "number", false, "Weight of the absolute word change in the score, default 1"),
+			openapi.Query("sectionWeight", "number", false, "Weight of the absolute section change in the score, default 0"),
+		},
+		Data: []service.TitleChange{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/changes/sections"): {
+		Summary: "Sections of a title added, removed, or modified between two dates",
+		Query: []openapi.Parameter{
+			titleQuery,
+			startDateQuery,
+			endDateQuery,
+			openapi.Query("fast", "boolean", false, "Compare the stored structures of both versions"),
+			openapi.Query("matchBy", "string", false, "nodeId (default) or path"),
+			openapi.Query("typeCounts", "boolean", false, "Include the change in the count of each div type"),
+		},
+		Data: service.SectionDiff{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/changes/stats"): {
+		Summary: "Statistics of the changes of every title between two dates",
+		Query:   []openapi.Parameter{startDateQuery, endDateQuery},
+		Data:    service.ChangeStats{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/changes/agencies/top-growth"): {
+		Summary: "Agency whose words grew the most between two dates",
+		Query:   []openapi.Parameter{startDateQuery, endDateQuery},
+		Data:    service.AgencyChange{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/changes/report"): {
+		Summary: "Report of the changes between two dates, JSON with Accept: application/json",
+		Query: []openapi.Parameter{
+			startDateQuery,
+			endDateQuery,
+			openapi.Query("minPercentWordChange", "number", false, "Minimum absolute percent word change"),
+			openapi.Query("format", "string", false, "markdown for a Markdown report"),
+		},
+		Data: service.ChangeReport{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/changes/latest"): {
+		Summary: "Change of a title between its two most recent stored versions",
+		Query:   []openapi.Parameter{titleQuery},
+		Data:    service.TitleChange{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/changes/periods"): {
+		Summary: "Change of a title over each week, month, or quarter of a year",
+		Query: []openapi.Parameter{
+			titleQuery,
+			openapi.Query("year", "integer", true, "Year"),
+			openapi.Query("period", "string", false, "week, month, or quarter (default)"),
+		},
+		Data: []*service.PeriodChange{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/titles/:number/velocity"): {
+		Summary: "Average absolute word change per month of a title",
+		Query:   []openapi.Parameter{openapi.Query("months", "integer", false, "Window in months, default 12")},
+		Data:    service.ChangeVelocity{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/titles/:number/anomalies"): {
+		Summary: "Changes between consecutive versions of a title that are far from its usual change",
+		Data:    []service.Anomaly{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/titles/:number/compare"): {
+		Summary: "Change of a title between two dates, not stored",
+		Query: []openapi.Parameter{
+			openapi.Query("from", "string", true, "From date, YYYY-MM-DD"),
+			openapi.Query("to", "string", true, "To date, YYYY-MM-DD"),
+			openapi.Query("excludeReserved", "boolean", false, "Leave reserved sections out of section counts"),
+		},
+		Data: service.TitleChange{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/titles/:number/tree/compare"): {
+		Summary: "Structure trees of a title at two dates, with the change status of each element",
+		Query: []openapi.Parameter{
+			openapi.Query("from", "string", true, "From date, YYYY-MM-DD"),
+			openapi.Query("to", "string", true, "To date, YYYY-MM-DD"),
+			openapi.Query("matchBy", "string", false, "Match elements by nodeId (default) or path"),
+		},
+		Data: service.TreeComparison{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/titles/:number/versions"): {
+		Summary: "Stored versions of a title, most recent first",
+		Data:    []*data.TitleVersionDate{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/jobs"): {
+		Summary: "Jobs started since the server started, most recent first",
+		Data:    []service.Job{},
+	},
+	openapi.RouteKey(fiber.MethodGet, "/jobs/:id"): {
+		Summary: "Status and result of a job",
+		Data:    service.Job{},
+	},
+	openapi.RouteKey(fiber.MethodDelete, "/jobs/:id"): {
+		Summary: "Cancel a running job",
+		Data:    service.Job{},
+	},
+	openapi.RouteKey(fiber.MethodPost, "/jobs/:id/resume"): {
+		Summary: "Resume a failed or cancelled resumable job",
+		Data:    service.Job{},
+	},
+}
+
+func (api *DocsAPI) Register() {
+	// Public endpoint describing every registered route as OpenAPI, for client code generation
+	// Routes are read on first request, once every API is registered.
+	api.Router.Get(
+		"/openapi.json", func(c *fiber.Ctx) error {
+			api.buildDocument.Do(func() {
+				documented := make(map[string]openapi.Route, len(documentedRoutes))
+				for key, route := range documentedRoutes {
+					documented[prefixRouteKey(key, api.PathPrefix)] = route
+				}
+
+				api.document = openapi.Build(
+					"eCFR Analyzer",
+					"1.0.0",
+					api.App.GetRoutes(true),
+					documented,
+					api.PublicRoutes,
+				)
+			})
+
+			return c.JSON(api.document)
+		},
+	)
+}
+
+// prefixRouteKey prefixes the path of a route key, see openapi.RouteKey
+func prefixRouteKey(key string, prefix string) string {
+	method, path, _ := strings.Cut(key, " ")
+	return openapi.RouteKey(method, prefix+path)
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sam-berry/ecfr-analyzer/server/httpresponse"
+	"github.com/sam-berry/ecfr-analyzer/server/service"
+)
+
+type HealthAPI struct {
+	Router        fiber.Router
+	HealthService *service.HealthService
+}
+
+func (api *HealthAPI) Register() {
+	// Readiness probe, returns 503 when any dependency is unavailable
+	api.Router.Get(
+		"/health", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			health := api.HealthService.CheckHealth(ctx)
+
+			if !health.Healthy {
+				return c.Status(fiber.StatusServiceUnavailable).JSON(httpresponse.SuccessResponse(health))
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, health)
+		},
+	)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sam-berry/ecfr-analyzer/server/httpresponse"
+	"github.com/sam-berry/ecfr-analyzer/server/service"
+)
+
+type JobAPI struct {
+	Router     fiber.Router
+	JobService *service.JobService
+}
+
+func (api *JobAPI) Register() {
+	// Admin endpoint to list the jobs started since the server started, most recent first
+	api.Router.Get(
+		"/jobs", func(c *fiber.Ctx) error {
+			return httpresponse.ApplySuccessToResponse(c, api.JobService.GetJobs())
+		},
+	)
+
+	// Admin endpoint to get the status of a job
+	api.Router.Get(
+		"/jobs/:id", func(c *fiber.Ctx) error {
+			job, err := api.JobService.GetJob(c.Params("id"))
+			if err != nil {
+				if errors.Is(err, service.ErrJobNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, job)
+		},
+	)
+
+	// Admin endpoint to cancel a running job, responds once the job has stopped with its partial result
+	api.Router.Delete(
+		"/jobs/:id", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			job, err := api.JobService.CancelJob(ctx, c.Params("id"))
+			if err != nil {
+				if errors.Is(err, service.ErrJobNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, job)
+		},
+	)
+
+	// Admin endpoint to resume a failed or cancelled resumable job as a new job, which skips the work already done
+	api.Router.Post(
+		"/jobs/:id/resume", func(c *fiber.Ctx) error {
+			job, err := api.JobService.ResumeJob(c.Params("id"))
+			if err != nil {
+				if errors.Is(err, service.ErrJobNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				if errors.Is(err, service.ErrJobNotResumable) {
+					return httpresponse.ApplyErrorToResponse(c, err.Error(), err)
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, job)
+		},
+	)
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/sam-berry/ecfr-analyzer/server/httpresponse"
 	"github.com/sam-berry/ecfr-analyzer/server/service"
@@ -16,13 +17,50 @@ func (api *MetricAPI) Register() {
 		"/metrics/titles", func(c *fiber.Ctx) error {
 			ctx := c.UserContext()
 
-			r, err := api.MetricService.GetTitleMetrics(ctx)
+			r, lastModified, err := api.MetricService.GetTitleMetrics(ctx)
 
 			if err != nil {
+				if errors.Is(err, service.ErrNotComputed) || errors.Is(err, service.ErrAgencyNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
 				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
 			}
 
-			return httpresponse.ApplySuccessToResponse(c, r)
+			return httpresponse.ApplyCacheableResponse(c, r, lastModified)
+		},
+	)
+
+	api.Router.Get(
+		"/metrics/snapshot", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			r, lastModified, err := api.MetricService.GetGlobalSnapshot(ctx)
+
+			if err != nil {
+				if errors.Is(err, service.ErrNotComputed) || errors.Is(err, service.ErrAgencyNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplyCacheableResponse(c, r, lastModified)
+		},
+	)
+
+	api.Router.Get(
+		"/metrics/global-timeseries", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			r, lastModified, err := api.MetricService.GetGlobalTimeSeries(ctx)
+
+			if err != nil {
+				if errors.Is(err, service.ErrNotComputed) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplyCacheableResponse(c, r, lastModified)
 		},
 	)
 
@@ -30,13 +68,23 @@ func (api *MetricAPI) Register() {
 		"/metrics/agencies", func(c *fiber.Ctx) error {
 			ctx := c.UserContext()
 
-			r, err := api.MetricService.GetAgencyMetrics(ctx)
+			// Get optional metric to sort by, largest first, and number of agencies (default: 0, all agencies)
+			sortBy := c.Query("sortBy")
+			limit := c.QueryInt("limit", 0)
+
+			r, lastModified, err := api.MetricService.GetAgencyMetrics(ctx, sortBy, limit)
 
 			if err != nil {
+				if errors.Is(err, service.ErrNotComputed) || errors.Is(err, service.ErrAgencyNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				if errors.Is(err, service.ErrInvalidSortBy) {
+					return httpresponse.ApplyErrorToResponse(c, err.Error(), err)
+				}
 				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
 			}
 
-			return httpresponse.ApplySuccessToResponse(c, r)
+			return httpresponse.ApplyCacheableResponse(c, r, lastModified)
 		},
 	)
 
@@ -45,13 +93,16 @@ func (api *MetricAPI) Register() {
 			ctx := c.UserContext()
 			slug := c.Params("slug")
 
-			r, err := api.MetricService.GetMetricsForAgency(ctx, slug)
+			r, lastModified, err := api.MetricService.GetMetricsForAgency(ctx, slug)
 
 			if err != nil {
+				if errors.Is(err, service.ErrNotComputed) || errors.Is(err, service.ErrAgencyNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
 				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
 			}
 
-			return httpresponse.ApplySuccessToResponse(c, r)
+			return httpresponse.ApplyCacheableResponse(c, r, lastModified)
 		},
 	)
 
@@ -60,13 +111,16 @@ func (api *MetricAPI) Register() {
 			ctx := c.UserContext()
 			slug := c.Params("slug")
 
-			r, err := api.MetricService.GetSubAgencyMetrics(ctx, slug)
+			r, lastModified, err := api.MetricService.GetSubAgencyMetrics(ctx, slug)
 
 			if err != nil {
+				if errors.Is(err, service.ErrNotComputed) || errors.Is(err, service.ErrAgencyNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
 				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
 			}
 
-			return httpresponse.ApplySuccessToResponse(c, r)
+			return httpresponse.ApplyCacheableResponse(c, r, lastModified)
 		},
 	)
 }
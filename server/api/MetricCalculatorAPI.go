@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/sam-berry/ecfr-analyzer/server/httpresponse"
 	"github.com/sam-berry/ecfr-analyzer/server/service"
@@ -19,10 +20,17 @@ func (api *MetricCalculatorAPI) Register() {
 		"/calculate/agency-metrics/:slug", func(c *fiber.Ctx) error {
 			ctx := c.UserContext()
 			slug := c.Params("slug")
+			options := parseCountOptionsQuery(c)
 
-			r, err := api.AgencyMetricService.CountWordsAndSections(ctx, slug, "")
+			r, err := api.AgencyMetricService.CountWordsAndSections(ctx, slug, "", options)
 
 			if err != nil {
+				if errors.Is(err, service.ErrAgencyNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				if errors.Is(err, service.ErrLeavesOnlyTitle) {
+					return httpresponse.ApplyErrorToResponse(c, err.Error(), err)
+				}
 				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
 			}
 
@@ -43,4 +51,23 @@ func (api *MetricCalculatorAPI) Register() {
 			return httpresponse.ApplySuccessToResponse(c, r)
 		},
 	)
+
+	api.Router.Get(
+		"/titles/:number/subpart-metrics", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			r, err := api.TitleMetricService.CountWordsBySubpart(ctx, titleNumber)
+
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, r)
+		},
+	)
 }
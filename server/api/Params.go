@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sam-berry/ecfr-analyzer/server/data"
+	"github.com/sam-berry/ecfr-analyzer/server/httpresponse"
+	"io"
+	"strings"
+	"time"
+)
+
+// dateLayout is the format of date parameters, e.g., 2024-01-31
+const dateLayout = "2006-01-02"
+
+// parseDateQuery parses the YYYY-MM-DD date query parameter name, an omitted optional parameter is the zero time
+// ok is false when the parameter is required but missing, or invalid. The error response has then been
+// applied and the handler should return err.
+func parseDateQuery(c *fiber.Ctx, name string, required bool) (date time.Time, ok bool, err error) {
+	value := c.Query(name)
+	if value == "" {
+		if !required {
+			return time.Time{}, true, nil
+		}
+
+		message := fmt.Sprintf("%s parameter is required (format: YYYY-MM-DD)", name)
+		return time.Time{}, false, httpresponse.ApplyErrorToResponse(c, message, errors.New(message))
+	}
+
+	date, err = time.Parse(dateLayout, value)
+	if err != nil {
+		message := fmt.Sprintf("Invalid %s format. Use YYYY-MM-DD", name)
+		return time.Time{}, false, httpresponse.ApplyErrorToResponse(c, message, err)
+	}
+
+	return date, true, nil
+}
+
+// parseDateListQuery parses the comma separated YYYY-MM-DD dates of query parameter name, an omitted parameter is nil
+// ok is false when a date is invalid. The error response has then been applied and the handler should return err.
+func parseDateListQuery(c *fiber.Ctx, name string) (dates []time.Time, ok bool, err error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, true, nil
+	}
+
+	for _, part := range strings.Split(value, ",") {
+		date, err := time.Parse(dateLayout, strings.TrimSpace(part))
+		if err != nil {
+			message := fmt.Sprintf("Invalid %s format. Use comma separated YYYY-MM-DD dates", name)
+			return nil, false, httpresponse.ApplyErrorToResponse(c, message, err)
+		}
+		dates = append(dates, date)
+	}
+
+	return dates, true, nil
+}
+
+// parseCountOptionsQuery reads the metric count options from the includeAppendices (default false) and
+// excludeReserved (default false) query parameters
+func parseCountOptionsQuery(c *fiber.Ctx) data.CountOptions {
+	return data.CountOptions{
+		IncludeAppendices: c.QueryBool("includeAppendices", data.DefaultCountOptions.IncludeAppendices),
+		ExcludeReserved:   c.QueryBool("excludeReserved", data.DefaultCountOptions.ExcludeReserved),
+	}
+}
+
+// parseJSONBody decodes the JSON request body into v, reading at most maxSize bytes
+// Bodies over config.RequestBodyLimit are streamed rather than rejected by the app, so this bounds what is read.
+func parseJSONBody(c *fiber.Ctx, v any, maxSize int64) error {
+	body, err := io.ReadAll(io.LimitReader(c.Context().RequestBodyStream(), maxSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	if int64(len(body)) > maxSize {
+		return fmt.Errorf("request body exceeds %d bytes", maxSize)
+	}
+
+	return json.Unmarshal(body, v)
+}
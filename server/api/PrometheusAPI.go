@@ -0,0 +1,17 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type PrometheusAPI struct {
+	Router fiber.Router
+}
+
+func (api *PrometheusAPI) Register() {
+	// Admin endpoint for Prometheus to scrape import and parse metrics, along with the Go runtime and process metrics
+	// Scrapers need the admin token, registered after AdminAuthHandler like the other admin APIs
+	api.Router.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
+}
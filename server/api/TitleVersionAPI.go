@@ -1,9 +1,16 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
+	"github.com/sam-berry/ecfr-analyzer/server/dao"
 	"github.com/sam-berry/ecfr-analyzer/server/httpresponse"
+	"github.com/sam-berry/ecfr-analyzer/server/parser"
 	"github.com/sam-berry/ecfr-analyzer/server/service"
+	"io"
+	"mime/multipart"
 	"strings"
 	"time"
 )
@@ -11,6 +18,7 @@ import (
 type TitleVersionAPI struct {
 	Router              fiber.Router
 	TitleVersionService *service.TitleVersionService
+	JobService          *service.JobService
 }
 
 func (api *TitleVersionAPI) Register() {
@@ -19,15 +27,9 @@ func (api *TitleVersionAPI) Register() {
 		"/import/historical-titles", func(c *fiber.Ctx) error {
 			ctx := c.UserContext()
 
-			// Get date parameter (required)
-			dateStr := c.Query("date") // Format: YYYY-MM-DD
-			if dateStr == "" {
-				return httpresponse.ApplyErrorToResponse(c, "Date parameter is required (format: YYYY-MM-DD)", nil)
-			}
-
-			versionDate, err := time.Parse("2006-01-02", dateStr)
-			if err != nil {
-				return httpresponse.ApplyErrorToResponse(c, "Invalid date format. Use YYYY-MM-DD", err)
+			versionDate, ok, err := parseDateQuery(c, "date", true)
+			if !ok {
+				return err
 			}
 
 			// Get optional titles filter
@@ -39,13 +41,161 @@ func (api *TitleVersionAPI) Register() {
 				titlesFilter = []string{}
 			}
 
-			err = api.TitleVersionService.ImportHistoricalTitles(ctx, versionDate, titlesFilter)
+			// Run in the background as a job that can be canceled, see JobAPI
+			if c.QueryBool("async", false) {
+				name := fmt.Sprintf("Historical Import (%s)", versionDate.Format(dateLayout))
+				job := api.JobService.Start(ctx, name, func(ctx context.Context) (any, error) {
+					return api.TitleVersionService.ImportHistoricalTitles(ctx, versionDate, titlesFilter)
+				})
+				return httpresponse.ApplySuccessToResponse(c, job)
+			}
+
+			summary, err := api.TitleVersionService.ImportHistoricalTitles(ctx, versionDate, titlesFilter)
+
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, summary)
+		},
+	)
+
+	// Endpoint to list the version dates available for a title, most recent first
+	api.Router.Get(
+		"/titles/:number/versions", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			versions, err := api.TitleVersionService.GetVersionDates(ctx, titleNumber)
+
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, versions)
+		},
+	)
+
+	// Endpoint to get the most recent version of a title with its content
+	api.Router.Get(
+		"/titles/:number/latest", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			version, err := api.TitleVersionService.GetLatestVersion(ctx, titleNumber)
+
+			if err != nil {
+				if errors.Is(err, service.ErrVersionNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, version)
+		},
+	)
+
+	// Endpoint to download the stored XML of a title version
+	api.Router.Get(
+		"/titles/:number/versions/:date/content", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber, err := c.ParamsInt("number")
+			if err != nil || titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid title number", err)
+			}
+
+			versionDate, err := time.Parse(dateLayout, c.Params("date"))
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, "Invalid date format. Use YYYY-MM-DD", err)
+			}
+
+			acceptGzip := c.AcceptsEncodings("gzip") == "gzip"
+
+			content, gzipped, err := api.TitleVersionService.OpenVersionContent(ctx, titleNumber, versionDate, acceptGzip)
 
 			if err != nil {
+				if errors.Is(err, service.ErrVersionNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
 				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
 			}
 
-			return httpresponse.ApplySuccessToResponse(c, nil)
+			c.Vary(fiber.HeaderAcceptEncoding)
+			c.Set(fiber.HeaderContentType, fiber.MIMEApplicationXMLCharsetUTF8)
+			if gzipped {
+				// Already compressed in storage, so the compress middleware leaves it as is
+				c.Set(fiber.HeaderContentEncoding, "gzip")
+			}
+
+			return c.Status(200).SendStream(content)
 		},
 	)
+
+	// Admin endpoint to store an uploaded XML file as the version of a title for a date
+	api.Router.Post(
+		"/import/upload", func(c *fiber.Ctx) error {
+			ctx := c.UserContext()
+
+			titleNumber := c.QueryInt("title", 0)
+			if titleNumber <= 0 {
+				return httpresponse.ApplyErrorToResponse(c, "title parameter is required", nil)
+			}
+
+			versionDate, ok, err := parseDateQuery(c, "date", true)
+			if !ok {
+				return err
+			}
+
+			file, err := uploadedFile(c, "file")
+			if err != nil {
+				return httpresponse.ApplyErrorToResponse(c, err.Error(), err)
+			}
+
+			version, err := api.TitleVersionService.ImportUploadedVersion(ctx, titleNumber, versionDate, file)
+			if err != nil {
+				if errors.Is(err, dao.ErrTitleNotFound) {
+					return httpresponse.ApplyNotFoundToResponse(c, err.Error())
+				}
+				if errors.Is(err, parser.ErrInvalidTitleXML) || errors.Is(err, parser.ErrTitleMismatch) {
+					return httpresponse.ApplyErrorToResponse(c, err.Error(), err)
+				}
+				return httpresponse.ApplyErrorToResponse(c, "Unexpected error", err)
+			}
+
+			return httpresponse.ApplySuccessToResponse(c, version)
+		},
+	)
+}
+
+// uploadedFile returns a reader over the named file of a multipart request body
+// The body is read as a stream, so the reader is only valid until the handler returns.
+func uploadedFile(c *fiber.Ctx, name string) (io.Reader, error) {
+	boundary := c.Context().Request.Header.MultipartFormBoundary()
+	if len(boundary) == 0 {
+		return nil, errors.New("expected a multipart/form-data request")
+	}
+
+	reader := multipart.NewReader(c.Context().RequestBodyStream(), string(boundary))
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("missing %s in multipart form", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read multipart form: %w", err)
+		}
+
+		if part.FormName() == name {
+			return part, nil
+		}
+	}
 }
@@ -0,0 +1,77 @@
+package concurrent
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrShuttingDown is recorded for the items of a runner that were not started because WaitForWorkers was called
+var ErrShuttingDown = errors.New("workers are shutting down")
+
+// workers tracks the workers of every runner, so shutdown can wait for in-flight work to return
+var workers = &workerTracker{}
+
+// workerTracker counts running workers and stops new ones from starting once it is closed
+// Starting a worker and closing share a lock, so no worker starts unseen while the tracker is waited on.
+type workerTracker struct {
+	mu     sync.Mutex
+	active int
+	closed bool
+	// idle is closed once no workers are running after the tracker is closed, nil until it is waited on
+	idle chan struct{}
+}
+
+// start counts a worker about to start, returns false without counting it if the tracker is closed
+func (w *workerTracker) start() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return false
+	}
+	w.active++
+	return true
+}
+
+// finish counts a started worker as returned
+func (w *workerTracker) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.active--
+	if w.active == 0 && w.idle != nil {
+		close(w.idle)
+		w.idle = nil
+	}
+}
+
+// closeAndWait closes the tracker and waits for the running workers to return, or ctx to be done
+func (w *workerTracker) closeAndWait(ctx context.Context) error {
+	w.mu.Lock()
+	w.closed = true
+	if w.active == 0 {
+		w.mu.Unlock()
+		return nil
+	}
+	if w.idle == nil {
+		w.idle = make(chan struct{})
+	}
+	idle := w.idle
+	w.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WaitForWorkers stops runners from starting workers and waits for the workers of every runner to return, or ctx
+// to be done. Items not started from then on are recorded with an error wrapping ErrShuttingDown.
+// Cancel the context the runs were started with first, so running workers stop early.
+// Returns the context's error if workers were still running when ctx was done.
+func WaitForWorkers(ctx context.Context) error {
+	return workers.closeAndWait(ctx)
+}
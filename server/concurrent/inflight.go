@@ -0,0 +1,53 @@
+package concurrent
+
+import (
+	"context"
+	"sync"
+)
+
+// InFlight deduplicates concurrent runs of the same computation, identified by a key
+// The zero value is ready to use. A key is released as soon as its run completes or fails,
+// so a later call with the same key runs again.
+type InFlight struct {
+	mu    sync.Mutex
+	calls map[string]*inFlightCall
+}
+
+type inFlightCall struct {
+	done chan struct{}
+	err  error
+}
+
+// Do runs fn unless a run with the same key is already in progress, in which case it waits for
+// that run to finish and returns its error. shared reports whether the result came from another caller's run.
+// Waiting stops with the context's error if ctx is done first, the other run is not interrupted.
+func (f *InFlight) Do(ctx context.Context, key string, fn func() error) (shared bool, err error) {
+	f.mu.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]*inFlightCall)
+	}
+
+	if call, ok := f.calls[key]; ok {
+		f.mu.Unlock()
+		select {
+		case <-call.done:
+			return true, call.err
+		case <-ctx.Done():
+			return true, ctx.Err()
+		}
+	}
+
+	call := &inFlightCall{done: make(chan struct{})}
+	f.calls[key] = call
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		delete(f.calls, key)
+		f.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.err = fn()
+	return false, call.err
+}
@@ -1,24 +1,49 @@
 package concurrent
 
 import (
+	"context"
+	stderrors "errors"
 	"fmt"
-	"github.com/gofiber/fiber/v2/log"
+	"github.com/sam-berry/ecfr-analyzer/server/logging"
+	"github.com/sam-berry/ecfr-analyzer/server/metrics"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // WorkerFunc defines the function signature for work to be executed
 // It receives the item to process and channels for communication
 type WorkerFunc[T any, R any] func(item T, messages chan<- string, results chan<- R, errors chan<- error)
 
+// ContextWorkerFunc is a WorkerFunc that also receives a context
+// The context carries the per-worker deadline when WorkerTimeout is configured
+type ContextWorkerFunc[T any, R any] func(ctx context.Context, item T, messages chan<- string, results chan<- R, errors chan<- error)
+
+// SimpleWorkerFunc processes a single item and returns its result directly
+// Used with RunSimple when a worker has no progress messages to report
+type SimpleWorkerFunc[T any, R any] func(ctx context.Context, item T) (R, error)
+
 // RunnerConfig configures the concurrent runner
 type RunnerConfig struct {
 	MaxConcurrency int    // 0 means unlimited concurrency
-	LogPrefix      string // Prefix for log messages
+	LogPrefix      string // Name of the job, added to worker messages as the "job" field
+
+	// WorkerTimeout bounds the time a single worker may hold a concurrency slot, 0 means no timeout.
+	// On timeout an error is recorded for the item and its slot is released. The worker must honor
+	// the context passed to a ContextWorkerFunc for the timeout to interrupt in-flight work; a worker
+	// that ignores it keeps running in the background and the run still waits for it to return. Results
+	// sent after the timeout are dropped, so a timed out item is only reported by its error.
+	WorkerTimeout time.Duration
+
+	// Adaptive lowers the concurrency below MaxConcurrency while workers fail or are slow, nil keeps it fixed.
+	// Only applies when MaxConcurrency is set.
+	Adaptive *AdaptiveConfig
 }
 
 // Runner encapsulates concurrent processing with channels and wait groups
 type Runner[T any, R any] struct {
 	config RunnerConfig
+	log    *logging.Logger
 }
 
 // NewRunner creates a new concurrent runner with the given configuration
@@ -28,108 +53,96 @@ func NewRunner[T any, R any](config RunnerConfig) *Runner[T, R] {
 	}
 	return &Runner[T, R]{
 		config: config,
+		log:    logging.New("runner").With("job", config.LogPrefix),
 	}
 }
 
 // RunResult contains the results of a concurrent run
-type RunResult[R any] struct {
+type RunResult[T any, R any] struct {
 	Results []R
 	Errors  []error
+
+	// FailedItems are the items that recorded at least one error, including those not started, see RunRetry
+	FailedItems []T
+}
+
+// itemError is an error recorded for an item, first is set for the first error of the item
+type itemError[T any] struct {
+	item  T
+	err   error
+	first bool
 }
 
 // Run executes the worker function for each item concurrently
 // Returns aggregated results and errors
-func (r *Runner[T, R]) Run(items []T, worker WorkerFunc[T, R]) RunResult[R] {
+func (r *Runner[T, R]) Run(items []T, worker WorkerFunc[T, R]) RunResult[T, R] {
+	return r.RunWithContext(context.Background(), items, ignoreContext(worker))
+}
+
+// RunWithContext is similar to Run but passes each worker a context derived from ctx
+// When WorkerTimeout is configured the derived context carries the worker deadline
+func (r *Runner[T, R]) RunWithContext(
+	ctx context.Context,
+	items []T,
+	worker ContextWorkerFunc[T, R],
+) RunResult[T, R] {
 	if len(items) == 0 {
-		return RunResult[R]{
-			Results: []R{},
-			Errors:  []error{},
+		return RunResult[T, R]{
+			Results:     []R{},
+			Errors:      []error{},
+			FailedItems: []T{},
 		}
 	}
 
-	var messagesWG sync.WaitGroup
-
-	// Messages channel for logging
-	messages := make(chan string)
-	messagesWG.Add(1)
-	go func() {
-		defer messagesWG.Done()
-		for message := range messages {
-			r.logInfo(message)
-		}
-	}()
-
-	// Results channel for successful completions
-	results := make(chan R)
+	// Only the collector goroutine appends, so the lists are not shared until the run is done
 	var resultsList []R
-	messagesWG.Add(1)
-	go func() {
-		defer messagesWG.Done()
-		for result := range results {
-			resultsList = append(resultsList, result)
-		}
-	}()
-
-	// Errors channel for failures
-	errors := make(chan error)
 	var errorsList []error
-	messagesWG.Add(1)
-	go func() {
-		defer messagesWG.Done()
-		for err := range errors {
-			errorsList = append(errorsList, err)
-		}
-	}()
-
-	// Worker wait group
-	var workersWg sync.WaitGroup
-
-	// Throttle channel for limiting concurrency (if configured)
-	var throttle chan int
-	if r.config.MaxConcurrency > 0 {
-		throttle = make(chan int, r.config.MaxConcurrency)
-	}
-
-	// Process each item
-	for _, item := range items {
-		workersWg.Add(1)
-
-		// Acquire throttle slot if configured
-		if throttle != nil {
-			throttle <- 1
-		}
-
-		go func(item T) {
-			defer workersWg.Done()
-
-			// Release throttle slot if configured
-			if throttle != nil {
-				defer func() { <-throttle }()
+	var failedList []T
+	r.runCollected(
+		ctx,
+		items,
+		worker,
+		nil,
+		func(result R) { resultsList = append(resultsList, result) },
+		func(itemErr itemError[T]) {
+			errorsList = append(errorsList, itemErr.err)
+			if itemErr.first {
+				failedList = append(failedList, itemErr.item)
 			}
+		},
+	)
 
-			// Execute worker function
-			worker(item, messages, results, errors)
-		}(item)
+	return RunResult[T, R]{
+		Results:     resultsList,
+		Errors:      errorsList,
+		FailedItems: failedList,
 	}
+}
 
-	// Wait for all workers to complete
-	workersWg.Wait()
-
-	// Close channels
-	close(messages)
-	close(results)
-	close(errors)
-
-	// Wait for all message handlers to complete
-	messagesWG.Wait()
+// RunSimple is similar to RunWithContext but takes a worker that returns its result or error
+// A nil error records the returned result, otherwise the error is recorded and the result discarded
+func (r *Runner[T, R]) RunSimple(
+	ctx context.Context,
+	items []T,
+	worker SimpleWorkerFunc[T, R],
+) RunResult[T, R] {
+	return r.RunWithContext(ctx, items, adaptSimple(worker))
+}
 
-	return RunResult[R]{
-		Results: resultsList,
-		Errors:  errorsList,
+// RunRetry runs the worker again for the failed items of a previous run, see RunResult.FailedItems
+// It is RunSimple over just those items, the result only has the items that failed again.
+func (r *Runner[T, R]) RunRetry(
+	ctx context.Context,
+	failed []T,
+	worker SimpleWorkerFunc[T, R],
+) RunResult[T, R] {
+	if len(failed) > 0 {
+		r.log.Info("Retrying failed items", "items", len(failed))
 	}
+	return r.RunSimple(ctx, failed, worker)
 }
 
-// RunWithContext is similar to Run but provides a way to access results as they come
+// RunWithCallbacks is similar to Run but provides a way to access results as they come
 // Useful when you need more control over result handling
 func (r *Runner[T, R]) RunWithCallbacks(
 	items []T,
@@ -137,93 +150,275 @@ func (r *Runner[T, R]) RunWithCallbacks(
 	onMessage func(string),
 	onResult func(R),
 	onError func(error),
+) {
+	r.RunWithCallbacksContext(context.Background(), items, ignoreContext(worker), onMessage, onResult, onError)
+}
+
+// RunWithCallbacksContext is similar to RunWithCallbacks but passes each worker a context derived from ctx
+func (r *Runner[T, R]) RunWithCallbacksContext(
+	ctx context.Context,
+	items []T,
+	worker ContextWorkerFunc[T, R],
+	onMessage func(string),
+	onResult func(R),
+	onError func(error),
 ) {
 	if len(items) == 0 {
 		return
 	}
 
-	var messagesWG sync.WaitGroup
+	var onItemError func(itemError[T])
+	if onError != nil {
+		onItemError = func(itemErr itemError[T]) { onError(itemErr.err) }
+	}
+
+	r.runCollected(ctx, items, worker, onMessage, onResult, onItemError)
+}
 
-	// Messages channel for logging
+// runCollected dispatches the workers and hands their messages, results, and errors to the callbacks
+// A single collector goroutine receives from all three channels, so the callbacks are never called concurrently
+// and need no synchronization of their own. Returns once every worker has returned and every value is handled
+func (r *Runner[T, R]) runCollected(
+	ctx context.Context,
+	items []T,
+	worker ContextWorkerFunc[T, R],
+	onMessage func(string),
+	onResult func(R),
+	onError func(itemError[T]),
+) {
 	messages := make(chan string)
-	messagesWG.Add(1)
+	results := make(chan R)
+	errors := make(chan itemError[T])
+
+	collected := make(chan struct{})
 	go func() {
-		defer messagesWG.Done()
-		for message := range messages {
+		defer close(collected)
+		r.collect(messages, results, errors, onMessage, onResult, onError)
+	}()
+
+	// Execute workers and wait for all of them to complete
+	r.dispatch(ctx, items, worker, messages, results, errors)
+
+	// Close channels and wait for the collector to handle what is left
+	close(messages)
+	close(results)
+	close(errors)
+	<-collected
+}
+
+// collect receives from the channels until all three are closed, logging messages and passing each value to its
+// callback, if set
+func (r *Runner[T, R]) collect(
+	messages <-chan string,
+	results <-chan R,
+	errors <-chan itemError[T],
+	onMessage func(string),
+	onResult func(R),
+	onError func(itemError[T]),
+) {
+	// A closed channel is set to nil, which the select never receives from
+	for messages != nil || results != nil || errors != nil {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				messages = nil
+				continue
+			}
 			if onMessage != nil {
 				onMessage(message)
 			}
-			r.logInfo(message)
-		}
-	}()
-
-	// Results channel for successful completions
-	results := make(chan R)
-	messagesWG.Add(1)
-	go func() {
-		defer messagesWG.Done()
-		for result := range results {
+			r.log.Info(message)
+		case result, ok := <-results:
+			if !ok {
+				results = nil
+				continue
+			}
 			if onResult != nil {
 				onResult(result)
 			}
-		}
-	}()
-
-	// Errors channel for failures
-	errors := make(chan error)
-	messagesWG.Add(1)
-	go func() {
-		defer messagesWG.Done()
-		for err := range errors {
+		case err, ok := <-errors:
+			if !ok {
+				errors = nil
+				continue
+			}
 			if onError != nil {
 				onError(err)
 			}
 		}
-	}()
+	}
+}
 
+// dispatch runs the worker for each item, honoring MaxConcurrency, Adaptive, and WorkerTimeout
+// Once ctx is done, or WaitForWorkers was called, no more workers are started, an error is recorded for each item left.
+// Errors are sent along with the item they were recorded for.
+// Returns once every started worker has returned
+func (r *Runner[T, R]) dispatch(
+	ctx context.Context,
+	items []T,
+	worker ContextWorkerFunc[T, R],
+	messages chan<- string,
+	results chan<- R,
+	errors chan<- itemError[T],
+) {
 	// Worker wait group
 	var workersWg sync.WaitGroup
 
-	// Throttle channel for limiting concurrency (if configured)
-	var throttle chan int
+	// Slots for limiting concurrency (if configured)
+	var throttle *slots
 	if r.config.MaxConcurrency > 0 {
-		throttle = make(chan int, r.config.MaxConcurrency)
+		throttle = newSlots(r.config.MaxConcurrency, r.config.Adaptive, r.config.LogPrefix, r.log)
 	}
 
 	// Process each item
-	for _, item := range items {
-		workersWg.Add(1)
-
-		// Acquire throttle slot if configured
-		if throttle != nil {
-			throttle <- 1
+	for i, item := range items {
+		// Acquire a slot if configured, giving up when ctx is done
+		acquired := throttle == nil || throttle.acquire(ctx)
+
+		// A slot acquired here is left held, no more workers are started to need it
+		var stopped error
+		switch {
+		case !acquired || ctx.Err() != nil:
+			stopped = ctx.Err()
+		case !workers.start():
+			stopped = ErrShuttingDown
+		}
+		if stopped != nil {
+			r.log.Warn("Stopped before all items were started", "started", i, "items", len(items))
+			for _, skipped := range items[i:] {
+				errors <- itemError[T]{
+					item:  skipped,
+					err:   fmt.Errorf("worker for %v not started: %w", skipped, stopped),
+					first: true,
+				}
+			}
+			break
 		}
 
+		workersWg.Add(1)
+
 		go func(item T) {
 			defer workersWg.Done()
+			defer workers.finish()
+
+			// A timed out worker stays in flight until it actually returns
+			metrics.RunnerWorkersInFlight.WithLabelValues(r.config.LogPrefix).Inc()
+			defer metrics.RunnerWorkersInFlight.WithLabelValues(r.config.LogPrefix).Dec()
+
+			// Release the slot if configured, at most once per item, with how long it was held and whether
+			// an error was recorded by then
+			start := time.Now()
+			var failed atomic.Bool
+			var releaseOnce sync.Once
+			release := func() {
+				if throttle != nil {
+					releaseOnce.Do(func() {
+						throttle.release(workerOutcome{duration: time.Since(start), failed: failed.Load()})
+					})
+				}
+			}
+			defer release()
+
+			// The worker sends plain errors, which are forwarded with the item until it has returned
+			var failedOnce sync.Once
+			recordError := func(err error) {
+				first := false
+				failedOnce.Do(func() { first = true })
+				failed.Store(true)
+				errors <- itemError[T]{item: item, err: err, first: first}
+			}
 
-			// Release throttle slot if configured
-			if throttle != nil {
-				defer func() { <-throttle }()
+			workerErrors := make(chan error)
+			forwarded := make(chan struct{})
+			go func() {
+				defer close(forwarded)
+				for err := range workerErrors {
+					recordError(err)
+				}
+			}()
+			defer func() {
+				close(workerErrors)
+				<-forwarded
+			}()
+
+			if r.config.WorkerTimeout <= 0 {
+				worker(ctx, item, messages, results, workerErrors)
+				return
 			}
 
-			// Execute worker function
-			worker(item, messages, results, errors)
+			workerCtx, cancel := context.WithTimeout(ctx, r.config.WorkerTimeout)
+			defer cancel()
+
+			// The worker sends results through a channel of its own, they are forwarded until it times out
+			workerResults := make(chan R)
+			timedOut := make(chan struct{})
+			resultsForwarded := make(chan struct{})
+			go func() {
+				defer close(resultsForwarded)
+				for result := range workerResults {
+					select {
+					case <-timedOut:
+						continue
+					default:
+					}
+					select {
+					case results <- result:
+					case <-timedOut:
+					}
+				}
+			}()
+			defer func() {
+				close(workerResults)
+				<-resultsForwarded
+			}()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				worker(workerCtx, item, messages, workerResults, workerErrors)
+			}()
+
+			select {
+			case <-done:
+			case <-workerCtx.Done():
+				select {
+				case <-done:
+					return
+				default:
+				}
+				close(timedOut)
+				// A canceled run is not the worker's timeout, it is recorded with the run's error as for the items
+				// not started
+				if stderrors.Is(workerCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+					recordError(fmt.Errorf("worker for %v stopped after %v: %w", item, r.config.WorkerTimeout, workerCtx.Err()))
+				} else {
+					recordError(fmt.Errorf("worker for %v not finished: %w", item, ctx.Err()))
+				}
+				release()
+				// Keep the channels open until the worker has actually returned
+				<-done
+			}
 		}(item)
 	}
 
 	// Wait for all workers to complete
 	workersWg.Wait()
+}
 
-	// Close channels
-	close(messages)
-	close(results)
-	close(errors)
-
-	// Wait for all message handlers to complete
-	messagesWG.Wait()
+// ignoreContext adapts a WorkerFunc to a ContextWorkerFunc
+func ignoreContext[T any, R any](worker WorkerFunc[T, R]) ContextWorkerFunc[T, R] {
+	return func(ctx context.Context, item T, messages chan<- string, results chan<- R, errors chan<- error) {
+		worker(item, messages, results, errors)
+	}
 }
 
-func (r *Runner[T, R]) logInfo(message string) {
-	log.Info(fmt.Sprintf("%s: %s", r.config.LogPrefix, message))
+// adaptSimple adapts a SimpleWorkerFunc to a ContextWorkerFunc
+func adaptSimple[T any, R any](worker SimpleWorkerFunc[T, R]) ContextWorkerFunc[T, R] {
+	return func(ctx context.Context, item T, messages chan<- string, results chan<- R, errors chan<- error) {
+		result, err := worker(ctx, item)
+		if err != nil {
+			errors <- err
+			return
+		}
+		results <- result
+	}
 }
@@ -0,0 +1,156 @@
+package concurrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunWorkerTimeoutDropsLateResults(t *testing.T) {
+	runner := NewRunner[int, int](RunnerConfig{MaxConcurrency: 2, WorkerTimeout: 20 * time.Millisecond})
+
+	// Item 2 ignores its context and sends its result well after the timeout
+	result := runner.RunWithContext(
+		context.Background(),
+		[]int{1, 2, 3},
+		func(ctx context.Context, item int, messages chan<- string, results chan<- int, errors chan<- error) {
+			if item == 2 {
+				time.Sleep(100 * time.Millisecond)
+			}
+			results <- item
+		},
+	)
+
+	slices.Sort(result.Results)
+	if !slices.Equal(result.Results, []int{1, 3}) {
+		t.Errorf("expected results [1 3], got %v", result.Results)
+	}
+	if !slices.Equal(result.FailedItems, []int{2}) {
+		t.Errorf("expected failed items [2], got %v", result.FailedItems)
+	}
+	if len(result.Errors) != 1 || !errors.Is(result.Errors[0], context.DeadlineExceeded) {
+		t.Errorf("expected a single deadline error, got %v", result.Errors)
+	}
+}
+
+func TestRunCanceledIsNotTimeout(t *testing.T) {
+	runner := NewRunner[int, int](RunnerConfig{MaxConcurrency: 1, WorkerTimeout: time.Minute})
+
+	// The worker ignores its context, so it is still running when the run is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	result := runner.RunWithContext(
+		ctx,
+		[]int{1},
+		func(ctx context.Context, item int, messages chan<- string, results chan<- int, errors chan<- error) {
+			cancel()
+			time.Sleep(20 * time.Millisecond)
+		},
+	)
+
+	if !slices.Equal(result.FailedItems, []int{1}) {
+		t.Errorf("expected failed items [1], got %v", result.FailedItems)
+	}
+	if len(result.Errors) != 1 || !errors.Is(result.Errors[0], context.Canceled) {
+		t.Fatalf("expected a single cancellation error, got %v", result.Errors)
+	}
+	if errors.Is(result.Errors[0], context.DeadlineExceeded) || strings.Contains(result.Errors[0].Error(), "stopped after") {
+		t.Errorf("expected the cancellation not to be reported as a timeout, got %v", result.Errors[0])
+	}
+}
+
+// TestRunManyItems is meant to be run with -race, the callbacks share unsynchronized counters because they are
+// never called concurrently
+func TestRunManyItems(t *testing.T) {
+	const itemCount = 2000
+	items := make([]int, itemCount)
+	for i := range items {
+		items[i] = i
+	}
+
+	var messageCount, resultCount, errorCount int
+	runner := NewRunner[int, int](RunnerConfig{MaxConcurrency: 50})
+	runner.RunWithCallbacks(
+		items,
+		func(item int, messages chan<- string, results chan<- int, errors chan<- error) {
+			messages <- fmt.Sprintf("item %d", item)
+			results <- item
+			if item%10 == 0 {
+				errors <- fmt.Errorf("item %d failed", item)
+			}
+		},
+		func(string) { messageCount++ },
+		func(int) { resultCount++ },
+		func(error) { errorCount++ },
+	)
+
+	if messageCount != itemCount || resultCount != itemCount || errorCount != itemCount/10 {
+		t.Errorf("got %d messages, %d results, %d errors", messageCount, resultCount, errorCount)
+	}
+
+	result := runner.Run(items, func(item int, messages chan<- string, results chan<- int, errors chan<- error) {
+		if item%10 == 0 {
+			errors <- fmt.Errorf("item %d failed", item)
+			return
+		}
+		results <- item
+	})
+
+	slices.Sort(result.FailedItems)
+	if len(result.Results) != itemCount-itemCount/10 || len(result.Errors) != itemCount/10 {
+		t.Errorf("got %d results and %d errors", len(result.Results), len(result.Errors))
+	}
+	for i, item := range result.FailedItems {
+		if item != i*10 {
+			t.Fatalf("failed item %d is %d, want %d", i, item, i*10)
+		}
+	}
+}
+
+// TestWorkerTrackerRejectsWorkersOnceClosed is meant to be run with -race, workers start while the tracker is closed
+func TestWorkerTrackerRejectsWorkersOnceClosed(t *testing.T) {
+	tracker := &workerTracker{}
+	if !tracker.start() {
+		t.Fatal("expected a worker to start before closing")
+	}
+
+	starting := make(chan struct{})
+	go func() {
+		for {
+			if !tracker.start() {
+				close(starting)
+				return
+			}
+			tracker.finish()
+		}
+	}()
+
+	waited := make(chan error)
+	go func() {
+		waited <- tracker.closeAndWait(context.Background())
+	}()
+
+	<-starting
+	select {
+	case err := <-waited:
+		t.Fatalf("expected to wait for the running worker, returned %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	tracker.finish()
+	if err := <-waited; err != nil {
+		t.Errorf("expected to wait without error, got %v", err)
+	}
+	if tracker.start() {
+		t.Error("expected no worker to start once closed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := tracker.closeAndWait(ctx); err != nil {
+		t.Errorf("expected no error waiting without running workers, got %v", err)
+	}
+}
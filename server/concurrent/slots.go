@@ -0,0 +1,149 @@
+package concurrent
+
+import (
+	"context"
+	"github.com/sam-berry/ecfr-analyzer/server/logging"
+	"github.com/sam-berry/ecfr-analyzer/server/metrics"
+	"sync"
+	"time"
+)
+
+// DefaultAdaptiveWindow is the number of finished workers an adaptive runner judges its load by, see AdaptiveConfig
+const DefaultAdaptiveWindow = 10
+
+// AdaptiveConfig lowers the concurrency of a runner while its workers fail or are slow, e.g., from database
+// contention, and raises it back as they recover
+//
+// The runner starts at MaxConcurrency. Once Window workers have finished at the current concurrency, it is lowered
+// by one, to no less than MinConcurrency, if their error rate is above ErrorRateThreshold or their average duration
+// is above LatencyThreshold, otherwise it is raised by one, to no more than MaxConcurrency. A threshold of 0 is
+// not checked.
+type AdaptiveConfig struct {
+	MinConcurrency     int           // Defaults to 1
+	ErrorRateThreshold float64       // Share of workers that recorded an error, from 0 to 1
+	LatencyThreshold   time.Duration // Average time workers held a slot
+	Window             int           // Defaults to DefaultAdaptiveWindow
+}
+
+// workerOutcome is how long a finished worker held its slot and whether it recorded an error
+type workerOutcome struct {
+	duration time.Duration
+	failed   bool
+}
+
+// slots limits the number of workers running at once, adjusting the limit to their outcomes if adaptive is set
+type slots struct {
+	mu       sync.Mutex
+	limit    int
+	max      int
+	active   int
+	freed    chan struct{} // Closed and replaced whenever a slot is released
+	adaptive *AdaptiveConfig
+	outcomes []workerOutcome // Outcomes of the workers finished since the limit was last adjusted
+	job      string
+	log      *logging.Logger
+}
+
+func newSlots(maxConcurrency int, adaptive *AdaptiveConfig, job string, log *logging.Logger) *slots {
+	if adaptive != nil {
+		config := *adaptive
+		if config.MinConcurrency <= 0 {
+			config.MinConcurrency = 1
+		}
+		if config.Window <= 0 {
+			config.Window = DefaultAdaptiveWindow
+		}
+		adaptive = &config
+		metrics.RunnerConcurrencyLimit.WithLabelValues(job).Set(float64(maxConcurrency))
+	}
+
+	return &slots{
+		limit:    maxConcurrency,
+		max:      maxConcurrency,
+		freed:    make(chan struct{}),
+		adaptive: adaptive,
+		job:      job,
+		log:      log,
+	}
+}
+
+// acquire waits for a free slot and takes it, returns false without taking one if ctx is done first
+func (s *slots) acquire(ctx context.Context) bool {
+	for {
+		s.mu.Lock()
+		if s.active < s.limit {
+			s.active++
+			s.mu.Unlock()
+			return true
+		}
+		freed := s.freed
+		s.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// release frees a slot taken by acquire, recording the outcome of the worker that held it
+func (s *slots) release(outcome workerOutcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active--
+	if s.adaptive != nil {
+		s.adjust(outcome)
+	}
+
+	close(s.freed)
+	s.freed = make(chan struct{})
+}
+
+// adjust records a worker outcome and, once a window of them is recorded, adjusts the limit, see AdaptiveConfig
+// Slots held above a lowered limit are not taken back, fewer workers are started until the active ones finish.
+func (s *slots) adjust(outcome workerOutcome) {
+	s.outcomes = append(s.outcomes, outcome)
+	if len(s.outcomes) < s.adaptive.Window {
+		return
+	}
+
+	failed := 0
+	var total time.Duration
+	for _, o := range s.outcomes {
+		if o.failed {
+			failed++
+		}
+		total += o.duration
+	}
+	errorRate := float64(failed) / float64(len(s.outcomes))
+	averageDuration := total / time.Duration(len(s.outcomes))
+	s.outcomes = s.outcomes[:0]
+
+	overloaded := (s.adaptive.ErrorRateThreshold > 0 && errorRate > s.adaptive.ErrorRateThreshold) ||
+		(s.adaptive.LatencyThreshold > 0 && averageDuration > s.adaptive.LatencyThreshold)
+
+	previous := s.limit
+	if overloaded && s.limit > s.adaptive.MinConcurrency {
+		s.limit--
+	} else if !overloaded && s.limit < s.max {
+		s.limit++
+	}
+
+	if s.limit == previous {
+		return
+	}
+
+	metrics.RunnerConcurrencyLimit.WithLabelValues(s.job).Set(float64(s.limit))
+	if s.limit < previous {
+		s.log.Warn(
+			"Lowered concurrency",
+			"concurrency", s.limit,
+			"errorRate", errorRate,
+			"averageDurationMs", averageDuration.Milliseconds(),
+		)
+	} else {
+		s.log.Info("Raised concurrency", "concurrency", s.limit)
+	}
+}
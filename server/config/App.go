@@ -1,19 +1,34 @@
 package config
 
 import (
+	"context"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/sam-berry/ecfr-analyzer/server/logging"
 	"log"
 )
 
-func InitHTTPApp() *fiber.App {
+// configLog reports invalid configuration values
+var configLog = logging.New("config")
+
+// RequestBodyLimit is the largest request body read into memory, larger bodies are streamed to the handler
+const RequestBodyLimit = 1 * 1024 * 1024
+
+// InitHTTPApp creates the app, request handlers get rootCtx as their user context, so canceling it on shutdown
+// stops the work of in-flight requests, such as imports
+func InitHTTPApp(rootCtx context.Context) *fiber.App {
 	application := fiber.New(
 		fiber.Config{
-			BodyLimit:      1 * 1024 * 1024,
+			BodyLimit:      RequestBodyLimit,
 			ReadBufferSize: 4096 * 5,
+			// Bodies over the limit are streamed to the handler rather than rejected, so uploaded title
+			// versions are never held in memory whole, see TitleVersionAPI. Handlers reading a JSON body must
+			// bound it themselves, see parseJSONBody.
+			StreamRequestBody:            true,
+			DisablePreParseMultipartForm: true,
 		},
 	)
 
@@ -37,5 +52,10 @@ func InitHTTPApp() *fiber.App {
 
 	application.Use(compress.New())
 
+	application.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(rootCtx)
+		return c.Next()
+	})
+
 	return application
 }
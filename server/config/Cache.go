@@ -0,0 +1,54 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	versionMetricsCacheSize = os.Getenv("ECFR_VERSION_METRICS_CACHE_SIZE")
+	versionMetricsCacheTTL  = os.Getenv("ECFR_VERSION_METRICS_CACHE_TTL")
+)
+
+// DefaultVersionMetricsCacheSize and DefaultVersionMetricsCacheTTL bound the cache of parsed title version metrics
+// An entry is a few numbers, so the default holds every title for a couple of years of versions
+var (
+	DefaultVersionMetricsCacheSize = 5000
+	DefaultVersionMetricsCacheTTL  = 24 * time.Hour
+)
+
+// VersionMetricsCacheConfig returns the size and TTL of the cache of parsed title version metrics
+// ECFR_VERSION_METRICS_CACHE_SIZE (0 disables the cache) and ECFR_VERSION_METRICS_CACHE_TTL (a Go duration,
+// e.g., "1h") override the defaults.
+func VersionMetricsCacheConfig() (int, time.Duration) {
+	size := DefaultVersionMetricsCacheSize
+	if versionMetricsCacheSize != "" {
+		parsed, err := strconv.Atoi(versionMetricsCacheSize)
+		if err != nil || parsed < 0 {
+			configLog.Warn(
+				"Invalid ECFR_VERSION_METRICS_CACHE_SIZE, using the default",
+				"value", versionMetricsCacheSize,
+				"default", DefaultVersionMetricsCacheSize,
+			)
+		} else {
+			size = parsed
+		}
+	}
+
+	ttl := DefaultVersionMetricsCacheTTL
+	if versionMetricsCacheTTL != "" {
+		parsed, err := time.ParseDuration(versionMetricsCacheTTL)
+		if err != nil || parsed <= 0 {
+			configLog.Warn(
+				"Invalid ECFR_VERSION_METRICS_CACHE_TTL, using the default",
+				"value", versionMetricsCacheTTL,
+				"default", DefaultVersionMetricsCacheTTL,
+			)
+		} else {
+			ttl = parsed
+		}
+	}
+
+	return size, ttl
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	maxContentBytes = os.Getenv("ECFR_MAX_CONTENT_BYTES")
+	downloadTimeout = os.Getenv("ECFR_DOWNLOAD_TIMEOUT")
+)
+
+// MaxContentBytes returns the maximum size of a downloaded title version set by ECFR_MAX_CONTENT_BYTES
+// Returns 0, the default of service.TitleVersionService, when it is not set or invalid.
+func MaxContentBytes() int64 {
+	if maxContentBytes == "" {
+		return 0
+	}
+
+	parsed, err := strconv.ParseInt(maxContentBytes, 10, 64)
+	if err != nil || parsed <= 0 {
+		configLog.Warn("Invalid ECFR_MAX_CONTENT_BYTES, using the default", "value", maxContentBytes)
+		return 0
+	}
+
+	return parsed
+}
+
+// DownloadTimeout returns the time limit of downloading and storing a title version set by ECFR_DOWNLOAD_TIMEOUT,
+// a Go duration, e.g., "15m"
+// Returns 0, the default of service.TitleVersionService, when it is not set or invalid.
+func DownloadTimeout() time.Duration {
+	if downloadTimeout == "" {
+		return 0
+	}
+
+	parsed, err := time.ParseDuration(downloadTimeout)
+	if err != nil || parsed <= 0 {
+		configLog.Warn("Invalid ECFR_DOWNLOAD_TIMEOUT, using the default", "value", downloadTimeout)
+		return 0
+	}
+
+	return parsed
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"github.com/sam-berry/ecfr-analyzer/server/httpclient"
+	"net/http"
+	"os"
+	"time"
+)
+
+var (
+	bulkDataUserAgent = os.Getenv("ECFR_BULK_DATA_USER_AGENT")
+	bulkDataTimeout   = os.Getenv("ECFR_BULK_DATA_TIMEOUT")
+)
+
+// DefaultBulkDataUserAgent identifies the application to govinfo, which throttles anonymous clients
+var DefaultBulkDataUserAgent = "cfr-metrics/1.0 (+https://cfr-metrics.com)"
+
+// DefaultBulkDataTimeout bounds a single bulk data request, including reading the response body
+var DefaultBulkDataTimeout = 10 * time.Minute
+
+// BulkDataResponseHeaderTimeout bounds the wait for response headers, so a hung connection fails fast
+var BulkDataResponseHeaderTimeout = 1 * time.Minute
+
+// BulkDataMaxAttempts and BulkDataRetryBackoff control retries of transient bulk data failures
+var (
+	BulkDataMaxAttempts  = 4
+	BulkDataRetryBackoff = 2 * time.Second
+)
+
+// NewBulkDataHTTPClient creates the HTTP client used for the govinfo bulk data repository
+// ECFR_BULK_DATA_USER_AGENT and ECFR_BULK_DATA_TIMEOUT (a Go duration, e.g., "15m") override the defaults.
+// Request contexts are still honored, so an earlier context deadline ends a request sooner.
+func NewBulkDataHTTPClient() *httpclient.Client {
+	userAgent := DefaultBulkDataUserAgent
+	if bulkDataUserAgent != "" {
+		userAgent = bulkDataUserAgent
+	}
+
+	timeout := DefaultBulkDataTimeout
+	if bulkDataTimeout != "" {
+		parsed, err := time.ParseDuration(bulkDataTimeout)
+		if err != nil || parsed <= 0 {
+			configLog.Warn(
+				"Invalid ECFR_BULK_DATA_TIMEOUT, using the default",
+				"value", bulkDataTimeout,
+				"default", DefaultBulkDataTimeout,
+			)
+		} else {
+			timeout = parsed
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = BulkDataResponseHeaderTimeout
+
+	return &httpclient.Client{
+		HttpClient: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		},
+		UserAgent:    userAgent,
+		MaxAttempts:  BulkDataMaxAttempts,
+		RetryBackoff: BulkDataRetryBackoff,
+	}
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"os"
+	"strconv"
+)
+
+var parseConcurrency = os.Getenv("ECFR_PARSE_CONCURRENCY")
+
+// ParseConcurrency returns the number of titles parsed at once set by ECFR_PARSE_CONCURRENCY
+// Returns 0, the default of service.CfrStructureService, when it is not set or invalid.
+func ParseConcurrency() int {
+	if parseConcurrency == "" {
+		return 0
+	}
+
+	parsed, err := strconv.Atoi(parseConcurrency)
+	if err != nil || parsed <= 0 {
+		configLog.Warn("Invalid ECFR_PARSE_CONCURRENCY, using the default", "value", parseConcurrency)
+		return 0
+	}
+
+	return parsed
+}
+
+var structureBatchSize = os.Getenv("ECFR_STRUCTURE_BATCH_SIZE")
+
+// StructureBatchSize returns the number of structure elements stored per transaction set by ECFR_STRUCTURE_BATCH_SIZE
+// Returns 0, the default of dao.CfrStructureDAO, when it is not set or invalid.
+func StructureBatchSize() int {
+	if structureBatchSize == "" {
+		return 0
+	}
+
+	parsed, err := strconv.Atoi(structureBatchSize)
+	if err != nil || parsed <= 0 {
+		configLog.Warn("Invalid ECFR_STRUCTURE_BATCH_SIZE, using the default", "value", structureBatchSize)
+		return 0
+	}
+
+	return parsed
+}
+
+var maxTextBytes = os.Getenv("ECFR_MAX_TEXT_BYTES")
+
+// MaxTextBytes returns the maximum stored text length of a structure set by ECFR_MAX_TEXT_BYTES
+// Returns 0, unlimited, when it is not set or invalid.
+func MaxTextBytes() int {
+	if maxTextBytes == "" {
+		return 0
+	}
+
+	parsed, err := strconv.Atoi(maxTextBytes)
+	if err != nil || parsed <= 0 {
+		configLog.Warn("Invalid ECFR_MAX_TEXT_BYTES, not limiting text length", "value", maxTextBytes)
+		return 0
+	}
+
+	return parsed
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"database/sql"
+	"github.com/sam-berry/ecfr-analyzer/server/storage"
+	"os"
+)
+
+var (
+	contentStore    = os.Getenv("ECFR_CONTENT_STORE")
+	contentStoreDir = os.Getenv("ECFR_CONTENT_STORE_DIR")
+)
+
+// NewContentStore returns the store of title version content selected by ECFR_CONTENT_STORE
+// "postgres", the default, stores content in the database. "filesystem" stores it in files under
+// ECFR_CONTENT_STORE_DIR, which may be a mounted object storage bucket.
+func NewContentStore(db *sql.DB) storage.ContentStore {
+	switch contentStore {
+	case "", "postgres":
+		return &storage.PostgresContentStore{Db: db}
+	case "filesystem":
+		if contentStoreDir == "" {
+			configLog.Error("ECFR_CONTENT_STORE_DIR is required when ECFR_CONTENT_STORE is filesystem")
+			os.Exit(1)
+		}
+		return &storage.FileContentStore{Dir: contentStoreDir}
+	default:
+		configLog.Warn("Invalid ECFR_CONTENT_STORE, using postgres", "value", contentStore)
+		return &storage.PostgresContentStore{Db: db}
+	}
+}
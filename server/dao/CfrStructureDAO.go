@@ -5,28 +5,38 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/sam-berry/ecfr-analyzer/server/data"
 	"time"
 )
 
+// DefaultStructureBatchSize is the number of structure elements BatchInsert writes per transaction when no
+// BatchSize is set
+const DefaultStructureBatchSize = 5000
+
 type CfrStructureDAO struct {
 	Db *sql.DB
+	// BatchSize is the number of structure elements BatchInsert writes per transaction, DefaultStructureBatchSize
+	// if not positive
+	BatchSize int
 }
 
-// Insert inserts a new CFR structure element
+// Insert inserts a new CFR structure element and sets its InternalId
 func (d *CfrStructureDAO) Insert(
 	ctx context.Context,
 	structure *data.CfrStructure,
 ) error {
 	id := uuid.New().String()
 
-	_, err := d.Db.ExecContext(
+	err := d.Db.QueryRowContext(
 		ctx,
 		`INSERT INTO cfr_structure(
 			structure_id, title_id, title_number, div_type, div_level,
-			identifier, node_id, heading, text_content, word_count,
-			parent_id, path, created_timestamp
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+			identifier, node_id, heading, text_content, notes_content, word_count,
+			parent_id, path, sequence_index, is_appendix, appendix_part, raw_xml, heading_path, text_truncated,
+			is_reserved, created_timestamp
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+		RETURNING id`,
 		id,
 		structure.TitleId,
 		structure.TitleNumber,
@@ -36,11 +46,19 @@ func (d *CfrStructureDAO) Insert(
 		structure.NodeId,
 		structure.Heading,
 		structure.TextContent,
+		structure.Notes,
 		structure.WordCount,
 		structure.ParentId,
 		structure.Path,
+		structure.SequenceIndex,
+		structure.IsAppendix,
+		structure.AppendixPart,
+		structure.RawXML,
+		structure.HeadingPath,
+		structure.TextTruncated,
+		structure.IsReserved,
 		time.Now().UTC(),
-	)
+	).Scan(&structure.InternalId)
 
 	if err != nil {
 		return fmt.Errorf("error inserting cfr structure: %w", err)
@@ -49,28 +67,169 @@ func (d *CfrStructureDAO) Insert(
 	return nil
 }
 
-// BatchInsert inserts multiple CFR structure elements in a single transaction
+// BatchInsert inserts or updates multiple CFR structure elements, by title and path, committing a transaction per
+// BatchSize elements so inserting the largest titles does not hold one long transaction
+// Existing elements whose stored columns are all unchanged are not written. Sets the InternalIds of all elements,
+// returns the number inserted or updated. On error, the batches committed before it are kept.
 func (d *CfrStructureDAO) BatchInsert(
 	ctx context.Context,
 	structures []*data.CfrStructure,
-) error {
-	if len(structures) == 0 {
-		return nil
+) (int64, error) {
+	batchSize := d.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultStructureBatchSize
+	}
+
+	var changed int64
+	for start := 0; start < len(structures); start += batchSize {
+		end := min(start+batchSize, len(structures))
+
+		batchChanged, err := d.insertBatch(ctx, structures[start:end])
+		if err != nil {
+			return changed, fmt.Errorf("error inserting cfr structures %d to %d: %w", start, end, err)
+		}
+		changed += batchChanged
 	}
 
+	return changed, nil
+}
+
+// insertBatch upserts structure elements in a single transaction
+func (d *CfrStructureDAO) insertBatch(
+	ctx context.Context,
+	structures []*data.CfrStructure,
+) (int64, error) {
 	tx, err := d.Db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("error beginning transaction: %w", err)
+		return 0, fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	changed, err := d.upsertStructures(ctx, tx, structures)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return changed, nil
+}
+
+// ReplaceByTitleId replaces the structure elements of a title
+// The elements are upserted by BatchInsert, a transaction per BatchSize elements, so a reparse only writes the
+// elements that changed and the largest titles do not hold one long transaction. The elements whose paths are no
+// longer parsed are deleted afterwards. The replace is not atomic: an interrupted replace, e.g., by shutdown, leaves
+// the batches upserted until then alongside the rest of the previous structure, until the title is replaced again.
+// Returns the number of structure elements deleted, and the number inserted or updated
+func (d *CfrStructureDAO) ReplaceByTitleId(
+	ctx context.Context,
+	titleId int,
+	structures []*data.CfrStructure,
+) (int64, int64, error) {
+	changed, err := d.BatchInsert(ctx, structures)
+	if err != nil {
+		return 0, changed, err
+	}
+
+	paths := make([]string, len(structures))
+	for i, structure := range structures {
+		paths[i] = structure.Path
+	}
+
+	result, err := d.Db.ExecContext(
+		ctx,
+		`DELETE FROM cfr_structure WHERE title_id = $1 AND path <> ALL($2)`,
+		titleId,
+		pq.Array(paths),
+	)
+	if err != nil {
+		return 0, changed, fmt.Errorf("error deleting cfr structures for title %d: %w", titleId, err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, changed, fmt.Errorf("error counting deleted cfr structures for title %d: %w", titleId, err)
+	}
+
+	return deleted, changed, nil
+}
+
+// ReplaceSubtree replaces the structure element at rootPath and its descendants in a single transaction
+// structures must be the newly parsed subtree in document order, rooted at rootPath, with sequence indexes that
+// continue those of the elements before it. The sequence indexes of the elements after the subtree are shifted by
+// the change in its size, so the title stays in document order.
+// Returns the number of structure elements deleted
+func (d *CfrStructureDAO) ReplaceSubtree(
+	ctx context.Context,
+	titleId int,
+	rootPath string,
+	structures []*data.CfrStructure,
+) (int64, error) {
+	tx, err := d.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error beginning transaction: %w", err)
 	}
 	defer tx.Rollback()
 
+	result, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM cfr_structure
+		WHERE title_id = $1 AND (path = $2 OR STARTS_WITH(path, $2 || '/'))`,
+		titleId,
+		rootPath,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting cfr structure subtree %s for title %d: %w", rootPath, titleId, err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error counting deleted cfr structures for title %d: %w", titleId, err)
+	}
+
+	if len(structures) > 0 {
+		_, err = tx.ExecContext(
+			ctx,
+			`UPDATE cfr_structure SET sequence_index = sequence_index + $3
+			WHERE title_id = $1 AND sequence_index >= $2`,
+			titleId,
+			structures[0].SequenceIndex,
+			int64(len(structures))-deleted,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("error shifting cfr structure sequence indexes for title %d: %w", titleId, err)
+		}
+	}
+
+	if err := d.insertStructures(ctx, tx, structures); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// insertStructures inserts structure elements within tx and sets their InternalIds
+// Parents must come before their children, so the parent id a child points to is set by the time it is inserted
+func (d *CfrStructureDAO) insertStructures(
+	ctx context.Context,
+	tx *sql.Tx,
+	structures []*data.CfrStructure,
+) error {
 	stmt, err := tx.PrepareContext(
 		ctx,
 		`INSERT INTO cfr_structure(
 			structure_id, title_id, title_number, div_type, div_level,
-			identifier, node_id, heading, text_content, word_count,
-			parent_id, path, created_timestamp
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+			identifier, node_id, heading, text_content, notes_content, word_count,
+			parent_id, path, sequence_index, is_appendix, appendix_part, raw_xml, heading_path, text_truncated,
+			is_reserved, created_timestamp
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+		RETURNING id`,
 	)
 	if err != nil {
 		return fmt.Errorf("error preparing statement: %w", err)
@@ -79,7 +238,7 @@ func (d *CfrStructureDAO) BatchInsert(
 
 	for _, structure := range structures {
 		id := uuid.New().String()
-		_, err := stmt.ExecContext(
+		err := stmt.QueryRowContext(
 			ctx,
 			id,
 			structure.TitleId,
@@ -90,39 +249,239 @@ func (d *CfrStructureDAO) BatchInsert(
 			structure.NodeId,
 			structure.Heading,
 			structure.TextContent,
+			structure.Notes,
 			structure.WordCount,
 			structure.ParentId,
 			structure.Path,
+			structure.SequenceIndex,
+			structure.IsAppendix,
+			structure.AppendixPart,
+			structure.RawXML,
+			structure.HeadingPath,
+			structure.TextTruncated,
+			structure.IsReserved,
 			time.Now().UTC(),
-		)
+		).Scan(&structure.InternalId)
 		if err != nil {
 			return fmt.Errorf("error inserting cfr structure: %w", err)
 		}
 	}
 
+	return nil
+}
+
+// upsertStructures inserts structure elements within tx, or updates the existing elements with the same title and
+// path when any of their stored columns differ, and sets their InternalIds
+// Parents must come before their children, so the parent id a child points to is set by the time it is upserted.
+// Returns the number of elements inserted or updated
+func (d *CfrStructureDAO) upsertStructures(
+	ctx context.Context,
+	tx *sql.Tx,
+	structures []*data.CfrStructure,
+) (int64, error) {
+	// An unchanged element is not returned by the upsert, so its id is read from the table as it was before
+	stmt, err := tx.PrepareContext(
+		ctx,
+		`WITH upserted AS (
+			INSERT INTO cfr_structure(
+				structure_id, title_id, title_number, div_type, div_level,
+				identifier, node_id, heading, text_content, notes_content, word_count,
+				parent_id, path, sequence_index, is_appendix, appendix_part, raw_xml, heading_path, text_truncated,
+				is_reserved, created_timestamp
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+			ON CONFLICT (title_id, path) DO UPDATE SET
+				title_number = EXCLUDED.title_number,
+				div_type = EXCLUDED.div_type,
+				div_level = EXCLUDED.div_level,
+				identifier = EXCLUDED.identifier,
+				node_id = EXCLUDED.node_id,
+				heading = EXCLUDED.heading,
+				text_content = EXCLUDED.text_content,
+				notes_content = EXCLUDED.notes_content,
+				word_count = EXCLUDED.word_count,
+				parent_id = EXCLUDED.parent_id,
+				sequence_index = EXCLUDED.sequence_index,
+				is_appendix = EXCLUDED.is_appendix,
+				appendix_part = EXCLUDED.appendix_part,
+				raw_xml = EXCLUDED.raw_xml,
+				heading_path = EXCLUDED.heading_path,
+				text_truncated = EXCLUDED.text_truncated,
+				is_reserved = EXCLUDED.is_reserved
+			WHERE (
+				cfr_structure.title_number, cfr_structure.div_type, cfr_structure.div_level,
+				cfr_structure.identifier, cfr_structure.node_id, cfr_structure.heading, cfr_structure.text_content,
+				cfr_structure.notes_content, cfr_structure.word_count, cfr_structure.parent_id,
+				cfr_structure.sequence_index, cfr_structure.is_appendix, cfr_structure.appendix_part,
+				cfr_structure.raw_xml, cfr_structure.heading_path, cfr_structure.text_truncated,
+				cfr_structure.is_reserved
+			) IS DISTINCT FROM (
+				EXCLUDED.title_number, EXCLUDED.div_type, EXCLUDED.div_level,
+				EXCLUDED.identifier, EXCLUDED.node_id, EXCLUDED.heading, EXCLUDED.text_content,
+				EXCLUDED.notes_content, EXCLUDED.word_count, EXCLUDED.parent_id,
+				EXCLUDED.sequence_index, EXCLUDED.is_appendix, EXCLUDED.appendix_part,
+				EXCLUDED.raw_xml, EXCLUDED.heading_path, EXCLUDED.text_truncated,
+				EXCLUDED.is_reserved
+			)
+			RETURNING id
+		)
+		SELECT id, TRUE FROM upserted
+		UNION ALL
+		SELECT id, FALSE FROM cfr_structure
+		WHERE title_id = $2 AND path = $13 AND NOT EXISTS (SELECT 1 FROM upserted)`,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error preparing statement: %w", err)
+	}
+	defer stmt.Close()
+
+	var changed int64
+	for _, structure := range structures {
+		var written bool
+		err := stmt.QueryRowContext(
+			ctx,
+			uuid.New().String(),
+			structure.TitleId,
+			structure.TitleNumber,
+			structure.DivType,
+			structure.DivLevel,
+			structure.Identifier,
+			structure.NodeId,
+			structure.Heading,
+			structure.TextContent,
+			structure.Notes,
+			structure.WordCount,
+			structure.ParentId,
+			structure.Path,
+			structure.SequenceIndex,
+			structure.IsAppendix,
+			structure.AppendixPart,
+			structure.RawXML,
+			structure.HeadingPath,
+			structure.TextTruncated,
+			structure.IsReserved,
+			time.Now().UTC(),
+		).Scan(&structure.InternalId, &written)
+		if err != nil {
+			return 0, fmt.Errorf("error upserting cfr structure: %w", err)
+		}
+
+		if written {
+			changed++
+		}
+	}
+
+	return changed, nil
+}
+
+// recomputeWordCountBatchSize is the number of rows updated per statement by RecomputeWordCounts
+const recomputeWordCountBatchSize = 1000
+
+// RecomputeWordCounts recounts the words of each structure element of a title from its stored text
+// Elements whose stored text was truncated keep the count of their full text, which a recount would lower.
+// The rows are read and updated in one transaction, with changed counts written in batches.
+// Returns the number of structure elements whose word count changed
+func (d *CfrStructureDAO) RecomputeWordCounts(
+	ctx context.Context,
+	titleNumber int,
+	countWords func(string) int,
+) (int, error) {
+	tx, err := d.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ids, wordCounts, err := d.changedWordCounts(ctx, tx, titleNumber, countWords)
+	if err != nil {
+		return 0, err
+	}
+
+	for start := 0; start < len(ids); start += recomputeWordCountBatchSize {
+		end := min(start+recomputeWordCountBatchSize, len(ids))
+		_, err := tx.ExecContext(
+			ctx,
+			`UPDATE cfr_structure SET word_count = v.word_count
+			FROM unnest($1::INT[], $2::INT[]) AS v(id, word_count)
+			WHERE cfr_structure.id = v.id`,
+			pq.Array(ids[start:end]),
+			pq.Array(wordCounts[start:end]),
+		)
+		if err != nil {
+			return 0, fmt.Errorf("error updating word counts for title %d: %w", titleNumber, err)
+		}
+	}
+
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("error committing transaction: %w", err)
+		return 0, fmt.Errorf("error committing transaction: %w", err)
 	}
 
-	return nil
+	return len(ids), nil
+}
+
+// changedWordCounts returns the ids and recounted word counts of the structure elements whose count changed
+// The rows are fully read before returning, as the connection cannot run the updates while they are open
+func (d *CfrStructureDAO) changedWordCounts(
+	ctx context.Context,
+	tx *sql.Tx,
+	titleNumber int,
+	countWords func(string) int,
+) ([]int, []int, error) {
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT id, text_content, word_count
+		FROM cfr_structure
+		WHERE title_number = $1 AND NOT text_truncated
+		FOR UPDATE`,
+		titleNumber,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error finding cfr structure text for title %d: %w", titleNumber, err)
+	}
+	defer rows.Close()
+
+	var ids, wordCounts []int
+	for rows.Next() {
+		var id, wordCount int
+		var text sql.NullString
+		if err := rows.Scan(&id, &text, &wordCount); err != nil {
+			return nil, nil, fmt.Errorf("error scanning cfr structure text: %w", err)
+		}
+
+		if recounted := countWords(text.String); recounted != wordCount {
+			ids = append(ids, id)
+			wordCounts = append(wordCounts, recounted)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating cfr structure rows: %w", err)
+	}
+
+	return ids, wordCounts, nil
 }
 
 // DeleteByTitleId deletes all structure elements for a given title
+// Returns the number of structure elements deleted
 func (d *CfrStructureDAO) DeleteByTitleId(
 	ctx context.Context,
 	titleId int,
-) error {
-	_, err := d.Db.ExecContext(
+) (int64, error) {
+	result, err := d.Db.ExecContext(
 		ctx,
 		`DELETE FROM cfr_structure WHERE title_id = $1`,
 		titleId,
 	)
 
 	if err != nil {
-		return fmt.Errorf("error deleting cfr structures for title %d: %w", titleId, err)
+		return 0, fmt.Errorf("error deleting cfr structures for title %d: %w", titleId, err)
 	}
 
-	return nil
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error counting deleted cfr structures for title %d: %w", titleId, err)
+	}
+
+	return deleted, nil
 }
 
 // FindByTitleNumber finds all structure elements for a given title number
@@ -133,11 +492,12 @@ func (d *CfrStructureDAO) FindByTitleNumber(
 	rows, err := d.Db.QueryContext(
 		ctx,
 		`SELECT id, structure_id, title_id, title_number, div_type, div_level,
-			identifier, node_id, heading, text_content, word_count,
-			parent_id, path, created_timestamp
+			identifier, node_id, heading, text_content, notes_content, word_count,
+			parent_id, path, sequence_index, is_appendix, appendix_part, raw_xml, heading_path, text_truncated,
+			is_reserved, created_timestamp
 		FROM cfr_structure
 		WHERE title_number = $1
-		ORDER BY path`,
+		ORDER BY sequence_index, path`,
 		titleNumber,
 	)
 	if err != nil {
@@ -148,106 +508,846 @@ func (d *CfrStructureDAO) FindByTitleNumber(
 	return d.scanStructures(rows)
 }
 
-// FindByDivType finds all structure elements of a given type
-func (d *CfrStructureDAO) FindByDivType(
+// StreamByTitleNumber calls fn for each structure element of a title in document order
+// Rows are scanned one at a time, so memory stays flat regardless of the title size.
+// Iteration stops at the first error returned by fn, which is returned unwrapped.
+func (d *CfrStructureDAO) StreamByTitleNumber(
 	ctx context.Context,
 	titleNumber int,
-	divType string,
-) ([]*data.CfrStructure, error) {
+	fn func(*data.CfrStructure) error,
+) error {
 	rows, err := d.Db.QueryContext(
 		ctx,
 		`SELECT id, structure_id, title_id, title_number, div_type, div_level,
-			identifier, node_id, heading, text_content, word_count,
-			parent_id, path, created_timestamp
+			identifier, node_id, heading, text_content, notes_content, word_count,
+			parent_id, path, sequence_index, is_appendix, appendix_part, raw_xml, heading_path, text_truncated,
+			is_reserved, created_timestamp
 		FROM cfr_structure
-		WHERE title_number = $1 AND div_type = $2
-		ORDER BY path`,
+		WHERE title_number = $1
+		ORDER BY sequence_index, path`,
 		titleNumber,
-		divType,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("error finding cfr structures by type: %w", err)
+		return fmt.Errorf("error streaming cfr structures by title: %w", err)
 	}
 	defer rows.Close()
 
-	return d.scanStructures(rows)
+	for rows.Next() {
+		structure, err := d.scanStructure(rows)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(structure); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating cfr structure rows: %w", err)
+	}
+
+	return nil
 }
 
-// FindByPath finds a structure element by its hierarchical path
-func (d *CfrStructureDAO) FindByPath(
+// ReplaceForVersion stores the structure elements parsed from a title version, replacing any stored before
+// Text and notes are not stored for versions, see FindByTitleAndVersionDate
+func (d *CfrStructureDAO) ReplaceForVersion(
 	ctx context.Context,
 	titleNumber int,
-	path string,
-) (*data.CfrStructure, error) {
-	var structure data.CfrStructure
-	err := d.Db.QueryRowContext(
+	versionDate time.Time,
+	structures []*data.CfrStructure,
+) error {
+	tx, err := d.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
 		ctx,
-		`SELECT id, structure_id, title_id, title_number, div_type, div_level,
-			identifier, node_id, heading, text_content, word_count,
-			parent_id, path, created_timestamp
-		FROM cfr_structure
-		WHERE title_number = $1 AND path = $2`,
+		`DELETE FROM cfr_structure_version WHERE title_number = $1 AND version_date = $2`,
 		titleNumber,
-		path,
-	).Scan(
-		&structure.InternalId,
-		&structure.Id,
-		&structure.TitleId,
-		&structure.TitleNumber,
-		&structure.DivType,
-		&structure.DivLevel,
-		&structure.Identifier,
-		&structure.NodeId,
-		&structure.Heading,
-		&structure.TextContent,
-		&structure.WordCount,
-		&structure.ParentId,
-		&structure.Path,
-		&structure.CreatedAt,
+		versionDate,
 	)
-
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("error finding cfr structure by path: %w", err)
+		return fmt.Errorf("error deleting cfr structures for title %d version: %w", titleNumber, err)
 	}
 
-	return &structure, nil
-}
-
-// scanStructures scans multiple rows into CfrStructure slice
-func (d *CfrStructureDAO) scanStructures(rows *sql.Rows) ([]*data.CfrStructure, error) {
-	var structures []*data.CfrStructure
+	stmt, err := tx.PrepareContext(
+		ctx,
+		`INSERT INTO cfr_structure_version(
+			structure_id, title_id, title_number, version_date, div_type, div_level,
+			identifier, node_id, heading, word_count, path, sequence_index, created_timestamp
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+	)
+	if err != nil {
+		return fmt.Errorf("error preparing statement: %w", err)
+	}
+	defer stmt.Close()
 
-	for rows.Next() {
-		var structure data.CfrStructure
-		err := rows.Scan(
-			&structure.InternalId,
-			&structure.Id,
-			&structure.TitleId,
-			&structure.TitleNumber,
-			&structure.DivType,
-			&structure.DivLevel,
-			&structure.Identifier,
-			&structure.NodeId,
-			&structure.Heading,
-			&structure.TextContent,
-			&structure.WordCount,
-			&structure.ParentId,
-			&structure.Path,
-			&structure.CreatedAt,
+	for _, structure := range structures {
+		id := uuid.New().String()
+		_, err := stmt.ExecContext(
+			ctx,
+			id,
+			structure.TitleId,
+			structure.TitleNumber,
+			versionDate,
+			structure.DivType,
+			structure.DivLevel,
+			structure.Identifier,
+			structure.NodeId,
+			structure.Heading,
+			structure.WordCount,
+			structure.Path,
+			structure.SequenceIndex,
+			time.Now().UTC(),
 		)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning cfr structure row: %w", err)
+			return fmt.Errorf("error inserting cfr structure version: %w", err)
 		}
-
-		structures = append(structures, &structure)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating cfr structure rows: %w", err)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
 	}
 
-	return structures, nil
+	return nil
+}
+
+// FindByTitleAndVersionDate finds the structure elements parsed from a title version, in document order
+// Text content, notes, parent ids, appendix and reserved tags, raw XML and heading paths are not stored for versions and
+// are always empty
+func (d *CfrStructureDAO) FindByTitleAndVersionDate(
+	ctx context.Context,
+	titleNumber int,
+	versionDate time.Time,
+) ([]*data.CfrStructure, error) {
+	rows, err := d.Db.QueryContext(
+		ctx,
+		`SELECT id, structure_id, title_id, title_number, div_type, div_level,
+			identifier, node_id, heading, NULL::TEXT, NULL::TEXT, word_count,
+			NULL::INTEGER, path, sequence_index, FALSE, NULL::TEXT, NULL::TEXT, NULL::TEXT, FALSE,
+			FALSE, created_timestamp
+		FROM cfr_structure_version
+		WHERE title_number = $1 AND version_date = $2
+		ORDER BY sequence_index, path`,
+		titleNumber,
+		versionDate,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error finding cfr structures by title and version date: %w", err)
+	}
+	defer rows.Close()
+
+	return d.scanStructures(rows)
+}
+
+// HasVersion reports whether the structure of a title version is stored, see ReplaceForVersion
+func (d *CfrStructureDAO) HasVersion(
+	ctx context.Context,
+	titleNumber int,
+	versionDate time.Time,
+) (bool, error) {
+	var exists bool
+	err := d.Db.QueryRowContext(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM cfr_structure_version WHERE title_number = $1 AND version_date = $2)`,
+		titleNumber,
+		versionDate,
+	).Scan(&exists)
+
+	if err != nil {
+		return false, fmt.Errorf("error checking cfr structure version for title %d: %w", titleNumber, err)
+	}
+
+	return exists, nil
+}
+
+// FindChangedBetween compares the stored structures of two versions of a title, see ReplaceForVersion
+// Elements are matched by node id, or by path when they have none or matchBy is data.MatchByPath, and are changed
+// when their heading or word count differs. Text is not stored for versions, so an edit that keeps both is not found.
+// Unchanged elements are omitted, the rest are in document order of the later version, then of the earlier one.
+func (d *CfrStructureDAO) FindChangedBetween(
+	ctx context.Context,
+	titleNumber int,
+	dateA time.Time,
+	dateB time.Time,
+	matchBy string,
+) ([]*data.StructureChange, error) {
+	// Same as CfrStructure.MatchKey
+	matchKey := "COALESCE(NULLIF(node_id, ''), path)"
+	if matchBy == data.MatchByPath {
+		matchKey = "path"
+	}
+
+	rows, err := d.Db.QueryContext(
+		ctx,
+		`WITH a AS (
+			SELECT `+matchKey+` AS match_key, div_type, identifier, heading, path, word_count, sequence_index
+			FROM cfr_structure_version
+			WHERE title_number = $1 AND version_date = $2
+		), b AS (
+			SELECT `+matchKey+` AS match_key, div_type, identifier, heading, path, word_count, sequence_index
+			FROM cfr_structure_version
+			WHERE title_number = $1 AND version_date = $3
+		)
+		SELECT CASE
+				WHEN a.match_key IS NULL THEN 'added'
+				WHEN b.match_key IS NULL THEN 'removed'
+				ELSE 'changed'
+			END,
+			COALESCE(b.div_type, a.div_type),
+			COALESCE(b.identifier, a.identifier),
+			CASE WHEN b.match_key IS NULL THEN a.heading ELSE b.heading END,
+			COALESCE(b.path, a.path),
+			COALESCE(a.word_count, 0),
+			COALESCE(b.word_count, 0)
+		FROM a
+		FULL OUTER JOIN b ON a.match_key = b.match_key
+		WHERE a.match_key IS NULL
+			OR b.match_key IS NULL
+			OR a.word_count <> b.word_count
+			OR a.heading IS DISTINCT FROM b.heading
+		ORDER BY b.sequence_index NULLS LAST, a.sequence_index`,
+		titleNumber,
+		dateA,
+		dateB,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error comparing cfr structure versions: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []*data.StructureChange{}
+	for rows.Next() {
+		var change data.StructureChange
+		err := rows.Scan(
+			&change.ChangeType,
+			&change.DivType,
+			&change.Identifier,
+			&change.Heading,
+			&change.Path,
+			&change.WordCountStart,
+			&change.WordCountEnd,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning cfr structure change row: %w", err)
+		}
+
+		changes = append(changes, &change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating cfr structure change rows: %w", err)
+	}
+
+	return changes, nil
+}
+
+// FindByDivType finds all structure elements of a given type
+func (d *CfrStructureDAO) FindByDivType(
+	ctx context.Context,
+	titleNumber int,
+	divType string,
+) ([]*data.CfrStructure, error) {
+	rows, err := d.Db.QueryContext(
+		ctx,
+		`SELECT id, structure_id, title_id, title_number, div_type, div_level,
+			identifier, node_id, heading, text_content, notes_content, word_count,
+			parent_id, path, sequence_index, is_appendix, appendix_part, raw_xml, heading_path, text_truncated,
+			is_reserved, created_timestamp
+		FROM cfr_structure
+		WHERE title_number = $1 AND div_type = $2
+		ORDER BY sequence_index, path`,
+		titleNumber,
+		divType,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error finding cfr structures by type: %w", err)
+	}
+	defer rows.Close()
+
+	return d.scanStructures(rows)
+}
+
+// FindByPath finds a structure element by its hierarchical path
+func (d *CfrStructureDAO) FindByPath(
+	ctx context.Context,
+	titleNumber int,
+	path string,
+) (*data.CfrStructure, error) {
+	var structure data.CfrStructure
+	err := d.Db.QueryRowContext(
+		ctx,
+		`SELECT id, structure_id, title_id, title_number, div_type, div_level,
+			identifier, node_id, heading, text_content, notes_content, word_count,
+			parent_id, path, sequence_index, is_appendix, appendix_part, raw_xml, heading_path, text_truncated,
+			is_reserved, created_timestamp
+		FROM cfr_structure
+		WHERE title_number = $1 AND path = $2`,
+		titleNumber,
+		path,
+	).Scan(
+		&structure.InternalId,
+		&structure.Id,
+		&structure.TitleId,
+		&structure.TitleNumber,
+		&structure.DivType,
+		&structure.DivLevel,
+		&structure.Identifier,
+		&structure.NodeId,
+		&structure.Heading,
+		&structure.TextContent,
+		&structure.Notes,
+		&structure.WordCount,
+		&structure.ParentId,
+		&structure.Path,
+		&structure.SequenceIndex,
+		&structure.IsAppendix,
+		&structure.AppendixPart,
+		&structure.RawXML,
+		&structure.HeadingPath,
+		&structure.TextTruncated,
+		&structure.IsReserved,
+		&structure.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error finding cfr structure by path: %w", err)
+	}
+
+	return &structure, nil
+}
+
+// FindByPaths finds the structure elements for several hierarchical paths in a single query
+// Results are in document order regardless of the order of the input paths
+func (d *CfrStructureDAO) FindByPaths(
+	ctx context.Context,
+	titleNumber int,
+	paths []string,
+) ([]*data.CfrStructure, error) {
+	rows, err := d.Db.QueryContext(
+		ctx,
+		`SELECT id, structure_id, title_id, title_number, div_type, div_level,
+			identifier, node_id, heading, text_content, notes_content, word_count,
+			parent_id, path, sequence_index, is_appendix, appendix_part, raw_xml, heading_path, text_truncated,
+			is_reserved, created_timestamp
+		FROM cfr_structure
+		WHERE title_number = $1 AND path = ANY($2)
+		ORDER BY sequence_index, path`,
+		titleNumber,
+		pq.Array(paths),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error finding cfr structures by paths: %w", err)
+	}
+	defer rows.Close()
+
+	return d.scanStructures(rows)
+}
+
+// FindLargestSections finds the sections of a title with the highest word counts
+func (d *CfrStructureDAO) FindLargestSections(
+	ctx context.Context,
+	titleNumber int,
+	limit int,
+) ([]*data.CfrStructure, error) {
+	rows, err := d.Db.QueryContext(
+		ctx,
+		`SELECT id, structure_id, title_id, title_number, div_type, div_level,
+			identifier, node_id, heading, text_content, notes_content, word_count,
+			parent_id, path, sequence_index, is_appendix, appendix_part, raw_xml, heading_path, text_truncated,
+			is_reserved, created_timestamp
+		FROM cfr_structure
+		WHERE title_number = $1 AND div_type = 'SECTION'
+		ORDER BY word_count DESC, sequence_index
+		LIMIT $2`,
+		titleNumber,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error finding largest cfr sections: %w", err)
+	}
+	defer rows.Close()
+
+	return d.scanStructures(rows)
+}
+
+// FindByWordCountRange finds the structure elements of a title with a word count between minWords and maxWords,
+// inclusive
+func (d *CfrStructureDAO) FindByWordCountRange(
+	ctx context.Context,
+	titleNumber int,
+	minWords int,
+	maxWords int,
+) ([]*data.CfrStructure, error) {
+	rows, err := d.Db.QueryContext(
+		ctx,
+		`SELECT id, structure_id, title_id, title_number, div_type, div_level,
+			identifier, node_id, heading, text_content, notes_content, word_count,
+			parent_id, path, sequence_index, is_appendix, appendix_part, raw_xml, heading_path, text_truncated,
+			is_reserved, created_timestamp
+		FROM cfr_structure
+		WHERE title_number = $1 AND word_count BETWEEN $2 AND $3
+		ORDER BY word_count, sequence_index`,
+		titleNumber,
+		minWords,
+		maxWords,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error finding cfr structures by word count range: %w", err)
+	}
+	defer rows.Close()
+
+	return d.scanStructures(rows)
+}
+
+// WordCountHistogram counts the sections of a title in word count buckets bounded by bucketEdges, which must ascend
+// Each edge is the inclusive upper bound of a bucket, e.g., edges 50 and 100 count sections in "0-50", "51-100",
+// and "101+". Every bucket is present in the result, empty ones with a count of 0.
+func (d *CfrStructureDAO) WordCountHistogram(
+	ctx context.Context,
+	titleNumber int,
+	bucketEdges []int,
+) (map[string]int, error) {
+	// width_bucket counts the thresholds at or below the word count, which is the bucket index
+	thresholds := make([]int64, len(bucketEdges))
+	for i, edge := range bucketEdges {
+		thresholds[i] = int64(edge) + 1
+	}
+
+	rows, err := d.Db.QueryContext(
+		ctx,
+		`SELECT width_bucket(word_count, $2::INT[]), COUNT(*)
+		FROM cfr_structure
+		WHERE title_number = $1 AND div_type = $3
+		GROUP BY 1`,
+		titleNumber,
+		pq.Array(thresholds),
+		data.DivTypeSection,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error counting cfr sections by word count: %w", err)
+	}
+	defer rows.Close()
+
+	histogram := make(map[string]int, len(bucketEdges)+1)
+	for i := 0; i <= len(bucketEdges); i++ {
+		histogram[wordCountBucketLabel(bucketEdges, i)] = 0
+	}
+
+	for rows.Next() {
+		var bucket, count int
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, fmt.Errorf("error scanning cfr section word count row: %w", err)
+		}
+
+		histogram[wordCountBucketLabel(bucketEdges, bucket)] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating cfr section word count rows: %w", err)
+	}
+
+	return histogram, nil
+}
+
+// wordCountBucketLabel names bucket i of WordCountHistogram, e.g., "51-100", or "101+" for the last one
+func wordCountBucketLabel(bucketEdges []int, i int) string {
+	low := 0
+	if i > 0 {
+		low = bucketEdges[i-1] + 1
+	}
+
+	if i == len(bucketEdges) {
+		return fmt.Sprintf("%d+", low)
+	}
+
+	return fmt.Sprintf("%d-%d", low, bucketEdges[i])
+}
+
+// LevelDistribution counts the structure elements of a title at each div level
+func (d *CfrStructureDAO) LevelDistribution(
+	ctx context.Context,
+	titleNumber int,
+) (map[int]int, error) {
+	rows, err := d.Db.QueryContext(
+		ctx,
+		`SELECT div_level, COUNT(*)
+		FROM cfr_structure
+		WHERE title_number = $1
+		GROUP BY div_level`,
+		titleNumber,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error counting cfr structure levels: %w", err)
+	}
+	defer rows.Close()
+
+	levels := make(map[int]int)
+	for rows.Next() {
+		var level, count int
+		if err := rows.Scan(&level, &count); err != nil {
+			return nil, fmt.Errorf("error scanning cfr structure level row: %w", err)
+		}
+
+		levels[level] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating cfr structure level rows: %w", err)
+	}
+
+	return levels, nil
+}
+
+// TitlesWithoutStructures returns the numbers of the imported titles that have no stored structure elements,
+// in order
+func (d *CfrStructureDAO) TitlesWithoutStructures(
+	ctx context.Context,
+) ([]int, error) {
+	rows, err := d.Db.QueryContext(
+		ctx,
+		`SELECT t.name
+		FROM title t
+		WHERE NOT EXISTS (SELECT 1 FROM cfr_structure s WHERE s.title_id = t.id)
+		ORDER BY t.name`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error finding titles without cfr structures: %w", err)
+	}
+	defer rows.Close()
+
+	titles := []int{}
+	for rows.Next() {
+		var title int
+		if err := rows.Scan(&title); err != nil {
+			return nil, fmt.Errorf("error scanning title without cfr structures row: %w", err)
+		}
+
+		titles = append(titles, title)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating titles without cfr structures rows: %w", err)
+	}
+
+	return titles, nil
+}
+
+// SumMetricsByTitle totals the word and section counts of the stored structures of each title
+// Word counts include appendices, section counts do not, and appendices and reserved sections are also totaled
+// separately
+func (d *CfrStructureDAO) SumMetricsByTitle(
+	ctx context.Context,
+) ([]*data.TitleSnapshot, error) {
+	rows, err := d.Db.QueryContext(
+		ctx,
+		`SELECT title_number,
+			COALESCE(SUM(word_count), 0),
+			COUNT(*) FILTER (WHERE div_type = 'SECTION' AND NOT is_appendix),
+			COALESCE(SUM(word_count) FILTER (WHERE is_appendix), 0),
+			COUNT(*) FILTER (WHERE is_appendix),
+			COUNT(*) FILTER (WHERE is_reserved AND NOT is_appendix)
+		FROM cfr_structure
+		GROUP BY title_number
+		ORDER BY title_number`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error summing cfr structure metrics: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []*data.TitleSnapshot
+	for rows.Next() {
+		var snapshot data.TitleSnapshot
+		err := rows.Scan(
+			&snapshot.Title,
+			&snapshot.WordCount,
+			&snapshot.SectionCount,
+			&snapshot.AppendixWordCount,
+			&snapshot.AppendixCount,
+			&snapshot.ReservedCount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning cfr structure metrics row: %w", err)
+		}
+
+		snapshots = append(snapshots, &snapshot)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating cfr structure metrics rows: %w", err)
+	}
+
+	return snapshots, nil
+}
+
+// SumMetricsForTitle totals the word and section counts of all stored structures of a title
+func (d *CfrStructureDAO) SumMetricsForTitle(
+	ctx context.Context,
+	titleNumber int,
+) (int, int, error) {
+	var wordCount int
+	var sectionCount int
+	err := d.Db.QueryRowContext(
+		ctx,
+		`SELECT COALESCE(SUM(word_count), 0),
+			COUNT(*) FILTER (WHERE div_type = 'SECTION')
+		FROM cfr_structure
+		WHERE title_number = $1`,
+		titleNumber,
+	).Scan(&wordCount, &sectionCount)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("error summing cfr structure metrics for title: %w", err)
+	}
+
+	return wordCount, sectionCount, nil
+}
+
+// SumMetricsByReferences totals the word and section counts of the structures within any of the references
+// A reference covers the structure it scopes to, see data.CfrReference.IsScope, and all of that structure's descendants.
+// An appendix linked to a part is covered by a reference to that part, wherever it is nested, rather than
+// by a reference to the part it is nested under. Structures covered by more than one reference are only counted once.
+// Word counts include appendices, section counts do not, and appendices and reserved sections are also totaled
+// separately.
+func (d *CfrStructureDAO) SumMetricsByReferences(
+	ctx context.Context,
+	references []*data.CfrReference,
+) (*data.StructureTotals, error) {
+	totals := &data.StructureTotals{}
+	if len(references) == 0 {
+		return totals, nil
+	}
+
+	titles := make([]int64, len(references))
+	divTypes := make([]string, len(references))
+	identifiers := make([]string, len(references))
+	for i, reference := range references {
+		titles[i] = int64(reference.Title)
+		divTypes[i], identifiers[i] = reference.Scope()
+	}
+
+	candidates, err := d.findScopeCandidates(ctx, titles, divTypes, identifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	// The elements the references scope to, with the type and identifier of the reference
+	var scopeTitles []int64
+	var scopePaths, scopeTypes, scopeIdentifiers []string
+	for i, reference := range references {
+		for _, candidate := range candidates {
+			if candidate.TitleNumber == reference.Title && reference.IsScope(candidate) {
+				scopeTitles = append(scopeTitles, titles[i])
+				scopePaths = append(scopePaths, candidate.Path)
+				scopeTypes = append(scopeTypes, divTypes[i])
+				scopeIdentifiers = append(scopeIdentifiers, identifiers[i])
+			}
+		}
+	}
+
+	err = d.Db.QueryRowContext(
+		ctx,
+		`WITH refs AS (
+			SELECT * FROM UNNEST($1::INTEGER[], $2::TEXT[], $3::TEXT[]) AS r(title_number, div_type, identifier)
+		), scope AS (
+			SELECT * FROM UNNEST($4::INTEGER[], $5::TEXT[], $6::TEXT[], $7::TEXT[])
+				AS sc(title_number, path, div_type, identifier)
+		)
+		SELECT COALESCE(SUM(s.word_count), 0),
+			COUNT(*) FILTER (WHERE s.div_type = 'SECTION' AND NOT s.is_appendix),
+			COALESCE(SUM(s.word_count) FILTER (WHERE s.is_appendix), 0),
+			COUNT(*) FILTER (WHERE s.is_appendix),
+			COUNT(*) FILTER (WHERE s.is_reserved AND NOT s.is_appendix)
+		FROM cfr_structure s
+		WHERE EXISTS (
+			SELECT 1 FROM scope sc
+			WHERE sc.title_number = s.title_number
+				AND (s.path = sc.path OR STARTS_WITH(s.path, sc.path || '/'))
+				AND NOT (sc.div_type = 'PART' AND s.appendix_part IS NOT NULL AND s.appendix_part <> sc.identifier)
+		) OR EXISTS (
+			SELECT 1 FROM refs r
+			WHERE r.title_number = s.title_number
+				AND r.div_type = 'PART'
+				AND s.appendix_part = r.identifier
+		)`,
+		pq.Array(titles),
+		pq.Array(divTypes),
+		pq.Array(identifiers),
+		pq.Array(scopeTitles),
+		pq.Array(scopePaths),
+		pq.Array(scopeTypes),
+		pq.Array(scopeIdentifiers),
+	).Scan(
+		&totals.WordCount,
+		&totals.SectionCount,
+		&totals.AppendixWordCount,
+		&totals.AppendixCount,
+		&totals.ReservedCount,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("error summing cfr structure metrics by references: %w", err)
+	}
+
+	return totals, nil
+}
+
+// findScopeCandidates finds the elements with the type and identifier of the most specific level of any reference,
+// and the root elements of the titles of references to an entire title, given as by SumMetricsByReferences
+// Only the title number, type, identifier and path of the elements are read.
+func (d *CfrStructureDAO) findScopeCandidates(
+	ctx context.Context,
+	titles []int64,
+	divTypes []string,
+	identifiers []string,
+) ([]*data.CfrStructure, error) {
+	rows, err := d.Db.QueryContext(
+		ctx,
+		`WITH refs AS (
+			SELECT * FROM UNNEST($1::INTEGER[], $2::TEXT[], $3::TEXT[]) AS r(title_number, div_type, identifier)
+		)
+		SELECT DISTINCT s.title_number, s.div_type, s.identifier, s.path
+		FROM cfr_structure s
+		JOIN refs r ON r.title_number = s.title_number
+		WHERE (r.div_type = '' AND s.parent_id IS NULL)
+			OR (s.div_type = r.div_type AND s.identifier = r.identifier)`,
+		pq.Array(titles),
+		pq.Array(divTypes),
+		pq.Array(identifiers),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error finding cfr structures referenced: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []*data.CfrStructure
+	for rows.Next() {
+		candidate := &data.CfrStructure{}
+		if err := rows.Scan(&candidate.TitleNumber, &candidate.DivType, &candidate.Identifier, &candidate.Path); err != nil {
+			return nil, fmt.Errorf("error scanning cfr structure referenced: %w", err)
+		}
+		candidates = append(candidates, candidate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating cfr structures referenced: %w", err)
+	}
+
+	return candidates, nil
+}
+
+// SumMetricsBySubpart totals the word and section counts of each subpart of a title and all of its descendants
+// The descendants are found by following parent ids down from each subpart, subparts are in document order
+func (d *CfrStructureDAO) SumMetricsBySubpart(
+	ctx context.Context,
+	titleNumber int,
+) ([]*data.SubpartMetric, error) {
+	rows, err := d.Db.QueryContext(
+		ctx,
+		`WITH RECURSIVE subtree AS (
+			SELECT id AS subpart_id, id, div_type, word_count
+			FROM cfr_structure
+			WHERE title_number = $1 AND div_type = 'SUBPART'
+			UNION ALL
+			SELECT t.subpart_id, s.id, s.div_type, s.word_count
+			FROM cfr_structure s
+			JOIN subtree t ON s.parent_id = t.id
+		)
+		SELECT sp.identifier, sp.heading, sp.path,
+			COALESCE(SUM(t.word_count), 0),
+			COUNT(*) FILTER (WHERE t.div_type = 'SECTION')
+		FROM subtree t
+		JOIN cfr_structure sp ON sp.id = t.subpart_id
+		GROUP BY sp.id, sp.identifier, sp.heading, sp.path, sp.sequence_index
+		ORDER BY sp.sequence_index, sp.path`,
+		titleNumber,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error summing cfr structure metrics by subpart: %w", err)
+	}
+	defer rows.Close()
+
+	subparts := []*data.SubpartMetric{}
+	for rows.Next() {
+		var subpart data.SubpartMetric
+		err := rows.Scan(
+			&subpart.Identifier,
+			&subpart.Heading,
+			&subpart.Path,
+			&subpart.WordCount,
+			&subpart.SectionCount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning cfr structure subpart metrics row: %w", err)
+		}
+
+		subparts = append(subparts, &subpart)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating cfr structure subpart metrics rows: %w", err)
+	}
+
+	return subparts, nil
+}
+
+// scanStructures scans multiple rows into CfrStructure slice
+func (d *CfrStructureDAO) scanStructures(rows *sql.Rows) ([]*data.CfrStructure, error) {
+	var structures []*data.CfrStructure
+
+	for rows.Next() {
+		structure, err := d.scanStructure(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		structures = append(structures, structure)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating cfr structure rows: %w", err)
+	}
+
+	return structures, nil
+}
+
+// scanStructure scans the current row into a CfrStructure
+func (d *CfrStructureDAO) scanStructure(rows *sql.Rows) (*data.CfrStructure, error) {
+	var structure data.CfrStructure
+	err := rows.Scan(
+		&structure.InternalId,
+		&structure.Id,
+		&structure.TitleId,
+		&structure.TitleNumber,
+		&structure.DivType,
+		&structure.DivLevel,
+		&structure.Identifier,
+		&structure.NodeId,
+		&structure.Heading,
+		&structure.TextContent,
+		&structure.Notes,
+		&structure.WordCount,
+		&structure.ParentId,
+		&structure.Path,
+		&structure.SequenceIndex,
+		&structure.IsAppendix,
+		&structure.AppendixPart,
+		&structure.RawXML,
+		&structure.HeadingPath,
+		&structure.TextTruncated,
+		&structure.IsReserved,
+		&structure.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning cfr structure row: %w", err)
+	}
+
+	return &structure, nil
 }
@@ -8,9 +8,13 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/sam-berry/ecfr-analyzer/server/data"
+	"strings"
 	"time"
 )
 
+// ErrComputedValueNotFound is returned when no computed value exists for a key
+var ErrComputedValueNotFound = errors.New("computed value not found")
+
 type ComputedValueDAO struct {
 	Db *sql.DB
 }
@@ -55,7 +59,7 @@ func (d *ComputedValueDAO) FindByKey(
 
 	err := d.Db.QueryRowContext(
 		ctx,
-		`SELECT id, valueId, key, data
+		`SELECT id, valueId, key, data, createdTimestamp
          FROM computed_value
          WHERE key = $1`,
 		key,
@@ -64,6 +68,7 @@ func (d *ComputedValueDAO) FindByKey(
 		&cv.Id,
 		&cv.Key,
 		&dBytes,
+		&cv.CreatedAt,
 	)
 
 	if err != nil {
@@ -84,21 +89,25 @@ func (d *ComputedValueDAO) FindByKey(
 	return &cv, nil
 }
 
+// FindByKeyPrefix finds all computed values whose key starts with prefix, ordered by key
+// LIKE wildcards in the prefix are matched literally, e.g., the "__" key delimiter
 func (d *ComputedValueDAO) FindByKeyPrefix(
 	ctx context.Context,
 	prefix string,
 ) ([]*data.ComputedValue, error) {
 	rows, err := d.Db.QueryContext(
 		ctx,
-		`SELECT id, valueId, key, data
+		`SELECT id, valueId, key, data, createdTimestamp
          FROM computed_value
-         WHERE key LIKE $1 || '%'`,
-		prefix,
+         WHERE key LIKE $1 || '%' ESCAPE '\'
+         ORDER BY key`,
+		escapeLikePattern(prefix),
 	)
 
 	if err != nil {
 		return nil, fmt.Errorf("error finding computed values by prefix: %v, %w", prefix, err)
 	}
+	defer rows.Close()
 
 	var values []*data.ComputedValue
 	for rows.Next() {
@@ -110,6 +119,7 @@ func (d *ComputedValueDAO) FindByKeyPrefix(
 			&value.Id,
 			&value.Key,
 			&dBytes,
+			&value.CreatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning computed value row: %v, %w", prefix, err)
@@ -125,5 +135,103 @@ func (d *ComputedValueDAO) FindByKeyPrefix(
 		values = append(values, &value)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating computed value rows: %v, %w", prefix, err)
+	}
+
 	return values, nil
 }
+
+// FindKeysByPrefix finds the keys of all computed values whose key starts with prefix, matched as by FindByKeyPrefix
+// Keys are ordered, their data is not read
+func (d *ComputedValueDAO) FindKeysByPrefix(
+	ctx context.Context,
+	prefix string,
+) ([]string, error) {
+	rows, err := d.Db.QueryContext(
+		ctx,
+		`SELECT key
+         FROM computed_value
+         WHERE key LIKE $1 || '%' ESCAPE '\'
+         ORDER BY key`,
+		escapeLikePattern(prefix),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("error finding computed value keys by prefix: %v, %w", prefix, err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("error scanning computed value key: %v, %w", prefix, err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating computed value keys: %v, %w", prefix, err)
+	}
+
+	return keys, nil
+}
+
+// Delete deletes the computed value of a key, returns ErrComputedValueNotFound if there is none
+func (d *ComputedValueDAO) Delete(
+	ctx context.Context,
+	key string,
+) error {
+	result, err := d.Db.ExecContext(
+		ctx,
+		`DELETE FROM computed_value WHERE key = $1`,
+		key,
+	)
+
+	if err != nil {
+		return fmt.Errorf("error deleting computed value, %v, %w", key, err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error counting deleted computed values, %v, %w", key, err)
+	}
+
+	if deleted == 0 {
+		return fmt.Errorf("%w: %v", ErrComputedValueNotFound, key)
+	}
+
+	return nil
+}
+
+// DeleteByKeyPrefix deletes all computed values whose key starts with prefix, matched as by FindByKeyPrefix
+// Returns the number of computed values deleted
+func (d *ComputedValueDAO) DeleteByKeyPrefix(
+	ctx context.Context,
+	prefix string,
+) (int64, error) {
+	result, err := d.Db.ExecContext(
+		ctx,
+		`DELETE FROM computed_value WHERE key LIKE $1 || '%' ESCAPE '\'`,
+		escapeLikePattern(prefix),
+	)
+
+	if err != nil {
+		return 0, fmt.Errorf("error deleting computed values by prefix: %v, %w", prefix, err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error counting deleted computed values: %v, %w", prefix, err)
+	}
+
+	return deleted, nil
+}
+
+var likePatternEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLikePattern escapes the LIKE wildcard characters so they match literally
+func escapeLikePattern(s string) string {
+	return likePatternEscaper.Replace(s)
+}
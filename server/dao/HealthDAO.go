@@ -0,0 +1,22 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type HealthDAO struct {
+	Db *sql.DB
+}
+
+// Ping verifies the database is reachable and able to run a query
+func (d *HealthDAO) Ping(ctx context.Context) error {
+	var result int
+	err := d.Db.QueryRowContext(ctx, `SELECT 1`).Scan(&result)
+	if err != nil {
+		return fmt.Errorf("error pinging database: %w", err)
+	}
+
+	return nil
+}
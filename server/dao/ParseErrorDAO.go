@@ -0,0 +1,91 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/sam-berry/ecfr-analyzer/server/data"
+	"time"
+)
+
+type ParseErrorDAO struct {
+	Db *sql.DB
+}
+
+// Insert records a failed parse of a title
+func (d *ParseErrorDAO) Insert(
+	ctx context.Context,
+	titleNumber int,
+	errorMessage string,
+) error {
+	_, err := d.Db.ExecContext(
+		ctx,
+		`INSERT INTO parse_errors(title_number, error_message, occurred_timestamp)
+		VALUES ($1, $2, $3)`,
+		titleNumber,
+		errorMessage,
+		time.Now().UTC(),
+	)
+
+	if err != nil {
+		return fmt.Errorf("error inserting parse error for title %d: %w", titleNumber, err)
+	}
+
+	return nil
+}
+
+// DeleteByTitleNumber clears the recorded parse errors of a title
+func (d *ParseErrorDAO) DeleteByTitleNumber(
+	ctx context.Context,
+	titleNumber int,
+) error {
+	_, err := d.Db.ExecContext(
+		ctx,
+		`DELETE FROM parse_errors WHERE title_number = $1`,
+		titleNumber,
+	)
+
+	if err != nil {
+		return fmt.Errorf("error deleting parse errors for title %d: %w", titleNumber, err)
+	}
+
+	return nil
+}
+
+// FindAll finds all recorded parse errors, most recent first
+func (d *ParseErrorDAO) FindAll(
+	ctx context.Context,
+) ([]*data.ParseError, error) {
+	rows, err := d.Db.QueryContext(
+		ctx,
+		`SELECT id, title_number, error_message, occurred_timestamp
+		FROM parse_errors
+		ORDER BY occurred_timestamp DESC, title_number`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error finding parse errors: %w", err)
+	}
+	defer rows.Close()
+
+	parseErrors := []*data.ParseError{}
+	for rows.Next() {
+		var parseError data.ParseError
+		err := rows.Scan(
+			&parseError.InternalId,
+			&parseError.TitleNumber,
+			&parseError.ErrorMessage,
+			&parseError.OccurredAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning parse error row: %w", err)
+		}
+
+		parseErrors = append(parseErrors, &parseError)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating parse error rows: %w", err)
+	}
+
+	return parseErrors, nil
+}
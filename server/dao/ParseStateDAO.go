@@ -0,0 +1,171 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/sam-berry/ecfr-analyzer/server/data"
+	"time"
+)
+
+type ParseStateDAO struct {
+	Db *sql.DB
+}
+
+// Upsert records the parse state of a successfully parsed title, with vocabulary the distinct words of its text
+// The unique word count is the size of vocabulary, the parse time is now.
+func (d *ParseStateDAO) Upsert(
+	ctx context.Context,
+	state *data.ParseState,
+	vocabulary []string,
+) error {
+	_, err := d.Db.ExecContext(
+		ctx,
+		`INSERT INTO parse_state(
+			title_id, title_number, content_hash, structure_count, leaves_only, unique_word_count, vocabulary,
+			sentence_count, readability_word_count, syllable_count, parsed_timestamp
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (title_id) DO UPDATE
+		SET content_hash = $3, structure_count = $4, leaves_only = $5, unique_word_count = $6, vocabulary = $7,
+			sentence_count = $8, readability_word_count = $9, syllable_count = $10, parsed_timestamp = $11
+		WHERE parse_state.title_id = $1`,
+		state.TitleId,
+		state.TitleNumber,
+		state.ContentHash,
+		state.StructureCount,
+		state.LeavesOnly,
+		len(vocabulary),
+		pq.Array(vocabulary),
+		state.Sentences,
+		state.ReadabilityWords,
+		state.Syllables,
+		time.Now().UTC(),
+	)
+
+	if err != nil {
+		return fmt.Errorf("error upserting parse state for title %d: %w", state.TitleNumber, err)
+	}
+
+	return nil
+}
+
+// DeleteByTitleId deletes the parse state of a title, so its next parse is not skipped
+func (d *ParseStateDAO) DeleteByTitleId(
+	ctx context.Context,
+	titleId int,
+) error {
+	_, err := d.Db.ExecContext(
+		ctx,
+		`DELETE FROM parse_state WHERE title_id = $1`,
+		titleId,
+	)
+
+	if err != nil {
+		return fmt.Errorf("error deleting parse state for title %d: %w", titleId, err)
+	}
+
+	return nil
+}
+
+// FindByTitleId finds the parse state for a title, returns nil if the title was never parsed
+func (d *ParseStateDAO) FindByTitleId(
+	ctx context.Context,
+	titleId int,
+) (*data.ParseState, error) {
+	var state data.ParseState
+	err := d.Db.QueryRowContext(
+		ctx,
+		`SELECT id, title_id, title_number, content_hash, structure_count, leaves_only, unique_word_count,
+			sentence_count, readability_word_count, syllable_count, parsed_timestamp
+		FROM parse_state
+		WHERE title_id = $1`,
+		titleId,
+	).Scan(
+		&state.InternalId,
+		&state.TitleId,
+		&state.TitleNumber,
+		&state.ContentHash,
+		&state.StructureCount,
+		&state.LeavesOnly,
+		&state.UniqueWordCount,
+		&state.Sentences,
+		&state.ReadabilityWords,
+		&state.Syllables,
+		&state.ParsedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error finding parse state for title %d: %w", titleId, err)
+	}
+
+	return &state, nil
+}
+
+// FindAll finds the parse state of every title that was parsed, ordered by title number
+func (d *ParseStateDAO) FindAll(
+	ctx context.Context,
+) ([]*data.ParseState, error) {
+	rows, err := d.Db.QueryContext(
+		ctx,
+		`SELECT id, title_id, title_number, content_hash, structure_count, leaves_only, unique_word_count,
+			sentence_count, readability_word_count, syllable_count, parsed_timestamp
+		FROM parse_state
+		ORDER BY title_number`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error finding parse states: %w", err)
+	}
+	defer rows.Close()
+
+	states := []*data.ParseState{}
+	for rows.Next() {
+		var state data.ParseState
+		err := rows.Scan(
+			&state.InternalId,
+			&state.TitleId,
+			&state.TitleNumber,
+			&state.ContentHash,
+			&state.StructureCount,
+			&state.LeavesOnly,
+			&state.UniqueWordCount,
+			&state.Sentences,
+			&state.ReadabilityWords,
+			&state.Syllables,
+			&state.ParsedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning parse state row: %w", err)
+		}
+
+		states = append(states, &state)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating parse state rows: %w", err)
+	}
+
+	return states, nil
+}
+
+// CountDistinctWords counts the distinct words across the vocabularies of every parsed title
+func (d *ParseStateDAO) CountDistinctWords(
+	ctx context.Context,
+) (int, error) {
+	var count int
+	err := d.Db.QueryRowContext(
+		ctx,
+		`SELECT COUNT(DISTINCT word)
+		FROM parse_state, UNNEST(vocabulary) AS word`,
+	).Scan(&count)
+
+	if err != nil {
+		return 0, fmt.Errorf("error counting distinct words of parsed titles: %w", err)
+	}
+
+	return count, nil
+}
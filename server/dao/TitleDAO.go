@@ -3,12 +3,17 @@ package dao
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/lib/pq"
 	"github.com/sam-berry/ecfr-analyzer/server/data"
 	"strings"
+	"time"
 )
 
+// ErrTitleNotFound is returned when no title exists for a title number
+var ErrTitleNotFound = errors.New("title not found")
+
 type TitleDAO struct {
 	Db *sql.DB
 }
@@ -169,6 +174,51 @@ func (d *TitleDAO) GetContent(ctx context.Context, titleNumber int) (
 	return content, nil
 }
 
+// GetContentHash computes the SHA-256 hash of the XML content for a title
+// Hashing in the database avoids transferring the content when only the hash is needed
+func (d *TitleDAO) GetContentHash(ctx context.Context, titleNumber int) (
+	string,
+	error,
+) {
+	var hash string
+	err := d.Db.QueryRowContext(
+		ctx,
+		`SELECT ENCODE(SHA256(CONVERT_TO(content::TEXT, 'UTF8')), 'hex')
+         FROM title
+         WHERE name = $1`,
+		titleNumber,
+	).Scan(&hash)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("title %d not found", titleNumber)
+		}
+		return "", fmt.Errorf("error getting title content hash for %d: %w", titleNumber, err)
+	}
+
+	return hash, nil
+}
+
+// FindLatestImportTimestamp returns the time the most recent title was imported, nil if none have been
+func (d *TitleDAO) FindLatestImportTimestamp(ctx context.Context) (*time.Time, error) {
+	var timestamp sql.NullTime
+	err := d.Db.QueryRowContext(
+		ctx,
+		`SELECT MAX(createdTimestamp)
+         FROM title`,
+	).Scan(&timestamp)
+
+	if err != nil {
+		return nil, fmt.Errorf("error finding latest title import timestamp: %w", err)
+	}
+
+	if !timestamp.Valid {
+		return nil, nil
+	}
+
+	return &timestamp.Time, nil
+}
+
 // FindByNumber finds a title by its number
 func (d *TitleDAO) FindByNumber(ctx context.Context, titleNumber int) (
 	*data.Title,
@@ -189,7 +239,7 @@ func (d *TitleDAO) FindByNumber(ctx context.Context, titleNumber int) (
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("title %d not found", titleNumber)
+			return nil, fmt.Errorf("%w: %d", ErrTitleNotFound, titleNumber)
 		}
 		return nil, fmt.Errorf("error finding title %d: %w", titleNumber, err)
 	}
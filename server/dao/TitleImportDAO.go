@@ -5,14 +5,16 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
+	"github.com/sam-berry/ecfr-analyzer/server/logging"
 	"time"
 )
 
 var InvalidXMLErrorCode = pq.ErrorCode("2200N")
 
+var titleImportLog = logging.New("title-import")
+
 type TitleImportDAO struct {
 	Db *sql.DB
 }
@@ -33,12 +35,7 @@ func (d *TitleImportDAO) Insert(
 		var pqErr *pq.Error
 		if errors.As(err, &pqErr) {
 			if pqErr.Code == InvalidXMLErrorCode {
-				log.Info(
-					fmt.Sprintf(
-						"Invalid XML detected, attempting to scrub title %v",
-						name,
-					),
-				)
+				titleImportLog.Warn("Invalid XML detected, attempting to scrub title", "title", name)
 				err = d.insertTitle(ctx, name, scrubXML(content), id)
 				if err == nil {
 					return nil
@@ -47,12 +44,7 @@ func (d *TitleImportDAO) Insert(
 				var pqErr *pq.Error
 				if errors.As(err, &pqErr) {
 					if pqErr.Code == InvalidXMLErrorCode {
-						log.Info(
-							fmt.Sprintf(
-								"Invalid XML detected, attempting to aggressively scrub title %v",
-								name,
-							),
-						)
+						titleImportLog.Warn("Invalid XML detected, attempting to aggressively scrub title", "title", name)
 						scrubbedXML, err := scrubXMLAggresive(content)
 						if err != nil {
 							return fmt.Errorf(
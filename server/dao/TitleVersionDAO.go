@@ -1,16 +1,24 @@
 package dao
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"database/sql"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/sam-berry/ecfr-analyzer/server/data"
+	"github.com/sam-berry/ecfr-analyzer/server/storage"
+	"io"
+	"strings"
 	"time"
 )
 
+// TitleVersionDAO stores the metadata of title versions in title_version and their content in ContentStore
+// Versions stored before the content store was introduced keep their content in title_version, which is still read.
 type TitleVersionDAO struct {
-	Db *sql.DB
+	Db           *sql.DB
+	ContentStore storage.ContentStore
 }
 
 // Insert inserts a new title version
@@ -19,33 +27,184 @@ func (d *TitleVersionDAO) Insert(
 	titleId int,
 	titleNumber int,
 	versionDate time.Time,
+	effectiveDate time.Time,
 	content []byte,
 ) error {
+	_, err := d.InsertStream(ctx, titleId, titleNumber, versionDate, effectiveDate, bytes.NewReader(content))
+	return err
+}
+
+// InsertStream inserts a new title version, reading the XML content from r
+// The content is gzip compressed as it is streamed into the content store, so the uncompressed XML is never held
+// in memory. The metadata is inserted once the content is stored.
+// Returns the number of uncompressed bytes read from r.
+func (d *TitleVersionDAO) InsertStream(
+	ctx context.Context,
+	titleId int,
+	titleNumber int,
+	versionDate time.Time,
+	effectiveDate time.Time,
+	r io.Reader,
+) (int64, error) {
+	key := storage.TitleVersionContentKey(titleNumber, versionDate)
+
+	// Compress into the pipe the store reads from, a failed read fails the put
+	pr, pw := io.Pipe()
+	defer pr.Close()
+
+	compressed := make(chan int64, 1)
+	go func() {
+		gzipWriter := gzip.NewWriter(pw)
+		size, err := io.Copy(gzipWriter, r)
+		if err == nil {
+			err = gzipWriter.Close()
+		}
+		if err != nil {
+			err = fmt.Errorf("error compressing title version content: %w", err)
+		}
+		pw.CloseWithError(err)
+		compressed <- size
+	}()
+
+	err := d.ContentStore.Put(ctx, key, pr)
+	pr.Close()
+	size := <-compressed
+	if err != nil {
+		return 0, fmt.Errorf("error storing title version content: %w", err)
+	}
+
 	id := uuid.New().String()
 
-	_, err := d.Db.ExecContext(
+	_, err = d.Db.ExecContext(
 		ctx,
 		`INSERT INTO title_version(
-			version_id, title_id, title_number, content, version_date, created_timestamp
-		) VALUES ($1, $2, $3, $4, $5, $6)
+			version_id, title_id, title_number, content_key, version_date, effective_date, created_timestamp
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
 		ON CONFLICT (title_number, version_date) DO UPDATE
-		SET content = $4, created_timestamp = $6
+		SET content = NULL, content_gzip = NULL, content_key = $4, effective_date = $6, created_timestamp = $7,
+			total_words = NULL, total_sections = NULL
 		WHERE title_version.title_number = $3 AND title_version.version_date = $5`,
 		id,
 		titleId,
 		titleNumber,
-		string(content),
+		key,
 		versionDate,
+		effectiveDate,
 		time.Now().UTC(),
 	)
 
 	if err != nil {
-		return fmt.Errorf("error inserting title version: %w", err)
+		return 0, fmt.Errorf("error inserting title version: %w", err)
+	}
+
+	return size, nil
+}
+
+// UpdateTotals sets the word and section totals of a title version
+func (d *TitleVersionDAO) UpdateTotals(
+	ctx context.Context,
+	titleNumber int,
+	versionDate time.Time,
+	totalWords int,
+	totalSections int,
+) error {
+	_, err := d.Db.ExecContext(
+		ctx,
+		`UPDATE title_version SET total_words = $3, total_sections = $4
+		WHERE title_number = $1 AND version_date = $2`,
+		titleNumber,
+		versionDate,
+		totalWords,
+		totalSections,
+	)
+	if err != nil {
+		return fmt.Errorf("error updating title version totals: %w", err)
 	}
 
 	return nil
 }
 
+// FindTotalsOnOrBefore finds the totals of the latest version of each title on or before a date
+// Totals are summed from the stored structures of the version when there are any, see
+// CfrStructureDAO.ReplaceForVersion, otherwise they are the totals counted at import
+func (d *TitleVersionDAO) FindTotalsOnOrBefore(
+	ctx context.Context,
+	date time.Time,
+) ([]*data.TitleVersionTotals, error) {
+	rows, err := d.Db.QueryContext(
+		ctx,
+		`SELECT v.title_number, v.version_date,
+			COALESCE(s.total_words, v.total_words), COALESCE(s.total_sections, v.total_sections),
+			s.total_words IS NOT NULL
+		FROM (
+			SELECT DISTINCT ON (title_number) title_number, version_date, total_words, total_sections
+			FROM title_version
+			WHERE version_date <= $1
+			ORDER BY title_number, version_date DESC
+		) v
+		LEFT JOIN LATERAL (
+			SELECT SUM(word_count)::INTEGER AS total_words,
+				(COUNT(*) FILTER (WHERE div_type = 'SECTION'))::INTEGER AS total_sections
+			FROM cfr_structure_version
+			WHERE title_number = v.title_number AND version_date = v.version_date
+			HAVING COUNT(*) > 0
+		) s ON TRUE
+		ORDER BY v.title_number`,
+		date,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error finding title version totals on or before %s: %w", date.Format("2006-01-02"), err)
+	}
+	defer rows.Close()
+
+	var totals []*data.TitleVersionTotals
+	for rows.Next() {
+		var t data.TitleVersionTotals
+		err := rows.Scan(&t.TitleNumber, &t.VersionDate, &t.TotalWords, &t.TotalSections, &t.FromStructures)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning title version totals row: %w", err)
+		}
+
+		totals = append(totals, &t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating title version totals rows: %w", err)
+	}
+
+	return totals, nil
+}
+
+// FindVersionDates finds the distinct dates versions are stored for, of any title, oldest first
+func (d *TitleVersionDAO) FindVersionDates(
+	ctx context.Context,
+) ([]time.Time, error) {
+	rows, err := d.Db.QueryContext(
+		ctx,
+		`SELECT DISTINCT version_date FROM title_version ORDER BY version_date`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error finding title version dates: %w", err)
+	}
+	defer rows.Close()
+
+	var dates []time.Time
+	for rows.Next() {
+		var date time.Time
+		if err := rows.Scan(&date); err != nil {
+			return nil, fmt.Errorf("error scanning title version date row: %w", err)
+		}
+
+		dates = append(dates, date)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating title version date rows: %w", err)
+	}
+
+	return dates, nil
+}
+
 // FindByTitleNumber finds all versions for a given title number
 func (d *TitleVersionDAO) FindByTitleNumber(
 	ctx context.Context,
@@ -53,7 +212,8 @@ func (d *TitleVersionDAO) FindByTitleNumber(
 ) ([]*data.TitleVersion, error) {
 	rows, err := d.Db.QueryContext(
 		ctx,
-		`SELECT id, version_id, title_id, title_number, version_date, created_timestamp
+		`SELECT id, version_id, title_id, title_number, version_date, effective_date, created_timestamp,
+			total_words, total_sections
 		FROM title_version
 		WHERE title_number = $1
 		ORDER BY version_date DESC`,
@@ -73,7 +233,10 @@ func (d *TitleVersionDAO) FindByTitleNumber(
 			&version.TitleId,
 			&version.TitleNumber,
 			&version.VersionDate,
+			&version.EffectiveDate,
 			&version.CreatedAt,
+			&version.TotalWords,
+			&version.TotalSections,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning title version row: %w", err)
@@ -96,7 +259,8 @@ func (d *TitleVersionDAO) FindByDate(
 ) ([]*data.TitleVersion, error) {
 	rows, err := d.Db.QueryContext(
 		ctx,
-		`SELECT id, version_id, title_id, title_number, version_date, created_timestamp
+		`SELECT id, version_id, title_id, title_number, version_date, effective_date, created_timestamp,
+			total_words, total_sections
 		FROM title_version
 		WHERE version_date = $1
 		ORDER BY title_number`,
@@ -116,7 +280,10 @@ func (d *TitleVersionDAO) FindByDate(
 			&version.TitleId,
 			&version.TitleNumber,
 			&version.VersionDate,
+			&version.EffectiveDate,
 			&version.CreatedAt,
+			&version.TotalWords,
+			&version.TotalSections,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning title version row: %w", err)
@@ -141,7 +308,8 @@ func (d *TitleVersionDAO) FindByTitleAndDateRange(
 ) ([]*data.TitleVersion, error) {
 	rows, err := d.Db.QueryContext(
 		ctx,
-		`SELECT id, version_id, title_id, title_number, version_date, created_timestamp
+		`SELECT id, version_id, title_id, title_number, version_date, effective_date, created_timestamp,
+			total_words, total_sections
 		FROM title_version
 		WHERE title_number = $1 AND version_date BETWEEN $2 AND $3
 		ORDER BY version_date DESC`,
@@ -163,7 +331,10 @@ func (d *TitleVersionDAO) FindByTitleAndDateRange(
 			&version.TitleId,
 			&version.TitleNumber,
 			&version.VersionDate,
+			&version.EffectiveDate,
 			&version.CreatedAt,
+			&version.TotalWords,
+			&version.TotalSections,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning title version row: %w", err)
@@ -185,24 +356,83 @@ func (d *TitleVersionDAO) GetContentByVersion(
 	titleNumber int,
 	versionDate time.Time,
 ) (*data.TitleVersionWithContent, error) {
-	var version data.TitleVersionWithContent
-	var content string
-
-	err := d.Db.QueryRowContext(
+	row := d.Db.QueryRowContext(
 		ctx,
-		`SELECT id, version_id, title_id, title_number, version_date, created_timestamp, content
+		`SELECT id, version_id, title_id, title_number, version_date, effective_date, created_timestamp,
+			content::TEXT, content_gzip, content_key
 		FROM title_version
 		WHERE title_number = $1 AND version_date = $2`,
 		titleNumber,
 		versionDate,
-	).Scan(
+	)
+
+	return d.scanVersionWithContent(ctx, row)
+}
+
+// GetContentOnOrBefore retrieves the XML content of the latest version dated on or before date
+// Returns nil if the title has no version that early.
+func (d *TitleVersionDAO) GetContentOnOrBefore(
+	ctx context.Context,
+	titleNumber int,
+	date time.Time,
+) (*data.TitleVersionWithContent, error) {
+	row := d.Db.QueryRowContext(
+		ctx,
+		`SELECT id, version_id, title_id, title_number, version_date, effective_date, created_timestamp,
+			content::TEXT, content_gzip, content_key
+		FROM title_version
+		WHERE title_number = $1 AND version_date <= $2
+		ORDER BY version_date DESC
+		LIMIT 1`,
+		titleNumber,
+		date,
+	)
+
+	return d.scanVersionWithContent(ctx, row)
+}
+
+// GetLatestContent retrieves the XML content of the most recent version of a title
+// Returns nil if the title has no versions.
+func (d *TitleVersionDAO) GetLatestContent(
+	ctx context.Context,
+	titleNumber int,
+) (*data.TitleVersionWithContent, error) {
+	row := d.Db.QueryRowContext(
+		ctx,
+		`SELECT id, version_id, title_id, title_number, version_date, effective_date, created_timestamp,
+			content::TEXT, content_gzip, content_key
+		FROM title_version
+		WHERE title_number = $1
+		ORDER BY version_date DESC
+		LIMIT 1`,
+		titleNumber,
+	)
+
+	return d.scanVersionWithContent(ctx, row)
+}
+
+// scanVersionWithContent scans a version with its content, reading it from the content store when stored there and
+// decompressing it if stored compressed
+func (d *TitleVersionDAO) scanVersionWithContent(
+	ctx context.Context,
+	row *sql.Row,
+) (*data.TitleVersionWithContent, error) {
+	var version data.TitleVersionWithContent
+	var content sql.NullString
+	var compressed []byte
+	var contentKey sql.NullString
+
+	err := row.Scan(
 		&version.InternalId,
 		&version.Id,
 		&version.TitleId,
 		&version.TitleNumber,
 		&version.VersionDate,
+		&version.EffectiveDate,
 		&version.CreatedAt,
 		&content,
+		&compressed,
+		&contentKey,
 	)
 
 	if err != nil {
@@ -212,6 +442,77 @@ func (d *TitleVersionDAO) GetContentByVersion(
 		return nil, fmt.Errorf("error finding title version with content: %w", err)
 	}
 
-	version.Content = content
+	var compressedReader io.Reader
+	switch {
+	case contentKey.Valid:
+		stored, err := d.ContentStore.Get(ctx, contentKey.String)
+		if err != nil {
+			return nil, fmt.Errorf("error reading title version content: %w", err)
+		}
+		defer stored.Close()
+		compressedReader = stored
+	case compressed != nil:
+		compressedReader = bytes.NewReader(compressed)
+	default:
+		version.Content = content.String
+		return &version, nil
+	}
+
+	gzipReader, err := gzip.NewReader(compressedReader)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing title version content: %w", err)
+	}
+	defer gzipReader.Close()
+
+	var decompressed strings.Builder
+	if _, err := io.Copy(&decompressed, gzipReader); err != nil {
+		return nil, fmt.Errorf("error decompressing title version content: %w", err)
+	}
+
+	version.Content = decompressed.String()
 	return &version, nil
 }
+
+// OpenContentByVersion opens the stored XML content of a specific version without decompressing it
+// gzipped reports whether the reader yields the gzip compressed content. Content read from the content store must be
+// closed, so the reader is an io.Closer when it is.
+// Returns a nil reader if the version does not exist.
+func (d *TitleVersionDAO) OpenContentByVersion(
+	ctx context.Context,
+	titleNumber int,
+	versionDate time.Time,
+) (r io.Reader, gzipped bool, err error) {
+	var content sql.NullString
+	var compressed []byte
+	var contentKey sql.NullString
+
+	err = d.Db.QueryRowContext(
+		ctx,
+		`SELECT content::TEXT, content_gzip, content_key
+		FROM title_version
+		WHERE title_number = $1 AND version_date = $2`,
+		titleNumber,
+		versionDate,
+	).Scan(&content, &compressed, &contentKey)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("error finding title version content: %w", err)
+	}
+
+	if contentKey.Valid {
+		stored, err := d.ContentStore.Get(ctx, contentKey.String)
+		if err != nil {
+			return nil, false, fmt.Errorf("error reading title version content: %w", err)
+		}
+		return stored, true, nil
+	}
+
+	if compressed == nil {
+		return strings.NewReader(content.String), false, nil
+	}
+
+	return bytes.NewReader(compressed), true, nil
+}
@@ -1,7 +1,11 @@
 package data
 
 type AgencyReference struct {
-	Title int `json:"title"`
+	Title      int    `json:"title"`
+	Subtitle   string `json:"subtitle,omitempty"`
+	Chapter    string `json:"chapter,omitempty"`
+	Subchapter string `json:"subchapter,omitempty"`
+	Part       string `json:"part,omitempty"`
 }
 
 type Agency struct {
@@ -16,3 +20,14 @@ type Agency struct {
 	Children         []*Agency          `json:"children"`
 	AgencyReferences []*AgencyReference `json:"cfr_references"`
 }
+
+// AgencyTreeNode is an agency in the agency hierarchy with its sub-agencies
+// Agencies reference their parent by slug, as a parent reference would make the tree cyclic when serialized.
+type AgencyTreeNode struct {
+	Id          string            `json:"id"`
+	Name        string            `json:"name"`
+	DisplayName string            `json:"displayName"`
+	Slug        string            `json:"slug"`
+	ParentSlug  *string           `json:"parentSlug"` // Slug of the parent agency, nil for a top level agency
+	Children    []*AgencyTreeNode `json:"children"`
+}
@@ -0,0 +1,19 @@
+package data
+
+// AgencyComparison compares the regulatory footprint of two agencies
+// Deltas are computed as A minus B
+type AgencyComparison struct {
+	A                       *AgencyComparisonEntry `json:"a"`
+	B                       *AgencyComparisonEntry `json:"b"`
+	WordCountDelta          int                    `json:"wordCountDelta"`
+	SectionCountDelta       int                    `json:"sectionCountDelta"`
+	AvgWordsPerSectionDelta float64                `json:"avgWordsPerSectionDelta"`
+}
+
+type AgencyComparisonEntry struct {
+	Agency             *Agency `json:"agency"`
+	WordCount          int     `json:"wordCount"`
+	SectionCount       int     `json:"sectionCount"`
+	AvgWordsPerSection float64 `json:"avgWordsPerSection"`
+	Computed           bool    `json:"computed"` // True if read from stored computed values, false if counted live
+}
@@ -1,8 +1,16 @@
 package data
 
+// Appendices are always totaled separately, their words are included in the word counts,
+// and they are counted as sections when IncludesAppendices is set
+// Reserved sections are also totaled separately, and left out of the section counts when ExcludesReserved is set
 type AgencyMetricResponse struct {
-	WordCount    int `json:"wordCount"`
-	SectionCount int `json:"sectionCount"`
+	WordCount          int  `json:"wordCount"`
+	SectionCount       int  `json:"sectionCount"`
+	AppendixWordCount  int  `json:"appendixWordCount"`
+	AppendixCount      int  `json:"appendixCount"`
+	ReservedCount      int  `json:"reservedCount"`
+	IncludesAppendices bool `json:"includesAppendices"`
+	ExcludesReserved   bool `json:"excludesReserved"`
 }
 
 func DefaultAgencyMetrics() AgencyMetricResponse {
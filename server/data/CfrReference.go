@@ -0,0 +1,79 @@
+package data
+
+import "strings"
+
+// CfrReference is a portion of the CFR that an agency is responsible for
+// Only the title is required, each further level narrows the scope
+type CfrReference struct {
+	Agency     string `json:"agency"` // Name of the agency or sub-agency holding the reference
+	Title      int    `json:"title"`
+	Subtitle   string `json:"subtitle,omitempty"`
+	Chapter    string `json:"chapter,omitempty"`
+	Subchapter string `json:"subchapter,omitempty"`
+	Part       string `json:"part,omitempty"`
+}
+
+// Scope returns the div type and identifier of the most specific level of the reference
+// Both are empty when the reference covers the entire title
+func (r *CfrReference) Scope() (string, string) {
+	switch {
+	case r.Part != "":
+		return DivTypePart, r.Part
+	case r.Subchapter != "":
+		return DivTypeSubchap, r.Subchapter
+	case r.Chapter != "":
+		return DivTypeChapter, r.Chapter
+	case r.Subtitle != "":
+		return DivTypeSubtitle, r.Subtitle
+	default:
+		return "", ""
+	}
+}
+
+// ScopeAncestors returns the path segments, see PathSegment, of the levels of the reference less specific than its
+// scope, e.g., "CHAPTER:I" for subchapter A of chapter I. The element the reference scopes to must be within them.
+func (r *CfrReference) ScopeAncestors() []string {
+	levels := []struct{ divType, identifier string }{
+		{DivTypeSubtitle, r.Subtitle},
+		{DivTypeChapter, r.Chapter},
+		{DivTypeSubchap, r.Subchapter},
+		{DivTypePart, r.Part},
+	}
+
+	scopeType, _ := r.Scope()
+	var ancestors []string
+	for _, level := range levels {
+		if level.divType == scopeType {
+			break
+		}
+		if level.identifier != "" {
+			ancestors = append(ancestors, PathSegment(level.divType, level.identifier))
+		}
+	}
+	return ancestors
+}
+
+// IsScope reports whether an element of the reference's title is the element the reference scopes to
+// That is the root element for a reference to the entire title, otherwise the element of the reference's most
+// specific level within the elements of its other levels, so subchapter A of chapter I does not match subchapter A
+// of chapter II. Only the type, identifier and path of the element are used.
+func (r *CfrReference) IsScope(structure *CfrStructure) bool {
+	divType, identifier := r.Scope()
+	if divType == "" {
+		return !strings.Contains(structure.Path, "/")
+	}
+	if structure.DivType != divType || structure.Identifier != identifier {
+		return false
+	}
+
+	segments := make(map[string]bool)
+	for _, segment := range strings.Split(structure.Path, "/") {
+		segments[SegmentBase(segment)] = true
+	}
+	for _, ancestor := range r.ScopeAncestors() {
+		if !segments[ancestor] {
+			return false
+		}
+	}
+	return true
+}
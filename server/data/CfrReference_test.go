@@ -0,0 +1,76 @@
+package data
+
+import "testing"
+
+func TestIsScopeMatchesWholeChain(t *testing.T) {
+	structures := []*CfrStructure{
+		{DivType: DivTypeTitle, Identifier: "40", Path: "TITLE:40"},
+		{DivType: DivTypeChapter, Identifier: "I", Path: "TITLE:40/CHAPTER:I"},
+		{DivType: DivTypeSubchap, Identifier: "A", Path: "TITLE:40/CHAPTER:I/SUBCHAP:A"},
+		{DivType: DivTypePart, Identifier: "1", Path: "TITLE:40/CHAPTER:I/SUBCHAP:A/PART:1"},
+		{DivType: DivTypeChapter, Identifier: "II", Path: "TITLE:40/CHAPTER:II"},
+		{DivType: DivTypeSubchap, Identifier: "A", Path: "TITLE:40/CHAPTER:II/SUBCHAP:A"},
+		{DivType: DivTypeSubchap, Identifier: "A", Path: "TITLE:40/CHAPTER:II/SUBCHAP:A#2"},
+		{DivType: DivTypePart, Identifier: "1", Path: "TITLE:40/CHAPTER:II/SUBCHAP:A/PART:1"},
+	}
+
+	tests := []struct {
+		name      string
+		reference CfrReference
+		expected  []string
+	}{
+		{
+			name:      "entire title",
+			reference: CfrReference{Title: 40},
+			expected:  []string{"TITLE:40"},
+		},
+		{
+			name:      "subchapter of first chapter",
+			reference: CfrReference{Title: 40, Chapter: "I", Subchapter: "A"},
+			expected:  []string{"TITLE:40/CHAPTER:I/SUBCHAP:A"},
+		},
+		{
+			name:      "subchapter of second chapter",
+			reference: CfrReference{Title: 40, Chapter: "II", Subchapter: "A"},
+			expected:  []string{"TITLE:40/CHAPTER:II/SUBCHAP:A", "TITLE:40/CHAPTER:II/SUBCHAP:A#2"},
+		},
+		{
+			name:      "subchapter of any chapter",
+			reference: CfrReference{Title: 40, Subchapter: "A"},
+			expected: []string{
+				"TITLE:40/CHAPTER:I/SUBCHAP:A",
+				"TITLE:40/CHAPTER:II/SUBCHAP:A",
+				"TITLE:40/CHAPTER:II/SUBCHAP:A#2",
+			},
+		},
+		{
+			name:      "part within chapter and subchapter",
+			reference: CfrReference{Title: 40, Chapter: "II", Subchapter: "A", Part: "1"},
+			expected:  []string{"TITLE:40/CHAPTER:II/SUBCHAP:A/PART:1"},
+		},
+		{
+			name:      "chapter not containing subchapter",
+			reference: CfrReference{Title: 40, Chapter: "III", Subchapter: "A"},
+			expected:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var matched []string
+			for _, structure := range structures {
+				if tt.reference.IsScope(structure) {
+					matched = append(matched, structure.Path)
+				}
+			}
+			if len(matched) != len(tt.expected) {
+				t.Fatalf("matched %v, expected %v", matched, tt.expected)
+			}
+			for i := range matched {
+				if matched[i] != tt.expected[i] {
+					t.Errorf("matched %v, expected %v", matched, tt.expected)
+				}
+			}
+		})
+	}
+}
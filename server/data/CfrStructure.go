@@ -1,35 +1,117 @@
 package data
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // CfrStructure represents a hierarchical element in the CFR XML structure
 // DIV1-DIV9 elements with their metadata and content
 type CfrStructure struct {
-	InternalId    int       `json:"-"`
-	Id            string    `json:"id"`
-	TitleId       int       `json:"titleId"`
-	TitleNumber   int       `json:"titleNumber"`
-	DivType       string    `json:"divType"`       // TITLE, SUBTITLE, CHAPTER, SUBCHAP, PART, SUBPART, SUBJGRP, SECTION, APPENDIX
-	DivLevel      int       `json:"divLevel"`      // 1-9
-	Identifier    string    `json:"identifier"`    // N attribute value
-	NodeId        *string   `json:"nodeId"`        // NODE attribute value (optional)
-	Heading       *string   `json:"heading"`       // HEAD element content (optional)
-	TextContent   *string   `json:"textContent"`   // Full text content (optional)
-	WordCount     int       `json:"wordCount"`     // Precomputed word count
-	ParentId      *int      `json:"parentId"`      // Parent structure element (optional for root)
-	Path          string    `json:"path"`          // Hierarchical path (e.g., "1/3/A/1")
-	CreatedAt     time.Time `json:"createdAt"`
+	InternalId  int       `json:"-"`
+	Id          string    `json:"id"`
+	TitleId     int       `json:"titleId"`
+	TitleNumber int       `json:"titleNumber"`
+	DivType     string    `json:"divType"`     // TITLE, SUBTITLE, CHAPTER, SUBCHAP, PART, SUBPART, SUBJGRP, SECTION, APPENDIX
+	DivLevel    int       `json:"divLevel"`    // 1-9
+	Identifier  string    `json:"identifier"`  // N attribute value
+	NodeId      *string   `json:"nodeId"`      // NODE attribute value (optional)
+	Heading     *string   `json:"heading"`     // HEAD element content (optional)
+	TextContent *string   `json:"textContent"` // Full text content (optional), see TextTruncated
+	Notes       *string   `json:"notes"`       // Authority, source and editorial notes excluded from the text (optional)
+	WordCount   int       `json:"wordCount"`   // Precomputed word count
+	ParentId    *int      `json:"parentId"`    // Parent structure element (optional for root)
+	Path        string    `json:"path"`        // Hierarchical path, unique within a title, see JoinPath
+	CreatedAt   time.Time `json:"createdAt"`
+
+	// SequenceIndex is the position of the element in the title document, so siblings can be ordered when
+	// their identifiers do not sort lexically (e.g., "10" sorts before "2")
+	SequenceIndex int `json:"sequenceIndex"`
+
+	// IsAppendix tags appendices, by TYPE or by an identifier like "Appendix A to Part 50", see the parser
+	IsAppendix   bool    `json:"isAppendix"`
+	AppendixPart *string `json:"appendixPart"` // Identifier of the part an appendix belongs to (optional)
+
+	// RawXML is the inner XML of a section, only captured on request, see parser.ParserOptions
+	RawXML *string `json:"rawXml"`
+
+	// HeadingPath joins the headings of a section's ancestors, only stored by leaves-only parses that store no
+	// ancestors, e.g., "Title 40—Protection of Environment > CHAPTER I—... > PART 50—..."
+	HeadingPath *string `json:"headingPath"`
+
+	// TextTruncated is set when TextContent was cut short by parser.ParserOptions.MaxTextBytes, WordCount still
+	// counts the full text
+	TextTruncated bool `json:"textTruncated"`
+
+	// IsReserved tags reserved sections, placeholders for removed provisions, see parser.IsReservedSection
+	IsReserved bool `json:"isReserved"`
+
+	// PathSegments are the path segments from the root, the type and escaped identifier of each element, e.g.,
+	// "PART:60", set by the parser and not stored
+	PathSegments []string `json:"-"`
+}
+
+// ParentPathSegments returns the path segments of the parent element, nil for a root element
+func (s *CfrStructure) ParentPathSegments() []string {
+	if len(s.PathSegments) == 0 {
+		return nil
+	}
+	return s.PathSegments[:len(s.PathSegments)-1]
+}
+
+// MatchKey returns the key matching the element to the same element of another version of the title
+// Node ids are stable when elements are renumbered, so they are used unless matchBy is MatchByPath or the element
+// has no node id, in which case the path is used.
+func (s *CfrStructure) MatchKey(matchBy string) string {
+	if matchBy != MatchByPath && s.NodeId != nil && *s.NodeId != "" {
+		return *s.NodeId
+	}
+	return s.Path
 }
 
+// JoinPath joins path segments into the stored path, e.g., "TITLE:40/CHAPTER:I/PART:60/SECTION:60.1"
+// Segments escape "/" in identifiers, so the path is unambiguous and a descendant's path starts with its ancestor's
+// path and "/"
+func JoinPath(segments []string) string {
+	return strings.Join(segments, "/")
+}
+
+// segmentEscaper escapes the characters of an identifier that delimit path segments and ordinals
+var segmentEscaper = strings.NewReplacer("%", "%25", "/", "%2F", "#", "%23")
+
+// PathSegment returns the path segment of an element, its type and escaped identifier, e.g., "PART:60"
+// The parser appends "#" and an ordinal to the segments of elements without an identifier or repeating one of a
+// sibling, see SegmentBase.
+func PathSegment(divType string, identifier string) string {
+	return divType + ":" + segmentEscaper.Replace(identifier)
+}
+
+// SegmentBase returns a path segment without the ordinal the parser may append to it, see PathSegment
+func SegmentBase(segment string) string {
+	base, _, _ := strings.Cut(segment, "#")
+	return base
+}
+
+// PathKey joins path segments into an in-memory lookup key
+func PathKey(segments []string) string {
+	return strings.Join(segments, "\x00")
+}
+
+// Keys matching elements between versions, see MatchKey
+const (
+	MatchByNodeId = "nodeId"
+	MatchByPath   = "path"
+)
+
 // DivType constants for structured CFR elements
 const (
-	DivTypeTitle     = "TITLE"
-	DivTypeSubtitle  = "SUBTITLE"
-	DivTypeChapter   = "CHAPTER"
-	DivTypeSubchap   = "SUBCHAP"
-	DivTypePart      = "PART"
-	DivTypeSubpart   = "SUBPART"
-	DivTypeSubjgrp   = "SUBJGRP"
-	DivTypeSection   = "SECTION"
-	DivTypeAppendix  = "APPENDIX"
+	DivTypeTitle    = "TITLE"
+	DivTypeSubtitle = "SUBTITLE"
+	DivTypeChapter  = "CHAPTER"
+	DivTypeSubchap  = "SUBCHAP"
+	DivTypePart     = "PART"
+	DivTypeSubpart  = "SUBPART"
+	DivTypeSubjgrp  = "SUBJGRP"
+	DivTypeSection  = "SECTION"
+	DivTypeAppendix = "APPENDIX"
 )
@@ -3,7 +3,7 @@ package data
 import (
 	"encoding/json"
 	"strings"
-	"unicode"
+	"time"
 )
 
 type ComputedValue struct {
@@ -11,6 +11,7 @@ type ComputedValue struct {
 	Id         string          `json:"valueId"`
 	Key        string          `json:"key"`
 	Data       json.RawMessage `json:"data"`
+	CreatedAt  time.Time       `json:"createdAt"`
 }
 
 var delimiter = "__"
@@ -23,22 +24,18 @@ func ParseComputedValueKey(key string) []string {
 	return strings.Split(key, delimiter)
 }
 
-func sanitize(s string) string {
-	var result []rune
-	for _, r := range s {
-		if unicode.IsLetter(r) || unicode.IsDigit(r) {
-			result = append(result, r)
-		} else if unicode.IsSpace(r) {
-			result = append(result, '-')
-		}
-	}
-	return string(result)
-}
-
 func ComputedValueKeyGlobalTitleMetrics() string {
 	return "global-title-metrics"
 }
 
+func ComputedValueKeyGlobalSnapshot() string {
+	return "global-snapshot"
+}
+
+func ComputedValueKeyGlobalTimeSeries() string {
+	return "global-timeseries"
+}
+
 var ComputedValueKeyAgencyMetricPrefix = "agency-metrics"
 
 func ComputedValueKeyAgencyMetric(agencyId string) string {
@@ -47,11 +44,11 @@ func ComputedValueKeyAgencyMetric(agencyId string) string {
 
 var ComputedValueKeySubAgencyMetricPrefix = "sub-agency-metrics"
 
-func ComputedValueKeySubAgencyMetric(parentId string, agencyName string) string {
-	agencyId := strings.ToLower(agencyName)
+// ComputedValueKeySubAgencyMetric is keyed by the sub-agency slug, which unlike its name is stable across renames
+func ComputedValueKeySubAgencyMetric(parentId string, subAgencySlug string) string {
 	return CreateComputedValueKey(
 		ComputedValueKeySubAgencyMetricPrefix,
 		parentId,
-		sanitize(agencyId),
+		subAgencySlug,
 	)
 }
@@ -0,0 +1,42 @@
+package data
+
+import "time"
+
+// GlobalSnapshot aggregates the stored structure metrics of every parsed title
+// Appendices are always totaled separately, their words are included in the word counts,
+// and they are counted as sections when IncludesAppendices is set
+// Reserved sections are also totaled separately, and left out of the section counts when ExcludesReserved is set
+type GlobalSnapshot struct {
+	WordCount          int              `json:"wordCount"`
+	SectionCount       int              `json:"sectionCount"`
+	AppendixWordCount  int              `json:"appendixWordCount"`
+	AppendixCount      int              `json:"appendixCount"`
+	ReservedCount      int              `json:"reservedCount"`
+	IncludesAppendices bool             `json:"includesAppendices"`
+	ExcludesReserved   bool             `json:"excludesReserved"`
+	TitleCount         int              `json:"titleCount"`
+	ComputedAt         time.Time        `json:"computedAt"`
+	Titles             []*TitleSnapshot `json:"titles"`
+}
+
+// GlobalPoint totals the words and sections of every title at a date, using the latest version of each title on or
+// before it
+// Titles without a version on or before the date are not counted. MissingTitles lists those with a version but
+// without totals, as the version has no stored structures and was imported before totals were counted.
+type GlobalPoint struct {
+	Date          time.Time `json:"date"`
+	WordCount     int       `json:"wordCount"`
+	SectionCount  int       `json:"sectionCount"`
+	TitleCount    int       `json:"titleCount"`
+	MissingTitles []int     `json:"missingTitles"`
+}
+
+// TitleSnapshot contains the structure metrics of a single title
+type TitleSnapshot struct {
+	Title             int `json:"title"`
+	WordCount         int `json:"wordCount"`
+	SectionCount      int `json:"sectionCount"`
+	AppendixWordCount int `json:"appendixWordCount"`
+	AppendixCount     int `json:"appendixCount"`
+	ReservedCount     int `json:"reservedCount"`
+}
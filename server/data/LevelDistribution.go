@@ -0,0 +1,8 @@
+package data
+
+// LevelDistribution contains the number of structure elements at each div level of a title
+type LevelDistribution struct {
+	Title    int         `json:"title"`
+	MaxDepth int         `json:"maxDepth"`
+	Levels   map[int]int `json:"levels"`
+}
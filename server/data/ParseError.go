@@ -0,0 +1,11 @@
+package data
+
+import "time"
+
+// ParseError records a failed structure parse of a title
+type ParseError struct {
+	InternalId   int       `json:"-"`
+	TitleNumber  int       `json:"titleNumber"`
+	ErrorMessage string    `json:"errorMessage"`
+	OccurredAt   time.Time `json:"occurredAt"`
+}
@@ -0,0 +1,21 @@
+package data
+
+import "time"
+
+// ParseState records the content hash of a title, its number of structure elements, and the distinct words and
+// readability counts of its text at its last successful structure parse
+type ParseState struct {
+	InternalId      int       `json:"-"`
+	TitleId         int       `json:"titleId"`
+	TitleNumber     int       `json:"titleNumber"`
+	ContentHash     string    `json:"contentHash"`
+	StructureCount  int       `json:"structureCount"`
+	LeavesOnly      bool      `json:"leavesOnly"`      // Only sections were stored, see service.CfrStructureService
+	UniqueWordCount int       `json:"uniqueWordCount"` // Distinct words of the text, see parser.ParseResult
+	ParsedAt        time.Time `json:"parsedAt"`
+
+	// Readability counts of the text, see readability.Score
+	Sentences        int `json:"sentences"`
+	ReadabilityWords int `json:"readabilityWords"`
+	Syllables        int `json:"syllables"`
+}
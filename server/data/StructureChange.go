@@ -0,0 +1,21 @@
+package data
+
+// StructureChange types
+const (
+	StructureAdded     = "added"
+	StructureRemoved   = "removed"
+	StructureChanged   = "changed"
+	StructureUnchanged = "unchanged"
+)
+
+// StructureChange describes a structure element that was added, removed, or changed between two version snapshots
+// Heading and path are from the later snapshot, or the earlier one for a removed element
+type StructureChange struct {
+	ChangeType     string  `json:"changeType"`
+	DivType        string  `json:"divType"`
+	Identifier     string  `json:"identifier"`
+	Heading        *string `json:"heading"`
+	Path           string  `json:"path"`
+	WordCountStart int     `json:"wordCountStart"`
+	WordCountEnd   int     `json:"wordCountEnd"`
+}
@@ -0,0 +1,34 @@
+package data
+
+// StructureTotals are the word and section counts of a set of stored structures
+// WordCount includes the words of appendices, SectionCount does not count appendices
+type StructureTotals struct {
+	WordCount         int
+	SectionCount      int
+	AppendixWordCount int
+	AppendixCount     int
+	ReservedCount     int // Reserved sections counted by SectionCount, see parser.IsReservedSection
+}
+
+// CountOptions select what the word and section counts of metrics include
+type CountOptions struct {
+	IncludeAppendices bool // Count appendices as sections, appendix words are always counted
+	ExcludeReserved   bool // Leave reserved sections out of section counts, see parser.IsReservedSection
+}
+
+// DefaultCountOptions count reserved sections but not appendices, keeping the section counts metrics reported
+// before appendices were tagged
+var DefaultCountOptions = CountOptions{}
+
+// Counts returns the word and section counts, with appendices counted as sections if set
+// and reserved sections excluded from the section count if set
+func (t *StructureTotals) Counts(options CountOptions) (wordCount int, sectionCount int) {
+	wordCount, sectionCount = t.WordCount, t.SectionCount
+	if options.IncludeAppendices {
+		sectionCount += t.AppendixCount
+	}
+	if options.ExcludeReserved {
+		sectionCount -= t.ReservedCount
+	}
+	return wordCount, sectionCount
+}
@@ -0,0 +1,10 @@
+package data
+
+// SubpartMetric contains the word and section counts of a subpart, including all of its descendants
+type SubpartMetric struct {
+	Identifier   string  `json:"identifier"`
+	Heading      *string `json:"heading"`
+	Path         string  `json:"path"`
+	WordCount    int     `json:"wordCount"`
+	SectionCount int     `json:"sectionCount"`
+}
@@ -1,6 +1,19 @@
 package data
 
+import "github.com/sam-berry/ecfr-analyzer/server/readability"
+
 type TitleMetricResponse struct {
-	WordCount    int `json:"wordCount"`
-	SectionCount int `json:"sectionCount"`
+	WordCount       int                             `json:"wordCount"`
+	UniqueWordCount int                             `json:"uniqueWordCount"` // Distinct words across all titles
+	SectionCount    int                             `json:"sectionCount"`
+	Readability     *readability.ReadabilityMetrics `json:"readability"`
+	Titles          []*TitleMetrics                 `json:"titles"`
+}
+
+type TitleMetrics struct {
+	Title           int                             `json:"title"`
+	WordCount       int                             `json:"wordCount"`
+	UniqueWordCount int                             `json:"uniqueWordCount"` // Distinct words, see readability.Vocabulary
+	SectionCount    int                             `json:"sectionCount"`
+	Readability     *readability.ReadabilityMetrics `json:"readability"`
 }
@@ -9,8 +9,29 @@ type TitleVersion struct {
 	Id            string    `json:"id"`
 	TitleId       int       `json:"titleId"`
 	TitleNumber   int       `json:"titleNumber"`
-	VersionDate   time.Time `json:"versionDate"`   // The date this version was effective
+	VersionDate   time.Time `json:"versionDate"`   // The date this version was requested for
+	EffectiveDate time.Time `json:"effectiveDate"` // The date the stored content is effective, its latest amendment
 	CreatedAt     time.Time `json:"createdAt"`
+	TotalWords    *int      `json:"totalWords"`    // Counted at import, nil for versions imported before totals were
+	TotalSections *int      `json:"totalSections"` // Counted at import, nil for versions imported before totals were
+}
+
+// TitleVersionDate identifies an available version of a title without its content
+type TitleVersionDate struct {
+	VersionDate   time.Time `json:"versionDate"`
+	CreatedAt     time.Time `json:"createdAt"`
+	TotalWords    *int      `json:"totalWords"`
+	TotalSections *int      `json:"totalSections"`
+}
+
+// TitleVersionTotals are the word and section totals of a title version, see TitleVersionDAO.FindTotalsOnOrBefore
+// The totals are nil when the version has neither stored structures nor totals counted at import.
+type TitleVersionTotals struct {
+	TitleNumber    int
+	VersionDate    time.Time
+	TotalWords     *int
+	TotalSections  *int
+	FromStructures bool // Summed from the stored structures of the version rather than counted at import
 }
 
 // TitleVersionWithContent extends TitleVersion to include the XML content
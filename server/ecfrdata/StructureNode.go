@@ -0,0 +1,12 @@
+package ecfrdata
+
+// StructureNode is an element of the eCFR structure JSON of a title, with its children
+type StructureNode struct {
+	Identifier       string           `json:"identifier"`
+	Label            string           `json:"label"`
+	LabelLevel       string           `json:"label_level"`
+	LabelDescription string           `json:"label_description"`
+	Reserved         bool             `json:"reserved"`
+	Type             string           `json:"type"` // title, chapter, part, section, appendix, etc.
+	Children         []*StructureNode `json:"children"`
+}
@@ -0,0 +1,14 @@
+package ecfrdata
+
+type VersionerTitlesResponse struct {
+	Titles []VersionerTitle `json:"titles"`
+}
+
+type VersionerTitle struct {
+	Number          int    `json:"number"`
+	Name            string `json:"name"`
+	LatestAmendedOn string `json:"latest_amended_on"`
+	LatestIssueDate string `json:"latest_issue_date"`
+	UpToDateAsOf    string `json:"up_to_date_as_of"`
+	Reserved        bool   `json:"reserved"`
+}
@@ -4,10 +4,18 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 type Client struct {
 	HttpClient *http.Client
+	UserAgent  string // Sent as the User-Agent header when set
+
+	// MaxAttempts is the number of times a GET is tried before giving up, 0 or 1 means no retries.
+	// Connection errors and 429, 500, 502, 503, and 504 responses are retried after an exponential
+	// backoff starting at RetryBackoff, or after the Retry-After delay of a 429 or 503 response.
+	MaxAttempts  int
+	RetryBackoff time.Duration
 }
 
 func (s *Client) GetJSON(
@@ -29,12 +37,85 @@ func (s *Client) Get(
 	url string,
 	accept string,
 ) (*http.Response, error) {
+	maxAttempts := s.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	var lastErr error
+	attempts := 0
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		attempts = attempt
+		resp, retryAfter, err := s.get(ctx, url, accept)
+		if err == nil {
+			return resp, nil
+		}
+
+		lastErr = err
+		if retryAfter < 0 || attempt == maxAttempts {
+			break
+		}
+
+		delay := retryAfter
+		if delay == 0 {
+			delay = backoff(s.RetryBackoff, attempt)
+		}
+
+		if err := sleep(ctx, delay); err != nil {
+			lastErr = err
+			break
+		}
+	}
+
+	return nil, fmt.Errorf("HTTP GET failed after %d attempt(s), %v, %w", attempts, url, lastErr)
+}
+
+// get makes a single GET request
+// On failure the returned duration is negative if the request should not be retried,
+// otherwise it is the server requested delay before retrying, or 0 to use the backoff
+func (s *Client) get(
+	ctx context.Context,
+	url string,
+	accept string,
+) (*http.Response, time.Duration, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request, %v, %w", url, err)
+		return nil, -1, fmt.Errorf("failed to create HTTP request, %v, %w", url, err)
 	}
 
 	req.Header.Set("Accept", accept)
+	s.setUserAgent(req)
+
+	resp, err := s.HttpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, -1, fmt.Errorf("HTTP request failed, %v, %w", url, err)
+		}
+		return nil, 0, fmt.Errorf("HTTP request failed, %v, %w", url, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err := fmt.Errorf("request retuned non-200 response: %v, %v", resp.StatusCode, url)
+		if !isRetryableStatus(resp.StatusCode) {
+			return nil, -1, err
+		}
+		return nil, retryAfter(resp), err
+	}
+
+	return resp, 0, nil
+}
+
+func (s *Client) Head(
+	ctx context.Context,
+	url string,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request, %v, %w", url, err)
+	}
+
+	s.setUserAgent(req)
 
 	resp, err := s.HttpClient.Do(req)
 	if err != nil {
@@ -42,8 +123,15 @@ func (s *Client) Get(
 	}
 
 	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
 		return nil, fmt.Errorf("request retuned non-200 response: %v, %v", resp.StatusCode, url)
 	}
 
 	return resp, nil
 }
+
+func (s *Client) setUserAgent(req *http.Request) {
+	if s.UserAgent != "" {
+		req.Header.Set("User-Agent", s.UserAgent)
+	}
+}
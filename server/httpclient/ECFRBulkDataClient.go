@@ -29,3 +29,14 @@ func (s *ECFRBulkDataClient) GetXML(
 ) (*http.Response, error) {
 	return s.HttpClient.GetXML(ctx, url)
 }
+
+// Ping verifies the bulk data host responds, without downloading the file listing
+func (s *ECFRBulkDataClient) Ping(
+	ctx context.Context,
+) error {
+	resp, err := s.HttpClient.Head(ctx, s.APIRoot)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,58 @@
+package httpresponse
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sendConditional sends content with its validators, or only the status 304 when the request's validators match
+// The ETag is weak because the compress middleware may re-encode the content
+func sendConditional(c *fiber.Ctx, content []byte, lastModified time.Time) error {
+	etag := contentETag(content)
+	c.Set(fiber.HeaderETag, etag)
+	if !lastModified.IsZero() {
+		c.Set(fiber.HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if isNotModified(c, etag, lastModified) {
+		c.Status(fiber.StatusNotModified)
+		return nil
+	}
+
+	return c.Status(200).Send(content)
+}
+
+func contentETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// isNotModified evaluates If-None-Match, falling back to If-Modified-Since only when it is absent, per RFC 9110
+func isNotModified(c *fiber.Ctx, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := c.Get(fiber.HeaderIfNoneMatch); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	ifModifiedSince := c.Get(fiber.HeaderIfModifiedSince)
+	if ifModifiedSince == "" || lastModified.IsZero() {
+		return false
+	}
+
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+
+	// Last-Modified has second precision
+	return !lastModified.Truncate(time.Second).After(since)
+}
@@ -3,13 +3,51 @@ package httpresponse
 import (
 	"github.com/gofiber/fiber/v2"
 	"log"
+	"time"
 )
 
 func ApplyErrorToResponse(c *fiber.Ctx, message string, err error) error {
-	log.Println(err.Error())
+	if err != nil {
+		log.Println(err.Error())
+	}
 	return c.Status(500).JSON(ErrorResponse(message))
 }
 
+func ApplyNotFoundToResponse(c *fiber.Ctx, message string) error {
+	return c.Status(404).JSON(ErrorResponse(message))
+}
+
 func ApplySuccessToResponse(c *fiber.Ctx, body any) error {
 	return c.Status(200).JSON(SuccessResponse(body))
 }
+
+// ApplyCacheableResponse responds like ApplySuccessToResponse with an ETag of the content and a Last-Modified of
+// lastModified, omitted when zero, and responds 304 Not Modified to a conditional request that is still current
+func ApplyCacheableResponse(c *fiber.Ctx, body any, lastModified time.Time) error {
+	content, err := c.App().Config().JSONEncoder(SuccessResponse(body))
+	if err != nil {
+		return ApplyErrorToResponse(c, "Unexpected error", err)
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return sendConditional(c, content, lastModified)
+}
+
+// ApplyTextResponse responds with text of the content type, cached like ApplyCacheableResponse
+func ApplyTextResponse(c *fiber.Ctx, contentType string, text string, lastModified time.Time) error {
+	c.Set(fiber.HeaderContentType, contentType)
+	return sendConditional(c, []byte(text), lastModified)
+}
+
+// ApplyNegotiatedResponse responds with the JSON body or the text rendering, based on the Accept header, cached like
+// ApplyCacheableResponse
+// Text is preferred when both are equally acceptable, such as with no Accept header, */*, or a browser request
+func ApplyNegotiatedResponse(c *fiber.Ctx, body any, textFn func() string, lastModified time.Time) error {
+	c.Vary(fiber.HeaderAccept)
+
+	if c.Accepts(fiber.MIMETextPlain, fiber.MIMEApplicationJSON) == fiber.MIMEApplicationJSON {
+		return ApplyCacheableResponse(c, body, lastModified)
+	}
+
+	return ApplyTextResponse(c, fiber.MIMETextPlainCharsetUTF8, textFn(), lastModified)
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// The minimum level is read from ECFR_LOG_LEVEL (debug, info, warn, error) and defaults to info.
+// Entries are written as JSON so they can be filtered by field, or as text in development.
+var (
+	level   = new(slog.LevelVar)
+	handler slog.Handler
+)
+
+func init() {
+	level.Set(ParseLevel(os.Getenv("ECFR_LOG_LEVEL")))
+
+	options := &slog.HandlerOptions{Level: level}
+	if os.Getenv("ECFR_DEVELOPMENT") == "true" {
+		handler = slog.NewTextHandler(os.Stdout, options)
+	} else {
+		handler = slog.NewJSONHandler(os.Stdout, options)
+	}
+}
+
+// Logger writes leveled log entries with key-value fields
+// Fields are passed as alternating keys and values, e.g., log.Info("Parsed title", "title", 40, "durationMs", 1200)
+type Logger struct {
+	logger *slog.Logger
+}
+
+// New creates a logger whose entries are tagged with the given component name
+func New(component string) *Logger {
+	return &Logger{logger: slog.New(handler).With("component", component)}
+}
+
+// With returns a logger that adds the given fields to every entry
+func (l *Logger) With(fields ...any) *Logger {
+	return &Logger{logger: l.logger.With(fields...)}
+}
+
+func (l *Logger) Debug(message string, fields ...any) {
+	l.logger.Debug(message, fields...)
+}
+
+func (l *Logger) Info(message string, fields ...any) {
+	l.logger.Info(message, fields...)
+}
+
+func (l *Logger) Warn(message string, fields ...any) {
+	l.logger.Warn(message, fields...)
+}
+
+func (l *Logger) Error(message string, fields ...any) {
+	l.logger.Error(message, fields...)
+}
+
+// SetLevel changes the minimum level of all loggers
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+// ParseLevel converts a level name to a slog level, defaulting to info for unknown names
+func ParseLevel(name string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Label values used by the instruments below
+const (
+	ParseResultParsed  = "parsed"
+	ParseResultSkipped = "skipped"
+	ParseResultFailed  = "failed"
+
+	ImportTitle        = "title"
+	ImportTitleVersion = "title_version"
+
+	OperationParse              = "parse"
+	OperationTitleImport        = "title_import"
+	OperationTitleVersionImport = "title_version_import"
+)
+
+// The instruments are registered with the default Prometheus registry, which promhttp.Handler serves
+var (
+	TitlesParsed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ecfr_titles_parsed_total",
+			Help: "Titles processed into CFR structure, by result.",
+		},
+		[]string{"result"},
+	)
+
+	TitleParseDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "ecfr_title_parse_duration_seconds",
+			Help:    "Time to parse and store the CFR structure of a title.",
+			Buckets: []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		},
+	)
+
+	ImportBytesDownloaded = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ecfr_import_bytes_downloaded_total",
+			Help: "Bytes of title XML downloaded from the bulk data repository, by import.",
+		},
+		[]string{"import"},
+	)
+
+	Errors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ecfr_errors_total",
+			Help: "Failed title operations, by operation.",
+		},
+		[]string{"operation"},
+	)
+
+	RunnerWorkersInFlight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ecfr_runner_workers_in_flight",
+			Help: "Concurrent runner workers currently running, by job.",
+		},
+		[]string{"job"},
+	)
+
+	RunnerConcurrencyLimit = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ecfr_runner_concurrency_limit",
+			Help: "Current concurrency of adaptive concurrent runners, by job.",
+		},
+		[]string{"job"},
+	)
+)
@@ -0,0 +1,141 @@
+package openapi
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sam-berry/ecfr-analyzer/server/httpresponse"
+	"reflect"
+	"strings"
+)
+
+// Version of the OpenAPI specification documents are written in
+const Version = "3.0.3"
+
+// bearerAuth is the name of the security scheme of the routes that require the admin token
+const bearerAuth = "bearerAuth"
+
+// Route documents what a registered route does not tell, its query parameters and the type of its response data
+type Route struct {
+	Summary string
+	Query   []Parameter
+	Data    any // A value of the type of the response data, nil for none or an undocumented type
+}
+
+// Query describes a query parameter of type "string", "integer", "number", or "boolean"
+func Query(name string, schemaType string, required bool, description string) Parameter {
+	return Parameter{
+		Name:        name,
+		In:          "query",
+		Required:    required,
+		Description: description,
+		Schema:      &Schema{Type: schemaType},
+	}
+}
+
+// RouteKey is the key of a route in the documented routes and the public routes of Build, e.g., "GET /health"
+func RouteKey(method string, path string) string {
+	return method + " " + path
+}
+
+// Build describes registered routes as an OpenAPI document
+// Each route has its path parameters, and its query parameters and response data if it is in documented, keyed by
+// RouteKey. Responses are wrapped in the data and err fields of every response. Routes not in public require the
+// bearer token. HEAD routes, which fiber adds for each GET route, are left out.
+func Build(title string, version string, routes []fiber.Route, documented map[string]Route, public map[string]bool) *Document {
+	s := &schemas{components: make(map[string]*Schema)}
+	errorSchema := s.of(reflect.TypeOf(httpresponse.ResponseError{}))
+
+	document := &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version},
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			Schemas: s.components,
+			SecuritySchemes: map[string]SecurityScheme{
+				bearerAuth: {Type: "http", Scheme: "bearer"},
+			},
+		},
+	}
+
+	for _, route := range routes {
+		if route.Method == fiber.MethodHead {
+			continue
+		}
+
+		key := RouteKey(route.Method, route.Path)
+		doc := documented[key]
+
+		operation := &Operation{Summary: doc.Summary}
+		for _, param := range route.Params {
+			operation.Parameters = append(operation.Parameters, Parameter{
+				Name:     param,
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+		operation.Parameters = append(operation.Parameters, doc.Query...)
+
+		dataSchema := &Schema{}
+		if doc.Data != nil {
+			dataSchema = s.of(reflect.TypeOf(doc.Data))
+		}
+		operation.Responses = map[string]Response{
+			"200": {
+				Description: "Success",
+				Content: map[string]MediaType{
+					fiber.MIMEApplicationJSON: {Schema: envelope(dataSchema, errorSchema)},
+				},
+			},
+			"default": {
+				Description: "Error",
+				Content: map[string]MediaType{
+					fiber.MIMEApplicationJSON: {Schema: envelope(&Schema{Nullable: true}, errorSchema)},
+				},
+			},
+		}
+
+		if !public[key] {
+			operation.Security = []map[string][]string{{bearerAuth: {}}}
+		}
+
+		path := openAPIPath(route.Path)
+		if document.Paths[path] == nil {
+			document.Paths[path] = PathItem{}
+		}
+		document.Paths[path][strings.ToLower(route.Method)] = operation
+	}
+
+	return document
+}
+
+// envelope is the schema of a response container holding data of dataSchema
+func envelope(dataSchema *Schema, errorSchema *Schema) *Schema {
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"data": dataSchema,
+			"err":  errorSchema,
+		},
+	}
+}
+
+// openAPIPath converts the parameters of a fiber path to OpenAPI path templates, e.g., /titles/:number to
+// /titles/{number}
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + strings.TrimSuffix(strings.TrimPrefix(segment, ":"), "?") + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// RouteKeys returns the keys of routes, see RouteKey
+func RouteKeys(routes []fiber.Route) map[string]bool {
+	keys := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		keys[RouteKey(route.Method, route.Path)] = true
+	}
+	return keys
+}
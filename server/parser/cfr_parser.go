@@ -2,34 +2,100 @@ package parser
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"github.com/sam-berry/ecfr-analyzer/server/data"
+	"github.com/sam-berry/ecfr-analyzer/server/readability"
 	"io"
+	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+// ErrTitleMismatch is returned when the title DIV of a document declares a different title number than the parser's
+// It means the wrong file was fetched for the title
+var ErrTitleMismatch = errors.New("document is for a different title")
+
+// ErrSubtreeNotFound is returned by ParseSubtree when no DIV element matches the requested type and identifier
+var ErrSubtreeNotFound = errors.New("no matching DIV element")
+
 // XMLDiv represents a DIV element in the CFR XML structure
 type XMLDiv struct {
-	XMLName  xml.Name  `xml:""`
-	Type     string    `xml:"TYPE,attr"`
-	N        string    `xml:"N,attr"`
-	Node     string    `xml:"NODE,attr"`
-	Head     string    `xml:"HEAD"`
-	Content  string    `xml:",innerxml"`
-	Children []XMLDiv  `xml:",any"`
+	XMLName  xml.Name `xml:""`
+	Type     string   `xml:"TYPE,attr"`
+	N        string   `xml:"N,attr"`
+	Node     string   `xml:"NODE,attr"`
+	Head     string   `xml:"HEAD"`
+	Content  string   `xml:",innerxml"`
+	Children []XMLDiv `xml:",any"`
 }
 
 // CfrParser parses CFR XML documents into structured data
+// A parser is not safe for concurrent use, create one per document
 type CfrParser struct {
 	titleId     int
 	titleNumber int
+	options     ParserOptions
+
+	// recorders capture the inner XML of the sections being parsed, see ParserOptions.CaptureRawXML
+	recorders []*rawXMLRecorder
+
+	// vocabulary collects the distinct words of the text of the structures parsed, see ParseResult
+	vocabulary *readability.Vocabulary
+	// readability counts the sentences, words, and syllables of the same text
+	readability *readability.Counter
+}
+
+// ParserOptions configures what the parser extracts
+type ParserOptions struct {
+	// ExcludeNotes keeps authority citations, source notes and editorial notes out of the
+	// text content and word counts, storing them in the Notes field instead.
+	// The elements treated as notes are listed in noteElements.
+	ExcludeNotes bool
+
+	// CaptureRawXML stores the inner XML of each section in the RawXML field, for tooling that does its own
+	// analysis. Off by default, as it adds considerably to the size of the stored structure.
+	CaptureRawXML bool
+
+	// MaxTextBytes truncates the text content of a structure to at most this many bytes, setting TextTruncated,
+	// so a few outlier sections like giant tables do not dominate storage. Word counts are still computed from
+	// the full text. 0 is unlimited.
+	MaxTextBytes int
+}
+
+// DefaultParserOptions returns the options used by NewCfrParser
+// By default only substantive regulatory text is counted
+func DefaultParserOptions() ParserOptions {
+	return ParserOptions{
+		ExcludeNotes: true,
+	}
+}
+
+// noteElements are the elements holding non-substantive notes
+var noteElements = map[string]bool{
+	"AUTH":     true, // Authority citation, e.g., "Authority: 5 U.S.C. 301"
+	"SECAUTH":  true, // Section level authority citation
+	"SOURCE":   true, // Source note, e.g., "Source: 61 FR 1234, Jan. 1, 1996"
+	"CITA":     true, // Source citation at the end of a section
+	"EDNOTE":   true, // Editorial note
+	"EFFDNOT":  true, // Effective date note
+	"CROSSREF": true, // Cross reference note
+	"APPRO":    true, // Information collection approval note
 }
 
-// NewCfrParser creates a new CFR parser
+// NewCfrParser creates a new CFR parser with the default options
 func NewCfrParser(titleId int, titleNumber int) *CfrParser {
+	return NewCfrParserWithOptions(titleId, titleNumber, DefaultParserOptions())
+}
+
+// NewCfrParserWithOptions creates a new CFR parser with the given options
+func NewCfrParserWithOptions(titleId int, titleNumber int, options ParserOptions) *CfrParser {
 	return &CfrParser{
 		titleId:     titleId,
 		titleNumber: titleNumber,
+		options:     options,
 	}
 }
 
@@ -37,14 +103,127 @@ func NewCfrParser(titleId int, titleNumber int) *CfrParser {
 type ParseResult struct {
 	Structures []*data.CfrStructure
 	TotalWords int
+
+	// UniqueWordCount is the number of distinct words in the text counted by TotalWords, see readability.Vocabulary
+	UniqueWordCount int
+	// Vocabulary holds the distinct words counted by UniqueWordCount
+	Vocabulary *readability.Vocabulary
+	// Readability scores the text counted by TotalWords, see readability.Score
+	Readability readability.ReadabilityMetrics
+
+	// TruncatedStructures is the number of structures whose text was truncated, see ParserOptions.MaxTextBytes
+	TruncatedStructures int
+
+	// ZeroWordStructures is the number of sections without words that are not reserved, see IsZeroWordSection
+	// Many of them often mean the parser missed content, e.g., text in an element type it does not handle.
+	ZeroWordStructures int
+
+	// ReservedSections is the number of sections that are placeholders for removed provisions, see IsReservedSection
+	ReservedSections int
+
+	// TypeMismatches is the number of structures whose DIV TYPE is not the typical type of their level, see
+	// GetDivTypeForLevel. The eCFR ties each DIV level to a type, so mismatches mean a layout the parser may mishandle.
+	TypeMismatches int
+}
+
+// reservedMarker marks a removed provision kept as a placeholder, e.g., "§ 1.5 [Reserved]"
+const reservedMarker = "[reserved]"
+
+// IsReservedSection reports whether a structure is a section kept as a placeholder for a removed provision, whose
+// heading contains "[Reserved]" or whose only text is "[Reserved]"
+func IsReservedSection(structure *data.CfrStructure) bool {
+	if structure.DivType != data.DivTypeSection {
+		return false
+	}
+	if structure.Heading != nil && strings.Contains(strings.ToLower(*structure.Heading), reservedMarker) {
+		return true
+	}
+	return structure.TextContent != nil && strings.ToLower(strings.TrimSpace(*structure.TextContent)) == reservedMarker
+}
+
+// IsZeroWordSection reports whether a structure is a section without words that is not reserved
+// Other elements hold their text in their children, and reserved sections are empty by design.
+func IsZeroWordSection(structure *data.CfrStructure) bool {
+	if structure.DivType != data.DivTypeSection || structure.WordCount > 0 {
+		return false
+	}
+	return !IsReservedSection(structure)
+}
+
+// tagReservedSections sets IsReserved on the structures for which IsReservedSection is true and returns their number
+func tagReservedSections(structures []*data.CfrStructure) int {
+	count := 0
+	for _, structure := range structures {
+		structure.IsReserved = IsReservedSection(structure)
+		if structure.IsReserved {
+			count++
+		}
+	}
+	return count
+}
+
+// countTypeMismatches counts the structures whose type is not GetDivTypeForLevel of their level
+func countTypeMismatches(structures []*data.CfrStructure) int {
+	count := 0
+	for _, structure := range structures {
+		if structure.DivType != GetDivTypeForLevel(structure.DivLevel) {
+			count++
+		}
+	}
+	return count
+}
+
+// countZeroWordStructures counts the structures for which IsZeroWordSection is true
+func countZeroWordStructures(structures []*data.CfrStructure) int {
+	count := 0
+	for _, structure := range structures {
+		if IsZeroWordSection(structure) {
+			count++
+		}
+	}
+	return count
+}
+
+// countTruncatedStructures counts the structures whose text was truncated
+func countTruncatedStructures(structures []*data.CfrStructure) int {
+	count := 0
+	for _, structure := range structures {
+		if structure.TextTruncated {
+			count++
+		}
+	}
+	return count
+}
+
+// truncateText cuts text to at most maxBytes bytes without splitting a UTF-8 character, reporting whether it did
+// A maxBytes of 0 or less is unlimited.
+func truncateText(text string, maxBytes int) (string, bool) {
+	if maxBytes <= 0 || len(text) <= maxBytes {
+		return text, false
+	}
+
+	end := maxBytes
+	for end > 0 && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return text[:end], true
 }
 
 // Parse parses the CFR XML content and extracts the hierarchical structure
 func (p *CfrParser) Parse(xmlContent string) (*ParseResult, error) {
-	decoder := xml.NewDecoder(strings.NewReader(xmlContent))
+	return p.ParseReader(strings.NewReader(xmlContent))
+}
+
+// ParseReader parses the CFR XML content read from r, see Parse
+// r is read to its end unless parsing fails.
+func (p *CfrParser) ParseReader(r io.Reader) (*ParseResult, error) {
+	decoder := newXMLDecoder(r)
+	p.vocabulary = readability.NewVocabulary()
+	p.readability = &readability.Counter{}
 
 	var structures []*data.CfrStructure
 	var totalWords int
+	rootSegments := newSiblingSegments()
 
 	// Parse the XML document
 	for {
@@ -56,32 +235,244 @@ func (p *CfrParser) Parse(xmlContent string) (*ParseResult, error) {
 			return nil, fmt.Errorf("error parsing XML: %w", err)
 		}
 
+		if isIgnorableToken(token) {
+			continue
+		}
+
 		if startElement, ok := token.(xml.StartElement); ok {
 			// Check if this is a DIV element
-			if strings.HasPrefix(startElement.Name.Local, "DIV") && len(startElement.Name.Local) == 4 {
-				divLevel := int(startElement.Name.Local[3] - '0') // Extract number from DIV1-DIV9
+			if level, ok := parseDivLevel(startElement.Name); ok {
+				if err := p.checkTitleNumber(&startElement); err != nil {
+					return nil, err
+				}
 
 				// Parse this DIV element and its children
-				divStructures, words := p.parseDivElement(decoder, &startElement, divLevel, nil, "")
+				divType, identifier := divTypeAndIdentifier(&startElement)
+				divStructures, words := p.parseDivElement(
+					decoder, &startElement, level, nil, nil, rootSegments.next(divType, identifier),
+				)
 				structures = append(structures, divStructures...)
 				totalWords += words
 			}
 		}
 	}
 
+	assignSequenceIndexes(structures, 0)
+	tagAppendices(structures)
+
 	return &ParseResult{
-		Structures: structures,
-		TotalWords: totalWords,
+		Structures:          structures,
+		TotalWords:          totalWords,
+		UniqueWordCount:     p.vocabulary.Size(),
+		Vocabulary:          p.vocabulary,
+		Readability:         p.readability.Metrics(),
+		ZeroWordStructures:  countZeroWordStructures(structures),
+		TruncatedStructures: countTruncatedStructures(structures),
+		ReservedSections:    tagReservedSections(structures),
+		TypeMismatches:      countTypeMismatches(structures),
 	}, nil
 }
 
+// ParseSubtree parses only the DIV element with the given type and identifier (e.g., "PART", "60") and its descendants
+// Paths are the same as in a full parse, so the structures line up with those stored for the title.
+// Returns an error wrapping ErrSubtreeNotFound if no DIV element matches.
+func (p *CfrParser) ParseSubtree(xmlContent string, rootType string, rootIdentifier string) (*ParseResult, error) {
+	decoder := newXMLDecoder(strings.NewReader(xmlContent))
+	p.vocabulary = readability.NewVocabulary()
+	p.readability = &readability.Counter{}
+
+	// Path segments of the DIV elements enclosing the current position, used to build the root's path,
+	// and the segments assigned at each depth
+	var ancestors []string
+	siblings := []*siblingSegments{newSiblingSegments()}
+
+	// DIV elements before the root, so sequence indexes match a full parse
+	preceding := 0
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing XML: %w", err)
+		}
+
+		if endElement, ok := token.(xml.EndElement); ok {
+			if _, ok := parseDivLevel(endElement.Name); ok && len(ancestors) > 0 {
+				ancestors = ancestors[:len(ancestors)-1]
+				siblings = siblings[:len(siblings)-1]
+			}
+			continue
+		}
+
+		startElement, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		level, ok := parseDivLevel(startElement.Name)
+		if !ok {
+			continue
+		}
+
+		if err := p.checkTitleNumber(&startElement); err != nil {
+			return nil, err
+		}
+
+		// The root is matched by its identifier, or by the ordinal of its path segment, e.g., "#2", so a DIV without an
+		// N attribute can be selected too
+		divType, identifier := divTypeAndIdentifier(&startElement)
+		segment := siblings[len(siblings)-1].next(divType, identifier)
+		if divType != rootType || (identifier != rootIdentifier && segment != rootType+":"+rootIdentifier) {
+			ancestors = append(ancestors, segment)
+			siblings = append(siblings, newSiblingSegments())
+			preceding++
+			continue
+		}
+
+		structures, words := p.parseDivElement(decoder, &startElement, level, nil, ancestors, segment)
+		assignSequenceIndexes(structures, preceding)
+		tagAppendices(structures)
+		return &ParseResult{
+			Structures:          structures,
+			TotalWords:          words,
+			UniqueWordCount:     p.vocabulary.Size(),
+			Vocabulary:          p.vocabulary,
+			Readability:         p.readability.Metrics(),
+			ZeroWordStructures:  countZeroWordStructures(structures),
+			TruncatedStructures: countTruncatedStructures(structures),
+			ReservedSections:    tagReservedSections(structures),
+			TypeMismatches:      countTypeMismatches(structures),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s %s in title %d", ErrSubtreeNotFound, rootType, rootIdentifier, p.titleNumber)
+}
+
+// checkTitleNumber returns an error wrapping ErrTitleMismatch if a DIV element is a title that is not the parser's
+// Titles without a numeric N attribute, and parsers not given a title number, are not checked.
+func (p *CfrParser) checkTitleNumber(startElement *xml.StartElement) error {
+	divType, identifier := divTypeAndIdentifier(startElement)
+	if divType != "TITLE" || p.titleNumber <= 0 {
+		return nil
+	}
+
+	declared, err := strconv.Atoi(strings.TrimSpace(identifier))
+	if err != nil || declared == p.titleNumber {
+		return nil
+	}
+
+	return fmt.Errorf("%w: expected title %d, found title %d", ErrTitleMismatch, p.titleNumber, declared)
+}
+
+// divTypeAndIdentifier returns the TYPE and N attributes of a DIV element
+func divTypeAndIdentifier(startElement *xml.StartElement) (string, string) {
+	var divType string
+	var identifier string
+	for _, attr := range startElement.Attr {
+		switch attr.Name.Local {
+		case "TYPE":
+			divType = attr.Value
+		case "N":
+			identifier = attr.Value
+		}
+	}
+	return divType, identifier
+}
+
+// assignSequenceIndexes numbers structures from offset, parseDivElement returns them in document order
+func assignSequenceIndexes(structures []*data.CfrStructure, offset int) {
+	for i, structure := range structures {
+		structure.SequenceIndex = offset + i
+	}
+}
+
+// appendixPartPattern matches the part an appendix refers to, e.g., "Appendix A to Part 50"
+var appendixPartPattern = regexp.MustCompile(`(?i)\bto\s+part\s+(\d[\w.-]*)`)
+
+// tagAppendices tags the appendices among structures and links each to the part it belongs to
+// The part is taken from the identifier or heading, falling back to the enclosing part, since appendices
+// are sometimes nested under the wrong part. When neither is found the appendix is left without a part.
+func tagAppendices(structures []*data.CfrStructure) {
+	parts := make(map[string]string)
+	for _, structure := range structures {
+		if structure.DivType == data.DivTypePart {
+			parts[data.PathKey(structure.PathSegments)] = structure.Identifier
+		}
+	}
+
+	for _, structure := range structures {
+		if structure.DivType != data.DivTypeAppendix &&
+			!strings.HasPrefix(strings.ToLower(structure.Identifier), "appendix") {
+			continue
+		}
+
+		structure.IsAppendix = true
+
+		if part, ok := referencedPart(structure.Identifier); ok {
+			structure.AppendixPart = &part
+			continue
+		}
+
+		if structure.Heading != nil {
+			if part, ok := referencedPart(*structure.Heading); ok {
+				structure.AppendixPart = &part
+				continue
+			}
+		}
+
+		for segments := structure.ParentPathSegments(); len(segments) > 0; segments = segments[:len(segments)-1] {
+			if part, ok := parts[data.PathKey(segments)]; ok {
+				structure.AppendixPart = &part
+				break
+			}
+		}
+	}
+}
+
+// referencedPart returns the part identifier in text like "Appendix A to Part 50."
+func referencedPart(text string) (string, bool) {
+	match := appendixPartPattern.FindStringSubmatch(text)
+	if match == nil {
+		return "", false
+	}
+	return strings.TrimRight(match[1], ".-"), true
+}
+
+// siblingSegments assigns the path segments of the DIV elements under the same parent
+type siblingSegments struct {
+	ordinals map[string]int  // DIV elements seen of each type
+	used     map[string]bool // Segments assigned so far
+}
+
+func newSiblingSegments() *siblingSegments {
+	return &siblingSegments{ordinals: map[string]int{}, used: map[string]bool{}}
+}
+
+// next returns the path segment of the next DIV element under the parent, its type and escaped identifier, e.g.,
+// "PART:60". A DIV without an N attribute, or repeating the type and identifier of an earlier sibling, has its
+// ordinal among the siblings of its type appended, e.g., "APPENDIX:#2", so paths stay unique within a title.
+func (s *siblingSegments) next(divType string, identifier string) string {
+	s.ordinals[divType]++
+
+	segment := data.PathSegment(divType, identifier)
+	if identifier == "" || s.used[segment] {
+		segment += "#" + strconv.Itoa(s.ordinals[divType])
+	}
+
+	s.used[segment] = true
+	return segment
+}
+
 // parseDivElement recursively parses a DIV element and its children
 func (p *CfrParser) parseDivElement(
 	decoder *xml.Decoder,
 	startElement *xml.StartElement,
 	divLevel int,
 	parentId *int,
-	parentPath string,
+	parentSegments []string,
+	segment string,
 ) ([]*data.CfrStructure, int) {
 
 	// Extract attributes
@@ -100,25 +491,35 @@ func (p *CfrParser) parseDivElement(
 		}
 	}
 
-	// Build path
-	path := parentPath
-	if path != "" {
-		path += "/"
+	// Build path, copying the parent segments so siblings do not share a backing array
+	segments := make([]string, len(parentSegments), len(parentSegments)+1)
+	copy(segments, parentSegments)
+	segments = append(segments, segment)
+	children := newSiblingSegments()
+
+	var recorder *rawXMLRecorder
+	if p.options.CaptureRawXML && divType == data.DivTypeSection {
+		recorder = newRawXMLRecorder()
+		p.recorders = append(p.recorders, recorder)
 	}
-	path += identifier
 
 	// Parse the content of this element
 	var heading *string
 	var textContent strings.Builder
+	var notesContent strings.Builder
 	var childStructures []*data.CfrStructure
 	var inHead bool
 
 	for {
-		token, err := decoder.Token()
+		token, err := p.nextToken(decoder)
 		if err != nil {
 			break
 		}
 
+		if isIgnorableToken(token) {
+			continue
+		}
+
 		// Check for end of this DIV element
 		if endElement, ok := token.(xml.EndElement); ok {
 			if endElement.Name.Local == startElement.Name.Local {
@@ -133,7 +534,7 @@ func (p *CfrParser) parseDivElement(
 				// Read the HEAD content
 				headText := ""
 				for {
-					headToken, err := decoder.Token()
+					headToken, err := p.nextToken(decoder)
 					if err != nil {
 						break
 					}
@@ -141,29 +542,33 @@ func (p *CfrParser) parseDivElement(
 						break
 					}
 					if charData, ok := headToken.(xml.CharData); ok {
-						headText += string(charData)
+						headText += charDataText(charData)
 					}
 				}
-				headText = strings.TrimSpace(headText)
+				headText = normalizeText(headText)
 				heading = &headText
 				inHead = false
-			} else if strings.HasPrefix(childStart.Name.Local, "DIV") && len(childStart.Name.Local) == 4 {
+			} else if childDivLevel, ok := parseDivLevel(childStart.Name); ok {
 				// This is a child DIV element
-				childDivLevel := int(childStart.Name.Local[3] - '0')
-
 				// We'll need to assign parent_id after we create the current structure
 				// For now, parse with nil parent and we'll update it later
-				childDivs, _ := p.parseDivElement(decoder, &childStart, childDivLevel, nil, path)
+				childType, childIdentifier := divTypeAndIdentifier(&childStart)
+				childDivs, _ := p.parseDivElement(
+					decoder, &childStart, childDivLevel, nil, segments, children.next(childType, childIdentifier),
+				)
 				childStructures = append(childStructures, childDivs...)
+			} else if p.isExcludedNote(childStart.Name) {
+				// Notes are kept separately from the substantive text
+				p.extractTextContent(decoder, &childStart, &notesContent, &notesContent)
 			} else {
 				// Other elements - extract text content
-				p.extractTextContent(decoder, &childStart, &textContent)
+				p.extractTextContent(decoder, &childStart, &textContent, &notesContent)
 			}
 		}
 
 		// Handle character data
 		if charData, ok := token.(xml.CharData); ok && !inHead {
-			text := strings.TrimSpace(string(charData))
+			text := strings.TrimSpace(charDataText(charData))
 			if text != "" {
 				textContent.WriteString(text)
 				textContent.WriteString(" ")
@@ -171,15 +576,30 @@ func (p *CfrParser) parseDivElement(
 		}
 	}
 
+	var rawXML *string
+	if recorder != nil {
+		p.recorders = p.recorders[:len(p.recorders)-1]
+		rawXML = recorder.innerXML()
+	}
+
 	// Build the structure object
-	text := strings.TrimSpace(textContent.String())
-	wordCount := countWords(text)
+	text := normalizeText(textContent.String())
+	wordCount := CountWords(text)
+	p.vocabulary.Add(text)
+	p.readability.Add(text)
+
+	text, truncated := truncateText(text, p.options.MaxTextBytes)
 
 	var textPtr *string
 	if text != "" {
 		textPtr = &text
 	}
 
+	var notesPtr *string
+	if notes := normalizeText(notesContent.String()); notes != "" {
+		notesPtr = &notes
+	}
+
 	structure := &data.CfrStructure{
 		TitleId:     p.titleId,
 		TitleNumber: p.titleNumber,
@@ -189,9 +609,14 @@ func (p *CfrParser) parseDivElement(
 		NodeId:      nodeId,
 		Heading:     heading,
 		TextContent: textPtr,
+		Notes:       notesPtr,
 		WordCount:   wordCount,
 		ParentId:    parentId,
-		Path:        path,
+		Path:        data.JoinPath(segments),
+		RawXML:      rawXML,
+
+		TextTruncated: truncated,
+		PathSegments:  segments,
 	}
 
 	// Combine current structure with children
@@ -214,13 +639,15 @@ func (p *CfrParser) parseDivElement(
 }
 
 // extractTextContent recursively extracts text content from an element
+// Nested note elements are written to notesContent when notes are excluded
 func (p *CfrParser) extractTextContent(
 	decoder *xml.Decoder,
 	startElement *xml.StartElement,
 	textContent *strings.Builder,
+	notesContent *strings.Builder,
 ) {
 	for {
-		token, err := decoder.Token()
+		token, err := p.nextToken(decoder)
 		if err != nil {
 			break
 		}
@@ -232,11 +659,15 @@ func (p *CfrParser) extractTextContent(
 		}
 
 		if childStart, ok := token.(xml.StartElement); ok {
-			p.extractTextContent(decoder, &childStart, textContent)
+			if p.isExcludedNote(childStart.Name) {
+				p.extractTextContent(decoder, &childStart, notesContent, notesContent)
+			} else {
+				p.extractTextContent(decoder, &childStart, textContent, notesContent)
+			}
 		}
 
 		if charData, ok := token.(xml.CharData); ok {
-			text := strings.TrimSpace(string(charData))
+			text := strings.TrimSpace(charDataText(charData))
 			if text != "" {
 				textContent.WriteString(text)
 				textContent.WriteString(" ")
@@ -245,16 +676,70 @@ func (p *CfrParser) extractTextContent(
 	}
 }
 
-// countWords counts the number of words in a text string
-func countWords(text string) int {
-	if text == "" {
-		return 0
+// isExcludedNote reports whether an element is a note that should be kept out of the text content
+func (p *CfrParser) isExcludedNote(name xml.Name) bool {
+	return p.options.ExcludeNotes && noteElements[name.Local]
+}
+
+// normalizeText collapses runs of whitespace, removes the spaces left before closing
+// punctuation and after opening brackets when text chunks are joined, and trims the result
+// e.g., "word , ( a ) word ." -> "word, (a) word."
+func normalizeText(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return ""
 	}
 
-	words := strings.Fields(text)
-	return len(words)
+	var b strings.Builder
+	b.Grow(len(text))
+	for i, field := range fields {
+		if i > 0 && !isClosingPunctuation(field) && !endsWithOpeningBracket(fields[i-1]) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(field)
+	}
+
+	return b.String()
+}
+
+// isClosingPunctuation reports whether a token consists only of punctuation that attaches to the preceding word
+func isClosingPunctuation(token string) bool {
+	return strings.Trim(token, ".,;:!?)]") == ""
+}
+
+func endsWithOpeningBracket(token string) bool {
+	return strings.HasSuffix(token, "(") || strings.HasSuffix(token, "[")
+}
+
+// CountWords counts the number of words in a text string
+// Words are separated the same way as strings.Fields, but counted without allocating a slice of them
+func CountWords(text string) int {
+	count := 0
+	inWord := false
+	for i := 0; i < len(text); {
+		var space bool
+		if c := text[i]; c < utf8.RuneSelf {
+			space = asciiSpace[c]
+			i++
+		} else {
+			r, size := utf8.DecodeRuneInString(text[i:])
+			space = unicode.IsSpace(r)
+			i += size
+		}
+
+		if space {
+			inWord = false
+		} else if !inWord {
+			count++
+			inWord = true
+		}
+	}
+	return count
 }
 
+// asciiSpace marks the ASCII bytes unicode.IsSpace reports as space
+var asciiSpace = [utf8.RuneSelf]bool{'\t': true, '\n': true, '\v': true, '\f': true, '\r': true, ' ': true}
+
 // GetDivTypeForLevel returns the typical DIV type for a given level
 // Note: This is based on common CFR structure, but actual TYPE attributes should be used
 func GetDivTypeForLevel(level int) string {
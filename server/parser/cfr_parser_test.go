@@ -0,0 +1,264 @@
+package parser
+
+import (
+	"github.com/sam-berry/ecfr-analyzer/server/data"
+	"strings"
+	"testing"
+)
+
+const pathsXML = `<DIV1 N="40" TYPE="TITLE"><HEAD>Title 40</HEAD>
+<DIV5 N="60" TYPE="PART"><HEAD>PART 60</HEAD>
+<DIV8 N="60.1" TYPE="SECTION"><HEAD>§ 60.1 Applicability.</HEAD><P>Applies to sources.</P></DIV8>
+<DIV8 N="60.1" TYPE="SECTION"><HEAD>§ 60.1 Applicability.</HEAD><P>Repeated number.</P></DIV8>
+<DIV8 N="60.2/60.3" TYPE="SECTION"><HEAD>§ 60.2/60.3 Definitions.</HEAD><P>Terms used.</P></DIV8>
+<DIV9 TYPE="APPENDIX"><HEAD>Appendix to Part 60</HEAD><P>First appendix.</P></DIV9>
+<DIV9 TYPE="APPENDIX"><HEAD>Appendix to Part 60</HEAD><P>Second appendix.</P></DIV9>
+</DIV5>
+<DIV5 N="60.2" TYPE="PART"><HEAD>PART 60.2</HEAD>
+<DIV8 N="60.3" TYPE="SECTION"><HEAD>§ 60.3 Scope.</HEAD><P>Scope.</P></DIV8>
+</DIV5>
+</DIV1>`
+
+func TestParsePathsWithoutIdentifiers(t *testing.T) {
+	result, err := NewCfrParser(1, 40).Parse(pathsXML)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	expected := []string{
+		"TITLE:40",
+		"TITLE:40/PART:60",
+		"TITLE:40/PART:60/SECTION:60.1",
+		"TITLE:40/PART:60/SECTION:60.1#2",
+		"TITLE:40/PART:60/SECTION:60.2%2F60.3",
+		"TITLE:40/PART:60/APPENDIX:#1",
+		"TITLE:40/PART:60/APPENDIX:#2",
+		"TITLE:40/PART:60.2",
+		"TITLE:40/PART:60.2/SECTION:60.3",
+	}
+
+	if len(result.Structures) != len(expected) {
+		t.Fatalf("got %d structures, want %d", len(result.Structures), len(expected))
+	}
+
+	byKey := make(map[string]*data.CfrStructure)
+	for i, structure := range result.Structures {
+		if structure.Path != expected[i] {
+			t.Errorf("structure %d: path %q, want %q", i, structure.Path, expected[i])
+		}
+		byKey[data.PathKey(structure.PathSegments)] = structure
+	}
+
+	for _, structure := range result.Structures {
+		parentSegments := structure.ParentPathSegments()
+		if len(parentSegments) == 0 {
+			continue
+		}
+
+		parent, ok := byKey[data.PathKey(parentSegments)]
+		if !ok {
+			t.Errorf("%s: no parent", structure.Path)
+			continue
+		}
+		if !strings.HasPrefix(structure.Path, parent.Path+"/") {
+			t.Errorf("%s: path does not start with its parent's path %s", structure.Path, parent.Path)
+		}
+	}
+}
+
+func TestParseSubtreeSelectsDivWithoutIdentifier(t *testing.T) {
+	result, err := NewCfrParser(1, 40).ParseSubtree(pathsXML, data.DivTypeAppendix, "#2")
+	if err != nil {
+		t.Fatalf("ParseSubtree: %v", err)
+	}
+
+	if len(result.Structures) != 1 {
+		t.Fatalf("got %d structures, want 1", len(result.Structures))
+	}
+	if path := result.Structures[0].Path; path != "TITLE:40/PART:60/APPENDIX:#2" {
+		t.Errorf("path %q, want the second appendix", path)
+	}
+	if text := *result.Structures[0].TextContent; !strings.Contains(text, "Second appendix") {
+		t.Errorf("text %q, want the second appendix", text)
+	}
+}
+
+func TestParseEntitiesAndCDATA(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		text  string
+		words int
+	}{
+		{
+			name:  "numeric entities",
+			body:  `<P>See &#167;&#160;60.2 &#x2014; and 40&#xA0;CFR part&#x00A0;60.</P>`,
+			text:  "See § 60.2 — and 40 CFR part 60.",
+			words: 9,
+		},
+		{
+			name:  "named entities",
+			body:  `<P>Owners &amp; operators &mdash; &ldquo;affected facilities&rdquo; &lt;25&nbsp;MW.</P>`,
+			text:  "Owners & operators — “affected facilities” <25 MW.",
+			words: 8,
+		},
+		{
+			name:  "double encoded entities",
+			body:  `<P>Under &amp;#167; 60.3 &amp;#38; 60.4 &amp;#x2014; 60.5.</P>`,
+			text:  "Under § 60.3 & 60.4 — 60.5.",
+			words: 7,
+		},
+		{
+			name:  "CDATA",
+			body:  `<P><![CDATA[Emissions <= 10 ppm & opacity]]> limits apply.</P>`,
+			text:  "Emissions <= 10 ppm & opacity limits apply.",
+			words: 8,
+		},
+		{
+			name:  "CDATA between elements",
+			body:  `<P>Table:</P><![CDATA[Column A & Column B]]><P><E T="03">Note</E><![CDATA[ text]]></P>`,
+			text:  "Table: Column A & Column B Note text",
+			words: 8,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xmlContent := `<DIV8 N="60.1" TYPE="SECTION"><HEAD>&#167; 60.1 Applicability.</HEAD>` + tt.body + `</DIV8>`
+			result, err := NewCfrParser(1, 40).Parse(xmlContent)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			section := result.Structures[0]
+			if section.TextContent == nil || *section.TextContent != tt.text {
+				t.Errorf("text %v, want %q", section.TextContent, tt.text)
+			}
+			if strings.Contains(*section.TextContent, "&amp;") || strings.Contains(*section.TextContent, "&#") {
+				t.Errorf("text %q has entity literals", *section.TextContent)
+			}
+			if section.WordCount != tt.words {
+				t.Errorf("word count %d, want %d", section.WordCount, tt.words)
+			}
+			if section.Heading == nil || *section.Heading != "§ 60.1 Applicability." {
+				t.Errorf("heading %v, want the decoded section sign", section.Heading)
+			}
+		})
+	}
+}
+
+func TestParseKeepsEscapedAmpersands(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		text string
+	}{
+		{
+			name: "escaped entity",
+			body: `<P>Write &amp;lt; for less than.</P>`,
+			text: "Write &lt; for less than.",
+		},
+		{
+			name: "double escaped entity",
+			body: `<P>Under 60.3 &amp;amp; 60.4.</P>`,
+			text: "Under 60.3 &amp; 60.4.",
+		},
+		{
+			name: "names without a semicolon",
+			body: `<P>Marks &amp;para and &amp;copy are kept.</P>`,
+			text: "Marks &para and &copy are kept.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xmlContent := `<DIV8 N="60.1" TYPE="SECTION"><HEAD>&#167; 60.1 Applicability.</HEAD>` + tt.body + `</DIV8>`
+			result, err := NewCfrParser(1, 40).Parse(xmlContent)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			section := result.Structures[0]
+			if section.TextContent == nil || *section.TextContent != tt.text {
+				t.Errorf("text %v, want %q", section.TextContent, tt.text)
+			}
+		})
+	}
+}
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", ""},
+		{"   \n\t ", ""},
+		{"  word  ", "word"},
+		{"word\n\n  word\tword", "word word word"},
+		{"word . word", "word. word"},
+		{"word , ( a ) word .", "word, (a) word."},
+		{"see [ Reserved ] ;", "see [Reserved];"},
+		{"the ( a ) ( 1 ) , and", "the (a) (1), and"},
+		{"end ?! next : item", "end?! next: item"},
+		{"footnote ) . ]", "footnote).]"},
+		{"§ 60.1 , 60.2 ; and 60.3", "§ 60.1, 60.2; and 60.3"},
+		{"( word", "(word"},
+		{"don't - split", "don't - split"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeText(tt.text); got != tt.want {
+			t.Errorf("normalizeText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseNormalizesSpacingAroundElements(t *testing.T) {
+	xmlContent := `<DIV8 N="60.1" TYPE="SECTION"><HEAD>§ 60.1   Applicability .</HEAD>
+<P>(<E T="03">a</E>) The owner of any <E T="03">affected facility</E>, as defined in <E T="04">§ 60.2</E>.</P>
+<P>  Each   source
+	[<E T="03">see</E> paragraph (b)] ;  </P></DIV8>`
+
+	result, err := NewCfrParser(1, 40).Parse(xmlContent)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	section := result.Structures[0]
+	wantText := "(a) The owner of any affected facility, as defined in § 60.2. Each source [see paragraph (b)];"
+	if section.TextContent == nil || *section.TextContent != wantText {
+		t.Errorf("text %v, want %q", section.TextContent, wantText)
+	}
+	if section.Heading == nil || *section.Heading != "§ 60.1 Applicability." {
+		t.Errorf("heading %v, want normalized spacing", section.Heading)
+	}
+	if wantWords := CountWords(wantText); section.WordCount != wantWords {
+		t.Errorf("word count %d, want %d counted after normalization", section.WordCount, wantWords)
+	}
+}
+
+var countWordsText = strings.Repeat("(a) The owner or operator of any affected facility shall comply with § 60.2 and\tthe\n", 200)
+
+func TestCountWordsMatchesFields(t *testing.T) {
+	for _, text := range []string{"", "  ", "one", " one  two\tthree\n", "a b c", "§ 60.1—scope", countWordsText} {
+		if got, want := CountWords(text), len(strings.Fields(text)); got != want {
+			t.Errorf("CountWords(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
+
+// BenchmarkCountWords compares CountWords with counting strings.Fields, which allocates a slice of every word
+func BenchmarkCountWords(b *testing.B) {
+	b.Run("CountWords", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			CountWords(countWordsText)
+		}
+	})
+	b.Run("Fields", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = len(strings.Fields(countWordsText))
+		}
+	})
+}
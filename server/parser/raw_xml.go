@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/xml"
+)
+
+// rawXMLRecorder re-serializes the tokens inside an element to capture its inner XML
+// Entities are decoded by the decoder and re-escaped where needed, and empty elements are written with an end tag,
+// so the XML is equivalent to the original rather than byte for byte identical
+type rawXMLRecorder struct {
+	buf     bytes.Buffer
+	encoder *xml.Encoder
+	depth   int
+	err     error
+}
+
+func newRawXMLRecorder() *rawXMLRecorder {
+	r := &rawXMLRecorder{}
+	r.encoder = xml.NewEncoder(&r.buf)
+	return r
+}
+
+// record writes a token read inside the element, the end of the element itself is not written
+func (r *rawXMLRecorder) record(token xml.Token) {
+	if r.err != nil {
+		return
+	}
+
+	switch t := token.(type) {
+	case xml.StartElement:
+		r.depth++
+	case xml.EndElement:
+		if r.depth == 0 {
+			return
+		}
+		r.depth--
+	case xml.ProcInst:
+		// The encoder rejects an xml declaration after the start of the document
+		if t.Target == "xml" {
+			return
+		}
+	}
+
+	r.err = r.encoder.EncodeToken(token)
+}
+
+// innerXML returns the captured XML, or nil if a token could not be written or there was none
+func (r *rawXMLRecorder) innerXML() *string {
+	if r.err != nil {
+		return nil
+	}
+	if err := r.encoder.Flush(); err != nil || r.buf.Len() == 0 {
+		return nil
+	}
+
+	innerXML := r.buf.String()
+	return &innerXML
+}
+
+// nextToken reads the next token, recording it for the elements whose inner XML is being captured
+func (p *CfrParser) nextToken(decoder *xml.Decoder) (xml.Token, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, recorder := range p.recorders {
+		recorder.record(token)
+	}
+
+	return token, nil
+}
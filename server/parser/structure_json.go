@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/sam-berry/ecfr-analyzer/server/data"
+	"github.com/sam-berry/ecfr-analyzer/server/ecfrdata"
+	"strconv"
+	"strings"
+)
+
+// structureNodeDiv is the div type and level of an eCFR structure JSON node type
+type structureNodeDiv struct {
+	divType  string
+	divLevel int
+}
+
+// structureNodeDivs maps the node types of the eCFR structure JSON to the DIV elements of the title XML
+var structureNodeDivs = map[string]structureNodeDiv{
+	"title":         {data.DivTypeTitle, 1},
+	"subtitle":      {data.DivTypeSubtitle, 2},
+	"chapter":       {data.DivTypeChapter, 3},
+	"subchapter":    {data.DivTypeSubchap, 4},
+	"part":          {data.DivTypePart, 5},
+	"subpart":       {data.DivTypeSubpart, 6},
+	"subject_group": {data.DivTypeSubjgrp, 7},
+	"section":       {data.DivTypeSection, 8},
+	"appendix":      {data.DivTypeAppendix, 9},
+}
+
+// ParseStructureJSON converts the eCFR structure JSON of a title into structure elements, in document order
+// The JSON has the hierarchy and headings but no text, so text is empty and word counts are 0. Paths are built as
+// by Parse, but identifiers may differ from the N attributes of the XML for some elements, e.g., subject groups.
+// Nodes of unknown types are left out, with their children in their place. Returns an error wrapping
+// ErrTitleMismatch if the root is a title other than the parser's.
+func ParseStructureJSON(titleId int, titleNumber int, root *ecfrdata.StructureNode) (*ParseResult, error) {
+	if root.Type == "title" && titleNumber > 0 {
+		declared, err := strconv.Atoi(strings.TrimSpace(root.Identifier))
+		if err == nil && declared != titleNumber {
+			return nil, fmt.Errorf("%w: expected title %d, found title %d", ErrTitleMismatch, titleNumber, declared)
+		}
+	}
+
+	var structures []*data.CfrStructure
+	var add func(node *ecfrdata.StructureNode, parentSegments []string, siblings *siblingSegments)
+	add = func(node *ecfrdata.StructureNode, parentSegments []string, siblings *siblingSegments) {
+		div, ok := structureNodeDivs[node.Type]
+		if !ok {
+			for _, child := range node.Children {
+				add(child, parentSegments, siblings)
+			}
+			return
+		}
+
+		segment := siblings.next(div.divType, node.Identifier)
+		segments := append(append([]string{}, parentSegments...), segment)
+
+		var heading *string
+		if label := strings.TrimSpace(node.Label); label != "" {
+			heading = &label
+		}
+
+		structures = append(structures, &data.CfrStructure{
+			TitleId:      titleId,
+			TitleNumber:  titleNumber,
+			DivType:      div.divType,
+			DivLevel:     div.divLevel,
+			Identifier:   node.Identifier,
+			Heading:      heading,
+			Path:         data.JoinPath(segments),
+			PathSegments: segments,
+		})
+
+		children := newSiblingSegments()
+		for _, child := range node.Children {
+			add(child, segments, children)
+		}
+	}
+	add(root, nil, newSiblingSegments())
+
+	assignSequenceIndexes(structures, 0)
+	tagAppendices(structures)
+
+	return &ParseResult{Structures: structures, ReservedSections: tagReservedSections(structures)}, nil
+}
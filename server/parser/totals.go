@@ -0,0 +1,145 @@
+package parser
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/sam-berry/ecfr-analyzer/server/data"
+	"io"
+	"strings"
+)
+
+// Totals are the word and section totals of a title document, see CountTotals
+type Totals struct {
+	Words    int
+	Sections int
+}
+
+// CountTotals counts the words and sections of the CFR XML content read from r, giving the same
+// TotalWords and section count as ParseReader without building any structures or keeping any text,
+// so a full title is counted while it streams past.
+// Returns an error wrapping ErrTitleMismatch if the document is for another title.
+func (p *CfrParser) CountTotals(r io.Reader) (*Totals, error) {
+	decoder := newXMLDecoder(r)
+	totals := &Totals{}
+
+	// The open elements, mirroring how ParseReader, parseDivElement and extractTextContent recurse
+	var stack []*countFrame
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing XML: %w", err)
+		}
+
+		var parent *countFrame
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1]
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			frame, err := p.startCountFrame(parent, &t)
+			if err != nil {
+				return nil, err
+			}
+			if frame.kind == countFrameDiv && frame.divType == data.DivTypeSection {
+				totals.Sections++
+			}
+			stack = append(stack, frame)
+		case xml.EndElement:
+			if parent == nil {
+				continue
+			}
+			stack = stack[:len(stack)-1]
+			if parent.kind == countFrameDiv {
+				totals.Words += parent.words.count
+			}
+		case xml.CharData:
+			if parent == nil || (parent.kind != countFrameDiv && parent.kind != countFrameText) {
+				continue
+			}
+			parent.words.add(strings.TrimSpace(charDataText(t)))
+		}
+	}
+
+	return totals, nil
+}
+
+type countFrameKind int
+
+const (
+	// countFrameOutside is an element outside any DIV, its text is not counted
+	countFrameOutside countFrameKind = iota
+	// countFrameDiv is a DIV parsed as a structure
+	countFrameDiv
+	// countFrameText is an element whose text belongs to the enclosing DIV
+	countFrameText
+	// countFrameSkipped is a HEAD or note element, or any element inside one, whose text is not counted
+	countFrameSkipped
+)
+
+// countFrame is an open element while counting totals
+type countFrame struct {
+	kind    countFrameKind
+	divType string
+	// words counts the text of the enclosing DIV, shared by the DIV and its text elements
+	words *wordCounter
+}
+
+// startCountFrame returns the frame of an element opened inside parent, which is nil at the document root
+func (p *CfrParser) startCountFrame(parent *countFrame, startElement *xml.StartElement) (*countFrame, error) {
+	parentKind := countFrameOutside
+	if parent != nil {
+		parentKind = parent.kind
+	}
+
+	switch parentKind {
+	case countFrameOutside:
+		if _, ok := parseDivLevel(startElement.Name); !ok {
+			return &countFrame{kind: countFrameOutside}, nil
+		}
+		if err := p.checkTitleNumber(startElement); err != nil {
+			return nil, err
+		}
+	case countFrameDiv:
+		if startElement.Name.Local == "HEAD" || p.isExcludedNote(startElement.Name) {
+			return &countFrame{kind: countFrameSkipped}, nil
+		}
+		if _, ok := parseDivLevel(startElement.Name); !ok {
+			return &countFrame{kind: countFrameText, words: parent.words}, nil
+		}
+	case countFrameText:
+		// DIVs nested in text elements are text, as in extractTextContent
+		if p.isExcludedNote(startElement.Name) {
+			return &countFrame{kind: countFrameSkipped}, nil
+		}
+		return &countFrame{kind: countFrameText, words: parent.words}, nil
+	default:
+		return &countFrame{kind: countFrameSkipped}, nil
+	}
+
+	divType, _ := divTypeAndIdentifier(startElement)
+	return &countFrame{kind: countFrameDiv, divType: divType, words: &wordCounter{}}, nil
+}
+
+// wordCounter counts the words of text chunks as CountWords(normalizeText(...)) counts their joined text
+// Tokens that normalizeText attaches to the preceding token are not counted as words.
+type wordCounter struct {
+	count   int
+	started bool
+	// attachNext is set when the last token ends with an opening bracket
+	attachNext bool
+}
+
+func (w *wordCounter) add(chunk string) {
+	for _, field := range strings.Fields(chunk) {
+		if !w.started || (!isClosingPunctuation(field) && !w.attachNext) {
+			w.count++
+		}
+		w.started = true
+		w.attachNext = endsWithOpeningBracket(field)
+	}
+}
@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const totalsXML = `<?xml version="1.0" encoding="UTF-8"?>
+<ECFR><VOLUME>
+<DIV1 N="40" TYPE="TITLE"><HEAD>Title 40&#8212;Protection of Environment</HEAD>
+<DIV5 N="60" TYPE="PART"><HEAD>PART 60</HEAD>
+<AUTH><HED>Authority:</HED><PSPACE>42 U.S.C. 7401.</PSPACE></AUTH>
+<DIV8 N="60.1" TYPE="SECTION"><HEAD>§ 60.1 Applicability.</HEAD>
+<P>(a) The provisions of this part apply to <E T="03">owners</E> , operators ( see <E T="04">§ 60.2</E> ) [ and others ] .</P>
+<P><![CDATA[Text & more text]]> &amp;#167; 60.3</P>
+<CITA>[36 FR 24877, Dec. 23, 1971]</CITA>
+</DIV8>
+Loose text in the part.
+<DIV8 N="60.2" TYPE="SECTION"><HEAD>§ 60.2 [Reserved]</HEAD></DIV8>
+<DIV9 TYPE="APPENDIX"><HEAD>Appendix A</HEAD><P>Method <SU>1</SU> , test.</P><EDNOTE><P>Editorial note.</P></EDNOTE></DIV9>
+</DIV5>
+</DIV1>
+</VOLUME></ECFR>`
+
+func TestCountTotalsMatchesParse(t *testing.T) {
+	result, err := NewCfrParser(1, 40).Parse(totalsXML)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	sections := 0
+	for _, structure := range result.Structures {
+		if structure.DivType == "SECTION" {
+			sections++
+		}
+	}
+
+	totals, err := NewCfrParser(1, 40).CountTotals(strings.NewReader(totalsXML))
+	if err != nil {
+		t.Fatalf("CountTotals: %v", err)
+	}
+
+	if totals.Words != result.TotalWords {
+		t.Errorf("expected %d words, got %d", result.TotalWords, totals.Words)
+	}
+	if totals.Sections != sections {
+		t.Errorf("expected %d sections, got %d", sections, totals.Sections)
+	}
+	if totals.Words == 0 || totals.Sections != 2 {
+		t.Errorf("unexpected totals %+v", totals)
+	}
+}
+
+func TestCountTotalsTitleMismatch(t *testing.T) {
+	_, err := NewCfrParser(1, 41).CountTotals(strings.NewReader(totalsXML))
+	if !errors.Is(err, ErrTitleMismatch) {
+		t.Fatalf("expected a title mismatch error, got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// newXMLDecoder creates a decoder configured for the govinfo eCFR bulk files.
+// The files ship with an XML declaration that may name a non UTF-8 charset,
+// a DOCTYPE referencing the eCFR DTD, and HTML style entities that the DTD
+// would normally define. None of those should stop the token loop.
+func newXMLDecoder(r io.Reader) *xml.Decoder {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charsetReader
+	decoder.Entity = xml.HTMLEntity
+	return decoder
+}
+
+// charsetReader converts the declared document charset to UTF-8
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "iso8859-1", "latin1", "latin-1", "windows-1252", "cp1252":
+		// windows-1252 only differs from latin1 in the 0x80-0x9F range, which
+		// does not appear in the eCFR text content
+		return &latin1Reader{r: bufio.NewReader(input)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported XML charset: %v", charset)
+	}
+}
+
+// latin1Reader decodes single byte ISO-8859-1 input into UTF-8
+type latin1Reader struct {
+	r       *bufio.Reader
+	pending []byte
+}
+
+func (l *latin1Reader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(l.pending) > 0 {
+			c := copy(p[n:], l.pending)
+			l.pending = l.pending[c:]
+			n += c
+			continue
+		}
+
+		b, err := l.r.ReadByte()
+		if err != nil {
+			if n > 0 && err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+
+		if b < utf8.RuneSelf {
+			p[n] = b
+			n++
+			continue
+		}
+
+		var buf [utf8.UTFMax]byte
+		size := utf8.EncodeRune(buf[:], rune(b))
+		l.pending = append(l.pending[:0], buf[:size]...)
+	}
+	return n, nil
+}
+
+// parseDivLevel returns the level of a DIV1-DIV9 element, ignoring any namespace prefix
+func parseDivLevel(name xml.Name) (int, bool) {
+	local := name.Local
+	if len(local) != 4 || !strings.HasPrefix(local, "DIV") {
+		return 0, false
+	}
+	if local[3] < '1' || local[3] > '9' {
+		return 0, false
+	}
+	return int(local[3] - '0'), true
+}
+
+// doubleEncodedEntity matches the numeric character references left by double encoded content, e.g., "&#167;"
+var doubleEncodedEntity = regexp.MustCompile(`&#(?:[0-9]+|[xX][0-9a-fA-F]+);`)
+
+// charDataText returns the text of a character data token
+// CDATA sections arrive as CharData and XML entities are already decoded by the decoder.
+// Some feed content is double encoded (e.g., "&amp;#167;"), which leaves numeric character
+// references in the decoded text, so those are decoded as well. Other ampersands are text,
+// e.g., an escaped "&amp;lt;" stays "&lt;" and "&para" stays as it is.
+func charDataText(charData xml.CharData) string {
+	text := string(charData)
+	if strings.Contains(text, "&#") {
+		text = doubleEncodedEntity.ReplaceAllStringFunc(text, html.UnescapeString)
+	}
+	return text
+}
+
+// isIgnorableToken reports whether a token carries no document content.
+// Processing instructions, DOCTYPE directives and comments are skipped explicitly.
+func isIgnorableToken(token xml.Token) bool {
+	switch token.(type) {
+	case xml.ProcInst, xml.Directive, xml.Comment:
+		return true
+	default:
+		return false
+	}
+}
+
+// ErrInvalidTitleXML is returned by ValidateTitleXML for content that is not a CFR title document
+var ErrInvalidTitleXML = errors.New("invalid title XML")
+
+// ValidateTitleXML reads r to the end and checks that it is well-formed XML with at least one DIV element
+// The content is not parsed into structures, so r can be as large as a full title.
+// Returns an error wrapping ErrTitleMismatch if the title DIV declares a title other than titleNumber, which is not
+// checked if titleNumber is 0.
+func ValidateTitleXML(r io.Reader, titleNumber int) error {
+	decoder := newXMLDecoder(r)
+	titleChecker := &CfrParser{titleNumber: titleNumber}
+	divs := 0
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTitleXML, err)
+		}
+
+		if startElement, ok := token.(xml.StartElement); ok {
+			if _, ok := parseDivLevel(startElement.Name); ok {
+				if err := titleChecker.checkTitleNumber(&startElement); err != nil {
+					return err
+				}
+				divs++
+			}
+		}
+	}
+
+	if divs == 0 {
+		return fmt.Errorf("%w: no DIV elements", ErrInvalidTitleXML)
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// The eCFR and annual edition headers below are those of the govinfo bulk data files, each followed by a small title body
+
+const ecfrBulkHeader = `<?xml version="1.0" encoding="UTF-8" ?>
+<DLPSTEXTCLASS>
+<HEADER>
+<FILEDESC>
+<TITLESTMT>
+<TITLE>Title 40: Protection of Environment</TITLE>
+<AUTHOR TYPE="nameinv"></AUTHOR>
+</TITLESTMT>
+<PUBLICATIONSTMT>
+<PUBLISHER></PUBLISHER>
+<PUBPLACE></PUBPLACE>
+<IDNO TYPE="title">40</IDNO>
+<ACCESS></ACCESS>
+</PUBLICATIONSTMT>
+<SERIESSTMT>
+<TITLE></TITLE>
+</SERIESSTMT>
+</FILEDESC>
+<PROFILEDESC>
+<TEXTCLASS>
+<KEYWORDS></KEYWORDS>
+</TEXTCLASS>
+</PROFILEDESC>
+</HEADER>
+<TEXT>
+<BODY>
+<ECFRBRWS>
+<AMDDATE>Jan. 2, 2025</AMDDATE>
+`
+
+const ecfrBulkFooter = `
+</ECFRBRWS>
+</BODY>
+</TEXT>
+</DLPSTEXTCLASS>`
+
+const cfrAnnualHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<?xml-stylesheet type="text/xsl" href="cfr.xsl"?>
+<CFRGRANULE xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:noNamespaceSchemaLocation="CFRMergedXML.xsd">
+`
+
+const cfrAnnualFooter = `
+</CFRGRANULE>`
+
+const headerTestBody = `<DIV1 N="40" NODE="40:1" TYPE="TITLE"><HEAD>Title 40&#x2014;Protection of Environment&nbsp;</HEAD>
+<DIV5 N="60" NODE="40:7.0.1.1.1" TYPE="PART"><HEAD>PART 60&#x2014;STANDARDS OF PERFORMANCE</HEAD>
+<DIV8 N="60.1" NODE="40:7.0.1.1.1.1.1.1" TYPE="SECTION"><HEAD>&#xA7; 60.1 Applicability.</HEAD>
+<P>The provisions of this part apply to owners.</P>
+</DIV8>
+</DIV5>
+</DIV1>`
+
+func TestParseGovinfoHeaders(t *testing.T) {
+	documents := map[string]string{
+		"ecfr bulk":  ecfrBulkHeader + headerTestBody + ecfrBulkFooter,
+		"cfr annual": cfrAnnualHeader + headerTestBody + cfrAnnualFooter,
+		"latin1": strings.Replace(ecfrBulkHeader, "UTF-8", "ISO-8859-1", 1) +
+			strings.Replace(headerTestBody, "&#xA7;", "\xa7", 1) + ecfrBulkFooter,
+		"namespace prefixed": cfrAnnualHeader + namespacePrefixed(headerTestBody) + cfrAnnualFooter,
+		"doctype": strings.Replace(ecfrBulkHeader, "?>\n", "?>\n<!DOCTYPE DLPSTEXTCLASS SYSTEM \"ecfr.dtd\">\n", 1) +
+			headerTestBody + ecfrBulkFooter,
+	}
+
+	for name, document := range documents {
+		t.Run(name, func(t *testing.T) {
+			result, err := NewCfrParser(1, 40).Parse(document)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			var divTypes []string
+			for _, structure := range result.Structures {
+				divTypes = append(divTypes, structure.DivType)
+			}
+			if strings.Join(divTypes, ",") != "TITLE,PART,SECTION" {
+				t.Fatalf("expected TITLE,PART,SECTION, got %v", divTypes)
+			}
+
+			section := result.Structures[2]
+			if section.Heading == nil || *section.Heading != "§ 60.1 Applicability." {
+				t.Errorf("unexpected section heading %v", section.Heading)
+			}
+			if section.WordCount != 8 {
+				t.Errorf("expected 8 section words, got %d", section.WordCount)
+			}
+		})
+	}
+}
+
+func TestValidateTitleXMLGovinfoHeaders(t *testing.T) {
+	err := ValidateTitleXML(strings.NewReader(cfrAnnualHeader+headerTestBody+cfrAnnualFooter), 40)
+	if err != nil {
+		t.Errorf("ValidateTitleXML: %v", err)
+	}
+
+	err = ValidateTitleXML(strings.NewReader(ecfrBulkHeader+ecfrBulkFooter), 40)
+	if err == nil {
+		t.Error("expected an error for a header without any DIV")
+	}
+}
+
+func TestValidateTitleXMLTitleMismatch(t *testing.T) {
+	err := ValidateTitleXML(strings.NewReader(ecfrBulkHeader+headerTestBody+ecfrBulkFooter), 41)
+	if !errors.Is(err, ErrTitleMismatch) {
+		t.Errorf("expected a title mismatch error, got %v", err)
+	}
+
+	err = ValidateTitleXML(strings.NewReader(ecfrBulkHeader+headerTestBody+ecfrBulkFooter), 0)
+	if err != nil {
+		t.Errorf("expected the title number not to be checked, got %v", err)
+	}
+}
+
+// namespacePrefixed prefixes the DIV, HEAD and P elements of a document with an "ecfr" namespace
+func namespacePrefixed(document string) string {
+	replacer := strings.NewReplacer(
+		"<DIV1 ", `<ecfr:DIV1 xmlns:ecfr="urn:ecfr" `, "</DIV1>", "</ecfr:DIV1>",
+		"<DIV5 ", "<ecfr:DIV5 ", "</DIV5>", "</ecfr:DIV5>",
+		"<DIV8 ", "<ecfr:DIV8 ", "</DIV8>", "</ecfr:DIV8>",
+		"<HEAD>", "<ecfr:HEAD>", "</HEAD>", "</ecfr:HEAD>",
+		"<P>", "<ecfr:P>", "</P>", "</ecfr:P>",
+	)
+	return replacer.Replace(document)
+}
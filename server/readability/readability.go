@@ -0,0 +1,157 @@
+package readability
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ReadabilityMetrics contains the counts and Flesch scores for a body of text
+type ReadabilityMetrics struct {
+	Sentences   int     `json:"sentences"`
+	Words       int     `json:"words"`
+	Syllables   int     `json:"syllables"`
+	GradeLevel  float64 `json:"gradeLevel"`  // Flesch-Kincaid grade level
+	ReadingEase float64 `json:"readingEase"` // Flesch reading ease, higher is easier
+}
+
+// Score computes readability metrics for the given text
+//
+// Words are whitespace separated tokens containing at least one letter, so section
+// numbers and citations such as "§ 1.1" or "(a)" are not counted as words.
+// Sentences end at '.', '!' or '?' when followed by whitespace or the end of the text.
+// Abbreviations such as "U.S.C." are counted as sentence ends, which slightly lowers grade levels.
+// Syllables are approximated by counting groups of consecutive vowels (including 'y')
+// in each word, dropping a trailing silent 'e', with a minimum of one per word.
+// The heuristic is typically within one syllable per word of dictionary counts.
+func Score(text string) ReadabilityMetrics {
+	var counter Counter
+	counter.Add(text)
+	return counter.Metrics()
+}
+
+// Counter accumulates the sentence, word, and syllable counts of several texts as Score counts them
+// Adding texts one at a time gives the same metrics as scoring them joined by whitespace, without joining them.
+type Counter struct {
+	sentences int
+	words     int
+	syllables int
+}
+
+// Add counts the sentences, words, and syllables of text
+func (c *Counter) Add(text string) {
+	for _, token := range strings.Fields(text) {
+		if !hasLetter(token) {
+			continue
+		}
+
+		c.words++
+		c.syllables += countSyllables(token)
+
+		if endsSentence(token) {
+			c.sentences++
+		}
+	}
+}
+
+// Metrics computes readability metrics from the counts of the texts added
+func (c *Counter) Metrics() ReadabilityMetrics {
+	// Text without terminal punctuation is still a sentence
+	sentences := c.sentences
+	if c.words > 0 && sentences == 0 {
+		sentences = 1
+	}
+
+	return FromCounts(sentences, c.words, c.syllables)
+}
+
+// FromCounts computes readability metrics from precomputed counts
+// Useful for combining the counts of several texts into a single score
+func FromCounts(sentences int, words int, syllables int) ReadabilityMetrics {
+	metrics := ReadabilityMetrics{
+		Sentences: sentences,
+		Words:     words,
+		Syllables: syllables,
+	}
+
+	if sentences == 0 || words == 0 {
+		return metrics
+	}
+
+	wordsPerSentence := float64(words) / float64(sentences)
+	syllablesPerWord := float64(syllables) / float64(words)
+
+	metrics.GradeLevel = 0.39*wordsPerSentence + 11.8*syllablesPerWord - 15.59
+	metrics.ReadingEase = 206.835 - 1.015*wordsPerSentence - 84.6*syllablesPerWord
+
+	return metrics
+}
+
+func hasLetter(token string) bool {
+	for _, r := range token {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func endsSentence(token string) bool {
+	trimmed := strings.TrimRight(token, "\"')]”’")
+	if trimmed == "" {
+		return false
+	}
+
+	switch trimmed[len(trimmed)-1] {
+	case '.', '!', '?':
+		return true
+	default:
+		return false
+	}
+}
+
+// countSyllables approximates the syllables in a word by counting vowel groups
+func countSyllables(word string) int {
+	var letters []rune
+	for _, r := range strings.ToLower(word) {
+		if unicode.IsLetter(r) {
+			letters = append(letters, r)
+		}
+	}
+
+	count := 0
+	inVowelGroup := false
+	for _, r := range letters {
+		if isVowel(r) {
+			if !inVowelGroup {
+				count++
+			}
+			inVowelGroup = true
+		} else {
+			inVowelGroup = false
+		}
+	}
+
+	// Drop a silent trailing 'e' (e.g., "rule"), but keep consonant + "le" endings (e.g., "title")
+	n := len(letters)
+	if count > 1 && n > 2 && letters[n-1] == 'e' && !isVowel(letters[n-2]) {
+		consonantLE := letters[n-2] == 'l' && !isVowel(letters[n-3])
+		if !consonantLE {
+			count--
+		}
+	}
+
+	if count == 0 {
+		count = 1
+	}
+
+	return count
+}
+
+func isVowel(r rune) bool {
+	switch r {
+	case 'a', 'e', 'i', 'o', 'u', 'y':
+		return true
+	default:
+		return false
+	}
+}
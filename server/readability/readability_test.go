@@ -0,0 +1,129 @@
+package readability
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCountSyllables(t *testing.T) {
+	tests := []struct {
+		word     string
+		expected int
+	}{
+		{"the", 1},
+		{"rule", 1},
+		{"title", 2},
+		{"agency", 3},
+		{"Agency,", 3},
+		{"regulation", 4},
+		{"rhythm", 1},
+		{"queue", 1},
+		{"strengths", 1},
+		{"(a)", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			if got := countSyllables(tt.word); got != tt.expected {
+				t.Errorf("countSyllables(%q) = %d, expected %d", tt.word, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEndsSentence(t *testing.T) {
+	tests := []struct {
+		token    string
+		expected bool
+	}{
+		{"part.", true},
+		{"done?", true},
+		{`stop!"`, true},
+		{"apply.)", true},
+		{"U.S.C.", true},
+		{"(a)", false},
+		{"it's", false},
+		{"shall", false},
+		{")", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			if got := endsSentence(tt.token); got != tt.expected {
+				t.Errorf("endsSentence(%q) = %v, expected %v", tt.token, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		sentences   int
+		words       int
+		syllables   int
+		gradeLevel  float64
+		readingEase float64
+	}{
+		{
+			name: "empty",
+			text: "",
+		},
+		{
+			name:        "single sentence",
+			text:        "The rule applies.",
+			sentences:   1,
+			words:       3,
+			syllables:   4,
+			gradeLevel:  1.3133,
+			readingEase: 90.99,
+		},
+		{
+			name:        "no terminal punctuation and numbers",
+			text:        "§ 1.1 (a) The title",
+			sentences:   1,
+			words:       3,
+			syllables:   4,
+			gradeLevel:  1.3133,
+			readingEase: 90.99,
+		},
+		{
+			name:        "two sentences",
+			text:        "Rules apply. Titles differ.",
+			sentences:   2,
+			words:       4,
+			syllables:   8,
+			gradeLevel:  8.79,
+			readingEase: 35.605,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Score(tt.text)
+			if got.Sentences != tt.sentences || got.Words != tt.words || got.Syllables != tt.syllables {
+				t.Fatalf(
+					"counted %d sentences, %d words, %d syllables, expected %d, %d, %d",
+					got.Sentences, got.Words, got.Syllables, tt.sentences, tt.words, tt.syllables,
+				)
+			}
+			if math.Abs(got.GradeLevel-tt.gradeLevel) > 0.001 || math.Abs(got.ReadingEase-tt.readingEase) > 0.001 {
+				t.Errorf(
+					"grade level %f, reading ease %f, expected %f, %f",
+					got.GradeLevel, got.ReadingEase, tt.gradeLevel, tt.readingEase,
+				)
+			}
+		})
+	}
+}
+
+func TestCounterMatchesScore(t *testing.T) {
+	var counter Counter
+	counter.Add("Rules apply to (a) the")
+	counter.Add("title. Titles differ")
+
+	if got, expected := counter.Metrics(), Score("Rules apply to (a) the title. Titles differ"); got != expected {
+		t.Errorf("counter metrics %+v, expected %+v", got, expected)
+	}
+}
@@ -0,0 +1,58 @@
+package readability
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Vocabulary collects the distinct words of a body of text, a measure of its lexical diversity
+//
+// Words are counted as in Score, whitespace separated tokens containing at least one letter, lowercased and
+// with leading and trailing punctuation removed, so "Agency," and "agency" are the same word.
+// Distinct words are kept exactly, their number is bounded by the language rather than the size of the text,
+// in the tens of thousands even for the largest titles.
+type Vocabulary struct {
+	words map[string]struct{}
+}
+
+// NewVocabulary creates an empty vocabulary
+func NewVocabulary() *Vocabulary {
+	return &Vocabulary{words: make(map[string]struct{})}
+}
+
+// Add adds the words of text to the vocabulary
+func (v *Vocabulary) Add(text string) {
+	for _, token := range strings.Fields(text) {
+		if !hasLetter(token) {
+			continue
+		}
+
+		word := strings.TrimFunc(token, func(r rune) bool {
+			return unicode.IsPunct(r) || unicode.IsSymbol(r)
+		})
+		v.words[strings.ToLower(word)] = struct{}{}
+	}
+}
+
+// Merge adds the words of another vocabulary to the vocabulary
+func (v *Vocabulary) Merge(other *Vocabulary) {
+	for word := range other.words {
+		v.words[word] = struct{}{}
+	}
+}
+
+// Size returns the number of distinct words
+func (v *Vocabulary) Size() int {
+	return len(v.words)
+}
+
+// Words returns the distinct words in sorted order
+func (v *Vocabulary) Words() []string {
+	words := make([]string, 0, len(v.words))
+	for word := range v.words {
+		words = append(words, word)
+	}
+	slices.Sort(words)
+	return words
+}
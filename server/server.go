@@ -6,9 +6,11 @@ import (
 	"github.com/gofiber/fiber/v2"
 	_ "github.com/lib/pq"
 	"github.com/sam-berry/ecfr-analyzer/server/api"
+	"github.com/sam-berry/ecfr-analyzer/server/concurrent"
 	"github.com/sam-berry/ecfr-analyzer/server/config"
 	"github.com/sam-berry/ecfr-analyzer/server/dao"
 	"github.com/sam-berry/ecfr-analyzer/server/httpclient"
+	"github.com/sam-berry/ecfr-analyzer/server/openapi"
 	"github.com/sam-berry/ecfr-analyzer/server/service"
 	"log"
 	"net/http"
@@ -18,6 +20,12 @@ import (
 	"time"
 )
 
+// apiPrefix is the path every route is registered under
+const apiPrefix = "/ecfr-service"
+
+// shutdownTimeout bounds the wait for in-flight requests and workers to stop once shutdown begins
+var shutdownTimeout = 30 * time.Second
+
 func main() {
 	masterCtx, masterCancel := context.WithCancel(context.Background())
 	defer masterCancel()
@@ -29,8 +37,8 @@ func main() {
 	defer db.Close()
 	config.ConfigureDB(db)
 
-	app := config.InitHTTPApp()
-	router := app.Group("/ecfr-service")
+	app := config.InitHTTPApp(masterCtx)
+	router := app.Group(apiPrefix)
 
 	httpClient := &httpclient.Client{HttpClient: http.DefaultClient}
 	ecfrAPIClient := &httpclient.ECFRAPIClient{
@@ -39,23 +47,41 @@ func main() {
 	}
 	ecfrBulkDataClient := &httpclient.ECFRBulkDataClient{
 		APIRoot:    "https://www.govinfo.gov/bulkdata/json/ECFR",
-		HttpClient: httpClient,
+		HttpClient: config.NewBulkDataHTTPClient(),
 	}
 
 	agencyDAO := &dao.AgencyDAO{Db: db}
 	titleDAO := &dao.TitleDAO{Db: db}
 	titleImportDAO := &dao.TitleImportDAO{Db: db}
 	computedValueDAO := &dao.ComputedValueDAO{Db: db}
-	cfrStructureDAO := &dao.CfrStructureDAO{Db: db}
-	titleVersionDAO := &dao.TitleVersionDAO{Db: db}
+	cfrStructureDAO := &dao.CfrStructureDAO{Db: db, BatchSize: config.StructureBatchSize()}
+	titleVersionDAO := &dao.TitleVersionDAO{
+		Db:           db,
+		ContentStore: config.NewContentStore(db),
+	}
+	parseStateDAO := &dao.ParseStateDAO{Db: db}
+	parseErrorDAO := &dao.ParseErrorDAO{Db: db}
+	healthDAO := &dao.HealthDAO{Db: db}
 
 	agencyService := &service.AgencyService{AgencyDAO: agencyDAO}
-	agencyMetricService := &service.AgencyMetricService{AgencyDAO: agencyDAO, TitleDAO: titleDAO}
+	agencyMetricService := &service.AgencyMetricService{
+		AgencyDAO:        agencyDAO,
+		TitleDAO:         titleDAO,
+		CfrStructureDAO:  cfrStructureDAO,
+		ComputedValueDAO: computedValueDAO,
+		ParseStateDAO:    parseStateDAO,
+	}
 	agencyImportService := &service.AgencyImportService{
 		HttpClient: ecfrAPIClient,
 		AgencyDAO:  agencyDAO,
 	}
-	titleMetricService := &service.TitleMetricService{TitleDAO: titleDAO}
+	titleMetricService := &service.TitleMetricService{
+		TitleDAO:         titleDAO,
+		CfrStructureDAO:  cfrStructureDAO,
+		ComputedValueDAO: computedValueDAO,
+		TitleVersionDAO:  titleVersionDAO,
+		ParseStateDAO:    parseStateDAO,
+	}
 	titleImportService := &service.TitleImportService{
 		HttpClient:     ecfrBulkDataClient,
 		TitleImportDAO: titleImportDAO,
@@ -71,33 +97,63 @@ func main() {
 		ComputedValueDAO: computedValueDAO,
 	}
 	cfrStructureService := &service.CfrStructureService{
-		TitleDAO:        titleDAO,
-		CfrStructureDAO: cfrStructureDAO,
+		TitleDAO:         titleDAO,
+		CfrStructureDAO:  cfrStructureDAO,
+		ParseStateDAO:    parseStateDAO,
+		ParseErrorDAO:    parseErrorDAO,
+		TitleVersionDAO:  titleVersionDAO,
+		HttpClient:       ecfrAPIClient,
+		ParseConcurrency: config.ParseConcurrency(),
+		MaxTextBytes:     config.MaxTextBytes(),
 	}
+	versionMetricsCache := service.NewVersionMetricsCache(config.VersionMetricsCacheConfig())
 	titleVersionService := &service.TitleVersionService{
-		HttpClient:      ecfrBulkDataClient,
-		TitleDAO:        titleDAO,
-		TitleVersionDAO: titleVersionDAO,
+		HttpClient:          ecfrBulkDataClient,
+		VersionerClient:     ecfrAPIClient,
+		TitleDAO:            titleDAO,
+		TitleVersionDAO:     titleVersionDAO,
+		VersionMetricsCache: versionMetricsCache,
+		MaxContentBytes:     config.MaxContentBytes(),
+		DownloadTimeout:     config.DownloadTimeout(),
 	}
 	changeTrackingService := &service.ChangeTrackingService{
-		TitleVersionDAO:  titleVersionDAO,
-		ComputedValueDAO: computedValueDAO,
-		TitleDAO:         titleDAO,
+		TitleVersionDAO:     titleVersionDAO,
+		ComputedValueDAO:    computedValueDAO,
+		TitleDAO:            titleDAO,
+		CfrStructureDAO:     cfrStructureDAO,
+		AgencyDAO:           agencyDAO,
+		VersionMetricsCache: versionMetricsCache,
+	}
+	jobService := &service.JobService{}
+	healthService := &service.HealthService{
+		HealthDAO:  healthDAO,
+		TitleDAO:   titleDAO,
+		HttpClient: ecfrBulkDataClient,
+	}
+	// Refactored service with cleaner sub-agency logic, used for computing all metrics in one call
+	computedValueServiceRefactored := &service.ComputedValueServiceRefactored{
+		TitleMetricService:  titleMetricService,
+		AgencyMetricService: agencyMetricService,
+		ComputedValueDAO:    computedValueDAO,
+		AgencyDAO:           agencyDAO,
 	}
-	// Refactored service available for cleaner sub-agency logic
-	// Uncomment to use instead of the original ComputedValueService
-	// computedValueServiceRefactored := &service.ComputedValueServiceRefactored{
-	// 	TitleMetricService:  titleMetricService,
-	// 	AgencyMetricService: agencyMetricService,
-	// 	ComputedValueDAO:    computedValueDAO,
-	// 	AgencyDAO:           agencyDAO,
-	// }
 
+	docsAPI := &api.DocsAPI{
+		Router:     router,
+		App:        app,
+		PathPrefix: apiPrefix,
+	}
 	registerAPIs(
 		[]api.API{
-			&api.AgencyAPI{
+			docsAPI,
+			&api.HealthAPI{
 				Router:        router,
-				AgencyService: agencyService,
+				HealthService: healthService,
+			},
+			&api.AgencyAPI{
+				Router:              router,
+				AgencyService:       agencyService,
+				AgencyMetricService: agencyMetricService,
 			},
 			&api.MetricAPI{
 				Router:        router,
@@ -106,6 +162,9 @@ func main() {
 		},
 	)
 
+	// The routes registered so far are public, those registered after the admin auth handler require the token
+	docsAPI.PublicRoutes = openapi.RouteKeys(app.GetRoutes(true))
+
 	router.Use(config.AdminAuthHandler)
 	registerAPIs(
 		[]api.API{
@@ -115,8 +174,9 @@ func main() {
 				TitleMetricService:  titleMetricService,
 			},
 			&api.ComputedValueAPI{
-				Router:               router,
-				ComputedValueService: computedValueService,
+				Router:                         router,
+				ComputedValueService:           computedValueService,
+				ComputedValueServiceRefactored: computedValueServiceRefactored,
 			},
 			&api.AgencyImportAPI{
 				Router:              router,
@@ -133,10 +193,19 @@ func main() {
 			&api.TitleVersionAPI{
 				Router:              router,
 				TitleVersionService: titleVersionService,
+				JobService:          jobService,
+			},
+			&api.JobAPI{
+				Router:     router,
+				JobService: jobService,
 			},
 			&api.ChangeTrackingAPI{
 				Router:                router,
 				ChangeTrackingService: changeTrackingService,
+				JobService:            jobService,
+			},
+			&api.PrometheusAPI{
+				Router: router,
 			},
 		},
 	)
@@ -151,15 +220,22 @@ func main() {
 		masterCancel()
 	}()
 
+	// Canceling the master context stops in-flight imports from starting more work, and interrupts the
+	// database calls of their workers so transactions roll back rather than leaving partial data
 	<-masterCtx.Done()
 
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer shutdownCancel()
 
 	if err := app.ShutdownWithContext(shutdownCtx); err != nil {
 		log.Printf("HTTP server Shutdown: %v", err)
 	}
 
+	// Workers that outlived their request, such as timed out ones, still hold database connections
+	if err := concurrent.WaitForWorkers(shutdownCtx); err != nil {
+		log.Printf("Workers still running at shutdown: %v", err)
+	}
+
 	if err := db.Close(); err != nil {
 		log.Printf("Error closing database: %v", err)
 	}
@@ -2,126 +2,259 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/sam-berry/ecfr-analyzer/server/dao"
 	"github.com/sam-berry/ecfr-analyzer/server/data"
-	"sync"
+	"github.com/sam-berry/ecfr-analyzer/server/logging"
+	"slices"
 )
 
-type AgencyResult struct {
-	Name   string
-	Titles []int
-}
+var agencyMetricLog = logging.New("agency-metrics")
 
-var MaxConcurrentAgencyLookups = 10
+// ErrAgencyNotFound is returned when no agency exists for a slug
+var ErrAgencyNotFound = errors.New("agency not found")
 
 type AgencyMetricService struct {
-	AgencyDAO *dao.AgencyDAO
-	TitleDAO  *dao.TitleDAO
+	AgencyDAO        *dao.AgencyDAO
+	TitleDAO         *dao.TitleDAO
+	CfrStructureDAO  *dao.CfrStructureDAO
+	ComputedValueDAO *dao.ComputedValueDAO
+	ParseStateDAO    *dao.ParseStateDAO
 }
 
+// CountWordsAndSections totals the words and sections of the parsed structures within an agency's CFR references
+// Without a sub-agency filter the references of the agency and all of its sub-agencies are included,
+// otherwise only the references of the sub-agency with the filter slug are included
+// options select whether appendices are counted and reserved sections excluded, both are totaled separately either way
+// Returns an error wrapping ErrLeavesOnlyTitle if a referenced title was last parsed leaves-only, as its references
+// to chapters and parts would match nothing and silently count 0
 func (s *AgencyMetricService) CountWordsAndSections(
 	ctx context.Context,
 	slug string,
-	subAgencyNameFilter string,
+	subAgencySlugFilter string,
+	options data.CountOptions,
 ) (*data.AgencyMetricResponse, error) {
-	agency, err := s.AgencyDAO.FindBySlug(ctx, slug)
+	agency, err := s.findAgency(ctx, slug)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find agency, %v, %w", slug, err)
+		return nil, err
 	}
 
-	var agencyResults []*AgencyResult
-	if subAgencyNameFilter == "" {
-		agencyResults = append(agencyResults, s.buildAgencyResult(agency))
-		for _, childAgency := range agency.Children {
-			agencyResults = append(agencyResults, s.buildAgencyResult(childAgency))
-		}
+	var references []*data.CfrReference
+	if subAgencySlugFilter == "" {
+		references = agencyReferences(agency, true)
 	} else {
 		for _, childAgency := range agency.Children {
-			if childAgency.Name == subAgencyNameFilter {
-				agencyResults = append(agencyResults, s.buildAgencyResult(childAgency))
+			if childAgency.Slug == subAgencySlugFilter {
+				references = agencyReferences(childAgency, false)
 				break
 			}
 		}
 	}
 
-	var messagesWG sync.WaitGroup
+	if err := s.checkLeavesOnlyTitles(ctx, references); err != nil {
+		return nil, err
+	}
+
+	totals, err := s.CfrStructureDAO.SumMetricsByReferences(ctx, references)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count agency metrics, %v, %w", slug, err)
+	}
+
+	wordCount, sectionCount := totals.Counts(options)
+
+	agencyMetricLog.Debug(
+		"Counted agency metrics",
+		"agency", slug,
+		"subAgency", subAgencySlugFilter,
+		"references", len(references),
+		"words", wordCount,
+		"sections", sectionCount,
+		"appendices", totals.AppendixCount,
+	)
 
-	messages := make(chan string)
-	messagesWG.Add(1)
-	go func() {
-		defer messagesWG.Done()
-		for message := range messages {
-			log.Info(fmt.Sprintf("Agency Metrics Process: %v", message))
+	return &data.AgencyMetricResponse{
+		WordCount:          wordCount,
+		SectionCount:       sectionCount,
+		AppendixWordCount:  totals.AppendixWordCount,
+		AppendixCount:      totals.AppendixCount,
+		ReservedCount:      totals.ReservedCount,
+		IncludesAppendices: options.IncludeAppendices,
+		ExcludesReserved:   options.ExcludeReserved,
+	}, nil
+}
+
+// ResolveAgencyReferences returns the CFR references counted toward an agency's metrics,
+// which are the references of the agency followed by those of its sub-agencies
+func (s *AgencyMetricService) ResolveAgencyReferences(
+	ctx context.Context,
+	slug string,
+) ([]*data.CfrReference, error) {
+	agency, err := s.findAgency(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	return agencyReferences(agency, true), nil
+}
+
+func (s *AgencyMetricService) findAgency(
+	ctx context.Context,
+	slug string,
+) (*data.Agency, error) {
+	agency, err := s.AgencyDAO.FindBySlug(ctx, slug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find agency, %v, %w", slug, err)
+	}
+
+	if agency == nil {
+		return nil, fmt.Errorf("%w: %v", ErrAgencyNotFound, slug)
+	}
+
+	return agency, nil
+}
+
+// checkLeavesOnlyTitles returns an error wrapping ErrLeavesOnlyTitle if any referenced title was last parsed
+// leaves-only, which stored only its sections
+func (s *AgencyMetricService) checkLeavesOnlyTitles(
+	ctx context.Context,
+	references []*data.CfrReference,
+) error {
+	if len(references) == 0 {
+		return nil
+	}
+
+	states, err := s.ParseStateDAO.FindAll(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find parse states: %w", err)
+	}
+
+	leavesOnly := make(map[int]bool)
+	for _, state := range states {
+		if state.LeavesOnly {
+			leavesOnly[state.TitleNumber] = true
 		}
-	}()
+	}
 
-	var agencyWg sync.WaitGroup
-	var mu sync.Mutex
-	var totalWordCount int
-	var totalSectionCount int
+	var titles []int
+	for _, reference := range references {
+		if leavesOnly[reference.Title] && !slices.Contains(titles, reference.Title) {
+			titles = append(titles, reference.Title)
+		}
+	}
 
-	throttle := make(chan int, MaxConcurrentAgencyLookups)
+	if len(titles) > 0 {
+		return fmt.Errorf("%w: titles %v, reparse them without leavesOnly", ErrLeavesOnlyTitle, titles)
+	}
 
-	for _, agencyResult := range agencyResults {
-		agencyWg.Add(1)
-		throttle <- 1
+	return nil
+}
 
-		go func(agencyResult *AgencyResult) {
-			defer agencyWg.Done()
-			defer func() { <-throttle }()
+// agencyReferences converts the stored references of an agency, and optionally its sub-agencies, to CfrReferences
+func agencyReferences(agency *data.Agency, includeChildren bool) []*data.CfrReference {
+	references := []*data.CfrReference{}
+	for _, ref := range agency.AgencyReferences {
+		references = append(references, &data.CfrReference{
+			Agency:     agency.Name,
+			Title:      ref.Title,
+			Subtitle:   ref.Subtitle,
+			Chapter:    ref.Chapter,
+			Subchapter: ref.Subchapter,
+			Part:       ref.Part,
+		})
+	}
 
-			name := agencyResult.Name
+	if includeChildren {
+		for _, childAgency := range agency.Children {
+			references = append(references, agencyReferences(childAgency, false)...)
+		}
+	}
 
-			wordCount, err := s.TitleDAO.CountAgencyWords(ctx, name, agencyResult.Titles)
-			if err != nil {
-				messages <- fmt.Sprintf(
-					"failed to count words for agency, %v, %v",
-					name,
-					err,
-				)
-				return
-			}
+	return references
+}
 
-			mu.Lock()
-			totalWordCount += wordCount
-			mu.Unlock()
-
-			sectionCount, err := s.TitleDAO.CountAgencySections(ctx, name, agencyResult.Titles)
-			if err != nil {
-				messages <- fmt.Sprintf(
-					"failed to count sections for agency, %v, %v",
-					name,
-					err,
-				)
-				return
-			}
+// CompareAgencies compares the word and section counts of two agencies
+// Stored computed metrics are used when available, otherwise the metrics are counted live
+func (s *AgencyMetricService) CompareAgencies(
+	ctx context.Context,
+	slugA string,
+	slugB string,
+) (*data.AgencyComparison, error) {
+	a, err := s.getComparisonEntry(ctx, slugA)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := s.getComparisonEntry(ctx, slugB)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.AgencyComparison{
+		A:                       a,
+		B:                       b,
+		WordCountDelta:          a.WordCount - b.WordCount,
+		SectionCountDelta:       a.SectionCount - b.SectionCount,
+		AvgWordsPerSectionDelta: a.AvgWordsPerSection - b.AvgWordsPerSection,
+	}, nil
+}
 
-			mu.Lock()
-			totalSectionCount += sectionCount
-			mu.Unlock()
-		}(agencyResult)
+func (s *AgencyMetricService) getComparisonEntry(
+	ctx context.Context,
+	slug string,
+) (*data.AgencyComparisonEntry, error) {
+	agency, err := s.findAgency(ctx, slug)
+	if err != nil {
+		return nil, err
 	}
 
-	agencyWg.Wait()
+	computed := true
+	metrics, err := s.findComputedMetrics(ctx, agency)
+	if err != nil {
+		return nil, err
+	}
 
-	close(messages)
-	messagesWG.Wait()
+	if metrics == nil {
+		computed = false
+		metrics, err = s.CountWordsAndSections(ctx, slug, "", data.DefaultCountOptions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count agency metrics, %v, %w", slug, err)
+		}
+	}
 
-	return &data.AgencyMetricResponse{
-		WordCount:    totalWordCount,
-		SectionCount: totalSectionCount,
+	var avgWordsPerSection float64
+	if metrics.SectionCount > 0 {
+		avgWordsPerSection = float64(metrics.WordCount) / float64(metrics.SectionCount)
+	}
+
+	return &data.AgencyComparisonEntry{
+		Agency:             agency,
+		WordCount:          metrics.WordCount,
+		SectionCount:       metrics.SectionCount,
+		AvgWordsPerSection: avgWordsPerSection,
+		Computed:           computed,
 	}, nil
 }
 
-func (s *AgencyMetricService) buildAgencyResult(agency *data.Agency) *AgencyResult {
-	var titles []int
-	for _, ref := range agency.AgencyReferences {
-		titles = append(titles, ref.Title)
+// findComputedMetrics returns the stored metrics for an agency, or nil if none have been computed
+func (s *AgencyMetricService) findComputedMetrics(
+	ctx context.Context,
+	agency *data.Agency,
+) (*data.AgencyMetricResponse, error) {
+	cv, err := s.ComputedValueDAO.FindByKey(ctx, data.ComputedValueKeyAgencyMetric(agency.Id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find agency metrics, %v, %w", agency.Slug, err)
 	}
-	return &AgencyResult{
-		Name:   agency.Name,
-		Titles: titles,
+
+	if cv == nil {
+		return nil, nil
 	}
+
+	var metrics data.AgencyMetricResponse
+	if err := json.Unmarshal(cv.Data, &metrics); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal agency metrics, %v, %w", agency.Slug, err)
+	}
+
+	return &metrics, nil
 }
@@ -2,8 +2,10 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"github.com/sam-berry/ecfr-analyzer/server/dao"
 	"github.com/sam-berry/ecfr-analyzer/server/data"
+	"sort"
 )
 
 type AgencyService struct {
@@ -16,3 +18,48 @@ func (s *AgencyService) GetAgencyBySlug(
 ) (*data.Agency, error) {
 	return s.AgencyDAO.FindBySlug(ctx, slug)
 }
+
+// GetAgencyTree returns the top level agencies with their sub-agencies, ordered by sortable name at each level
+// The Parent of each sub-agency is set while building the tree, as extractSubAgencies does
+func (s *AgencyService) GetAgencyTree(
+	ctx context.Context,
+) ([]*data.AgencyTreeNode, error) {
+	agencies, err := s.AgencyDAO.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find agencies: %w", err)
+	}
+
+	return buildAgencyTree(agencies, nil), nil
+}
+
+// buildAgencyTree builds the tree nodes of agencies and their sub-agencies, whose parent is parent
+func buildAgencyTree(
+	agencies []*data.Agency,
+	parent *data.Agency,
+) []*data.AgencyTreeNode {
+	sorted := make([]*data.Agency, len(agencies))
+	copy(sorted, agencies)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].SortableName < sorted[j].SortableName
+	})
+
+	nodes := make([]*data.AgencyTreeNode, 0, len(sorted))
+	for _, agency := range sorted {
+		node := &data.AgencyTreeNode{
+			Id:          agency.Id,
+			Name:        agency.Name,
+			DisplayName: agency.DisplayName,
+			Slug:        agency.Slug,
+		}
+
+		if parent != nil {
+			agency.Parent = parent
+			node.ParentSlug = &parent.Slug
+		}
+
+		node.Children = buildAgencyTree(agency.Children, agency)
+		nodes = append(nodes, node)
+	}
+
+	return nodes
+}
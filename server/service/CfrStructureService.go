@@ -2,30 +2,168 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/sam-berry/ecfr-analyzer/server/concurrent"
 	"github.com/sam-berry/ecfr-analyzer/server/dao"
 	"github.com/sam-berry/ecfr-analyzer/server/data"
+	"github.com/sam-berry/ecfr-analyzer/server/ecfrdata"
+	"github.com/sam-berry/ecfr-analyzer/server/httpclient"
+	"github.com/sam-berry/ecfr-analyzer/server/logging"
+	"github.com/sam-berry/ecfr-analyzer/server/metrics"
 	"github.com/sam-berry/ecfr-analyzer/server/parser"
+	"github.com/sam-berry/ecfr-analyzer/server/textdiff"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 )
 
+var cfrStructureLog = logging.New("cfr-structure")
+
+// ErrLeavesOnlyTitle is returned when reparsing a part of a title whose last parse was leaves-only, which stored
+// no parts to replace, or counting agency metrics over such a title, which stored no chapters or parts to match
+var ErrLeavesOnlyTitle = errors.New("title was parsed leaves-only")
+
+// ErrInvalidSimilarityThreshold is returned when a similarity threshold is not above 0 and at most 1
+var ErrInvalidSimilarityThreshold = errors.New("threshold must be above 0 and at most 1")
+
 type CfrStructureService struct {
-	TitleDAO         *dao.TitleDAO
-	CfrStructureDAO  *dao.CfrStructureDAO
+	TitleDAO        *dao.TitleDAO
+	CfrStructureDAO *dao.CfrStructureDAO
+	ParseStateDAO   *dao.ParseStateDAO
+	ParseErrorDAO   *dao.ParseErrorDAO
+	TitleVersionDAO *dao.TitleVersionDAO
+	HttpClient      *httpclient.ECFRAPIClient
+
+	// ParseConcurrency is the number of titles ProcessAllTitles parses at once, 0 uses defaultParseConcurrency
+	ParseConcurrency int
+
+	// MaxTextBytes caps the text stored for each structure of a title, 0 is unlimited, see parser.ParserOptions
+	// Titles whose content is unchanged keep the text of their last parse until they are parsed with force.
+	MaxTextBytes int
+}
+
+// defaultParseConcurrency is the number of titles parsed at once when ParseConcurrency is not set
+const defaultParseConcurrency = 5
+
+// parseBackoff lowers the number of titles parsed at once while parses fail or are slow, which happens when
+// storing the structures of several large titles at once overwhelms a small database
+var parseBackoff = &concurrent.AdaptiveConfig{
+	MinConcurrency:     1,
+	ErrorRateThreshold: 0.2,
+	LatencyThreshold:   3 * time.Minute,
+	Window:             5,
+}
+
+// TitleParseSummary describes the outcome of parsing a single title
+type TitleParseSummary struct {
+	TitleNumber    int   `json:"titleNumber"`
+	StructureCount int   `json:"structureCount"`
+	SectionCount   int   `json:"sectionCount"`
+	TotalWords     int   `json:"totalWords"`
+	UniqueWords    int   `json:"uniqueWords"`
+	DurationMs     int64 `json:"durationMs"`
+	Skipped        bool  `json:"skipped"` // Content unchanged since the last parse
+
+	// ZeroWordSections is the number of sections without words that are not reserved, see parser.IsZeroWordSection
+	ZeroWordSections int `json:"zeroWordSections"`
+
+	// TruncatedStructures is the number of structures whose stored text was truncated, see MaxTextBytes
+	TruncatedStructures int `json:"truncatedStructures"`
+
+	// ChangedStructures is the number of structures inserted or updated, those unchanged since the last parse are
+	// not written
+	ChangedStructures int `json:"changedStructures"`
+
+	// ReservedSections is the number of sections that are placeholders, see parser.IsReservedSection
+	ReservedSections int `json:"reservedSections"`
+
+	// TypeMismatches is the number of structures whose type is unusual for their level, see parser.ParseResult
+	TypeMismatches int `json:"typeMismatches"`
+}
+
+// ParseStats are the quality counters of a single title parse, to judge a reparse at a glance
+type ParseStats struct {
+	TitleNumber      int   `json:"titleNumber"`
+	TotalWords       int   `json:"totalWords"`
+	SectionCount     int   `json:"sectionCount"`
+	ZeroWordSections int   `json:"zeroWordSections"`
+	TypeMismatches   int   `json:"typeMismatches"`
+	ReservedSections int   `json:"reservedSections"`
+	DurationMs       int64 `json:"durationMs"`
+}
+
+// Stats returns the quality counters of the parse
+func (s *TitleParseSummary) Stats() *ParseStats {
+	return &ParseStats{
+		TitleNumber:      s.TitleNumber,
+		TotalWords:       s.TotalWords,
+		SectionCount:     s.SectionCount,
+		ZeroWordSections: s.ZeroWordSections,
+		TypeMismatches:   s.TypeMismatches,
+		ReservedSections: s.ReservedSections,
+		DurationMs:       s.DurationMs,
+	}
+}
+
+// ZeroWordSectionWarnRatio is the share of a title's sections without words above which parsing logs a warning
+var ZeroWordSectionWarnRatio = 0.05
+
+// zeroWordSectionsLogged is the number of identifiers of sections without words logged with the warning
+const zeroWordSectionsLogged = 5
+
+// warnZeroWordSections logs a warning with the first identifiers of the sections without words of a parse result
+// when they are more than ZeroWordSectionWarnRatio of its sections, as a gate for parser regressions
+func warnZeroWordSections(titleNumber int, parseResult *parser.ParseResult, sectionCount int) {
+	if sectionCount == 0 || parseResult.ZeroWordStructures == 0 {
+		return
+	}
+
+	ratio := float64(parseResult.ZeroWordStructures) / float64(sectionCount)
+	if ratio <= ZeroWordSectionWarnRatio {
+		return
+	}
+
+	var identifiers []string
+	for _, structure := range parseResult.Structures {
+		if len(identifiers) == zeroWordSectionsLogged {
+			break
+		}
+		if parser.IsZeroWordSection(structure) {
+			identifiers = append(identifiers, structure.Identifier)
+		}
+	}
+
+	cfrStructureLog.Warn(
+		"Many sections without words, the parser may have missed content",
+		"title", titleNumber,
+		"zeroWordSections", parseResult.ZeroWordStructures,
+		"sections", sectionCount,
+		"ratio", ratio,
+		"first", strings.Join(identifiers, ", "),
+	)
 }
 
 // ProcessAllTitles parses and stores the CFR structure for all titles
+// Titles whose content is unchanged since their last successful parse are skipped unless force or captureRawXML
+// is set, captureRawXML stores the inner XML of each section, see parser.ParserOptions
+// leavesOnly stores only the sections of each title, see processTitle
+// Returns a summary for each title that was parsed or skipped, ordered by title number
 func (s *CfrStructureService) ProcessAllTitles(
 	ctx context.Context,
 	titlesFilter []string,
-) error {
-	s.logInfo("Start")
+	force bool,
+	captureRawXML bool,
+	leavesOnly bool,
+) ([]*TitleParseSummary, error) {
+	cfrStructureLog.Info("Start", "force", force, "captureRawXML", captureRawXML, "leavesOnly", leavesOnly)
 
 	// Get all titles
 	titles, err := s.TitleDAO.FindAll(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to find titles: %w", err)
+		return nil, fmt.Errorf("failed to find titles: %w", err)
 	}
 
 	// Apply filter if provided
@@ -44,111 +182,804 @@ func (s *CfrStructureService) ProcessAllTitles(
 		titles = filteredTitles
 	}
 
-	s.logInfo(fmt.Sprintf("Processing %d titles", len(titles)))
+	cfrStructureLog.Info("Processing titles", "count", len(titles))
 
-	// Create concurrent runner with limited concurrency
-	runner := concurrent.NewRunner[*data.Title, string](concurrent.RunnerConfig{
-		MaxConcurrency: 5, // Process 5 titles concurrently
+	concurrency := s.ParseConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultParseConcurrency
+	}
+
+	// Create concurrent runner with limited concurrency, backing off under database pressure
+	runner := concurrent.NewRunner[*data.Title, *TitleParseSummary](concurrent.RunnerConfig{
+		MaxConcurrency: concurrency,
 		LogPrefix:      "CFR Structure Parser",
+		Adaptive:       parseBackoff,
 	})
 
 	// Process titles concurrently
-	result := runner.Run(titles, func(
+	result := runner.RunSimple(ctx, titles, func(
+		ctx context.Context,
 		title *data.Title,
-		messages chan<- string,
-		results chan<- string,
-		errors chan<- error,
-	) {
-		messages <- fmt.Sprintf("Processing: Title %d", title.Name)
-
-		err := s.processTitle(ctx, title)
+	) (*TitleParseSummary, error) {
+		summary, err := s.parseTitle(ctx, title, force, captureRawXML, leavesOnly)
 		if err != nil {
-			messages <- fmt.Sprintf("Failed: Title %d - %v", title.Name, err)
-			errors <- fmt.Errorf("title %d: %w", title.Name, err)
-			return
+			cfrStructureLog.Error("Failed to process title", "title", title.Name, "error", err)
 		}
-
-		messages <- fmt.Sprintf("Success: Title %d", title.Name)
-		results <- fmt.Sprintf("Title %d", title.Name)
+		return summary, err
 	})
 
 	if len(result.Errors) > 0 {
-		s.logInfo(fmt.Sprintf("Completed with %d errors", len(result.Errors)))
-		for _, err := range result.Errors {
-			s.logInfo(fmt.Sprintf("Error: %v", err))
-		}
+		cfrStructureLog.Warn(
+			"Completed with errors",
+			"processed", len(result.Results),
+			"errors", len(result.Errors),
+		)
 	} else {
-		s.logInfo(fmt.Sprintf("Successfully processed %d titles", len(result.Results)))
+		cfrStructureLog.Info("Successfully processed titles", "count", len(result.Results))
 	}
 
-	s.logInfo("Complete")
-	return nil
+	sort.Slice(result.Results, func(i, j int) bool {
+		return result.Results[i].TitleNumber < result.Results[j].TitleNumber
+	})
+
+	cfrStructureLog.Info("Complete")
+	return result.Results, nil
 }
 
 // processTitle parses and stores the CFR structure for a single title
+// The summary is marked as skipped if the content is unchanged since the last parse in the same mode.
+// leavesOnly stores only the sections, without parents, with the headings of their ancestors in HeadingPath.
+// This roughly halves the storage of a title, but endpoints that navigate the hierarchy find nothing for it.
 func (s *CfrStructureService) processTitle(
 	ctx context.Context,
 	title *data.Title,
-) error {
+	force bool,
+	captureRawXML bool,
+	leavesOnly bool,
+) (*TitleParseSummary, error) {
+	contentHash, err := s.TitleDAO.GetContentHash(ctx, title.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get title content hash: %w", err)
+	}
+
+	// The stored structure may have been parsed without raw XML, so capturing it always reparses
+	if !force && !captureRawXML {
+		parseState, err := s.ParseStateDAO.FindByTitleId(ctx, title.InternalId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parse state: %w", err)
+		}
+
+		if parseState != nil && parseState.ContentHash == contentHash && parseState.LeavesOnly == leavesOnly {
+			return &TitleParseSummary{TitleNumber: title.Name, Skipped: true}, nil
+		}
+	}
+
 	// Get the XML content
 	xmlContent, err := s.TitleDAO.GetContent(ctx, title.Name)
 	if err != nil {
-		return fmt.Errorf("failed to get title content: %w", err)
+		return nil, fmt.Errorf("failed to get title content: %w", err)
 	}
 
 	// Parse the XML
-	cfrParser := parser.NewCfrParser(title.InternalId, title.Name)
+	options := parser.DefaultParserOptions()
+	options.CaptureRawXML = captureRawXML
+	options.MaxTextBytes = s.MaxTextBytes
+	cfrParser := parser.NewCfrParserWithOptions(title.InternalId, title.Name, options)
 	parseResult, err := cfrParser.Parse(xmlContent)
 	if err != nil {
-		return fmt.Errorf("failed to parse XML: %w", err)
+		return nil, fmt.Errorf("failed to parse XML: %w", err)
 	}
 
-	// Delete existing structures for this title (if any)
-	err = s.CfrStructureDAO.DeleteByTitleId(ctx, title.InternalId)
+	pathMap := linkParents(parseResult.Structures)
+
+	structures := parseResult.Structures
+	if leavesOnly {
+		structures = sectionsWithHeadingPaths(structures, pathMap)
+	}
+
+	// Clear the parse state first, as the replace is not atomic, so an interrupted replace is not skipped next time
+	if err := s.ParseStateDAO.DeleteByTitleId(ctx, title.InternalId); err != nil {
+		return nil, fmt.Errorf("failed to clear parse state: %w", err)
+	}
+
+	// Replace the existing structures for this title (if any) with the parsed structures
+	deleted, changed, err := s.CfrStructureDAO.ReplaceByTitleId(ctx, title.InternalId, structures)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replace existing structures: %w", err)
+	}
+
+	cfrStructureLog.Info(
+		"Replaced existing structures",
+		"title", title.Name,
+		"deleted", deleted,
+		"parsed", len(parseResult.Structures),
+		"stored", len(structures),
+		"changed", changed,
+	)
+
+	// Record the parsed content so an unchanged title is skipped next time
+	err = s.ParseStateDAO.Upsert(ctx, &data.ParseState{
+		TitleId:          title.InternalId,
+		TitleNumber:      title.Name,
+		ContentHash:      contentHash,
+		StructureCount:   len(structures),
+		LeavesOnly:       leavesOnly,
+		Sentences:        parseResult.Readability.Sentences,
+		ReadabilityWords: parseResult.Readability.Words,
+		Syllables:        parseResult.Readability.Syllables,
+	}, parseResult.Vocabulary.Words())
 	if err != nil {
-		return fmt.Errorf("failed to delete existing structures: %w", err)
+		return nil, fmt.Errorf("failed to record parse state: %w", err)
 	}
 
-	// Store the parsed structures
-	if len(parseResult.Structures) > 0 {
-		// Build parent-child relationships
-		// First pass: create a map of path to structure for quick lookup
-		pathMap := make(map[string]*data.CfrStructure)
-		for _, structure := range parseResult.Structures {
-			pathMap[structure.Path] = structure
+	sectionCount := 0
+	for _, structure := range parseResult.Structures {
+		if structure.DivType == data.DivTypeSection {
+			sectionCount++
 		}
+	}
+	warnZeroWordSections(title.Name, parseResult, sectionCount)
+	if parseResult.TruncatedStructures > 0 {
+		cfrStructureLog.Info(
+			"Truncated structure text",
+			"title", title.Name,
+			"structures", parseResult.TruncatedStructures,
+			"maxTextBytes", s.MaxTextBytes,
+		)
+	}
+
+	return &TitleParseSummary{
+		TitleNumber:       title.Name,
+		StructureCount:    len(structures),
+		ChangedStructures: int(changed),
+		SectionCount:      sectionCount,
+		TotalWords:        parseResult.TotalWords,
+		UniqueWords:       parseResult.UniqueWordCount,
+		ZeroWordSections:  parseResult.ZeroWordStructures,
+		ReservedSections:  parseResult.ReservedSections,
+		TypeMismatches:    parseResult.TypeMismatches,
+
+		TruncatedStructures: parseResult.TruncatedStructures,
+	}, nil
+}
+
+// ProcessTitle parses and stores the CFR structure of a single title, returning the quality counters of the parse
+// The title is always reparsed, even if its content is unchanged since the last parse
+// Returns an error wrapping dao.ErrTitleNotFound if the title has not been imported
+func (s *CfrStructureService) ProcessTitle(
+	ctx context.Context,
+	titleNumber int,
+	captureRawXML bool,
+	leavesOnly bool,
+) (*ParseStats, error) {
+	title, err := s.TitleDAO.FindByNumber(ctx, titleNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find title: %w", err)
+	}
 
-		// Second pass: set parent IDs based on path hierarchy
-		for _, structure := range parseResult.Structures {
-			// Find parent path by removing the last segment
-			parentPath := getParentPath(structure.Path)
-			if parentPath != "" {
-				if parent, ok := pathMap[parentPath]; ok {
-					structure.ParentId = &parent.InternalId
-				}
+	summary, err := s.parseTitle(ctx, title, true, captureRawXML, leavesOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	return summary.Stats(), nil
+}
+
+// linkParents builds parent-child relationships of structures in document order, returning them by path key
+// The parent's InternalId is set when it is inserted, which is before its children as structures are in document order
+func linkParents(structures []*data.CfrStructure) map[string]*data.CfrStructure {
+	// First pass: create a map of path to structure for quick lookup
+	pathMap := make(map[string]*data.CfrStructure)
+	for _, structure := range structures {
+		pathMap[data.PathKey(structure.PathSegments)] = structure
+	}
+
+	// Second pass: set parent IDs based on path hierarchy
+	for _, structure := range structures {
+		// Find parent path by removing the last segment
+		parentSegments := structure.ParentPathSegments()
+		if len(parentSegments) > 0 {
+			if parent, ok := pathMap[data.PathKey(parentSegments)]; ok {
+				structure.ParentId = &parent.InternalId
 			}
 		}
+	}
+
+	return pathMap
+}
 
-		err = s.CfrStructureDAO.BatchInsert(ctx, parseResult.Structures)
+// ReparsePart parses a single part of a title's stored content and replaces the stored structure of that part,
+// including its descendants, leaving the rest of the title as it is, e.g., after a change to just that part
+// The part is linked to its stored parent, and the title's parse state is left as it is, so the next full parse
+// still reparses a title whose content changed. Returns an error wrapping dao.ErrTitleNotFound if the title has not
+// been imported, parser.ErrSubtreeNotFound if the content has no such part, or ErrLeavesOnlyTitle if the title was
+// last parsed leaves-only.
+func (s *CfrStructureService) ReparsePart(
+	ctx context.Context,
+	titleNumber int,
+	partIdentifier string,
+) error {
+	title, err := s.TitleDAO.FindByNumber(ctx, titleNumber)
+	if err != nil {
+		return fmt.Errorf("failed to find title: %w", err)
+	}
+
+	parseState, err := s.ParseStateDAO.FindByTitleId(ctx, title.InternalId)
+	if err != nil {
+		return fmt.Errorf("failed to get parse state: %w", err)
+	}
+	if parseState != nil && parseState.LeavesOnly {
+		return fmt.Errorf("%w: %d, reparse the whole title", ErrLeavesOnlyTitle, titleNumber)
+	}
+
+	xmlContent, err := s.TitleDAO.GetContent(ctx, title.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get title content: %w", err)
+	}
+
+	options := parser.DefaultParserOptions()
+	options.MaxTextBytes = s.MaxTextBytes
+	cfrParser := parser.NewCfrParserWithOptions(title.InternalId, title.Name, options)
+	parseResult, err := cfrParser.ParseSubtree(xmlContent, data.DivTypePart, partIdentifier)
+	if err != nil {
+		return fmt.Errorf("failed to parse part %s: %w", partIdentifier, err)
+	}
+
+	linkParents(parseResult.Structures)
+
+	// The part is the first structure of the subtree, its parent is outside of it
+	part := parseResult.Structures[0]
+	if parentSegments := part.ParentPathSegments(); len(parentSegments) > 0 {
+		parent, err := s.CfrStructureDAO.FindByPath(ctx, title.Name, data.JoinPath(parentSegments))
 		if err != nil {
-			return fmt.Errorf("failed to insert structures: %w", err)
+			return fmt.Errorf("failed to find parent of part %s: %w", partIdentifier, err)
 		}
+		if parent == nil {
+			return fmt.Errorf(
+				"no stored parent %s of part %s, reparse the whole title",
+				data.JoinPath(parentSegments),
+				partIdentifier,
+			)
+		}
+		part.ParentId = &parent.InternalId
+	}
+
+	deleted, err := s.CfrStructureDAO.ReplaceSubtree(ctx, title.InternalId, part.Path, parseResult.Structures)
+	if err != nil {
+		return fmt.Errorf("failed to replace part %s: %w", partIdentifier, err)
 	}
 
+	cfrStructureLog.Info(
+		"Reparsed part",
+		"title", title.Name,
+		"part", partIdentifier,
+		"deleted", deleted,
+		"stored", len(parseResult.Structures),
+	)
 	return nil
 }
 
-// getParentPath extracts the parent path from a hierarchical path
-// e.g., "1/3/A/1" -> "1/3/A"
-func getParentPath(path string) string {
-	for i := len(path) - 1; i >= 0; i-- {
-		if path[i] == '/' {
-			return path[:i]
+// ImportFromStructureJSON stores the hierarchy of a title from the eCFR structure JSON instead of parsing its XML
+// The JSON is much smaller and is fetched for the title's latest date, but has no text, so every word count is 0.
+// Use it for a quick skeleton of a title when its text is not needed. The title's parse state is cleared, so the
+// next XML parse replaces the skeleton even if the content is unchanged.
+// Returns an error wrapping dao.ErrTitleNotFound if the title has not been imported
+func (s *CfrStructureService) ImportFromStructureJSON(
+	ctx context.Context,
+	titleNumber int,
+) (*TitleParseSummary, error) {
+	start := time.Now()
+
+	title, err := s.TitleDAO.FindByNumber(ctx, titleNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find title: %w", err)
+	}
+
+	date, err := s.latestTitleDate(ctx, titleNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.HttpClient.Get(ctx, fmt.Sprintf("/versioner/v1/structure/%s/title-%d.json", date, titleNumber))
+	if err != nil {
+		return nil, fmt.Errorf("title structure HTTP request failed, %w", err)
+	}
+	defer resp.Body.Close()
+
+	var root ecfrdata.StructureNode
+	if err := json.NewDecoder(resp.Body).Decode(&root); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal title structure, %w", err)
+	}
+
+	parseResult, err := parser.ParseStructureJSON(title.InternalId, titleNumber, &root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert title structure: %w", err)
+	}
+
+	linkParents(parseResult.Structures)
+
+	deleted, changed, err := s.CfrStructureDAO.ReplaceByTitleId(ctx, title.InternalId, parseResult.Structures)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replace existing structures: %w", err)
+	}
+
+	if err := s.ParseStateDAO.DeleteByTitleId(ctx, title.InternalId); err != nil {
+		return nil, fmt.Errorf("failed to clear parse state: %w", err)
+	}
+
+	sectionCount := 0
+	for _, structure := range parseResult.Structures {
+		if structure.DivType == data.DivTypeSection {
+			sectionCount++
+		}
+	}
+
+	summary := &TitleParseSummary{
+		TitleNumber:       titleNumber,
+		StructureCount:    len(parseResult.Structures),
+		ChangedStructures: int(changed),
+		SectionCount:      sectionCount,
+		DurationMs:        time.Since(start).Milliseconds(),
+	}
+
+	cfrStructureLog.Info(
+		"Imported title structure",
+		"title", titleNumber,
+		"date", date,
+		"deleted", deleted,
+		"structures", summary.StructureCount,
+		"changed", changed,
+		"durationMs", summary.DurationMs,
+	)
+
+	return summary, nil
+}
+
+// latestTitleDate returns the date the eCFR is up to date as of for a title, the latest date its structure is served
+func (s *CfrStructureService) latestTitleDate(
+	ctx context.Context,
+	titleNumber int,
+) (string, error) {
+	resp, err := s.HttpClient.Get(ctx, "/versioner/v1/titles.json")
+	if err != nil {
+		return "", fmt.Errorf("titles list HTTP request failed, %w", err)
+	}
+	defer resp.Body.Close()
+
+	var titlesResp ecfrdata.VersionerTitlesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&titlesResp); err != nil {
+		return "", fmt.Errorf("failed to unmarshal titles list, %w", err)
+	}
+
+	for _, title := range titlesResp.Titles {
+		if title.Number == titleNumber && title.UpToDateAsOf != "" {
+			return title.UpToDateAsOf, nil
 		}
 	}
-	return ""
+
+	return "", fmt.Errorf("no date listed for title %d", titleNumber)
 }
 
-func (s *CfrStructureService) logInfo(message string) {
-	log.Info(fmt.Sprintf("CFR Structure Process: %v", message))
+// headingPathSeparator joins the headings of a section's ancestors, see sectionsWithHeadingPaths
+const headingPathSeparator = " > "
+
+// sectionsWithHeadingPaths returns the sections of parsed structures, in document order, without their parents
+// Each section's HeadingPath is set from the headings of its ancestors, found by path key in pathMap
+func sectionsWithHeadingPaths(
+	structures []*data.CfrStructure,
+	pathMap map[string]*data.CfrStructure,
+) []*data.CfrStructure {
+	var sections []*data.CfrStructure
+	for _, structure := range structures {
+		if structure.DivType != data.DivTypeSection {
+			continue
+		}
+
+		var headings []string
+		for i := 1; i < len(structure.PathSegments); i++ {
+			ancestor, ok := pathMap[data.PathKey(structure.PathSegments[:i])]
+			if !ok {
+				continue
+			}
+
+			if ancestor.Heading != nil && *ancestor.Heading != "" {
+				headings = append(headings, *ancestor.Heading)
+			} else {
+				headings = append(headings, ancestor.DivType+" "+ancestor.Identifier)
+			}
+		}
+
+		headingPath := strings.Join(headings, headingPathSeparator)
+		structure.HeadingPath = &headingPath
+		structure.ParentId = nil
+		sections = append(sections, structure)
+	}
+
+	return sections
+}
+
+// RecomputeWordCounts recounts the words of a title's stored structure elements with the current parser.CountWords
+// Use it after a change to word counting to update counts without reparsing the title XML.
+// Stored metrics and version structures, which have no stored text, are not updated
+func (s *CfrStructureService) RecomputeWordCounts(
+	ctx context.Context,
+	titleNumber int,
+) error {
+	if _, err := s.TitleDAO.FindByNumber(ctx, titleNumber); err != nil {
+		return fmt.Errorf("failed to find title: %w", err)
+	}
+
+	updated, err := s.CfrStructureDAO.RecomputeWordCounts(ctx, titleNumber, parser.CountWords)
+	if err != nil {
+		return fmt.Errorf("failed to recompute word counts: %w", err)
+	}
+
+	cfrStructureLog.Info("Recomputed word counts", "title", titleNumber, "updated", updated)
+	return nil
+}
+
+// parseTitle processes a single title, logging the outcome and recording it in parse_errors
+// A failure adds a parse error row for the title and a success clears the title's rows
+func (s *CfrStructureService) parseTitle(
+	ctx context.Context,
+	title *data.Title,
+	force bool,
+	captureRawXML bool,
+	leavesOnly bool,
+) (*TitleParseSummary, error) {
+	cfrStructureLog.Debug("Processing title", "title", title.Name)
+
+	start := time.Now()
+	summary, err := s.processTitle(ctx, title, force, captureRawXML, leavesOnly)
+	if err != nil {
+		cfrStructureLog.Error(
+			"Failed to parse title",
+			"title", title.Name,
+			"durationMs", time.Since(start).Milliseconds(),
+			"error", err,
+		)
+		metrics.TitlesParsed.WithLabelValues(metrics.ParseResultFailed).Inc()
+		metrics.Errors.WithLabelValues(metrics.OperationParse).Inc()
+		if recordErr := s.ParseErrorDAO.Insert(ctx, title.Name, err.Error()); recordErr != nil {
+			cfrStructureLog.Error("Failed to record parse error", "title", title.Name, "error", recordErr)
+		}
+		return nil, fmt.Errorf("title %d: %w", title.Name, err)
+	}
+	summary.DurationMs = time.Since(start).Milliseconds()
+
+	if err := s.ParseErrorDAO.DeleteByTitleNumber(ctx, title.Name); err != nil {
+		cfrStructureLog.Error("Failed to clear parse errors", "title", title.Name, "error", err)
+	}
+
+	if summary.Skipped {
+		metrics.TitlesParsed.WithLabelValues(metrics.ParseResultSkipped).Inc()
+		cfrStructureLog.Info("Skipped title, unchanged since last parse", "title", title.Name)
+		return summary, nil
+	}
+
+	metrics.TitlesParsed.WithLabelValues(metrics.ParseResultParsed).Inc()
+	metrics.TitleParseDuration.Observe(time.Since(start).Seconds())
+
+	cfrStructureLog.Info(
+		"Parsed title",
+		"title", title.Name,
+		"structures", summary.StructureCount,
+		"sections", summary.SectionCount,
+		"words", summary.TotalWords,
+		"durationMs", summary.DurationMs,
+	)
+	return summary, nil
+}
+
+// ProcessTitleVersion parses the stored content of a title version and stores its structure
+// The structure is kept apart from the title's current structure and replaces any stored before for the version.
+// Returns an error wrapping ErrVersionNotFound if the version has not been imported
+func (s *CfrStructureService) ProcessTitleVersion(
+	ctx context.Context,
+	titleNumber int,
+	versionDate time.Time,
+) (*TitleParseSummary, error) {
+	start := time.Now()
+
+	version, err := s.TitleVersionDAO.GetContentByVersion(ctx, titleNumber, versionDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version %s: %w", versionDate.Format("2006-01-02"), err)
+	}
+
+	if version == nil {
+		return nil, fmt.Errorf(
+			"%w: title %d, %s",
+			ErrVersionNotFound,
+			titleNumber,
+			versionDate.Format("2006-01-02"),
+		)
+	}
+
+	cfrParser := parser.NewCfrParser(version.TitleId, titleNumber)
+	parseResult, err := cfrParser.Parse(version.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse version %s: %w", versionDate.Format("2006-01-02"), err)
+	}
+
+	err = s.CfrStructureDAO.ReplaceForVersion(ctx, titleNumber, versionDate, parseResult.Structures)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store version structures: %w", err)
+	}
+
+	sectionCount := 0
+	for _, structure := range parseResult.Structures {
+		if structure.DivType == data.DivTypeSection {
+			sectionCount++
+		}
+	}
+	warnZeroWordSections(titleNumber, parseResult, sectionCount)
+
+	summary := &TitleParseSummary{
+		TitleNumber:       titleNumber,
+		StructureCount:    len(parseResult.Structures),
+		ChangedStructures: len(parseResult.Structures),
+		SectionCount:      sectionCount,
+		TotalWords:        parseResult.TotalWords,
+		UniqueWords:       parseResult.UniqueWordCount,
+		ZeroWordSections:  parseResult.ZeroWordStructures,
+		DurationMs:        time.Since(start).Milliseconds(),
+	}
+
+	cfrStructureLog.Info(
+		"Parsed title version",
+		"title", titleNumber,
+		"versionDate", versionDate.Format("2006-01-02"),
+		"structures", summary.StructureCount,
+		"durationMs", summary.DurationMs,
+	)
+
+	return summary, nil
+}
+
+// GetStructuresByVersion returns the structure parsed from a title version by ProcessTitleVersion
+func (s *CfrStructureService) GetStructuresByVersion(
+	ctx context.Context,
+	titleNumber int,
+	versionDate time.Time,
+) ([]*data.CfrStructure, error) {
+	structures, err := s.CfrStructureDAO.FindByTitleAndVersionDate(ctx, titleNumber, versionDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find version structures: %w", err)
+	}
+
+	return structures, nil
+}
+
+// ConsistencyReport compares the metrics of a fresh parse of a title with the totals of its stored structures
+// A mismatch means the parser changed since the title was stored, or the stored structures are incomplete
+type ConsistencyReport struct {
+	TitleNumber    int  `json:"titleNumber"`
+	ParsedWords    int  `json:"parsedWords"`
+	StoredWords    int  `json:"storedWords"`
+	WordDelta      int  `json:"wordDelta"` // Parsed minus stored
+	ParsedSections int  `json:"parsedSections"`
+	StoredSections int  `json:"storedSections"`
+	SectionDelta   int  `json:"sectionDelta"` // Parsed minus stored
+	Consistent     bool `json:"consistent"`
+}
+
+// VerifyMetricsConsistency reparses the current content of a title, without storing it,
+// and compares its word and section counts with the totals of the stored structures
+// Returns an error wrapping dao.ErrTitleNotFound if the title has not been imported
+func (s *CfrStructureService) VerifyMetricsConsistency(
+	ctx context.Context,
+	titleNumber int,
+) (*ConsistencyReport, error) {
+	title, err := s.TitleDAO.FindByNumber(ctx, titleNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find title: %w", err)
+	}
+
+	xmlContent, err := s.TitleDAO.GetContent(ctx, titleNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get title content: %w", err)
+	}
+
+	parsed, err := parseVersionMetrics(title.InternalId, titleNumber, xmlContent)
+	if err != nil {
+		return nil, err
+	}
+
+	storedWords, storedSections, err := s.CfrStructureDAO.SumMetricsForTitle(ctx, titleNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum stored structure metrics: %w", err)
+	}
+
+	report := &ConsistencyReport{
+		TitleNumber:    titleNumber,
+		ParsedWords:    parsed.TotalWords,
+		StoredWords:    storedWords,
+		WordDelta:      parsed.TotalWords - storedWords,
+		ParsedSections: parsed.TotalSections,
+		StoredSections: storedSections,
+		SectionDelta:   parsed.TotalSections - storedSections,
+	}
+	report.Consistent = report.WordDelta == 0 && report.SectionDelta == 0
+
+	if !report.Consistent {
+		cfrStructureLog.Warn(
+			"Stored structure metrics differ from a fresh parse",
+			"title", titleNumber,
+			"wordDelta", report.WordDelta,
+			"sectionDelta", report.SectionDelta,
+		)
+	}
+
+	return report, nil
+}
+
+// GetParseErrors returns the recorded parse errors of titles that are currently failing, most recent first
+func (s *CfrStructureService) GetParseErrors(
+	ctx context.Context,
+) ([]*data.ParseError, error) {
+	parseErrors, err := s.ParseErrorDAO.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find parse errors: %w", err)
+	}
+
+	return parseErrors, nil
+}
+
+// GetParseStatus returns when each parsed title was last parsed successfully and how many structure elements were
+// stored, ordered by title number
+// A title that was skipped as unchanged keeps the time of the parse that stored its structure
+func (s *CfrStructureService) GetParseStatus(
+	ctx context.Context,
+) ([]*data.ParseState, error) {
+	states, err := s.ParseStateDAO.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find parse states: %w", err)
+	}
+
+	return states, nil
+}
+
+// GetPendingTitles returns the numbers of the imported titles that have not been parsed yet, in order
+// A title whose parse failed before storing anything is included, see GetParseErrors for why
+func (s *CfrStructureService) GetPendingTitles(
+	ctx context.Context,
+) ([]int, error) {
+	titles, err := s.CfrStructureDAO.TitlesWithoutStructures(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find titles without structures: %w", err)
+	}
+
+	return titles, nil
+}
+
+// GetStructuresByPaths returns the structure elements of a title for the given paths
+func (s *CfrStructureService) GetStructuresByPaths(
+	ctx context.Context,
+	titleNumber int,
+	paths []string,
+) ([]*data.CfrStructure, error) {
+	if len(paths) == 0 {
+		return []*data.CfrStructure{}, nil
+	}
+
+	structures, err := s.CfrStructureDAO.FindByPaths(ctx, titleNumber, paths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find structures by paths: %w", err)
+	}
+
+	return structures, nil
+}
+
+// GetLargestSections returns the sections of a title with the highest word counts
+func (s *CfrStructureService) GetLargestSections(
+	ctx context.Context,
+	titleNumber int,
+	limit int,
+) ([]*data.CfrStructure, error) {
+	sections, err := s.CfrStructureDAO.FindLargestSections(ctx, titleNumber, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find largest sections: %w", err)
+	}
+
+	return sections, nil
+}
+
+// FindDuplicateSections groups the sections of a title whose text is identical or similar, see
+// textdiff.ClusterDuplicates. A similarityThreshold of 1 groups sections with identical text only.
+// Sections with fewer than textdiff.ShingleSize words, such as reserved sections, are never grouped, nor are sections
+// whose stored text was truncated, as different sections can share a truncated prefix.
+// Returns the groups in document order of their first section, or an error wrapping ErrInvalidSimilarityThreshold
+func (s *CfrStructureService) FindDuplicateSections(
+	ctx context.Context,
+	titleNumber int,
+	similarityThreshold float64,
+) ([][]*data.CfrStructure, error) {
+	if similarityThreshold <= 0 || similarityThreshold > 1 {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSimilarityThreshold, similarityThreshold)
+	}
+
+	if _, err := s.TitleDAO.FindByNumber(ctx, titleNumber); err != nil {
+		return nil, fmt.Errorf("failed to find title: %w", err)
+	}
+
+	sections, err := s.CfrStructureDAO.FindByDivType(ctx, titleNumber, data.DivTypeSection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find sections: %w", err)
+	}
+
+	sections = slices.DeleteFunc(sections, func(section *data.CfrStructure) bool {
+		return section.TextTruncated
+	})
+
+	texts := make([]string, len(sections))
+	for i, section := range sections {
+		if section.TextContent != nil {
+			texts[i] = *section.TextContent
+		}
+	}
+
+	duplicates := [][]*data.CfrStructure{}
+	for _, group := range textdiff.ClusterDuplicates(texts, similarityThreshold) {
+		duplicateSections := make([]*data.CfrStructure, len(group))
+		for i, index := range group {
+			duplicateSections[i] = sections[index]
+		}
+		duplicates = append(duplicates, duplicateSections)
+	}
+
+	return duplicates, nil
+}
+
+// GetStructuresByWordCount returns the structure elements of a title with a word count between minWords and maxWords,
+// inclusive
+func (s *CfrStructureService) GetStructuresByWordCount(
+	ctx context.Context,
+	titleNumber int,
+	minWords int,
+	maxWords int,
+) ([]*data.CfrStructure, error) {
+	structures, err := s.CfrStructureDAO.FindByWordCountRange(ctx, titleNumber, minWords, maxWords)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find structures by word count: %w", err)
+	}
+
+	return structures, nil
+}
+
+// DefaultWordCountBucketEdges are the upper bounds of the word count buckets of GetWordCountHistogram
+var DefaultWordCountBucketEdges = []int{50, 100, 250, 500, 1000, 2500, 5000}
+
+// GetWordCountHistogram counts the sections of a title in word count buckets, see dao.CfrStructureDAO.WordCountHistogram
+func (s *CfrStructureService) GetWordCountHistogram(
+	ctx context.Context,
+	titleNumber int,
+	bucketEdges []int,
+) (map[string]int, error) {
+	histogram, err := s.CfrStructureDAO.WordCountHistogram(ctx, titleNumber, bucketEdges)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count sections by word count: %w", err)
+	}
+
+	return histogram, nil
+}
+
+// GetLevelDistribution returns the number of structure elements of a title at each div level and the deepest level
+func (s *CfrStructureService) GetLevelDistribution(
+	ctx context.Context,
+	titleNumber int,
+) (*data.LevelDistribution, error) {
+	levels, err := s.CfrStructureDAO.LevelDistribution(ctx, titleNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find level distribution: %w", err)
+	}
+
+	distribution := &data.LevelDistribution{
+		Title:  titleNumber,
+		Levels: levels,
+	}
+	for level := range levels {
+		distribution.MaxDepth = max(distribution.MaxDepth, level)
+	}
+
+	return distribution, nil
 }
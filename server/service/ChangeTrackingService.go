@@ -3,46 +3,161 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/gofiber/fiber/v2/log"
+	"github.com/sam-berry/ecfr-analyzer/server/concurrent"
 	"github.com/sam-berry/ecfr-analyzer/server/dao"
 	"github.com/sam-berry/ecfr-analyzer/server/data"
+	"github.com/sam-berry/ecfr-analyzer/server/logging"
 	"github.com/sam-berry/ecfr-analyzer/server/parser"
+	"github.com/sam-berry/ecfr-analyzer/server/textdiff"
+	"math"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// ErrVersionNotFound is returned when a requested title version has not been imported
+var ErrVersionNotFound = errors.New("no stored version of title")
+
+// ErrNotEnoughVersions is returned when a title has too few stored versions to compare, fewer than two unless noted
+var ErrNotEnoughVersions = errors.New("not enough stored versions of title")
+
+// ErrInvalidPeriod is returned when a calendar period is not one of week, month, or quarter
+var ErrInvalidPeriod = errors.New("period must be one of week, month, or quarter")
+
+// ErrInvalidMatchBy is returned for a section match key other than data.MatchByNodeId or data.MatchByPath
+var ErrInvalidMatchBy = errors.New("matchBy must be one of nodeId or path")
+
+// ErrInvalidScoreWeights is returned for change score weights that are negative or both zero
+var ErrInvalidScoreWeights = errors.New("score weights must not be negative and at least one must be positive")
+
+// ErrNoAgencyGrowth is returned when no agency's words grew between two dates
+var ErrNoAgencyGrowth = errors.New("no agency grew")
+
+var changeTrackingLog = logging.New("change-tracking")
+
 type ChangeTrackingService struct {
 	TitleVersionDAO  *dao.TitleVersionDAO
 	ComputedValueDAO *dao.ComputedValueDAO
 	TitleDAO         *dao.TitleDAO
+	CfrStructureDAO  *dao.CfrStructureDAO
+	AgencyDAO        *dao.AgencyDAO
+
+	// VersionMetricsCache keeps the metrics of parsed versions, optional
+	VersionMetricsCache *VersionMetricsCache
+
+	// computing deduplicates concurrent identical computations, keyed by computed value key
+	computing concurrent.InFlight
 }
 
 // TitleChange represents changes in a title between two versions
 type TitleChange struct {
-	TitleNumber         int       `json:"titleNumber"`
-	StartDate           time.Time `json:"startDate"`
-	EndDate             time.Time `json:"endDate"`
-	WordCountChange     int       `json:"wordCountChange"`     // Positive = added, negative = removed
-	SectionCountChange  int       `json:"sectionCountChange"`  // Positive = added, negative = removed
-	TotalWordsStart     int       `json:"totalWordsStart"`
-	TotalWordsEnd       int       `json:"totalWordsEnd"`
-	TotalSectionsStart  int       `json:"totalSectionsStart"`
-	TotalSectionsEnd    int       `json:"totalSectionsEnd"`
-	PercentWordChange   float64   `json:"percentWordChange"`
-	PercentSectionChange float64  `json:"percentSectionChange"`
+	TitleNumber          int       `json:"titleNumber"`
+	StartDate            time.Time `json:"startDate"`
+	EndDate              time.Time `json:"endDate"`
+	StartEffectiveDate   time.Time `json:"startEffectiveDate"` // Date the start content is effective
+	EndEffectiveDate     time.Time `json:"endEffectiveDate"`   // Date the end content is effective
+	WordCountChange      int       `json:"wordCountChange"`    // Positive = added, negative = removed
+	SectionCountChange   int       `json:"sectionCountChange"` // Positive = added, negative = removed
+	TotalWordsStart      int       `json:"totalWordsStart"`
+	TotalWordsEnd        int       `json:"totalWordsEnd"`
+	TotalSectionsStart   int       `json:"totalSectionsStart"`
+	TotalSectionsEnd     int       `json:"totalSectionsEnd"`
+	PercentWordChange    float64   `json:"percentWordChange"`
+	PercentSectionChange float64   `json:"percentSectionChange"`
+
+	// A change from zero has no meaningful percentage, so these flag it and the percentage is left at 0
+	IsNew         bool `json:"isNew"`         // Words went from zero to non-zero
+	IsNewSections bool `json:"isNewSections"` // Sections went from zero to non-zero
+
+	// Reserved sections counted by the section totals, see parser.IsReservedSection
+	ReservedSectionsStart int `json:"reservedSectionsStart"`
+	ReservedSectionsEnd   int `json:"reservedSectionsEnd"`
+
+	// ExcludesReserved is set when reserved sections were left out of the section totals and change
+	ExcludesReserved bool `json:"excludesReserved"`
+
+	// SameSnapshot is set when different stored versions were compared whose content is effective on the same date,
+	// so the content is the same snapshot and any change between the dates is not seen
+	SameSnapshot bool `json:"sameSnapshot"`
+
+	// Set when ranked by GetTopChangingTitles, see ScoreWeights
+	ChangeScore  float64       `json:"changeScore,omitempty"`
+	ScoreWeights *ScoreWeights `json:"scoreWeights,omitempty"` // Weights ChangeScore was computed with
+}
+
+// ScoreWeights weight the word and section changes of a title into its change score,
+// Words*|WordCountChange| + Sections*|SectionCountChange|
+type ScoreWeights struct {
+	Words    float64 `json:"words"`
+	Sections float64 `json:"sections"`
+}
+
+// DefaultScoreWeights rank titles by their absolute word change alone
+var DefaultScoreWeights = ScoreWeights{Words: 1, Sections: 0}
+
+// Validate returns ErrInvalidScoreWeights if a weight is negative or both are zero
+func (w ScoreWeights) Validate() error {
+	if w.Words < 0 || w.Sections < 0 || (w.Words == 0 && w.Sections == 0) {
+		return ErrInvalidScoreWeights
+	}
+	return nil
+}
+
+// Score computes the change score of a title change
+func (w ScoreWeights) Score(change TitleChange) float64 {
+	return w.Words*float64(abs(change.WordCountChange)) + w.Sections*float64(abs(change.SectionCountChange))
 }
 
 // ComputeChangesForDateRange computes changes for all titles between two dates
+// excludeReserved leaves reserved sections out of the section counts of each change, see TitleChange.
+// A request identical to one already in progress waits for that computation instead of running its own
 func (s *ChangeTrackingService) ComputeChangesForDateRange(
 	ctx context.Context,
 	startDate time.Time,
 	endDate time.Time,
 	titlesFilter []string,
+	excludeReserved bool,
 ) error {
-	s.logInfo(fmt.Sprintf("Computing changes from %s to %s",
+	key := data.CreateComputedValueKey(
+		"title-changes",
 		startDate.Format("2006-01-02"),
-		endDate.Format("2006-01-02")))
+		endDate.Format("2006-01-02"),
+	)
+
+	// The filter and exclusion are part of the identity since they change what is stored under the key
+	identity := data.CreateComputedValueKey(
+		key,
+		strings.Join(titlesFilter, ","),
+		strconv.FormatBool(excludeReserved),
+	)
+
+	shared, err := s.computing.Do(ctx, identity, func() error {
+		return s.computeChangesForDateRange(ctx, key, startDate, endDate, titlesFilter, excludeReserved)
+	})
+	if shared {
+		changeTrackingLog.Info("Joined in-progress computation of changes", "key", key)
+	}
+
+	return err
+}
+
+// computeChangesForDateRange computes changes for all titles between two dates and stores them under key
+func (s *ChangeTrackingService) computeChangesForDateRange(
+	ctx context.Context,
+	key string,
+	startDate time.Time,
+	endDate time.Time,
+	titlesFilter []string,
+	excludeReserved bool,
+) error {
+	changeTrackingLog.Info(
+		"Computing changes",
+		"startDate", startDate.Format("2006-01-02"),
+		"endDate", endDate.Format("2006-01-02"),
+	)
 
 	// Get all titles
 	titles, err := s.TitleDAO.FindAll(ctx)
@@ -71,15 +186,20 @@ func (s *ChangeTrackingService) ComputeChangesForDateRange(
 	for _, title := range titles {
 		change, err := s.computeTitleChange(ctx, title.Name, startDate, endDate)
 		if err != nil {
-			s.logInfo(fmt.Sprintf("Failed to compute change for title %d: %v", title.Name, err))
+			changeTrackingLog.Warn("Failed to compute change", "title", title.Name, "error", err)
 			continue
 		}
+		if excludeReserved {
+			change.excludeReservedSections()
+		}
 
 		allChanges = append(allChanges, *change)
-		s.logInfo(fmt.Sprintf("Title %d: %d words changed, %d sections changed",
-			title.Name,
-			change.WordCountChange,
-			change.SectionCountChange))
+		changeTrackingLog.Info(
+			"Computed title change",
+			"title", title.Name,
+			"wordCountChange", change.WordCountChange,
+			"sectionCountChange", change.SectionCountChange,
+		)
 	}
 
 	// Store the computed changes
@@ -89,9 +209,7 @@ func (s *ChangeTrackingService) ComputeChangesForDateRange(
 	}
 
 	cv := &data.ComputedValue{
-		Key:  fmt.Sprintf("title-changes__%s__%s",
-			startDate.Format("2006-01-02"),
-			endDate.Format("2006-01-02")),
+		Key:  key,
 		Data: changeBytes,
 	}
 
@@ -100,204 +218,1524 @@ func (s *ChangeTrackingService) ComputeChangesForDateRange(
 		return fmt.Errorf("failed to store changes: %w", err)
 	}
 
-	s.logInfo(fmt.Sprintf("Successfully computed changes for %d titles", len(allChanges)))
+	changeTrackingLog.Info("Successfully computed changes", "count", len(allChanges))
 	return nil
 }
 
-// computeTitleChange computes the change for a single title between two dates
-func (s *ChangeTrackingService) computeTitleChange(
+// GetLatestChange returns the change of a title between its two most recent stored versions
+// The change is computed on first request and stored, keyed by title and version dates.
+// A reimport of either version date does not invalidate the stored change.
+func (s *ChangeTrackingService) GetLatestChange(
 	ctx context.Context,
 	titleNumber int,
-	startDate time.Time,
-	endDate time.Time,
 ) (*TitleChange, error) {
-	// Get version for start date
-	startVersion, err := s.TitleVersionDAO.GetContentByVersion(ctx, titleNumber, startDate)
-	if err != nil || startVersion == nil {
-		return nil, fmt.Errorf("failed to get start version: %w", err)
+	versions, err := s.TitleVersionDAO.FindByTitleNumber(ctx, titleNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find versions: %w", err)
 	}
 
-	// Get version for end date
-	endVersion, err := s.TitleVersionDAO.GetContentByVersion(ctx, titleNumber, endDate)
-	if err != nil || endVersion == nil {
-		return nil, fmt.Errorf("failed to get end version: %w", err)
+	if len(versions) < 2 {
+		return nil, fmt.Errorf("%w: %d has %d", ErrNotEnoughVersions, titleNumber, len(versions))
 	}
 
-	// Parse both versions
-	startMetrics, err := s.parseVersionMetrics(startVersion.TitleId, titleNumber, startVersion.Content)
+	// Versions are ordered by version date, most recent first
+	startDate := versions[1].VersionDate
+	endDate := versions[0].VersionDate
+
+	key := titleChangeKey(titleNumber, startDate, endDate)
+
+	change, err := s.findStoredChange(ctx, key)
+	if err != nil || change != nil {
+		return change, err
+	}
+
+	// Concurrent first requests share a single computation
+	shared, err := s.computing.Do(ctx, key, func() error {
+		var err error
+		change, err = s.computeStoredChange(ctx, key, titleNumber, startDate, endDate)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse start version: %w", err)
+		return nil, err
+	}
+
+	if shared {
+		return s.findStoredChange(ctx, key)
 	}
 
-	endMetrics, err := s.parseVersionMetrics(endVersion.TitleId, titleNumber, endVersion.Content)
+	return change, nil
+}
+
+// BackfillSummary reports the progress of BackfillAdjacentChanges over the version pairs of a title
+// Remaining pairs failed or were not started, running the backfill again computes them.
+type BackfillSummary struct {
+	TitleNumber int `json:"titleNumber"`
+	Pairs       int `json:"pairs"`
+	Skipped     int `json:"skipped"`  // Pairs already stored when the backfill started
+	Computed    int `json:"computed"` // Pairs stored by this backfill
+	Remaining   int `json:"remaining"`
+}
+
+// BackfillAdjacentChanges computes and stores the change between each pair of consecutive stored versions of a title
+// Pairs are stored under the same keys as GetLatestChange, and the stored change of a pair is its checkpoint: the
+// keys stored for the title are read once at the start and their pairs are skipped, so a backfill that is canceled
+// or fails resumes where it left off when run again, e.g., by resuming its job. Canceling ctx stops the backfill,
+// the summary counts the pairs stored until then.
+func (s *ChangeTrackingService) BackfillAdjacentChanges(
+	ctx context.Context,
+	titleNumber int,
+) (*BackfillSummary, error) {
+	versions, err := s.TitleVersionDAO.FindByTitleNumber(ctx, titleNumber)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse end version: %w", err)
+		return nil, fmt.Errorf("failed to find versions: %w", err)
 	}
 
-	// Compute changes
-	wordChange := endMetrics.TotalWords - startMetrics.TotalWords
-	sectionChange := endMetrics.TotalSections - startMetrics.TotalSections
+	if len(versions) < 2 {
+		return nil, fmt.Errorf("%w: %d has %d", ErrNotEnoughVersions, titleNumber, len(versions))
+	}
 
-	// Compute percentages
-	var percentWordChange float64
-	if startMetrics.TotalWords > 0 {
-		percentWordChange = float64(wordChange) / float64(startMetrics.TotalWords) * 100
+	completed, err := s.ComputedValueDAO.FindKeysByPrefix(ctx, titleChangeKeyPrefix(titleNumber))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stored changes of title %d: %w", titleNumber, err)
+	}
+	completedKeys := make(map[string]bool, len(completed))
+	for _, key := range completed {
+		completedKeys[key] = true
 	}
 
-	var percentSectionChange float64
-	if startMetrics.TotalSections > 0 {
-		percentSectionChange = float64(sectionChange) / float64(startMetrics.TotalSections) * 100
+	summary := &BackfillSummary{TitleNumber: titleNumber, Pairs: len(versions) - 1}
+
+	// Versions are ordered by version date, most recent first
+	pairs := make([]versionPair, 0, len(versions)-1)
+	for i := len(versions) - 1; i > 0; i-- {
+		pair := versionPair{
+			startDate: versions[i].VersionDate,
+			endDate:   versions[i-1].VersionDate,
+		}
+		if completedKeys[titleChangeKey(titleNumber, pair.startDate, pair.endDate)] {
+			summary.Skipped++
+			continue
+		}
+		pairs = append(pairs, pair)
 	}
 
-	return &TitleChange{
-		TitleNumber:          titleNumber,
-		StartDate:            startDate,
-		EndDate:              endDate,
-		WordCountChange:      wordChange,
-		SectionCountChange:   sectionChange,
-		TotalWordsStart:      startMetrics.TotalWords,
-		TotalWordsEnd:        endMetrics.TotalWords,
-		TotalSectionsStart:   startMetrics.TotalSections,
-		TotalSectionsEnd:     endMetrics.TotalSections,
-		PercentWordChange:    percentWordChange,
-		PercentSectionChange: percentSectionChange,
-	}, nil
+	log := changeTrackingLog.With("title", titleNumber)
+	log.Info("Start - Backfilling adjacent changes", "pairs", summary.Pairs, "skipped", summary.Skipped)
+
+	runner := concurrent.NewRunner[versionPair, bool](concurrent.RunnerConfig{
+		MaxConcurrency: 4,
+		LogPrefix:      fmt.Sprintf("Change Backfill (%d)", titleNumber),
+	})
+
+	// A pair stored since the checkpoint was read, e.g., by GetLatestChange, is not computed again
+	result := runner.RunSimple(ctx, pairs, func(ctx context.Context, pair versionPair) (bool, error) {
+		key := titleChangeKey(titleNumber, pair.startDate, pair.endDate)
+
+		stored, err := s.findStoredChange(ctx, key)
+		if err != nil || stored != nil {
+			return err == nil, err
+		}
+
+		_, err = s.computing.Do(ctx, key, func() error {
+			_, err := s.computeStoredChange(ctx, key, titleNumber, pair.startDate, pair.endDate)
+			return err
+		})
+		return err == nil, err
+	})
+
+	summary.Computed = len(result.Results)
+	summary.Remaining = summary.Pairs - summary.Skipped - summary.Computed
+
+	if len(result.Errors) > 0 {
+		return summary, fmt.Errorf(
+			"failed to backfill %d of %d version pairs of title %d: %w",
+			summary.Remaining,
+			summary.Pairs,
+			titleNumber,
+			errors.Join(result.Errors...),
+		)
+	}
+
+	log.Info("Complete", "computed", summary.Computed, "skipped", summary.Skipped)
+	return summary, nil
 }
 
-// VersionMetrics holds metrics for a specific version
-type VersionMetrics struct {
-	TotalWords    int
-	TotalSections int
+// CompareVersions computes the change of a title between two dates without storing it
+// Each date uses the latest stored version on or before it, and reserved sections are excluded if set, like
+// ComputeChangesForDateRange
+func (s *ChangeTrackingService) CompareVersions(
+	ctx context.Context,
+	titleNumber int,
+	fromDate time.Time,
+	toDate time.Time,
+	excludeReserved bool,
+) (*TitleChange, error) {
+	change, err := s.computeTitleChange(ctx, titleNumber, fromDate, toDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare versions of title %d: %w", titleNumber, err)
+	}
+	if excludeReserved {
+		change.excludeReservedSections()
+	}
+
+	return change, nil
 }
 
-// parseVersionMetrics parses a version and extracts metrics
-func (s *ChangeTrackingService) parseVersionMetrics(
-	titleId int,
+// averageMonth is the length of a month averaged over a year, including leap years
+const averageMonth = time.Duration(365.25 * 24 / 12 * float64(time.Hour))
+
+// MonthsDuration is the duration of a number of average months, for ChangeVelocity windows
+func MonthsDuration(months int) time.Duration {
+	return time.Duration(months) * averageMonth
+}
+
+// ChangeVelocity is how fast a title has been changing over a window of time ending now
+// When fewer than two stored versions span the window, EnoughVersions is false and the velocity is 0.
+type ChangeVelocity struct {
+	TitleNumber             int       `json:"titleNumber"`
+	WindowStart             time.Time `json:"windowStart"`
+	WindowEnd               time.Time `json:"windowEnd"`
+	Changes                 int       `json:"changes"` // Pairs of consecutive versions ending within the window
+	TotalAbsoluteWordChange int       `json:"totalAbsoluteWordChange"`
+	WordChangePerMonth      float64   `json:"wordChangePerMonth"`
+	EnoughVersions          bool      `json:"enoughVersions"`
+}
+
+// ChangeVelocity computes the average absolute word change per month of a title over the window ending now
+// The changes between each pair of consecutive stored versions whose later version is within the window are summed,
+// using the changes stored by BackfillAdjacentChanges and computing and storing those missing.
+func (s *ChangeTrackingService) ChangeVelocity(
+	ctx context.Context,
 	titleNumber int,
-	content string,
-) (*VersionMetrics, error) {
-	cfrParser := parser.NewCfrParser(titleId, titleNumber)
-	parseResult, err := cfrParser.Parse(content)
+	window time.Duration,
+) (*ChangeVelocity, error) {
+	windowEnd := time.Now().UTC()
+	velocity := &ChangeVelocity{
+		TitleNumber: titleNumber,
+		WindowStart: windowEnd.Add(-window),
+		WindowEnd:   windowEnd,
+	}
+
+	versions, err := s.TitleVersionDAO.FindByTitleNumber(ctx, titleNumber)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse version: %w", err)
+		return nil, fmt.Errorf("failed to find versions: %w", err)
 	}
 
-	// Count sections (DIV8 elements)
-	sectionCount := 0
-	for _, structure := range parseResult.Structures {
-		if structure.DivType == data.DivTypeSection {
-			sectionCount++
+	// Versions are ordered by version date, most recent first
+	for i := 0; i < len(versions)-1; i++ {
+		endDate := versions[i].VersionDate
+		if endDate.Before(velocity.WindowStart) {
+			break
+		}
+		startDate := versions[i+1].VersionDate
+
+		change, err := s.adjacentChange(ctx, titleNumber, startDate, endDate)
+		if err != nil {
+			return nil, err
 		}
+
+		velocity.Changes++
+		velocity.TotalAbsoluteWordChange += abs(change.WordCountChange)
 	}
 
-	return &VersionMetrics{
-		TotalWords:    parseResult.TotalWords,
-		TotalSections: sectionCount,
-	}, nil
+	if velocity.Changes == 0 || window <= 0 {
+		return velocity, nil
+	}
+
+	velocity.EnoughVersions = true
+	velocity.WordChangePerMonth = float64(velocity.TotalAbsoluteWordChange) / (float64(window) / float64(averageMonth))
+
+	return velocity, nil
 }
 
-// GetChangeSummary retrieves a summary of changes across all titles for a date range
-func (s *ChangeTrackingService) GetChangeSummary(
+// AnomalyZScoreThreshold is how many standard deviations from the mean of a title's other changes between
+// consecutive versions a change must be for DetectAnomalies to flag it
+var AnomalyZScoreThreshold = 3.0
+
+// MinAnomalyChanges is the fewest changes between consecutive versions, i.e., one less than the number of versions,
+// DetectAnomalies needs to tell an outlier from a title's usual change
+var MinAnomalyChanges = 4
+
+// minAnomalyStdDev is the smallest standard deviation, in words, a change is compared against, so a title whose other
+// changes are all equal still has a finite z-score
+const minAnomalyStdDev = 1.0
+
+// Anomaly is a change between consecutive versions of a title that is far from the title's usual change
+type Anomaly struct {
+	TitleNumber      int       `json:"titleNumber"`
+	StartDate        time.Time `json:"startDate"`
+	EndDate          time.Time `json:"endDate"`
+	WordCountChange  int       `json:"wordCountChange"`
+	MeanWordChange   float64   `json:"meanWordChange"`   // Mean of the title's other changes
+	StdDevWordChange float64   `json:"stdDevWordChange"` // Standard deviation of the title's other changes
+	ZScore           float64   `json:"zScore"`           // Standard deviations from the mean, negative for shrinking
+}
+
+// DetectAnomalies flags the changes between consecutive stored versions of a title whose word change is more than
+// AnomalyZScoreThreshold standard deviations from the mean of the title's other changes, oldest first
+// Each change is left out of the mean and standard deviation it is compared against, so a single large change is not
+// hidden by inflating them. The changes stored by BackfillAdjacentChanges are used, computing and storing those
+// missing, so backfill a title with many versions first. Returns an error wrapping ErrNotEnoughVersions if the title
+// has fewer than MinAnomalyChanges changes.
+func (s *ChangeTrackingService) DetectAnomalies(
+	ctx context.Context,
+	titleNumber int,
+) ([]Anomaly, error) {
+	versions, err := s.TitleVersionDAO.FindByTitleNumber(ctx, titleNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find versions: %w", err)
+	}
+
+	if len(versions)-1 < MinAnomalyChanges {
+		return nil, fmt.Errorf(
+			"%w: %d has %d, detecting anomalies needs %d",
+			ErrNotEnoughVersions,
+			titleNumber,
+			len(versions),
+			MinAnomalyChanges+1,
+		)
+	}
+
+	// Versions are ordered by version date, most recent first
+	changes := make([]*TitleChange, 0, len(versions)-1)
+	for i := len(versions) - 1; i > 0; i-- {
+		change, err := s.adjacentChange(ctx, titleNumber, versions[i].VersionDate, versions[i-1].VersionDate)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	anomalies := flagAnomalies(titleNumber, changes, AnomalyZScoreThreshold)
+
+	changeTrackingLog.Debug(
+		"Detected anomalies",
+		"title", titleNumber,
+		"changes", len(changes),
+		"anomalies", len(anomalies),
+	)
+
+	return anomalies, nil
+}
+
+// flagAnomalies returns the changes whose word change is more than threshold standard deviations from the mean of
+// the other changes, in the order of changes
+func flagAnomalies(titleNumber int, changes []*TitleChange, threshold float64) []Anomaly {
+	var sum, sumOfSquares float64
+	for _, change := range changes {
+		words := float64(change.WordCountChange)
+		sum += words
+		sumOfSquares += words * words
+	}
+
+	anomalies := []Anomaly{}
+	others := float64(len(changes) - 1)
+	if others < 1 {
+		return anomalies
+	}
+
+	for _, change := range changes {
+		words := float64(change.WordCountChange)
+		mean := (sum - words) / others
+		variance := max((sumOfSquares-words*words)/others-mean*mean, 0)
+		stdDev := max(math.Sqrt(variance), minAnomalyStdDev)
+
+		zScore := (words - mean) / stdDev
+		if math.Abs(zScore) <= threshold {
+			continue
+		}
+		anomalies = append(anomalies, Anomaly{
+			TitleNumber:      titleNumber,
+			StartDate:        change.StartDate,
+			EndDate:          change.EndDate,
+			WordCountChange:  change.WordCountChange,
+			MeanWordChange:   mean,
+			StdDevWordChange: stdDev,
+			ZScore:           zScore,
+		})
+	}
+
+	return anomalies
+}
+
+// adjacentChange returns the stored change between consecutive versions of a title, computing and storing it if
+// missing, see BackfillAdjacentChanges
+func (s *ChangeTrackingService) adjacentChange(
 	ctx context.Context,
+	titleNumber int,
 	startDate time.Time,
 	endDate time.Time,
-) ([]TitleChange, error) {
-	key := fmt.Sprintf("title-changes__%s__%s",
+) (*TitleChange, error) {
+	key := titleChangeKey(titleNumber, startDate, endDate)
+	change, err := s.findStoredChange(ctx, key)
+	if err != nil || change != nil {
+		return change, err
+	}
+
+	_, err = s.computing.Do(ctx, key, func() error {
+		_, err := s.computeStoredChange(ctx, key, titleNumber, startDate, endDate)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.findStoredChange(ctx, key)
+}
+
+// versionPair is a pair of consecutive version dates of a title
+type versionPair struct {
+	startDate time.Time
+	endDate   time.Time
+}
+
+// titleChangeKey is the key of the stored change of a title between two version dates
+func titleChangeKey(titleNumber int, startDate time.Time, endDate time.Time) string {
+	return data.CreateComputedValueKey(
+		"title-change",
+		fmt.Sprintf("%d", titleNumber),
 		startDate.Format("2006-01-02"),
-		endDate.Format("2006-01-02"))
+		endDate.Format("2006-01-02"),
+	)
+}
+
+// titleChangeKeyPrefix is the prefix of the keys of every stored change of a title, see titleChangeKey
+// It ends with the key delimiter, so the prefix of title 4 does not match the changes of title 40.
+func titleChangeKeyPrefix(titleNumber int) string {
+	return data.CreateComputedValueKey("title-change", fmt.Sprintf("%d", titleNumber), "")
+}
+
+// computeStoredChange computes the change of a title between two version dates and stores it under key
+func (s *ChangeTrackingService) computeStoredChange(
+	ctx context.Context,
+	key string,
+	titleNumber int,
+	startDate time.Time,
+	endDate time.Time,
+) (*TitleChange, error) {
+	change, err := s.computeTitleChange(ctx, titleNumber, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute change for title %d: %w", titleNumber, err)
+	}
 
+	changeBytes, err := json.Marshal(change)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal change: %w", err)
+	}
+
+	err = s.ComputedValueDAO.Insert(ctx, &data.ComputedValue{Key: key, Data: changeBytes})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store change: %w", err)
+	}
+
+	changeTrackingLog.Info(
+		"Computed title change between versions",
+		"title", titleNumber,
+		"startDate", startDate.Format("2006-01-02"),
+		"endDate", endDate.Format("2006-01-02"),
+	)
+
+	return change, nil
+}
+
+// findStoredChange returns the title change stored under key, or nil if there is none
+func (s *ChangeTrackingService) findStoredChange(
+	ctx context.Context,
+	key string,
+) (*TitleChange, error) {
 	cv, err := s.ComputedValueDAO.FindByKey(ctx, key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find changes: %w", err)
+		return nil, fmt.Errorf("failed to find stored change: %w", err)
 	}
 
 	if cv == nil {
-		return nil, fmt.Errorf("no changes found for date range")
+		return nil, nil
 	}
 
-	var changes []TitleChange
-	err = json.Unmarshal(cv.Data, &changes)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal changes: %w", err)
+	var change TitleChange
+	if err := json.Unmarshal(cv.Data, &change); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal stored change: %w", err)
 	}
 
-	return changes, nil
+	return &change, nil
 }
 
-// GetTopChangingTitles returns the titles with the most significant changes
-func (s *ChangeTrackingService) GetTopChangingTitles(
+// PeriodChange is the change of a title over a calendar period
+type PeriodChange struct {
+	Period string `json:"period"` // e.g., "2024-W09", "2024-03", or "2024-Q1"
+	TitleChange
+}
+
+// ComputePeriodChanges computes the change of a title over each week, month, or quarter of a year
+// Each period is represented by its latest stored version, the one nearest the period's closing boundary,
+// and compared with the previous represented period. The first period of the year is compared with the
+// latest version before the year, if any. Periods without a stored version are skipped.
+func (s *ChangeTrackingService) ComputePeriodChanges(
 	ctx context.Context,
-	startDate time.Time,
-	endDate time.Time,
-	limit int,
-) ([]TitleChange, error) {
-	changes, err := s.GetChangeSummary(ctx, startDate, endDate)
+	titleNumber int,
+	period string,
+	year int,
+) ([]*PeriodChange, error) {
+	periods, err := calendarPeriods(period, year)
 	if err != nil {
 		return nil, err
 	}
 
-	// Sort by absolute word count change
-	sortedChanges := make([]TitleChange, len(changes))
-	copy(sortedChanges, changes)
+	versions, err := s.TitleVersionDAO.FindByTitleNumber(ctx, titleNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find versions: %w", err)
+	}
 
-	// Simple bubble sort for top N (good enough for small datasets)
-	for i := 0; i < len(sortedChanges)-1; i++ {
-		for j := 0; j < len(sortedChanges)-i-1; j++ {
-			if abs(sortedChanges[j].WordCountChange) < abs(sortedChanges[j+1].WordCountChange) {
-				sortedChanges[j], sortedChanges[j+1] = sortedChanges[j+1], sortedChanges[j]
+	// Versions are ordered by version date, most recent first
+	latestBefore := func(end time.Time) *time.Time {
+		for _, version := range versions {
+			if version.VersionDate.Before(end) {
+				return &version.VersionDate
 			}
 		}
+		return nil
 	}
 
-	// Return top N
-	if limit > len(sortedChanges) {
-		limit = len(sortedChanges)
+	previous := latestBefore(periods[0].start)
+	changes := []*PeriodChange{}
+	for _, p := range periods {
+		current := latestBefore(p.end)
+		if current == nil || current.Before(p.start) {
+			continue
+		}
+
+		if previous != nil {
+			change, err := s.computeTitleChange(ctx, titleNumber, *previous, *current)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compute change for %s: %w", p.label, err)
+			}
+			changes = append(changes, &PeriodChange{Period: p.label, TitleChange: *change})
+		}
+
+		previous = current
 	}
 
-	return sortedChanges[:limit], nil
+	return changes, nil
 }
 
-// GenerateChangeReport generates a human-readable report of changes
-func (s *ChangeTrackingService) GenerateChangeReport(
+// calendarPeriod is a period of a year from start, inclusive, to end, exclusive
+type calendarPeriod struct {
+	label string
+	start time.Time
+	end   time.Time
+}
+
+// calendarPeriods splits a year into ISO weeks, months, or quarters
+// ISO weeks start on Monday and the first week of a year is the one containing January 4th
+func calendarPeriods(period string, year int) ([]calendarPeriod, error) {
+	var periods []calendarPeriod
+
+	switch period {
+	case "week":
+		jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+		start := jan4.AddDate(0, 0, -((int(jan4.Weekday()) + 6) % 7))
+		for {
+			isoYear, week := start.ISOWeek()
+			if isoYear != year {
+				break
+			}
+			end := start.AddDate(0, 0, 7)
+			periods = append(periods, calendarPeriod{fmt.Sprintf("%d-W%02d", year, week), start, end})
+			start = end
+		}
+	case "month":
+		for month := 1; month <= 12; month++ {
+			start := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+			periods = append(periods, calendarPeriod{start.Format("2006-01"), start, start.AddDate(0, 1, 0)})
+		}
+	case "quarter":
+		for quarter := 1; quarter <= 4; quarter++ {
+			start := time.Date(year, time.Month(quarter*3-2), 1, 0, 0, 0, 0, time.UTC)
+			periods = append(periods, calendarPeriod{fmt.Sprintf("%d-Q%d", year, quarter), start, start.AddDate(0, 3, 0)})
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPeriod, period)
+	}
+
+	return periods, nil
+}
+
+// computeTitleChange computes the change for a single title between two dates
+func (s *ChangeTrackingService) computeTitleChange(
 	ctx context.Context,
+	titleNumber int,
 	startDate time.Time,
 	endDate time.Time,
-) (string, error) {
-	changes, err := s.GetChangeSummary(ctx, startDate, endDate)
+) (*TitleChange, error) {
+	// Use the most recent version on or before each date, versions are not stored for every date
+	startVersion, err := s.getVersionOnOrBefore(ctx, titleNumber, startDate)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to get start version: %w", err)
 	}
 
-	var report strings.Builder
-	report.WriteString(fmt.Sprintf("CFR Change Report: %s to %s\n\n",
-		startDate.Format("2006-01-02"),
-		endDate.Format("2006-01-02")))
+	endVersion, err := s.getVersionOnOrBefore(ctx, titleNumber, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get end version: %w", err)
+	}
 
-	totalWordChange := 0
-	totalSectionChange := 0
+	// Versions are stored by requested date, but the content may be a snapshot of another date.
+	// Comparing an older snapshot at the end of the range would report changes backwards.
+	if endVersion.EffectiveDate.Before(startVersion.EffectiveDate) {
+		return nil, fmt.Errorf(
+			"mismatched snapshots: start version is effective %s, end version is effective %s",
+			startVersion.EffectiveDate.Format("2006-01-02"),
+			endVersion.EffectiveDate.Format("2006-01-02"),
+		)
+	}
 
-	for _, change := range changes {
-		totalWordChange += change.WordCountChange
-		totalSectionChange += change.SectionCountChange
+	// Parse both versions
+	startMetrics, err := s.getVersionMetrics(startVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse start version: %w", err)
+	}
 
-		report.WriteString(fmt.Sprintf("Title %d:\n", change.TitleNumber))
-		report.WriteString(fmt.Sprintf("  Words: %d -> %d (change: %+d, %.2f%%)\n",
-			change.TotalWordsStart,
-			change.TotalWordsEnd,
-			change.WordCountChange,
-			change.PercentWordChange))
-		report.WriteString(fmt.Sprintf("  Sections: %d -> %d (change: %+d, %.2f%%)\n\n",
-			change.TotalSectionsStart,
-			change.TotalSectionsEnd,
-			change.SectionCountChange,
-			change.PercentSectionChange))
+	endMetrics, err := s.getVersionMetrics(endVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse end version: %w", err)
 	}
 
-	report.WriteString(fmt.Sprintf("Total across all titles:\n"))
-	report.WriteString(fmt.Sprintf("  Word change: %+d\n", totalWordChange))
-	report.WriteString(fmt.Sprintf("  Section change: %+d\n", totalSectionChange))
+	change := newTitleChange(titleNumber, startMetrics, endMetrics)
+	change.StartDate = startDate
+	change.EndDate = endDate
+	change.StartEffectiveDate = startVersion.EffectiveDate
+	change.EndEffectiveDate = endVersion.EffectiveDate
+	change.SameSnapshot = endVersion.EffectiveDate.Equal(startVersion.EffectiveDate) &&
+		!endVersion.VersionDate.Equal(startVersion.VersionDate)
 
-	return report.String(), nil
+	return change, nil
+}
+
+// newTitleChange computes the change between the metrics of two versions of a title, without any dates
+func newTitleChange(titleNumber int, startMetrics *VersionMetrics, endMetrics *VersionMetrics) *TitleChange {
+	// Compute changes
+	wordChange := endMetrics.TotalWords - startMetrics.TotalWords
+	sectionChange := endMetrics.TotalSections - startMetrics.TotalSections
+
+	return &TitleChange{
+		TitleNumber:           titleNumber,
+		WordCountChange:       wordChange,
+		SectionCountChange:    sectionChange,
+		TotalWordsStart:       startMetrics.TotalWords,
+		TotalWordsEnd:         endMetrics.TotalWords,
+		TotalSectionsStart:    startMetrics.TotalSections,
+		TotalSectionsEnd:      endMetrics.TotalSections,
+		PercentWordChange:     percentChange(wordChange, startMetrics.TotalWords),
+		PercentSectionChange:  percentChange(sectionChange, startMetrics.TotalSections),
+		IsNew:                 startMetrics.TotalWords == 0 && endMetrics.TotalWords > 0,
+		IsNewSections:         startMetrics.TotalSections == 0 && endMetrics.TotalSections > 0,
+		ReservedSectionsStart: startMetrics.ReservedSections,
+		ReservedSectionsEnd:   endMetrics.ReservedSections,
+	}
+}
+
+// percentChange is change as a percentage of start, 0 when start is 0 as a change from zero has no percentage
+func percentChange(change int, start int) float64 {
+	if start <= 0 {
+		return 0
+	}
+	return float64(change) / float64(start) * 100
+}
+
+// excludeReservedSections leaves reserved sections out of the section totals, change, and percent change
+func (c *TitleChange) excludeReservedSections() {
+	if c.ExcludesReserved {
+		return
+	}
+
+	c.TotalSectionsStart -= c.ReservedSectionsStart
+	c.TotalSectionsEnd -= c.ReservedSectionsEnd
+	c.SectionCountChange = c.TotalSectionsEnd - c.TotalSectionsStart
+	c.PercentSectionChange = percentChange(c.SectionCountChange, c.TotalSectionsStart)
+	c.IsNewSections = c.TotalSectionsStart == 0 && c.TotalSectionsEnd > 0
+	c.ExcludesReserved = true
+}
+
+// VersionMetrics holds metrics for a specific version
+type VersionMetrics struct {
+	TotalWords       int
+	TotalSections    int
+	ReservedSections int // Reserved sections counted by TotalSections, see parser.IsReservedSection
+}
+
+// getVersionMetrics returns the metrics of a version from the cache, parsing and caching them on a miss
+func (s *ChangeTrackingService) getVersionMetrics(version *data.TitleVersionWithContent) (*VersionMetrics, error) {
+	if metrics, ok := s.VersionMetricsCache.Get(version.TitleNumber, version.VersionDate); ok {
+		return metrics, nil
+	}
+
+	metrics, err := parseVersionMetrics(version.TitleId, version.TitleNumber, version.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	s.VersionMetricsCache.Put(version.TitleNumber, version.VersionDate, metrics)
+	return metrics, nil
+}
+
+// parseVersionMetrics parses a version and extracts metrics
+func parseVersionMetrics(
+	titleId int,
+	titleNumber int,
+	content string,
+) (*VersionMetrics, error) {
+	cfrParser := parser.NewCfrParser(titleId, titleNumber)
+	parseResult, err := cfrParser.Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse version: %w", err)
+	}
+
+	return &VersionMetrics{
+		TotalWords:       parseResult.TotalWords,
+		TotalSections:    len(sectionsOf(parseResult)),
+		ReservedSections: parseResult.ReservedSections,
+	}, nil
+}
+
+// sectionsOf returns the sections (DIV8 elements) of a parse result
+func sectionsOf(parseResult *parser.ParseResult) []*data.CfrStructure {
+	var sections []*data.CfrStructure
+	for _, structure := range parseResult.Structures {
+		if structure.DivType == data.DivTypeSection {
+			sections = append(sections, structure)
+		}
+	}
+	return sections
+}
+
+// SectionDiff lists the sections of a title that were added, removed, or modified between two versions
+type SectionDiff struct {
+	TitleNumber int                 `json:"titleNumber"`
+	StartDate   time.Time           `json:"startDate"`
+	EndDate     time.Time           `json:"endDate"`
+	Added       []*SectionDiffEntry `json:"added"`
+	Removed     []*SectionDiffEntry `json:"removed"`
+	Modified    []*SectionDiffEntry `json:"modified"`
+
+	// TypeCounts are the changes of the number of structure elements of each div type, only set on request
+	TypeCounts map[string]CountChange `json:"typeCounts,omitempty"`
+}
+
+// CountChange is the change of a count between two versions
+type CountChange struct {
+	Before int `json:"before"`
+	After  int `json:"after"`
+	Delta  int `json:"delta"` // After minus before
+}
+
+// SectionDiffEntry identifies a single changed section
+type SectionDiffEntry struct {
+	Identifier     string  `json:"identifier"`
+	Heading        *string `json:"heading"`
+	Path           string  `json:"path"`
+	WordCountStart int     `json:"wordCountStart"`
+	WordCountEnd   int     `json:"wordCountEnd"`
+
+	// Class is how material the change to the heading and text is, only set for modified sections of a parsed diff
+	Class textdiff.ChangeClass `json:"class,omitempty"`
+}
+
+// ComputeSectionDiff compares the sections of a title between two stored versions
+// Sections are matched by matchBy, see data.CfrStructure.MatchKey, a section is modified if its heading or text changed.
+// When preferStored is set and the structure of both versions is stored, see CfrStructureService.ProcessTitleVersion,
+// the diff is computed from the stored structures instead of parsing both versions, which is much faster but matches
+// sections differently and finds fewer modifications, see diffStoredSections.
+// When typeCounts is set the diff's TypeCounts are also computed, see ComputeTypeCountChanges, from the same parse of
+// both versions.
+func (s *ChangeTrackingService) ComputeSectionDiff(
+	ctx context.Context,
+	titleNumber int,
+	startDate time.Time,
+	endDate time.Time,
+	preferStored bool,
+	matchBy string,
+	typeCounts bool,
+) (*SectionDiff, error) {
+	if err := validateMatchBy(matchBy); err != nil {
+		return nil, err
+	}
+
+	if preferStored {
+		diff, stored, err := s.diffStoredSections(ctx, titleNumber, startDate, endDate, matchBy)
+		if err != nil {
+			return nil, err
+		}
+		if stored {
+			if typeCounts {
+				diff.TypeCounts, err = s.ComputeTypeCountChanges(ctx, titleNumber, startDate, endDate)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return diff, nil
+		}
+	}
+
+	startResult, err := s.parseVersionOnOrBefore(ctx, titleNumber, startDate)
+	if err != nil {
+		return nil, err
+	}
+
+	endResult, err := s.parseVersionOnOrBefore(ctx, titleNumber, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := diffSections(sectionsOf(startResult), sectionsOf(endResult), matchBy)
+	diff.TitleNumber = titleNumber
+	diff.StartDate = startDate
+	diff.EndDate = endDate
+	if typeCounts {
+		diff.TypeCounts = typeCountChanges(startResult, endResult)
+	}
+
+	return diff, nil
+}
+
+// validateMatchBy returns an error wrapping ErrInvalidMatchBy if matchBy is not a known match key
+func validateMatchBy(matchBy string) error {
+	if matchBy != data.MatchByNodeId && matchBy != data.MatchByPath {
+		return fmt.Errorf("%w: %q", ErrInvalidMatchBy, matchBy)
+	}
+	return nil
+}
+
+// diffSections compares two sets of parsed sections, matching them by matchBy
+func diffSections(startSections []*data.CfrStructure, endSections []*data.CfrStructure, matchBy string) *SectionDiff {
+	diff := &SectionDiff{
+		Added:    []*SectionDiffEntry{},
+		Removed:  []*SectionDiffEntry{},
+		Modified: []*SectionDiffEntry{},
+	}
+
+	startMap := make(map[string]*data.CfrStructure, len(startSections))
+	for _, section := range startSections {
+		startMap[section.MatchKey(matchBy)] = section
+	}
+
+	endMap := make(map[string]*data.CfrStructure, len(endSections))
+	for _, section := range endSections {
+		endMap[section.MatchKey(matchBy)] = section
+	}
+
+	for _, section := range endSections {
+		before, ok := startMap[section.MatchKey(matchBy)]
+		if !ok {
+			diff.Added = append(diff.Added, &SectionDiffEntry{
+				Identifier:   section.Identifier,
+				Heading:      section.Heading,
+				Path:         section.Path,
+				WordCountEnd: section.WordCount,
+			})
+			continue
+		}
+
+		if stringValue(before.Heading) != stringValue(section.Heading) ||
+			stringValue(before.TextContent) != stringValue(section.TextContent) {
+			diff.Modified = append(diff.Modified, &SectionDiffEntry{
+				Identifier:     section.Identifier,
+				Heading:        section.Heading,
+				Path:           section.Path,
+				WordCountStart: before.WordCount,
+				WordCountEnd:   section.WordCount,
+				Class:          textdiff.ClassifyChange(sectionText(before), sectionText(section)),
+			})
+		}
+	}
+
+	for _, section := range startSections {
+		if _, ok := endMap[section.MatchKey(matchBy)]; !ok {
+			diff.Removed = append(diff.Removed, &SectionDiffEntry{
+				Identifier:     section.Identifier,
+				Heading:        section.Heading,
+				Path:           section.Path,
+				WordCountStart: section.WordCount,
+			})
+		}
+	}
+
+	return diff
+}
+
+// DiffXML compares two title XML documents without storing anything, for checking the diff logic against samples
+// Both documents are parsed as titleNumber, which may be 0 to skip checking the title number they declare.
+// Sections are matched as by ComputeSectionDiff.
+// The change has no dates, as the documents are not versions.
+func (s *ChangeTrackingService) DiffXML(
+	startXML string,
+	endXML string,
+	titleNumber int,
+	matchBy string,
+) (*TitleChange, *SectionDiff, error) {
+	if err := validateMatchBy(matchBy); err != nil {
+		return nil, nil, err
+	}
+
+	startResult, err := parser.NewCfrParser(0, titleNumber).Parse(startXML)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse start XML: %w", err)
+	}
+
+	endResult, err := parser.NewCfrParser(0, titleNumber).Parse(endXML)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse end XML: %w", err)
+	}
+
+	startSections := sectionsOf(startResult)
+	endSections := sectionsOf(endResult)
+
+	change := newTitleChange(
+		titleNumber,
+		&VersionMetrics{
+			TotalWords:       startResult.TotalWords,
+			TotalSections:    len(startSections),
+			ReservedSections: startResult.ReservedSections,
+		},
+		&VersionMetrics{
+			TotalWords:       endResult.TotalWords,
+			TotalSections:    len(endSections),
+			ReservedSections: endResult.ReservedSections,
+		},
+	)
+
+	diff := diffSections(startSections, endSections, matchBy)
+	diff.TitleNumber = titleNumber
+
+	return change, diff, nil
+}
+
+// diffStoredSections compares the sections of the stored structures of the latest versions on or before each date
+// Sections are matched by matchBy and are modified if their heading or word count changed, see
+// dao.CfrStructureDAO.FindChangedBetween, modified sections are not classified.
+// stored is false when either version has no stored structure, or there is no version that early.
+func (s *ChangeTrackingService) diffStoredSections(
+	ctx context.Context,
+	titleNumber int,
+	startDate time.Time,
+	endDate time.Time,
+	matchBy string,
+) (diff *SectionDiff, stored bool, err error) {
+	versions, err := s.TitleVersionDAO.FindByTitleNumber(ctx, titleNumber)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to find versions: %w", err)
+	}
+
+	var versionDates []time.Time
+	for _, date := range []time.Time{startDate, endDate} {
+		// Versions are most recent first
+		index := slices.IndexFunc(versions, func(version *data.TitleVersion) bool {
+			return !version.VersionDate.After(date)
+		})
+		if index < 0 {
+			return nil, false, nil
+		}
+
+		versionDate := versions[index].VersionDate
+		ok, err := s.CfrStructureDAO.HasVersion(ctx, titleNumber, versionDate)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to check stored structure: %w", err)
+		}
+		if !ok {
+			return nil, false, nil
+		}
+
+		versionDates = append(versionDates, versionDate)
+	}
+
+	changes, err := s.CfrStructureDAO.FindChangedBetween(ctx, titleNumber, versionDates[0], versionDates[1], matchBy)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to compare stored structures: %w", err)
+	}
+
+	diff = &SectionDiff{
+		TitleNumber: titleNumber,
+		StartDate:   startDate,
+		EndDate:     endDate,
+		Added:       []*SectionDiffEntry{},
+		Removed:     []*SectionDiffEntry{},
+		Modified:    []*SectionDiffEntry{},
+	}
+
+	for _, change := range changes {
+		if change.DivType != data.DivTypeSection {
+			continue
+		}
+
+		entry := &SectionDiffEntry{
+			Identifier:     change.Identifier,
+			Heading:        change.Heading,
+			Path:           change.Path,
+			WordCountStart: change.WordCountStart,
+			WordCountEnd:   change.WordCountEnd,
+		}
+
+		switch change.ChangeType {
+		case data.StructureAdded:
+			diff.Added = append(diff.Added, entry)
+		case data.StructureRemoved:
+			diff.Removed = append(diff.Removed, entry)
+		default:
+			diff.Modified = append(diff.Modified, entry)
+		}
+	}
+
+	return diff, true, nil
+}
+
+// getVersionOnOrBefore gets the latest stored version of a title dated on or before date
+func (s *ChangeTrackingService) getVersionOnOrBefore(
+	ctx context.Context,
+	titleNumber int,
+	date time.Time,
+) (*data.TitleVersionWithContent, error) {
+	version, err := s.TitleVersionDAO.GetContentOnOrBefore(ctx, titleNumber, date)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version on or before %s: %w", date.Format("2006-01-02"), err)
+	}
+
+	if version == nil {
+		return nil, fmt.Errorf(
+			"%w: title %d, on or before %s",
+			ErrVersionNotFound,
+			titleNumber,
+			date.Format("2006-01-02"),
+		)
+	}
+
+	return version, nil
+}
+
+// parseVersionOnOrBefore parses the latest stored title version on or before versionDate
+func (s *ChangeTrackingService) parseVersionOnOrBefore(
+	ctx context.Context,
+	titleNumber int,
+	versionDate time.Time,
+) (*parser.ParseResult, error) {
+	version, err := s.getVersionOnOrBefore(ctx, titleNumber, versionDate)
+	if err != nil {
+		return nil, err
+	}
+
+	cfrParser := parser.NewCfrParser(version.TitleId, titleNumber)
+	parseResult, err := cfrParser.Parse(version.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse version %s: %w", versionDate.Format("2006-01-02"), err)
+	}
+
+	return parseResult, nil
+}
+
+// ComputeTypeCountChanges compares the number of structure elements of each div type of a title between two dates,
+// e.g., to find parts that were added or subparts that were removed by a reorganization
+// Each date uses the latest stored version on or before it, which is parsed. Types found in either version are
+// included, with a count of 0 in the version without them.
+func (s *ChangeTrackingService) ComputeTypeCountChanges(
+	ctx context.Context,
+	titleNumber int,
+	startDate time.Time,
+	endDate time.Time,
+) (map[string]CountChange, error) {
+	startResult, err := s.parseVersionOnOrBefore(ctx, titleNumber, startDate)
+	if err != nil {
+		return nil, err
+	}
+
+	endResult, err := s.parseVersionOnOrBefore(ctx, titleNumber, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return typeCountChanges(startResult, endResult), nil
+}
+
+// typeCountChanges compares the number of structure elements of each div type of two parsed versions
+func typeCountChanges(startResult *parser.ParseResult, endResult *parser.ParseResult) map[string]CountChange {
+	changes := make(map[string]CountChange)
+	for _, structure := range startResult.Structures {
+		change := changes[structure.DivType]
+		change.Before++
+		changes[structure.DivType] = change
+	}
+	for _, structure := range endResult.Structures {
+		change := changes[structure.DivType]
+		change.After++
+		changes[structure.DivType] = change
+	}
+
+	for divType, change := range changes {
+		change.Delta = change.After - change.Before
+		changes[divType] = change
+	}
+
+	return changes
+}
+
+// StructureTreeNode is a structure element in a tree of a title version compared by CompareTitleTrees
+type StructureTreeNode struct {
+	DivType    string               `json:"divType"`
+	Identifier string               `json:"identifier"`
+	NodeId     *string              `json:"nodeId"`
+	Heading    *string              `json:"heading"`
+	Path       string               `json:"path"`
+	WordCount  int                  `json:"wordCount"`
+	Status     string               `json:"status"` // data.StructureAdded, Removed, Changed, or Unchanged
+	Children   []*StructureTreeNode `json:"children"`
+
+	// DescendantsChanged is set when any descendant of the element is not unchanged, so unchanged subtrees can be
+	// collapsed
+	DescendantsChanged bool `json:"descendantsChanged"`
+}
+
+// TreeComparison holds the structure trees of a title at two dates, with the status of each element
+// The from tree has removed, changed, and unchanged elements, and the to tree added, changed, and unchanged ones.
+type TreeComparison struct {
+	TitleNumber     int                  `json:"titleNumber"`
+	FromDate        time.Time            `json:"fromDate"`
+	ToDate          time.Time            `json:"toDate"`
+	FromVersionDate time.Time            `json:"fromVersionDate"` // Date of the version compared for FromDate
+	ToVersionDate   time.Time            `json:"toVersionDate"`   // Date of the version compared for ToDate
+	From            []*StructureTreeNode `json:"from"`
+	To              []*StructureTreeNode `json:"to"`
+}
+
+// CompareTitleTrees parses the latest stored versions of a title on or before two dates and returns the structure
+// tree of each, with every element marked as added, removed, changed, or unchanged
+// Elements are matched as by ComputeSectionDiff, and a matched element is changed when its heading or text differ.
+// Both dates resolving to the same version parse it once.
+func (s *ChangeTrackingService) CompareTitleTrees(
+	ctx context.Context,
+	titleNumber int,
+	fromDate time.Time,
+	toDate time.Time,
+	matchBy string,
+) (*TreeComparison, error) {
+	if err := validateMatchBy(matchBy); err != nil {
+		return nil, err
+	}
+
+	fromVersion, err := s.getVersionOnOrBefore(ctx, titleNumber, fromDate)
+	if err != nil {
+		return nil, err
+	}
+
+	toVersion, err := s.getVersionOnOrBefore(ctx, titleNumber, toDate)
+	if err != nil {
+		return nil, err
+	}
+
+	fromResult, err := parser.NewCfrParser(fromVersion.TitleId, titleNumber).Parse(fromVersion.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse version %s: %w", fromVersion.VersionDate.Format("2006-01-02"), err)
+	}
+
+	toResult := fromResult
+	if !toVersion.VersionDate.Equal(fromVersion.VersionDate) {
+		toResult, err = parser.NewCfrParser(toVersion.TitleId, titleNumber).Parse(toVersion.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse version %s: %w", toVersion.VersionDate.Format("2006-01-02"), err)
+		}
+	}
+
+	fromByKey := make(map[string]*data.CfrStructure, len(fromResult.Structures))
+	for _, structure := range fromResult.Structures {
+		fromByKey[structure.MatchKey(matchBy)] = structure
+	}
+
+	toByKey := make(map[string]*data.CfrStructure, len(toResult.Structures))
+	for _, structure := range toResult.Structures {
+		toByKey[structure.MatchKey(matchBy)] = structure
+	}
+
+	return &TreeComparison{
+		TitleNumber:     titleNumber,
+		FromDate:        fromDate,
+		ToDate:          toDate,
+		FromVersionDate: fromVersion.VersionDate,
+		ToVersionDate:   toVersion.VersionDate,
+		From:            buildStructureTree(fromResult.Structures, toByKey, matchBy, data.StructureRemoved),
+		To:              buildStructureTree(toResult.Structures, fromByKey, matchBy, data.StructureAdded),
+	}, nil
+}
+
+// buildStructureTree builds the tree of structures in document order, returning its roots
+// Each element is marked unmatchedStatus if it has no match in others, otherwise changed or unchanged.
+func buildStructureTree(
+	structures []*data.CfrStructure,
+	others map[string]*data.CfrStructure,
+	matchBy string,
+	unmatchedStatus string,
+) []*StructureTreeNode {
+	roots := []*StructureTreeNode{}
+	nodesByPath := make(map[string]*StructureTreeNode, len(structures))
+	for _, structure := range structures {
+		status := unmatchedStatus
+		if other, ok := others[structure.MatchKey(matchBy)]; ok {
+			status = data.StructureUnchanged
+			if stringValue(other.Heading) != stringValue(structure.Heading) ||
+				stringValue(other.TextContent) != stringValue(structure.TextContent) {
+				status = data.StructureChanged
+			}
+		}
+
+		node := &StructureTreeNode{
+			DivType:    structure.DivType,
+			Identifier: structure.Identifier,
+			NodeId:     structure.NodeId,
+			Heading:    structure.Heading,
+			Path:       structure.Path,
+			WordCount:  structure.WordCount,
+			Status:     status,
+			Children:   []*StructureTreeNode{},
+		}
+		nodesByPath[data.PathKey(structure.PathSegments)] = node
+
+		if parent, ok := nodesByPath[data.PathKey(structure.ParentPathSegments())]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	for _, root := range roots {
+		markDescendantsChanged(root)
+	}
+
+	return roots
+}
+
+// markDescendantsChanged sets DescendantsChanged of node and its descendants, returns whether node or any of its
+// descendants changed
+func markDescendantsChanged(node *StructureTreeNode) bool {
+	for _, child := range node.Children {
+		if markDescendantsChanged(child) {
+			node.DescendantsChanged = true
+		}
+	}
+	return node.DescendantsChanged || node.Status != data.StructureUnchanged
+}
+
+// GetChangeSummary retrieves a summary of changes across all titles for a date range
+// Titles whose absolute percent word change is below minPercentWordChange are excluded, 0 includes all titles
+// New titles, whose words went from zero to non-zero, always meet the threshold
+// computedAt is when the changes of the date range were computed
+func (s *ChangeTrackingService) GetChangeSummary(
+	ctx context.Context,
+	startDate time.Time,
+	endDate time.Time,
+	minPercentWordChange float64,
+) (changes []TitleChange, computedAt time.Time, err error) {
+	key := fmt.Sprintf("title-changes__%s__%s",
+		startDate.Format("2006-01-02"),
+		endDate.Format("2006-01-02"))
+
+	cv, err := s.ComputedValueDAO.FindByKey(ctx, key)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to find changes: %w", err)
+	}
+
+	if cv == nil {
+		return nil, time.Time{}, fmt.Errorf(
+			"changes from %s to %s: %w",
+			startDate.Format("2006-01-02"),
+			endDate.Format("2006-01-02"),
+			ErrNotComputed,
+		)
+	}
+
+	err = json.Unmarshal(cv.Data, &changes)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to unmarshal changes: %w", err)
+	}
+
+	if minPercentWordChange > 0 {
+		significantChanges := []TitleChange{}
+		for _, change := range changes {
+			if change.IsNew || math.Abs(change.PercentWordChange) >= minPercentWordChange {
+				significantChanges = append(significantChanges, change)
+			}
+		}
+		changes = significantChanges
+	}
+
+	return changes, cv.CreatedAt, nil
+}
+
+// GetTopChangingTitles returns the titles with the most significant changes, ranked by their change score
+// Each returned change has its score and the weights it was computed with set, see ScoreWeights
+func (s *ChangeTrackingService) GetTopChangingTitles(
+	ctx context.Context,
+	startDate time.Time,
+	endDate time.Time,
+	limit int,
+	minPercentWordChange float64,
+	weights ScoreWeights,
+) ([]TitleChange, time.Time, error) {
+	if err := weights.Validate(); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	changes, computedAt, err := s.GetChangeSummary(ctx, startDate, endDate, minPercentWordChange)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	// Sort by change score
+	sortedChanges := make([]TitleChange, len(changes))
+	copy(sortedChanges, changes)
+	for i := range sortedChanges {
+		sortedChanges[i].ChangeScore = weights.Score(sortedChanges[i])
+		sortedChanges[i].ScoreWeights = &weights
+	}
+
+	// Simple bubble sort for top N (good enough for small datasets)
+	for i := 0; i < len(sortedChanges)-1; i++ {
+		for j := 0; j < len(sortedChanges)-i-1; j++ {
+			if sortedChanges[j].ChangeScore < sortedChanges[j+1].ChangeScore {
+				sortedChanges[j], sortedChanges[j+1] = sortedChanges[j+1], sortedChanges[j]
+			}
+		}
+	}
+
+	// Return top N
+	if limit > len(sortedChanges) {
+		limit = len(sortedChanges)
+	}
+
+	return sortedChanges[:limit], computedAt, nil
+}
+
+// ChangeReport summarizes the changes of all titles between two dates
+type ChangeReport struct {
+	StartDate  time.Time     `json:"startDate"`
+	EndDate    time.Time     `json:"endDate"`
+	Changes    []TitleChange `json:"changes"`
+	ComputedAt time.Time     `json:"computedAt"`
+	ChangeTotals
+}
+
+// ChangeTotals totals the changes of the titles in a report
+// Every rendering of a report uses these, so they always agree
+type ChangeTotals struct {
+	TotalWordsStart    int     `json:"totalWordsStart"`
+	TotalWordsEnd      int     `json:"totalWordsEnd"`
+	TotalWordChange    int     `json:"totalWordChange"`
+	TotalSectionChange int     `json:"totalSectionChange"`
+	PercentWordChange  float64 `json:"percentWordChange"`
+	IsNew              bool    `json:"isNew"` // Words went from zero to non-zero
+}
+
+// totalChanges totals the changes of titles, the percent word change is of the total words at the start
+func totalChanges(changes []TitleChange) ChangeTotals {
+	var totals ChangeTotals
+	for _, change := range changes {
+		totals.TotalWordsStart += change.TotalWordsStart
+		totals.TotalWordsEnd += change.TotalWordsEnd
+		totals.TotalWordChange += change.WordCountChange
+		totals.TotalSectionChange += change.SectionCountChange
+	}
+
+	if totals.TotalWordsStart > 0 {
+		totals.PercentWordChange = float64(totals.TotalWordChange) / float64(totals.TotalWordsStart) * 100
+	}
+	totals.IsNew = totals.TotalWordsStart == 0 && totals.TotalWordsEnd > 0
+
+	return totals
+}
+
+// GenerateChangeReport generates a report of changes, use Text or Markdown for the human-readable renderings
+func (s *ChangeTrackingService) GenerateChangeReport(
+	ctx context.Context,
+	startDate time.Time,
+	endDate time.Time,
+	minPercentWordChange float64,
+) (*ChangeReport, error) {
+	changes, computedAt, err := s.GetChangeSummary(ctx, startDate, endDate, minPercentWordChange)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ChangeReport{
+		StartDate:    startDate,
+		EndDate:      endDate,
+		Changes:      changes,
+		ComputedAt:   computedAt,
+		ChangeTotals: totalChanges(changes),
+	}
+	if report.Changes == nil {
+		report.Changes = []TitleChange{}
+	}
+
+	return report, nil
+}
+
+// ChangeStats are aggregate statistics of the word changes of all titles between two dates
+// The mean, median, and max are 0, and BiggestMover is nil, when no changes were computed for any title.
+type ChangeStats struct {
+	StartDate        time.Time    `json:"startDate"`
+	EndDate          time.Time    `json:"endDate"`
+	ComputedAt       time.Time    `json:"computedAt"`
+	TitleCount       int          `json:"titleCount"`
+	TotalWordChange  int          `json:"totalWordChange"`
+	MeanWordChange   float64      `json:"meanWordChange"`
+	MedianWordChange float64      `json:"medianWordChange"`
+	MaxWordChange    int          `json:"maxWordChange"` // Largest increase, or smallest decrease if every title shrank
+	TitlesGrown      int          `json:"titlesGrown"`
+	TitlesShrunk     int          `json:"titlesShrunk"`
+	TitlesUnchanged  int          `json:"titlesUnchanged"`
+	BiggestMover     *TitleChange `json:"biggestMover"` // Largest absolute word change
+}
+
+// GetChangeStatistics computes aggregate statistics of the stored changes of all titles between two dates
+func (s *ChangeTrackingService) GetChangeStatistics(
+	ctx context.Context,
+	startDate time.Time,
+	endDate time.Time,
+) (*ChangeStats, error) {
+	changes, computedAt, err := s.GetChangeSummary(ctx, startDate, endDate, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &ChangeStats{
+		StartDate:  startDate,
+		EndDate:    endDate,
+		ComputedAt: computedAt,
+		TitleCount: len(changes),
+	}
+	if len(changes) == 0 {
+		return stats, nil
+	}
+
+	wordChanges := make([]int, len(changes))
+	for i, change := range changes {
+		wordChanges[i] = change.WordCountChange
+		stats.TotalWordChange += change.WordCountChange
+
+		switch {
+		case change.WordCountChange > 0:
+			stats.TitlesGrown++
+		case change.WordCountChange < 0:
+			stats.TitlesShrunk++
+		default:
+			stats.TitlesUnchanged++
+		}
+
+		if stats.BiggestMover == nil || abs(change.WordCountChange) > abs(stats.BiggestMover.WordCountChange) {
+			stats.BiggestMover = &changes[i]
+		}
+	}
+
+	slices.Sort(wordChanges)
+	middle := len(wordChanges) / 2
+	if len(wordChanges)%2 == 0 {
+		stats.MedianWordChange = float64(wordChanges[middle-1]+wordChanges[middle]) / 2
+	} else {
+		stats.MedianWordChange = float64(wordChanges[middle])
+	}
+
+	stats.MeanWordChange = float64(stats.TotalWordChange) / float64(len(changes))
+	stats.MaxWordChange = wordChanges[len(wordChanges)-1]
+
+	return stats, nil
+}
+
+// Text renders the report as human-readable text
+func (r *ChangeReport) Text() string {
+	var report strings.Builder
+	report.WriteString(fmt.Sprintf("CFR Change Report: %s to %s\n\n",
+		r.StartDate.Format("2006-01-02"),
+		r.EndDate.Format("2006-01-02")))
+
+	for _, change := range r.Changes {
+		report.WriteString(fmt.Sprintf("Title %d:\n", change.TitleNumber))
+		report.WriteString(fmt.Sprintf("  Words: %d -> %d (change: %+d, %s)\n",
+			change.TotalWordsStart,
+			change.TotalWordsEnd,
+			change.WordCountChange,
+			formatPercentChange(change.PercentWordChange, change.IsNew)))
+		report.WriteString(fmt.Sprintf("  Sections: %d -> %d (change: %+d, %s)\n\n",
+			change.TotalSectionsStart,
+			change.TotalSectionsEnd,
+			change.SectionCountChange,
+			formatPercentChange(change.PercentSectionChange, change.IsNewSections)))
+	}
+
+	report.WriteString(fmt.Sprintf("Total across all titles:\n"))
+	report.WriteString(fmt.Sprintf("  Words: %d -> %d (change: %+d, %s)\n",
+		r.TotalWordsStart,
+		r.TotalWordsEnd,
+		r.TotalWordChange,
+		formatPercentChange(r.PercentWordChange, r.IsNew)))
+	report.WriteString(fmt.Sprintf("  Section change: %+d\n", r.TotalSectionChange))
+
+	return report.String()
+}
+
+// GenerateChangeReportMarkdown generates a report of the changes of all titles between two dates as Markdown,
+// see ChangeReport.Markdown
+func (s *ChangeTrackingService) GenerateChangeReportMarkdown(
+	ctx context.Context,
+	startDate time.Time,
+	endDate time.Time,
+) (string, error) {
+	report, err := s.GenerateChangeReport(ctx, startDate, endDate, 0)
+	if err != nil {
+		return "", err
+	}
+
+	return report.Markdown(), nil
+}
+
+// Markdown renders the report as a Markdown table of the word changes of each title, with a totals row
+func (r *ChangeReport) Markdown() string {
+	var report strings.Builder
+	report.WriteString(fmt.Sprintf("# CFR Change Report: %s to %s\n\n",
+		r.StartDate.Format("2006-01-02"),
+		r.EndDate.Format("2006-01-02")))
+
+	report.WriteString("| Title | Words Before | Words After | Delta | Percent |\n")
+	report.WriteString("| --- | ---: | ---: | ---: | ---: |\n")
+
+	for _, change := range r.Changes {
+		report.WriteString(fmt.Sprintf("| %d | %d | %d | %+d | %s |\n",
+			change.TitleNumber,
+			change.TotalWordsStart,
+			change.TotalWordsEnd,
+			change.WordCountChange,
+			formatPercentChange(change.PercentWordChange, change.IsNew)))
+	}
+
+	report.WriteString(fmt.Sprintf("| **Total** | **%d** | **%d** | **%+d** | **%s** |\n",
+		r.TotalWordsStart,
+		r.TotalWordsEnd,
+		r.TotalWordChange,
+		formatPercentChange(r.PercentWordChange, r.IsNew)))
+
+	return report.String()
+}
+
+// sectionText joins the heading and text of a section for comparison
+func sectionText(section *data.CfrStructure) string {
+	return stringValue(section.Heading) + " " + stringValue(section.TextContent)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// formatPercentChange renders a percent change for reports, or "new" for a change from zero
+func formatPercentChange(percent float64, isNew bool) string {
+	if isNew {
+		return "new"
+	}
+	return fmt.Sprintf("%.2f%%", percent)
 }
 
 func abs(n int) int {
@@ -307,6 +1745,248 @@ func abs(n int) int {
 	return n
 }
 
-func (s *ChangeTrackingService) logInfo(message string) {
-	log.Info(fmt.Sprintf("Change Tracking Process: %v", message))
+// AgencyChange is the change of the words within the CFR references of an agency and its sub-agencies between two
+// dates
+type AgencyChange struct {
+	Slug              string    `json:"slug"`
+	Name              string    `json:"name"`
+	DisplayName       string    `json:"displayName"`
+	StartDate         time.Time `json:"startDate"`
+	EndDate           time.Time `json:"endDate"`
+	TotalWordsStart   int       `json:"totalWordsStart"`
+	TotalWordsEnd     int       `json:"totalWordsEnd"`
+	WordCountChange   int       `json:"wordCountChange"`
+	PercentWordChange float64   `json:"percentWordChange"`
+	IsNew             bool      `json:"isNew"` // Words went from zero to non-zero, the percentage is left at 0
+
+	// TiedWith lists the slugs of the other agencies with the same word change, only set by TopGrowingAgency
+	TiedWith []string `json:"tiedWith,omitempty"`
+}
+
+// ComputeAgencyChanges computes the change of every top level agency between two dates, largest growth first
+// Each date uses the latest stored version of each referenced title on or before it, which is parsed, and words
+// are totaled by reference as CfrStructureDAO.SumMetricsByReferences totals agency metrics. Titles without a stored
+// version on or before both dates are left out of every agency's totals. The changes are computed on first request
+// and stored, keyed by the dates, a reimport of a version does not invalidate them.
+func (s *ChangeTrackingService) ComputeAgencyChanges(
+	ctx context.Context,
+	startDate time.Time,
+	endDate time.Time,
+) ([]*AgencyChange, error) {
+	key := data.CreateComputedValueKey(
+		"agency-changes",
+		startDate.Format("2006-01-02"),
+		endDate.Format("2006-01-02"),
+	)
+
+	changes, err := s.findStoredAgencyChanges(ctx, key)
+	if err != nil || changes != nil {
+		return changes, err
+	}
+
+	// Concurrent first requests share a single computation
+	shared, err := s.computing.Do(ctx, key, func() error {
+		var err error
+		changes, err = s.computeAgencyChanges(ctx, startDate, endDate)
+		if err != nil {
+			return err
+		}
+
+		changeBytes, err := json.Marshal(changes)
+		if err != nil {
+			return fmt.Errorf("failed to marshal agency changes: %w", err)
+		}
+
+		err = s.ComputedValueDAO.Insert(ctx, &data.ComputedValue{Key: key, Data: changeBytes})
+		if err != nil {
+			return fmt.Errorf("failed to store agency changes: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if shared {
+		return s.findStoredAgencyChanges(ctx, key)
+	}
+
+	return changes, nil
+}
+
+// TopGrowingAgency returns the agency whose words grew the most between two dates, see ComputeAgencyChanges
+// Agencies tied for the most growth are listed in TiedWith of the returned agency, which is the first of them by name.
+// Returns an error wrapping ErrNoAgencyGrowth if no agency grew, including when there is no data for the dates.
+func (s *ChangeTrackingService) TopGrowingAgency(
+	ctx context.Context,
+	startDate time.Time,
+	endDate time.Time,
+) (*AgencyChange, error) {
+	changes, err := s.ComputeAgencyChanges(ctx, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(changes) == 0 || changes[0].WordCountChange <= 0 {
+		return nil, fmt.Errorf(
+			"%w from %s to %s",
+			ErrNoAgencyGrowth,
+			startDate.Format("2006-01-02"),
+			endDate.Format("2006-01-02"),
+		)
+	}
+
+	// Changes are ordered by word change, then name
+	top := *changes[0]
+	for _, change := range changes[1:] {
+		if change.WordCountChange != top.WordCountChange {
+			break
+		}
+		top.TiedWith = append(top.TiedWith, change.Slug)
+	}
+
+	return &top, nil
+}
+
+// findStoredAgencyChanges returns the agency changes stored under key, or nil if there are none
+func (s *ChangeTrackingService) findStoredAgencyChanges(
+	ctx context.Context,
+	key string,
+) ([]*AgencyChange, error) {
+	cv, err := s.ComputedValueDAO.FindByKey(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stored agency changes: %w", err)
+	}
+
+	if cv == nil {
+		return nil, nil
+	}
+
+	changes := []*AgencyChange{}
+	if err := json.Unmarshal(cv.Data, &changes); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal stored agency changes: %w", err)
+	}
+
+	return changes, nil
+}
+
+// computeAgencyChanges computes the agency changes of ComputeAgencyChanges, parsing one title at a time
+func (s *ChangeTrackingService) computeAgencyChanges(
+	ctx context.Context,
+	startDate time.Time,
+	endDate time.Time,
+) ([]*AgencyChange, error) {
+	agencies, err := s.AgencyDAO.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find agencies: %w", err)
+	}
+
+	changes := make([]*AgencyChange, len(agencies))
+	referencesByTitle := make([]map[int][]*data.CfrReference, len(agencies))
+	var titleNumbers []int
+	for i, agency := range agencies {
+		changes[i] = &AgencyChange{
+			Slug:        agency.Slug,
+			Name:        agency.Name,
+			DisplayName: agency.DisplayName,
+			StartDate:   startDate,
+			EndDate:     endDate,
+		}
+
+		referencesByTitle[i] = make(map[int][]*data.CfrReference)
+		for _, reference := range agencyReferences(agency, true) {
+			referencesByTitle[i][reference.Title] = append(referencesByTitle[i][reference.Title], reference)
+			if !slices.Contains(titleNumbers, reference.Title) {
+				titleNumbers = append(titleNumbers, reference.Title)
+			}
+		}
+	}
+	slices.Sort(titleNumbers)
+
+	for _, titleNumber := range titleNumbers {
+		startResult, err := s.parseVersionOnOrBefore(ctx, titleNumber, startDate)
+		var endResult *parser.ParseResult
+		if err == nil {
+			endResult, err = s.parseVersionOnOrBefore(ctx, titleNumber, endDate)
+		}
+		if errors.Is(err, ErrVersionNotFound) {
+			changeTrackingLog.Warn("Left title out of agency changes", "title", titleNumber, "error", err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute agency changes for title %d: %w", titleNumber, err)
+		}
+
+		for i := range agencies {
+			if references, ok := referencesByTitle[i][titleNumber]; ok {
+				changes[i].TotalWordsStart += sumReferencedWords(startResult.Structures, references)
+				changes[i].TotalWordsEnd += sumReferencedWords(endResult.Structures, references)
+			}
+		}
+	}
+
+	for _, change := range changes {
+		change.WordCountChange = change.TotalWordsEnd - change.TotalWordsStart
+		if change.TotalWordsStart > 0 {
+			change.PercentWordChange = float64(change.WordCountChange) / float64(change.TotalWordsStart) * 100
+		}
+		change.IsNew = change.TotalWordsStart == 0 && change.TotalWordsEnd > 0
+	}
+
+	slices.SortStableFunc(changes, func(a *AgencyChange, b *AgencyChange) int {
+		if a.WordCountChange != b.WordCountChange {
+			return b.WordCountChange - a.WordCountChange
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return changes, nil
+}
+
+// sumReferencedWords totals the words of the parsed structures of a title within any of its references
+// Coverage matches CfrStructureDAO.SumMetricsByReferences: a reference covers the structure it scopes to, see
+// data.CfrReference.IsScope, and its descendants, appendices linked to a part are covered by references to that part, and structures
+// covered by more than one reference are only counted once.
+func sumReferencedWords(structures []*data.CfrStructure, references []*data.CfrReference) int {
+	type scope struct {
+		path       string
+		divType    string
+		identifier string
+	}
+
+	var scopes []scope
+	referencedParts := make(map[string]bool)
+	for _, reference := range references {
+		divType, identifier := reference.Scope()
+		if divType == data.DivTypePart {
+			referencedParts[identifier] = true
+		}
+
+		for _, structure := range structures {
+			if reference.IsScope(structure) {
+				scopes = append(scopes, scope{structure.Path, divType, identifier})
+			}
+		}
+	}
+
+	words := 0
+	for _, structure := range structures {
+		if structure.AppendixPart != nil && referencedParts[*structure.AppendixPart] {
+			words += structure.WordCount
+			continue
+		}
+
+		for _, sc := range scopes {
+			if structure.Path != sc.path && !strings.HasPrefix(structure.Path, sc.path+"/") {
+				continue
+			}
+			if sc.divType == data.DivTypePart && structure.AppendixPart != nil && *structure.AppendixPart != sc.identifier {
+				continue
+			}
+			words += structure.WordCount
+			break
+		}
+	}
+
+	return words
 }
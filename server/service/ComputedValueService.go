@@ -3,16 +3,23 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/sam-berry/ecfr-analyzer/server/dao"
 	"github.com/sam-berry/ecfr-analyzer/server/data"
+	"github.com/sam-berry/ecfr-analyzer/server/logging"
 	"strings"
 	"sync"
+	"time"
 )
 
 var MaxConcurrentAgencyMetricProcesses = 3
 
+var computedValueLog = logging.New("computed-value")
+
+// ErrEmptyKeyPrefix is returned for an empty key prefix, which would purge every computed value
+var ErrEmptyKeyPrefix = errors.New("prefix must not be empty")
+
 type ComputedValueService struct {
 	TitleMetricService  *TitleMetricService
 	AgencyMetricService *AgencyMetricService
@@ -46,10 +53,37 @@ func (s *ComputedValueService) ProcessTitleMetrics(
 	return nil
 }
 
+func (s *ComputedValueService) ProcessGlobalSnapshot(
+	ctx context.Context,
+	options data.CountOptions,
+) error {
+	_, err := s.TitleMetricService.ComputeGlobalSnapshot(ctx, options)
+	if err != nil {
+		return fmt.Errorf("failed to compute global snapshot, %w", err)
+	}
+
+	return nil
+}
+
+// ProcessGlobalTimeSeries computes and stores the total words and sections of every title at each date, see
+// TitleMetricService.GlobalTimeSeries
+func (s *ComputedValueService) ProcessGlobalTimeSeries(
+	ctx context.Context,
+	dates []time.Time,
+) error {
+	_, err := s.TitleMetricService.GlobalTimeSeries(ctx, dates)
+	if err != nil {
+		return fmt.Errorf("failed to compute global time series, %w", err)
+	}
+
+	return nil
+}
+
 func (s *ComputedValueService) ProcessAgencyMetrics(
 	ctx context.Context,
 	onlySubAgencies bool,
 	agenciesFilter []string,
+	options data.CountOptions,
 ) error {
 	agencies, err := s.AgencyDAO.FindAll(ctx)
 	if err != nil {
@@ -84,15 +118,6 @@ func (s *ComputedValueService) ProcessAgencyMetrics(
 
 	var messagesWG sync.WaitGroup
 
-	messages := make(chan string)
-	messagesWG.Add(1)
-	go func() {
-		defer messagesWG.Done()
-		for message := range messages {
-			s.logInfo(message)
-		}
-	}()
-
 	successes := make(chan string)
 	var successAgencies []string
 	messagesWG.Add(1)
@@ -128,31 +153,31 @@ func (s *ComputedValueService) ProcessAgencyMetrics(
 			var subAgencyFilter string
 			if onlySubAgencies {
 				slug = agency.Parent.Slug
-				subAgencyFilter = agency.Name
+				subAgencyFilter = agency.Slug
 			} else {
 				slug = agency.Slug
 				subAgencyFilter = ""
 			}
 
-			messages <- fmt.Sprintf("Processing: %v", slug)
+			computedValueLog.Debug("Processing agency", "agency", slug, "subAgency", subAgencyFilter)
 
-			result, err := s.AgencyMetricService.CountWordsAndSections(ctx, slug, subAgencyFilter)
+			result, err := s.AgencyMetricService.CountWordsAndSections(ctx, slug, subAgencyFilter, options)
 			if err != nil {
-				messages <- fmt.Sprintf("failed to count agency metrics, %v, %v", slug, err)
+				computedValueLog.Error("Failed to count agency metrics", "agency", slug, "error", err)
 				failures <- slug
 				return
 			}
 
 			rBytes, err := json.Marshal(result)
 			if err != nil {
-				messages <- fmt.Sprintf("failed to marshall agency metrics, %v, %v", slug, err)
+				computedValueLog.Error("Failed to marshal agency metrics", "agency", slug, "error", err)
 				failures <- slug
 				return
 			}
 
 			var key string
 			if onlySubAgencies {
-				key = data.ComputedValueKeySubAgencyMetric(agency.Parent.Id, agency.Name)
+				key = data.ComputedValueKeySubAgencyMetric(agency.Parent.Id, agency.Slug)
 			} else {
 				key = data.ComputedValueKeyAgencyMetric(agency.Id)
 			}
@@ -164,30 +189,60 @@ func (s *ComputedValueService) ProcessAgencyMetrics(
 
 			err = s.ComputedValueDAO.Insert(ctx, cv)
 			if err != nil {
-				messages <- fmt.Sprintf("failed to insert agency metrics, %v, %v", slug, err)
+				computedValueLog.Error("Failed to insert agency metrics", "agency", slug, "error", err)
 				failures <- slug
 				return
 			}
 
-			messages <- fmt.Sprintf("Success: %v", slug)
+			computedValueLog.Info("Computed agency metrics", "agency", slug, "subAgency", subAgencyFilter)
 			successes <- slug
 		}(agency)
 	}
 
 	agencyWg.Wait()
 
-	close(messages)
 	close(successes)
 	close(failures)
 
 	messagesWG.Wait()
-	s.logInfo(fmt.Sprintf("Successfully imported: %v", strings.Join(successAgencies, ", ")))
-	s.logInfo(fmt.Sprintf("Failed to import: %v", strings.Join(failedAgencies, ", ")))
-	s.logInfo("Complete")
+	computedValueLog.Info(
+		"Complete",
+		"succeeded", strings.Join(successAgencies, ", "),
+		"failed", strings.Join(failedAgencies, ", "),
+	)
+
+	return nil
+}
+
+// DeleteComputedValue deletes a stale or corrupt computed value, so it is computed again rather than served
+// Returns an error wrapping dao.ErrComputedValueNotFound if there is no value for the key
+func (s *ComputedValueService) DeleteComputedValue(
+	ctx context.Context,
+	key string,
+) error {
+	if err := s.ComputedValueDAO.Delete(ctx, key); err != nil {
+		return fmt.Errorf("failed to delete computed value: %w", err)
+	}
 
+	computedValueLog.Info("Deleted computed value", "key", key)
 	return nil
 }
 
-func (s *ComputedValueService) logInfo(message string) {
-	log.Info(fmt.Sprintf("Computed Value Process: %v", message))
+// PurgeComputedValues deletes the computed values whose key starts with prefix, e.g., the metrics of an agency
+// Returns the number of computed values deleted, or an error wrapping ErrEmptyKeyPrefix for an empty prefix
+func (s *ComputedValueService) PurgeComputedValues(
+	ctx context.Context,
+	prefix string,
+) (int64, error) {
+	if prefix == "" {
+		return 0, ErrEmptyKeyPrefix
+	}
+
+	deleted, err := s.ComputedValueDAO.DeleteByKeyPrefix(ctx, prefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge computed values: %w", err)
+	}
+
+	computedValueLog.Info("Purged computed values", "prefix", prefix, "deleted", deleted)
+	return deleted, nil
 }
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/sam-berry/ecfr-analyzer/server/concurrent"
 	"github.com/sam-berry/ecfr-analyzer/server/dao"
 	"github.com/sam-berry/ecfr-analyzer/server/data"
@@ -44,16 +43,88 @@ func (s *ComputedValueServiceRefactored) ProcessTitleMetrics(
 	return nil
 }
 
+// MetricsJobSummary counts the items a metrics computation succeeded and failed on
+type MetricsJobSummary struct {
+	Succeeded int      `json:"succeeded"`
+	Failed    int      `json:"failed"`
+	Errors    []string `json:"errors"`
+}
+
+// AllMetricsSummary describes the outcome of each computation run by ProcessAllMetrics
+type AllMetricsSummary struct {
+	TitleMetrics     *MetricsJobSummary `json:"titleMetrics"`
+	AgencyMetrics    *MetricsJobSummary `json:"agencyMetrics"`
+	SubAgencyMetrics *MetricsJobSummary `json:"subAgencyMetrics"`
+}
+
+// ProcessAllMetrics computes title, agency, and sub-agency metrics in sequence
+// A failing computation does not stop the ones after it, each failure is reported in the summary.
+// agenciesFilter limits the agency metrics to the given slugs, sub-agency metrics are computed for all agencies.
+// options apply to the agency and sub-agency metrics, see AgencyMetricService.CountWordsAndSections.
+func (s *ComputedValueServiceRefactored) ProcessAllMetrics(
+	ctx context.Context,
+	agenciesFilter []string,
+	options data.CountOptions,
+) *AllMetricsSummary {
+	summary := &AllMetricsSummary{}
+
+	if err := s.ProcessTitleMetrics(ctx); err != nil {
+		summary.TitleMetrics = newMetricsJobSummary(nil, []error{err})
+	} else {
+		summary.TitleMetrics = newMetricsJobSummary([]string{"titles"}, nil)
+	}
+
+	agencyResult, err := s.runAgencyMetrics(ctx, agenciesFilter, options)
+	if err != nil {
+		summary.AgencyMetrics = newMetricsJobSummary(nil, []error{err})
+	} else {
+		summary.AgencyMetrics = newMetricsJobSummary(agencyResult.Results, agencyResult.Errors)
+	}
+
+	subAgencyResult, err := s.runSubAgencyMetrics(ctx, options)
+	if err != nil {
+		summary.SubAgencyMetrics = newMetricsJobSummary(nil, []error{err})
+	} else {
+		summary.SubAgencyMetrics = newMetricsJobSummary(subAgencyResult.Results, subAgencyResult.Errors)
+	}
+
+	return summary
+}
+
+func newMetricsJobSummary(results []string, errors []error) *MetricsJobSummary {
+	messages := make([]string, len(errors))
+	for i, err := range errors {
+		messages[i] = err.Error()
+	}
+
+	return &MetricsJobSummary{
+		Succeeded: len(results),
+		Failed:    len(errors),
+		Errors:    messages,
+	}
+}
+
 // ProcessAgencyMetrics processes metrics for parent agencies
 func (s *ComputedValueServiceRefactored) ProcessAgencyMetrics(
 	ctx context.Context,
 	agenciesFilter []string,
+	options data.CountOptions,
 ) error {
-	s.logInfo("Start - Agency Metrics")
+	_, err := s.runAgencyMetrics(ctx, agenciesFilter, options)
+	return err
+}
+
+// runAgencyMetrics processes metrics for parent agencies and returns the processed slugs and errors
+func (s *ComputedValueServiceRefactored) runAgencyMetrics(
+	ctx context.Context,
+	agenciesFilter []string,
+	options data.CountOptions,
+) (concurrent.RunResult[*data.Agency, string], error) {
+	computedValueLog.Info("Start", "job", "Agency Metrics")
 
 	agencies, err := s.getFilteredAgencies(ctx, agenciesFilter)
 	if err != nil {
-		return err
+		return concurrent.RunResult[*data.Agency, string]{}, err
 	}
 
 	// Create concurrent runner with limited concurrency
@@ -63,33 +134,38 @@ func (s *ComputedValueServiceRefactored) ProcessAgencyMetrics(
 	})
 
 	// Process agencies concurrently
-	result := runner.Run(agencies, func(
-		agency *data.Agency,
-		messages chan<- string,
-		results chan<- string,
-		errors chan<- error,
-	) {
-		s.processAgencyMetric(ctx, agency, messages, results, errors)
+	result := runner.RunSimple(ctx, agencies, func(ctx context.Context, agency *data.Agency) (string, error) {
+		return s.processAgencyMetric(ctx, agency, options)
 	})
 
 	s.logResults("Agency Metrics", result.Results, result.Errors)
-	return nil
+	return result, nil
 }
 
 // ProcessSubAgencyMetrics processes metrics for sub-agencies
 func (s *ComputedValueServiceRefactored) ProcessSubAgencyMetrics(
 	ctx context.Context,
+	options data.CountOptions,
 ) error {
-	s.logInfo("Start - Sub-Agency Metrics")
+	_, err := s.runSubAgencyMetrics(ctx, options)
+	return err
+}
+
+// runSubAgencyMetrics processes metrics for sub-agencies and returns the processed names and errors
+func (s *ComputedValueServiceRefactored) runSubAgencyMetrics(
+	ctx context.Context,
+	options data.CountOptions,
+) (concurrent.RunResult[*data.Agency, string], error) {
+	computedValueLog.Info("Start", "job", "Sub-Agency Metrics")
 
 	// Get all agencies and extract sub-agencies
 	allAgencies, err := s.AgencyDAO.FindAll(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to find agencies, %w", err)
+		return concurrent.RunResult[*data.Agency, string]{}, fmt.Errorf("failed to find agencies, %w", err)
 	}
 
 	subAgencies := s.extractSubAgencies(allAgencies)
-	s.logInfo(fmt.Sprintf("Processing %d sub-agencies", len(subAgencies)))
+	computedValueLog.Info("Processing sub-agencies", "count", len(subAgencies))
 
 	// Create concurrent runner with limited concurrency
 	runner := concurrent.NewRunner[*data.Agency, string](concurrent.RunnerConfig{
@@ -98,44 +174,33 @@ func (s *ComputedValueServiceRefactored) ProcessSubAgencyMetrics(
 	})
 
 	// Process sub-agencies concurrently
-	result := runner.Run(subAgencies, func(
-		subAgency *data.Agency,
-		messages chan<- string,
-		results chan<- string,
-		errors chan<- error,
-	) {
-		s.processSubAgencyMetric(ctx, subAgency, messages, results, errors)
+	result := runner.RunSimple(ctx, subAgencies, func(ctx context.Context, subAgency *data.Agency) (string, error) {
+		return s.processSubAgencyMetric(ctx, subAgency, options)
 	})
 
 	s.logResults("Sub-Agency Metrics", result.Results, result.Errors)
-	return nil
+	return result, nil
 }
 
 // processAgencyMetric processes metrics for a single parent agency
 func (s *ComputedValueServiceRefactored) processAgencyMetric(
 	ctx context.Context,
 	agency *data.Agency,
-	messages chan<- string,
-	results chan<- string,
-	errors chan<- error,
-) {
+	options data.CountOptions,
+) (string, error) {
 	slug := agency.Slug
-	messages <- fmt.Sprintf("Processing: %v", slug)
+	computedValueLog.Debug("Processing agency", "agency", slug)
 
 	// Count metrics for the agency
-	result, err := s.AgencyMetricService.CountWordsAndSections(ctx, slug, "")
+	result, err := s.AgencyMetricService.CountWordsAndSections(ctx, slug, "", options)
 	if err != nil {
-		messages <- fmt.Sprintf("failed to count agency metrics, %v, %v", slug, err)
-		errors <- fmt.Errorf("agency %s: %w", slug, err)
-		return
+		return "", fmt.Errorf("agency %s: %w", slug, err)
 	}
 
 	// Marshal results
 	rBytes, err := json.Marshal(result)
 	if err != nil {
-		messages <- fmt.Sprintf("failed to marshall agency metrics, %v, %v", slug, err)
-		errors <- fmt.Errorf("agency %s: %w", slug, err)
-		return
+		return "", fmt.Errorf("agency %s: %w", slug, err)
 	}
 
 	// Store computed value
@@ -146,64 +211,53 @@ func (s *ComputedValueServiceRefactored) processAgencyMetric(
 
 	err = s.ComputedValueDAO.Insert(ctx, cv)
 	if err != nil {
-		messages <- fmt.Sprintf("failed to insert agency metrics, %v, %v", slug, err)
-		errors <- fmt.Errorf("agency %s: %w", slug, err)
-		return
+		return "", fmt.Errorf("agency %s: %w", slug, err)
 	}
 
-	messages <- fmt.Sprintf("Success: %v", slug)
-	results <- slug
+	computedValueLog.Info("Computed agency metrics", "agency", slug)
+	return slug, nil
 }
 
 // processSubAgencyMetric processes metrics for a single sub-agency
 func (s *ComputedValueServiceRefactored) processSubAgencyMetric(
 	ctx context.Context,
 	subAgency *data.Agency,
-	messages chan<- string,
-	results chan<- string,
-	errors chan<- error,
-) {
+	options data.CountOptions,
+) (string, error) {
 	if subAgency.Parent == nil {
-		errors <- fmt.Errorf("sub-agency %s has no parent", subAgency.Name)
-		return
+		return "", fmt.Errorf("sub-agency %s has no parent", subAgency.Name)
 	}
 
 	parentSlug := subAgency.Parent.Slug
 	subAgencyName := subAgency.Name
 
-	messages <- fmt.Sprintf("Processing: %v (sub-agency of %v)", subAgencyName, parentSlug)
+	computedValueLog.Debug("Processing sub-agency", "agency", parentSlug, "subAgency", subAgency.Slug)
 
 	// Count metrics for the sub-agency
-	result, err := s.AgencyMetricService.CountWordsAndSections(ctx, parentSlug, subAgencyName)
+	result, err := s.AgencyMetricService.CountWordsAndSections(ctx, parentSlug, subAgency.Slug, options)
 	if err != nil {
-		messages <- fmt.Sprintf("failed to count sub-agency metrics, %v, %v", subAgencyName, err)
-		errors <- fmt.Errorf("sub-agency %s: %w", subAgencyName, err)
-		return
+		return "", fmt.Errorf("sub-agency %s: %w", subAgencyName, err)
 	}
 
 	// Marshal results
 	rBytes, err := json.Marshal(result)
 	if err != nil {
-		messages <- fmt.Sprintf("failed to marshall sub-agency metrics, %v, %v", subAgencyName, err)
-		errors <- fmt.Errorf("sub-agency %s: %w", subAgencyName, err)
-		return
+		return "", fmt.Errorf("sub-agency %s: %w", subAgencyName, err)
 	}
 
 	// Store computed value with sub-agency key
 	cv := &data.ComputedValue{
-		Key:  data.ComputedValueKeySubAgencyMetric(subAgency.Parent.Id, subAgencyName),
+		Key:  data.ComputedValueKeySubAgencyMetric(subAgency.Parent.Id, subAgency.Slug),
 		Data: rBytes,
 	}
 
 	err = s.ComputedValueDAO.Insert(ctx, cv)
 	if err != nil {
-		messages <- fmt.Sprintf("failed to insert sub-agency metrics, %v, %v", subAgencyName, err)
-		errors <- fmt.Errorf("sub-agency %s: %w", subAgencyName, err)
-		return
+		return "", fmt.Errorf("sub-agency %s: %w", subAgencyName, err)
 	}
 
-	messages <- fmt.Sprintf("Success: %v", subAgencyName)
-	results <- subAgencyName
+	computedValueLog.Info("Computed sub-agency metrics", "agency", parentSlug, "subAgency", subAgency.Slug)
+	return subAgencyName, nil
 }
 
 // getFilteredAgencies retrieves and filters agencies based on the provided filter
@@ -238,6 +292,7 @@ func (s *ComputedValueServiceRefactored) getFilteredAgencies(
 }
 
 // extractSubAgencies extracts all sub-agencies from the list of agencies
+// Sub-agencies without a slug are skipped, as their metrics are keyed by it
 func (s *ComputedValueServiceRefactored) extractSubAgencies(
 	agencies []*data.Agency,
 ) []*data.Agency {
@@ -245,6 +300,15 @@ func (s *ComputedValueServiceRefactored) extractSubAgencies(
 
 	for _, agency := range agencies {
 		for _, child := range agency.Children {
+			if child.Slug == "" {
+				computedValueLog.Warn(
+					"Skipping sub-agency without a slug",
+					"agency", agency.Slug,
+					"subAgency", child.Name,
+				)
+				continue
+			}
+
 			// Set parent reference
 			child.Parent = agency
 			subAgencies = append(subAgencies, child)
@@ -260,20 +324,18 @@ func (s *ComputedValueServiceRefactored) logResults(
 	results []string,
 	errors []error,
 ) {
+	log := computedValueLog.With("job", prefix)
+
 	if len(errors) > 0 {
-		s.logInfo(fmt.Sprintf("%s - Completed with %d errors", prefix, len(errors)))
+		log.Warn("Completed with errors", "errors", len(errors))
 		for _, err := range errors {
-			s.logInfo(fmt.Sprintf("%s - Error: %v", prefix, err))
+			log.Error("Failed to compute metrics", "error", err)
 		}
 	}
 
 	if len(results) > 0 {
-		s.logInfo(fmt.Sprintf("%s - Successfully processed: %v", prefix, strings.Join(results, ", ")))
+		log.Info("Successfully processed", "count", len(results), "processed", strings.Join(results, ", "))
 	}
 
-	s.logInfo(fmt.Sprintf("%s - Complete", prefix))
-}
-
-func (s *ComputedValueServiceRefactored) logInfo(message string) {
-	log.Info(fmt.Sprintf("Computed Value Process: %v", message))
+	log.Info("Complete")
 }
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"github.com/sam-berry/ecfr-analyzer/server/dao"
+	"github.com/sam-berry/ecfr-analyzer/server/httpclient"
+	"sync"
+	"time"
+)
+
+// HealthCheckTimeout bounds each dependency check so the probe stays cheap to poll
+var HealthCheckTimeout = 2 * time.Second
+
+// BulkDataHealthCacheDuration is how long a bulk data check result is reused,
+// so frequent polling does not send a request to the external host on every probe
+var BulkDataHealthCacheDuration = 30 * time.Second
+
+type HealthService struct {
+	HealthDAO  *dao.HealthDAO
+	TitleDAO   *dao.TitleDAO
+	HttpClient *httpclient.ECFRBulkDataClient
+
+	mu              sync.Mutex
+	bulkDataStatus  *ComponentStatus
+	bulkDataChecked time.Time
+}
+
+// HealthStatus describes the readiness of the service and its dependencies
+type HealthStatus struct {
+	Healthy      bool               `json:"healthy"`
+	Components   []*ComponentStatus `json:"components"`
+	LastImportAt *time.Time         `json:"lastImportAt"` // Most recent successful title import
+}
+
+// ComponentStatus describes the health of a single dependency
+type ComponentStatus struct {
+	Name      string    `json:"name"`
+	Healthy   bool      `json:"healthy"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMs int64     `json:"latencyMs"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// CheckHealth checks the database and the eCFR bulk data host
+func (s *HealthService) CheckHealth(ctx context.Context) *HealthStatus {
+	database := s.checkDatabase(ctx)
+	bulkData := s.checkBulkData(ctx)
+
+	status := &HealthStatus{
+		Healthy:    database.Healthy && bulkData.Healthy,
+		Components: []*ComponentStatus{database, bulkData},
+	}
+
+	if database.Healthy {
+		timeoutCtx, cancel := context.WithTimeout(ctx, HealthCheckTimeout)
+		defer cancel()
+
+		// The import timestamp is informational and does not affect readiness
+		lastImportAt, err := s.TitleDAO.FindLatestImportTimestamp(timeoutCtx)
+		if err == nil {
+			status.LastImportAt = lastImportAt
+		}
+	}
+
+	return status
+}
+
+func (s *HealthService) checkDatabase(ctx context.Context) *ComponentStatus {
+	timeoutCtx, cancel := context.WithTimeout(ctx, HealthCheckTimeout)
+	defer cancel()
+
+	return checkComponent("database", func() error {
+		return s.HealthDAO.Ping(timeoutCtx)
+	})
+}
+
+func (s *HealthService) checkBulkData(ctx context.Context) *ComponentStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.bulkDataStatus != nil && time.Since(s.bulkDataChecked) < BulkDataHealthCacheDuration {
+		return s.bulkDataStatus
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, HealthCheckTimeout)
+	defer cancel()
+
+	s.bulkDataStatus = checkComponent("ecfr-bulk-data", func() error {
+		return s.HttpClient.Ping(timeoutCtx)
+	})
+	s.bulkDataChecked = time.Now()
+
+	return s.bulkDataStatus
+}
+
+func checkComponent(name string, check func() error) *ComponentStatus {
+	start := time.Now()
+	err := check()
+
+	status := &ComponentStatus{
+		Name:      name,
+		Healthy:   err == nil,
+		LatencyMs: time.Since(start).Milliseconds(),
+		CheckedAt: start.UTC(),
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	return status
+}
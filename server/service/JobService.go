@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/sam-berry/ecfr-analyzer/server/logging"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrJobNotFound is returned when no job has the requested id
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobNotResumable is returned when resuming a job that was not started resumable, or did not fail or get cancelled
+var ErrJobNotResumable = errors.New("job not resumable")
+
+// Job statuses
+const (
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+var jobLog = logging.New("jobs")
+
+// Job describes a long running operation started in the background
+type Job struct {
+	Id          string     `json:"id"`
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	StartedAt   time.Time  `json:"startedAt"`
+	FinishedAt  *time.Time `json:"finishedAt"`
+	Result      any        `json:"result"` // Partial for a cancelled job
+	Error       *string    `json:"error"`
+	Resumable   bool       `json:"resumable"`   // Whether the job can be resumed once it fails or is cancelled
+	ResumedBy   *string    `json:"resumedBy"`   // The id of the job that resumed this one
+	ResumedFrom *string    `json:"resumedFrom"` // The id of the job this one resumed
+}
+
+// JobFunc runs a job, it must stop when ctx is done and return the result it has so far
+// The function of a resumable job is run again to resume it, so it must skip the work completed by earlier runs.
+type JobFunc func(ctx context.Context) (any, error)
+
+type runningJob struct {
+	job    Job
+	parent context.Context // The context the job was started with, also used to resume it
+	fn     JobFunc         // Kept for resumable jobs only
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// JobService runs jobs in the background and keeps their status in memory until the server restarts
+// The zero value is ready to use
+type JobService struct {
+	mu   sync.Mutex
+	jobs map[string]*runningJob
+}
+
+// Start runs fn in the background with a context derived from ctx, which cancels the job when done
+// Returns the job as started
+func (s *JobService) Start(ctx context.Context, name string, fn JobFunc) Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.start(ctx, name, fn, false, nil)
+}
+
+// StartResumable is Start for a job that can be resumed with ResumeJob once it fails or is cancelled
+func (s *JobService) StartResumable(ctx context.Context, name string, fn JobFunc) Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.start(ctx, name, fn, true, nil)
+}
+
+// ResumeJob starts a failed or cancelled resumable job again as a new job, see StartResumable
+// Returns the new job as started. Returns an error wrapping ErrJobNotFound if there is no job with the id, or
+// ErrJobNotResumable if the job is not resumable, is still running, succeeded, or was already resumed.
+func (s *JobService) ResumeJob(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+
+	status := previous.job.Status
+	if !previous.job.Resumable || previous.job.ResumedBy != nil ||
+		(status != JobStatusFailed && status != JobStatusCancelled) {
+		return Job{}, fmt.Errorf("%w: %s is %s", ErrJobNotResumable, id, status)
+	}
+
+	resumed := s.start(previous.parent, previous.job.Name, previous.fn, true, &previous.job.Id)
+	previous.job.ResumedBy = &resumed.Id
+	return resumed, nil
+}
+
+// start runs a job, s.mu must be held
+func (s *JobService) start(
+	ctx context.Context,
+	name string,
+	fn JobFunc,
+	resumable bool,
+	resumedFrom *string,
+) Job {
+	jobCtx, cancel := context.WithCancel(ctx)
+	running := &runningJob{
+		job: Job{
+			Id:          uuid.New().String(),
+			Name:        name,
+			Status:      JobStatusRunning,
+			StartedAt:   time.Now().UTC(),
+			Resumable:   resumable,
+			ResumedFrom: resumedFrom,
+		},
+		parent: ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	if resumable {
+		running.fn = fn
+	}
+
+	if s.jobs == nil {
+		s.jobs = make(map[string]*runningJob)
+	}
+	s.jobs[running.job.Id] = running
+	started := running.job
+
+	if resumedFrom != nil {
+		jobLog.Info("Resumed job", "job", name, "id", started.Id, "resumedFrom", *resumedFrom)
+	} else {
+		jobLog.Info("Started job", "job", name, "id", started.Id)
+	}
+
+	go func() {
+		defer close(running.done)
+		defer cancel()
+
+		result, err := fn(jobCtx)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		finishedAt := time.Now().UTC()
+		running.job.FinishedAt = &finishedAt
+		running.job.Result = result
+		if err != nil {
+			message := err.Error()
+			running.job.Error = &message
+		}
+
+		switch {
+		case jobCtx.Err() != nil && ctx.Err() == nil:
+			running.job.Status = JobStatusCancelled
+		case err != nil:
+			running.job.Status = JobStatusFailed
+		default:
+			running.job.Status = JobStatusSucceeded
+		}
+
+		jobLog.Info("Finished job", "job", name, "id", started.Id, "status", running.job.Status)
+	}()
+
+	return started
+}
+
+// GetJob returns a job by id
+// Returns an error wrapping ErrJobNotFound if there is no job with the id
+func (s *JobService) GetJob(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	running, ok := s.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+
+	return running.job, nil
+}
+
+// GetJobs returns every job, most recently started first
+func (s *JobService) GetJobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, running := range s.jobs {
+		jobs = append(jobs, running.job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartedAt.After(jobs[j].StartedAt)
+	})
+
+	return jobs
+}
+
+// CancelJob cancels a running job and waits for it to return, or ctx to be done
+// Returns the job with its partial result, a job that already finished is returned unchanged.
+// Returns an error wrapping ErrJobNotFound if there is no job with the id
+func (s *JobService) CancelJob(ctx context.Context, id string) (Job, error) {
+	s.mu.Lock()
+	running, ok := s.jobs[id]
+	s.mu.Unlock()
+
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+
+	running.cancel()
+
+	select {
+	case <-running.done:
+	case <-ctx.Done():
+		return Job{}, fmt.Errorf("failed to wait for job %s to stop: %w", id, ctx.Err())
+	}
+
+	return s.GetJob(id)
+}
@@ -3,11 +3,29 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/sam-berry/ecfr-analyzer/server/dao"
 	"github.com/sam-berry/ecfr-analyzer/server/data"
+	"sort"
+	"time"
 )
 
+// ErrNotComputed is returned when a requested value has not been computed and stored yet
+var ErrNotComputed = errors.New("not computed yet")
+
+// ErrInvalidSortBy is returned for an agency metrics sort order other than those in agencyMetricSorts
+var ErrInvalidSortBy = errors.New("sortBy must be one of wordCount, sectionCount, appendixWordCount, or appendixCount")
+
+// agencyMetricSorts are the metrics agency metrics can be sorted by, largest first
+var agencyMetricSorts = map[string]func(m *data.AgencyMetricResponse) int{
+	"wordCount":         func(m *data.AgencyMetricResponse) int { return m.WordCount },
+	"sectionCount":      func(m *data.AgencyMetricResponse) int { return m.SectionCount },
+	"appendixWordCount": func(m *data.AgencyMetricResponse) int { return m.AppendixWordCount },
+	"appendixCount":     func(m *data.AgencyMetricResponse) int { return m.AppendixCount },
+}
+
+// MetricService reads stored metrics, the getters also return when the metrics were last computed, zero if never
 type MetricService struct {
 	AgencyDAO        *dao.AgencyDAO
 	ComputedValueDAO *dao.ComputedValueDAO
@@ -15,30 +33,93 @@ type MetricService struct {
 
 func (s *MetricService) GetTitleMetrics(
 	ctx context.Context,
-) (*data.TitleMetricResponse, error) {
+) (*data.TitleMetricResponse, time.Time, error) {
 	titleMetrics, err := s.ComputedValueDAO.FindByKey(
 		ctx,
 		data.ComputedValueKeyGlobalTitleMetrics(),
 	)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to find title metrics, %w", err)
+		return nil, time.Time{}, fmt.Errorf("failed to find title metrics, %w", err)
+	}
+
+	if titleMetrics == nil {
+		return nil, time.Time{}, fmt.Errorf("title metrics: %w", ErrNotComputed)
 	}
 
 	var m data.TitleMetricResponse
 	if err = json.Unmarshal(titleMetrics.Data, &m); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal title metrics, %w", err)
+		return nil, time.Time{}, fmt.Errorf("failed to unmarshal title metrics, %w", err)
+	}
+
+	return &m, titleMetrics.CreatedAt, nil
+}
+
+// GetGlobalSnapshot returns the stored global snapshot computed by TitleMetricService.ComputeGlobalSnapshot
+func (s *MetricService) GetGlobalSnapshot(
+	ctx context.Context,
+) (*data.GlobalSnapshot, time.Time, error) {
+	snapshot, err := s.ComputedValueDAO.FindByKey(
+		ctx,
+		data.ComputedValueKeyGlobalSnapshot(),
+	)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to find global snapshot, %w", err)
+	}
+
+	if snapshot == nil {
+		return nil, time.Time{}, fmt.Errorf("global snapshot: %w", ErrNotComputed)
+	}
+
+	var m data.GlobalSnapshot
+	if err = json.Unmarshal(snapshot.Data, &m); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to unmarshal global snapshot, %w", err)
+	}
+
+	return &m, snapshot.CreatedAt, nil
+}
+
+// GetGlobalTimeSeries returns the stored total words and sections of every title at each date, see
+// TitleMetricService.GlobalTimeSeries
+func (s *MetricService) GetGlobalTimeSeries(
+	ctx context.Context,
+) ([]*data.GlobalPoint, time.Time, error) {
+	series, err := s.ComputedValueDAO.FindByKey(
+		ctx,
+		data.ComputedValueKeyGlobalTimeSeries(),
+	)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to find global time series, %w", err)
+	}
+
+	if series == nil {
+		return nil, time.Time{}, fmt.Errorf("global time series: %w", ErrNotComputed)
 	}
 
-	return &m, nil
+	var points []*data.GlobalPoint
+	if err = json.Unmarshal(series.Data, &points); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to unmarshal global time series, %w", err)
+	}
+
+	return points, series.CreatedAt, nil
 }
 
+// GetAgencyMetrics returns the stored metrics of every agency, read in one query
+// By default agencies are in the order of AgencyDAO.FindAll, sortBy orders them by a metric, largest first, see
+// agencyMetricSorts. A limit above 0 returns only the first agencies.
 func (s *MetricService) GetAgencyMetrics(
 	ctx context.Context,
-) ([]*data.AgencyMetrics, error) {
+	sortBy string,
+	limit int,
+) ([]*data.AgencyMetrics, time.Time, error) {
+	metricValue, ok := agencyMetricSorts[sortBy]
+	if sortBy != "" && !ok {
+		return nil, time.Time{}, fmt.Errorf("%w: %q", ErrInvalidSortBy, sortBy)
+	}
+
 	agencies, err := s.AgencyDAO.FindAll(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find agencies, %w", err)
+		return nil, time.Time{}, fmt.Errorf("failed to find agencies, %w", err)
 	}
 
 	agencyMetrics, err := s.ComputedValueDAO.FindByKeyPrefix(
@@ -46,7 +127,7 @@ func (s *MetricService) GetAgencyMetrics(
 		data.ComputedValueKeyAgencyMetricPrefix,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find agency metrics, %w", err)
+		return nil, time.Time{}, fmt.Errorf("failed to find agency metrics, %w", err)
 	}
 
 	var metricsMap = make(map[string]*data.ComputedValue, len(agencyMetrics))
@@ -55,14 +136,16 @@ func (s *MetricService) GetAgencyMetrics(
 		metricsMap[agencyId] = metric
 	}
 
+	var lastModified time.Time
 	var results = make([]*data.AgencyMetrics, len(agencies))
 	for i, agency := range agencies {
 		metric, ok := metricsMap[agency.Id]
 		var metricResponse data.AgencyMetricResponse
 		if ok {
 			err := json.Unmarshal(metric.Data, &metricResponse)
+			lastModified = latest(lastModified, metric.CreatedAt)
 			if err != nil {
-				return nil, fmt.Errorf(
+				return nil, time.Time{}, fmt.Errorf(
 					"failed to unmarshal agency metrics, %v, %w",
 					agency.Name,
 					err,
@@ -78,16 +161,30 @@ func (s *MetricService) GetAgencyMetrics(
 		}
 	}
 
-	return results, nil
+	if metricValue != nil {
+		sort.SliceStable(results, func(i, j int) bool {
+			return metricValue(results[i].Metrics) > metricValue(results[j].Metrics)
+		})
+	}
+
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+
+	return results, lastModified, nil
 }
 
 func (s *MetricService) GetMetricsForAgency(
 	ctx context.Context,
 	slug string,
-) (*data.AgencyMetrics, error) {
+) (*data.AgencyMetrics, time.Time, error) {
 	agency, err := s.AgencyDAO.FindBySlug(ctx, slug)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find agency, %v, %w", slug, err)
+		return nil, time.Time{}, fmt.Errorf("failed to find agency, %v, %w", slug, err)
+	}
+
+	if agency == nil {
+		return nil, time.Time{}, fmt.Errorf("%w: %v", ErrAgencyNotFound, slug)
 	}
 
 	agencyMetrics, err := s.ComputedValueDAO.FindByKey(
@@ -95,16 +192,18 @@ func (s *MetricService) GetMetricsForAgency(
 		data.ComputedValueKeyAgencyMetric(agency.Id),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find agency metrics, %v, %w", agency.Id, err)
+		return nil, time.Time{}, fmt.Errorf("failed to find agency metrics, %v, %w", agency.Id, err)
 	}
 
 	var metricResponse data.AgencyMetricResponse
+	var lastModified time.Time
 	if agencyMetrics == nil {
 		metricResponse = data.DefaultAgencyMetrics()
 	} else {
+		lastModified = agencyMetrics.CreatedAt
 		err := json.Unmarshal(agencyMetrics.Data, &metricResponse)
 		if err != nil {
-			return nil, fmt.Errorf(
+			return nil, time.Time{}, fmt.Errorf(
 				"failed to unmarshal agency metrics, %v, %w",
 				agency.Name,
 				err,
@@ -115,17 +214,20 @@ func (s *MetricService) GetMetricsForAgency(
 	return &data.AgencyMetrics{
 		Agency:  agency,
 		Metrics: &metricResponse,
-	}, nil
-
+	}, lastModified, nil
 }
 
 func (s *MetricService) GetSubAgencyMetrics(
 	ctx context.Context,
 	slug string,
-) ([]*data.AgencyMetrics, error) {
+) ([]*data.AgencyMetrics, time.Time, error) {
 	agency, err := s.AgencyDAO.FindBySlug(ctx, slug)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find agency, %v, %w", slug, err)
+		return nil, time.Time{}, fmt.Errorf("failed to find agency, %v, %w", slug, err)
+	}
+
+	if agency == nil {
+		return nil, time.Time{}, fmt.Errorf("%w: %v", ErrAgencyNotFound, slug)
 	}
 
 	agencyMetrics, err := s.ComputedValueDAO.FindByKeyPrefix(
@@ -133,7 +235,7 @@ func (s *MetricService) GetSubAgencyMetrics(
 		data.CreateComputedValueKey(data.ComputedValueKeySubAgencyMetricPrefix, agency.Id),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find sub agency metrics, %v, %w", agency.Id, err)
+		return nil, time.Time{}, fmt.Errorf("failed to find sub agency metrics, %v, %w", agency.Id, err)
 	}
 
 	var metricsMap = make(map[string]*data.ComputedValue, len(agencyMetrics))
@@ -141,14 +243,16 @@ func (s *MetricService) GetSubAgencyMetrics(
 		metricsMap[metric.Key] = metric
 	}
 
+	var lastModified time.Time
 	var results = make([]*data.AgencyMetrics, len(agency.Children))
 	for i, subAgency := range agency.Children {
-		metric, ok := metricsMap[data.ComputedValueKeySubAgencyMetric(agency.Id, subAgency.Name)]
+		metric, ok := metricsMap[data.ComputedValueKeySubAgencyMetric(agency.Id, subAgency.Slug)]
 		var metricResponse data.AgencyMetricResponse
 		if ok {
 			err := json.Unmarshal(metric.Data, &metricResponse)
+			lastModified = latest(lastModified, metric.CreatedAt)
 			if err != nil {
-				return nil, fmt.Errorf(
+				return nil, time.Time{}, fmt.Errorf(
 					"failed to unmarshal agency metrics, %v, %w",
 					subAgency.Name,
 					err,
@@ -164,5 +268,13 @@ func (s *MetricService) GetSubAgencyMetrics(
 		}
 	}
 
-	return results, nil
+	return results, lastModified, nil
+}
+
+// latest returns the later of two times
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
 }
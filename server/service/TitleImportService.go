@@ -4,23 +4,27 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/sam-berry/ecfr-analyzer/server/dao"
 	"github.com/sam-berry/ecfr-analyzer/server/ecfrdata"
 	"github.com/sam-berry/ecfr-analyzer/server/httpclient"
+	"github.com/sam-berry/ecfr-analyzer/server/logging"
+	"github.com/sam-berry/ecfr-analyzer/server/metrics"
 	"io"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
+var titleImportLog = logging.New("title-import")
+
 type TitleImportService struct {
 	HttpClient     *httpclient.ECFRBulkDataClient
 	TitleImportDAO *dao.TitleImportDAO
 }
 
 func (s *TitleImportService) ImportTitles(ctx context.Context, titlesFilter []string) error {
-	s.logInfo("Start")
+	titleImportLog.Info("Start")
 
 	allFiles, err := s.getAllFiles(ctx, titlesFilter)
 	if err != nil {
@@ -29,15 +33,6 @@ func (s *TitleImportService) ImportTitles(ctx context.Context, titlesFilter []st
 
 	var messagesWG sync.WaitGroup
 
-	messages := make(chan string)
-	messagesWG.Add(1)
-	go func() {
-		defer messagesWG.Done()
-		for message := range messages {
-			s.logInfo(message)
-		}
-	}()
-
 	successes := make(chan int)
 	var successTitles []string
 	messagesWG.Add(1)
@@ -66,7 +61,6 @@ func (s *TitleImportService) ImportTitles(ctx context.Context, titlesFilter []st
 			ctx,
 			file,
 			&filesWg,
-			messages,
 			successes,
 			failures,
 		)
@@ -74,15 +68,16 @@ func (s *TitleImportService) ImportTitles(ctx context.Context, titlesFilter []st
 
 	filesWg.Wait()
 
-	close(messages)
 	close(successes)
 	close(failures)
 
 	messagesWG.Wait()
 
-	s.logInfo(fmt.Sprintf("Successfully imported titles: %v", strings.Join(successTitles, ", ")))
-	s.logInfo(fmt.Sprintf("Failed to import titles: %v", strings.Join(failedTitles, ", ")))
-	s.logInfo("Complete")
+	titleImportLog.Info(
+		"Complete",
+		"succeeded", strings.Join(successTitles, ", "),
+		"failed", strings.Join(failedTitles, ", "),
+	)
 
 	return nil
 }
@@ -91,33 +86,40 @@ func (s *TitleImportService) processTitleFile(
 	ctx context.Context,
 	file ecfrdata.AllFilesItem,
 	wg *sync.WaitGroup,
-	messages chan<- string,
 	successes chan<- int,
 	failures chan<- int,
 ) {
 	defer wg.Done()
 
 	titleNumber := file.CFRTitle
+	start := time.Now()
 
-	messages <- fmt.Sprintf("Fetching: %v", titleNumber)
+	titleImportLog.Debug("Fetching title file", "title", titleNumber)
 
 	titleFile, err := s.getTitleFile(ctx, file.Link)
 	if err != nil {
-		messages <- fmt.Sprintf("failed to get title file, %v, %v", titleNumber, err)
+		titleImportLog.Error("Failed to get title file", "title", titleNumber, "error", err)
+		metrics.Errors.WithLabelValues(metrics.OperationTitleImport).Inc()
 		failures <- titleNumber
 		return
 	}
 
-	messages <- fmt.Sprintf("Downloading: %v", titleNumber)
+	titleImportLog.Debug("Downloading title", "title", titleNumber)
 
 	err = s.downloadTitleFile(ctx, titleNumber, titleFile.Link)
 	if err != nil {
-		messages <- fmt.Sprintf("failed to download title file, %v, %v", titleNumber, err)
+		titleImportLog.Error(
+			"Failed to download title file",
+			"title", titleNumber,
+			"durationMs", time.Since(start).Milliseconds(),
+			"error", err,
+		)
+		metrics.Errors.WithLabelValues(metrics.OperationTitleImport).Inc()
 		failures <- titleNumber
 		return
 	}
 
-	messages <- fmt.Sprintf("Success: %v", titleNumber)
+	titleImportLog.Info("Imported title", "title", titleNumber, "durationMs", time.Since(start).Milliseconds())
 	successes <- titleNumber
 }
 
@@ -195,6 +197,7 @@ func (s *TitleImportService) downloadTitleFile(
 	if err != nil {
 		return fmt.Errorf("failed to read title content, %w", err)
 	}
+	metrics.ImportBytesDownloaded.WithLabelValues(metrics.ImportTitle).Add(float64(len(content)))
 
 	err = s.TitleImportDAO.Insert(ctx, name, content)
 	if err != nil {
@@ -203,7 +206,3 @@ func (s *TitleImportService) downloadTitleFile(
 
 	return nil
 }
-
-func (s *TitleImportService) logInfo(message string) {
-	log.Info(fmt.Sprintf("Title Import Process: %v", message))
-}
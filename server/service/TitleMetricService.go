@@ -2,19 +2,33 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/sam-berry/ecfr-analyzer/server/dao"
 	"github.com/sam-berry/ecfr-analyzer/server/data"
+	"github.com/sam-berry/ecfr-analyzer/server/logging"
+	"github.com/sam-berry/ecfr-analyzer/server/readability"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 )
 
 var MaxConcurrentTitleLookups = 10
 
+var titleMetricLog = logging.New("title-metrics")
+
 type TitleMetricService struct {
-	TitleDAO *dao.TitleDAO
+	TitleDAO         *dao.TitleDAO
+	CfrStructureDAO  *dao.CfrStructureDAO
+	ComputedValueDAO *dao.ComputedValueDAO
+	TitleVersionDAO  *dao.TitleVersionDAO
+	ParseStateDAO    *dao.ParseStateDAO
 }
 
+// CountAllWordsAndSections counts the words, sections, and readability of every title
+// Distinct words and readability are those of the text found when each title was last parsed, see dao.ParseStateDAO,
+// titles never parsed have none.
 func (s *TitleMetricService) CountAllWordsAndSections(
 	ctx context.Context,
 ) (*data.TitleMetricResponse, error) {
@@ -23,21 +37,28 @@ func (s *TitleMetricService) CountAllWordsAndSections(
 		return nil, fmt.Errorf("failed to find titles, %w", err)
 	}
 
-	var messagesWG sync.WaitGroup
+	parseStates, err := s.ParseStateDAO.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find parse states, %w", err)
+	}
+	parseStatesByTitle := make(map[int]*data.ParseState, len(parseStates))
+	for _, state := range parseStates {
+		parseStatesByTitle[state.TitleNumber] = state
+	}
 
-	messages := make(chan string)
-	messagesWG.Add(1)
-	go func() {
-		defer messagesWG.Done()
-		for message := range messages {
-			log.Info(fmt.Sprintf("Title Metrics Process: %v", message))
-		}
-	}()
+	uniqueWordCount, err := s.ParseStateDAO.CountDistinctWords(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count distinct words, %w", err)
+	}
 
 	var titleWg sync.WaitGroup
 	var mu sync.Mutex
 	var totalWordCount int
 	var totalSectionCount int
+	var totalSentences int
+	var totalReadabilityWords int
+	var totalSyllables int
+	var titleMetrics []*data.TitleMetrics
 
 	throttle := make(chan int, MaxConcurrentTitleLookups)
 
@@ -53,11 +74,7 @@ func (s *TitleMetricService) CountAllWordsAndSections(
 
 			wordCount, err := s.TitleDAO.CountAllWords(ctx, name)
 			if err != nil {
-				messages <- fmt.Sprintf(
-					"failed to count words for title, %v, %v",
-					name,
-					err,
-				)
+				titleMetricLog.Error("Failed to count words", "title", name, "error", err)
 				return
 			}
 
@@ -67,27 +84,181 @@ func (s *TitleMetricService) CountAllWordsAndSections(
 
 			sectionCount, err := s.TitleDAO.CountAllSections(ctx, name)
 			if err != nil {
-				messages <- fmt.Sprintf(
-					"failed to count sections for agency, %v, %v",
-					name,
-					err,
-				)
+				titleMetricLog.Error("Failed to count sections", "title", name, "error", err)
 				return
 			}
 
 			mu.Lock()
 			totalSectionCount += sectionCount
 			mu.Unlock()
+
+			state := parseStatesByTitle[name]
+			if state == nil {
+				state = &data.ParseState{}
+			}
+			score := readability.FromCounts(state.Sentences, state.ReadabilityWords, state.Syllables)
+
+			mu.Lock()
+			totalSentences += score.Sentences
+			totalReadabilityWords += score.Words
+			totalSyllables += score.Syllables
+			titleMetrics = append(titleMetrics, &data.TitleMetrics{
+				Title:           name,
+				WordCount:       wordCount,
+				UniqueWordCount: state.UniqueWordCount,
+				SectionCount:    sectionCount,
+				Readability:     &score,
+			})
+			mu.Unlock()
 		}(title)
 	}
 
 	titleWg.Wait()
 
-	close(messages)
-	messagesWG.Wait()
+	sort.Slice(titleMetrics, func(i, j int) bool {
+		return titleMetrics[i].Title < titleMetrics[j].Title
+	})
+
+	overallReadability := readability.FromCounts(totalSentences, totalReadabilityWords, totalSyllables)
 
 	return &data.TitleMetricResponse{
-		WordCount:    totalWordCount,
-		SectionCount: totalSectionCount,
+		WordCount:       totalWordCount,
+		UniqueWordCount: uniqueWordCount,
+		SectionCount:    totalSectionCount,
+		Readability:     &overallReadability,
+		Titles:          titleMetrics,
 	}, nil
 }
+
+// ComputeGlobalSnapshot totals the words and sections of every parsed title and stores the result
+// Totals come from the cfr_structure table, so titles must be parsed first
+// options select whether appendices are counted and reserved sections excluded, both are totaled separately either way
+func (s *TitleMetricService) ComputeGlobalSnapshot(
+	ctx context.Context,
+	options data.CountOptions,
+) (*data.GlobalSnapshot, error) {
+	titles, err := s.CfrStructureDAO.SumMetricsByTitle(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum structure metrics, %w", err)
+	}
+
+	snapshot := &data.GlobalSnapshot{
+		IncludesAppendices: options.IncludeAppendices,
+		ExcludesReserved:   options.ExcludeReserved,
+		TitleCount:         len(titles),
+		ComputedAt:         time.Now().UTC(),
+		Titles:             []*data.TitleSnapshot{},
+	}
+	for _, title := range titles {
+		totals := data.StructureTotals{
+			WordCount:         title.WordCount,
+			SectionCount:      title.SectionCount,
+			AppendixWordCount: title.AppendixWordCount,
+			AppendixCount:     title.AppendixCount,
+			ReservedCount:     title.ReservedCount,
+		}
+		title.WordCount, title.SectionCount = totals.Counts(options)
+
+		snapshot.WordCount += title.WordCount
+		snapshot.SectionCount += title.SectionCount
+		snapshot.AppendixWordCount += title.AppendixWordCount
+		snapshot.AppendixCount += title.AppendixCount
+		snapshot.ReservedCount += title.ReservedCount
+		snapshot.Titles = append(snapshot.Titles, title)
+	}
+
+	sBytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal global snapshot, %w", err)
+	}
+
+	err = s.ComputedValueDAO.Insert(ctx, &data.ComputedValue{
+		Key:  data.ComputedValueKeyGlobalSnapshot(),
+		Data: sBytes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert global snapshot, %w", err)
+	}
+
+	titleMetricLog.Info(
+		"Computed global snapshot",
+		"titles", snapshot.TitleCount,
+		"words", snapshot.WordCount,
+		"sections", snapshot.SectionCount,
+	)
+
+	return snapshot, nil
+}
+
+// GlobalTimeSeries totals the words and sections of every title at each date and stores the series
+// Each title is counted from its latest version on or before the date, preferring the version's stored structures
+// over the totals counted at import, see data.GlobalPoint. Without dates, every date a version is stored for is used.
+// Points are in date order.
+func (s *TitleMetricService) GlobalTimeSeries(
+	ctx context.Context,
+	dates []time.Time,
+) ([]*data.GlobalPoint, error) {
+	if len(dates) == 0 {
+		versionDates, err := s.TitleVersionDAO.FindVersionDates(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find version dates, %w", err)
+		}
+		dates = versionDates
+	}
+
+	dates = slices.Clone(dates)
+	slices.SortFunc(dates, func(a, b time.Time) int { return a.Compare(b) })
+	dates = slices.CompactFunc(dates, func(a, b time.Time) bool { return a.Equal(b) })
+
+	points := []*data.GlobalPoint{}
+	for _, date := range dates {
+		totals, err := s.TitleVersionDAO.FindTotalsOnOrBefore(ctx, date)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find title totals on %s, %w", date.Format("2006-01-02"), err)
+		}
+
+		point := &data.GlobalPoint{Date: date, MissingTitles: []int{}}
+		for _, title := range totals {
+			if title.TotalWords == nil || title.TotalSections == nil {
+				point.MissingTitles = append(point.MissingTitles, title.TitleNumber)
+				continue
+			}
+
+			point.WordCount += *title.TotalWords
+			point.SectionCount += *title.TotalSections
+			point.TitleCount++
+		}
+		points = append(points, point)
+	}
+
+	pBytes, err := json.Marshal(points)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal global time series, %w", err)
+	}
+
+	err = s.ComputedValueDAO.Insert(ctx, &data.ComputedValue{
+		Key:  data.ComputedValueKeyGlobalTimeSeries(),
+		Data: pBytes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert global time series, %w", err)
+	}
+
+	titleMetricLog.Info("Computed global time series", "dates", len(points))
+
+	return points, nil
+}
+
+// CountWordsBySubpart totals the words and sections under each subpart of a title, in document order
+// Totals come from the cfr_structure table, so the title must be parsed first
+func (s *TitleMetricService) CountWordsBySubpart(
+	ctx context.Context,
+	titleNumber int,
+) ([]*data.SubpartMetric, error) {
+	subparts, err := s.CfrStructureDAO.SumMetricsBySubpart(ctx, titleNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum subpart metrics for title %d, %w", titleNumber, err)
+	}
+
+	return subparts, nil
+}
@@ -1,69 +1,283 @@
 package service
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/sam-berry/ecfr-analyzer/server/concurrent"
 	"github.com/sam-berry/ecfr-analyzer/server/dao"
 	"github.com/sam-berry/ecfr-analyzer/server/data"
 	"github.com/sam-berry/ecfr-analyzer/server/ecfrdata"
 	"github.com/sam-berry/ecfr-analyzer/server/httpclient"
+	"github.com/sam-berry/ecfr-analyzer/server/logging"
+	"github.com/sam-berry/ecfr-analyzer/server/metrics"
+	"github.com/sam-berry/ecfr-analyzer/server/parser"
 	"io"
+	"sort"
 	"time"
 )
 
+// HistoricalTitleImportTimeout bounds the fetch and store of a single historical title
+var HistoricalTitleImportTimeout = 10 * time.Minute
+
+// DefaultMaxContentBytes is the size limit of a downloaded title version when MaxContentBytes is not set
+// The largest titles are a few hundred megabytes of XML, so this only stops responses that are not a title
+const DefaultMaxContentBytes int64 = 2 << 30
+
+// DefaultDownloadTimeout bounds downloading and storing a title version when DownloadTimeout is not set
+var DefaultDownloadTimeout = 10 * time.Minute
+
+// ErrContentTooLarge is returned when a downloaded title version is larger than the size limit
+var ErrContentTooLarge = stderrors.New("content exceeds the size limit")
+
+var titleVersionLog = logging.New("title-version")
+
 type TitleVersionService struct {
-	HttpClient       *httpclient.ECFRBulkDataClient
-	TitleDAO         *dao.TitleDAO
-	TitleVersionDAO  *dao.TitleVersionDAO
+	HttpClient *httpclient.ECFRBulkDataClient
+
+	// VersionerClient lists the latest amendment date of each title, the effective date of imported content
+	VersionerClient *httpclient.ECFRAPIClient
+
+	TitleDAO        *dao.TitleDAO
+	TitleVersionDAO *dao.TitleVersionDAO
+
+	// VersionMetricsCache is invalidated for each version imported, optional
+	VersionMetricsCache *VersionMetricsCache
+
+	// MaxContentBytes limits the size of a downloaded title version, defaults to DefaultMaxContentBytes
+	MaxContentBytes int64
+
+	// DownloadTimeout bounds downloading and storing a title version, defaults to DefaultDownloadTimeout
+	DownloadTimeout time.Duration
+}
+
+// HistoricalImportSummary lists the titles imported by ImportHistoricalTitles and the errors of those that failed
+// When the import is canceled the titles not started are among the errors.
+// Skipped lists titles in the feed that are not in the title table, such as reserved titles, which are not failures.
+type HistoricalImportSummary struct {
+	VersionDate time.Time `json:"versionDate"`
+	Imported    []int     `json:"imported"`
+	Skipped     []int     `json:"skipped"`
+	Errors      []string  `json:"errors"`
+}
+
+// titleVersionImport is the outcome of importing a title file that did not fail
+type titleVersionImport struct {
+	TitleNumber int
+	Skipped     bool
+}
+
+// UploadedVersion describes a title version stored by ImportUploadedVersion
+type UploadedVersion struct {
+	TitleNumber int       `json:"titleNumber"`
+	VersionDate time.Time `json:"versionDate"`
+	Bytes       int64     `json:"bytes"`
 }
 
 // ImportHistoricalTitles imports historical CFR titles for a specific date
 // The date should be in YYYY-MM-DD format (e.g., "2024-01-01")
+// Canceling ctx stops the import, the summary lists what was imported until then
 func (s *TitleVersionService) ImportHistoricalTitles(
 	ctx context.Context,
 	versionDate time.Time,
 	titlesFilter []string,
-) error {
-	s.logInfo(fmt.Sprintf("Start - Importing historical titles for %s", versionDate.Format("2006-01-02")))
+) (*HistoricalImportSummary, error) {
+	log := titleVersionLog.With("versionDate", versionDate.Format("2006-01-02"))
+	log.Info("Start - Importing historical titles")
 
 	// Get all files for the version date
 	allFiles, err := s.getAllFilesForDate(ctx, versionDate, titlesFilter)
 	if err != nil {
-		return fmt.Errorf("failed to get files for date %s: %w", versionDate.Format("2006-01-02"), err)
+		return nil, fmt.Errorf("failed to get files for date %s: %w", versionDate.Format("2006-01-02"), err)
 	}
 
-	s.logInfo(fmt.Sprintf("Found %d title files for %s", len(allFiles), versionDate.Format("2006-01-02")))
+	log.Info("Found title files", "count", len(allFiles))
+
+	// The bulk files have no effective date of their own, see resolveEffectiveDate
+	amendedDates, err := s.getAmendedDates(ctx)
+	if err != nil {
+		log.Warn("Failed to get title amendment dates, using the requested date as the effective date", "error", err)
+	}
 
 	// Create concurrent runner with limited concurrency
-	runner := concurrent.NewRunner[ecfrdata.AllFilesItem, int](concurrent.RunnerConfig{
+	runner := concurrent.NewRunner[ecfrdata.AllFilesItem, titleVersionImport](concurrent.RunnerConfig{
 		MaxConcurrency: 5,
 		LogPrefix:      fmt.Sprintf("Historical Import (%s)", versionDate.Format("2006-01-02")),
+		WorkerTimeout:  HistoricalTitleImportTimeout,
 	})
 
-	// Process files concurrently
-	result := runner.Run(allFiles, func(
+	// Process files concurrently, each download is bounded by the worker timeout
+	result := runner.RunWithContext(ctx, allFiles, func(
+		ctx context.Context,
 		file ecfrdata.AllFilesItem,
 		messages chan<- string,
-		results chan<- int,
+		results chan<- titleVersionImport,
 		errors chan<- error,
 	) {
-		s.processTitleVersionFile(ctx, file, versionDate, messages, results, errors)
+		s.processTitleVersionFile(ctx, file, versionDate, amendedDates, results, errors)
 	})
 
+	summary := &HistoricalImportSummary{
+		VersionDate: versionDate,
+		Imported:    []int{},
+		Skipped:     []int{},
+		Errors:      []string{},
+	}
+	for _, imported := range result.Results {
+		if imported.Skipped {
+			summary.Skipped = append(summary.Skipped, imported.TitleNumber)
+		} else {
+			summary.Imported = append(summary.Imported, imported.TitleNumber)
+		}
+	}
+	sort.Ints(summary.Imported)
+	sort.Ints(summary.Skipped)
+	for _, err := range result.Errors {
+		summary.Errors = append(summary.Errors, err.Error())
+	}
+
 	if len(result.Errors) > 0 {
-		s.logInfo(fmt.Sprintf("Completed with %d errors", len(result.Errors)))
+		log.Warn(
+			"Completed with errors",
+			"imported", len(summary.Imported),
+			"skipped", len(summary.Skipped),
+			"errors", len(result.Errors),
+		)
+		metrics.Errors.WithLabelValues(metrics.OperationTitleVersionImport).Add(float64(len(result.Errors)))
 		for _, err := range result.Errors {
-			s.logInfo(fmt.Sprintf("Error: %v", err))
+			log.Error("Failed to import title version", "error", err)
 		}
 	} else {
-		s.logInfo(fmt.Sprintf("Successfully imported %d titles", len(result.Results)))
+		log.Info("Successfully imported titles", "count", len(summary.Imported), "skipped", len(summary.Skipped))
 	}
 
-	s.logInfo("Complete")
-	return nil
+	log.Info("Complete")
+	return summary, nil
+}
+
+// GetVersionDates lists the stored version dates of a title, most recent first
+func (s *TitleVersionService) GetVersionDates(
+	ctx context.Context,
+	titleNumber int,
+) ([]*data.TitleVersionDate, error) {
+	versions, err := s.TitleVersionDAO.FindByTitleNumber(ctx, titleNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find versions for title %d: %w", titleNumber, err)
+	}
+
+	dates := make([]*data.TitleVersionDate, 0, len(versions))
+	for _, version := range versions {
+		dates = append(dates, &data.TitleVersionDate{
+			VersionDate:   version.VersionDate,
+			CreatedAt:     version.CreatedAt,
+			TotalWords:    version.TotalWords,
+			TotalSections: version.TotalSections,
+		})
+	}
+
+	return dates, nil
+}
+
+// GetLatestVersion returns the most recent stored version of a title with its content
+// Returns an error wrapping ErrVersionNotFound if the title has no versions
+func (s *TitleVersionService) GetLatestVersion(
+	ctx context.Context,
+	titleNumber int,
+) (*data.TitleVersionWithContent, error) {
+	version, err := s.TitleVersionDAO.GetLatestContent(ctx, titleNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest version of title %d: %w", titleNumber, err)
+	}
+
+	if version == nil {
+		return nil, fmt.Errorf("%w: title %d", ErrVersionNotFound, titleNumber)
+	}
+
+	return version, nil
+}
+
+// OpenVersionContent opens the stored XML of a title version for streaming
+// Compressed content is passed through as gzip when acceptGzip is set, otherwise it is decompressed as it is read.
+// gzipped reports whether the reader yields gzip compressed content. The reader must be closed when it is an io.Closer.
+func (s *TitleVersionService) OpenVersionContent(
+	ctx context.Context,
+	titleNumber int,
+	versionDate time.Time,
+	acceptGzip bool,
+) (r io.Reader, gzipped bool, err error) {
+	r, gzipped, err = s.TitleVersionDAO.OpenContentByVersion(ctx, titleNumber, versionDate)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get version %s: %w", versionDate.Format("2006-01-02"), err)
+	}
+
+	if r == nil {
+		return nil, false, fmt.Errorf(
+			"%w: title %d, %s",
+			ErrVersionNotFound,
+			titleNumber,
+			versionDate.Format("2006-01-02"),
+		)
+	}
+
+	if !gzipped || acceptGzip {
+		return r, gzipped, nil
+	}
+
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		if closer, ok := r.(io.Closer); ok {
+			closer.Close()
+		}
+		return nil, false, fmt.Errorf("failed to decompress version %s: %w", versionDate.Format("2006-01-02"), err)
+	}
+
+	// Keep closing the stored content, such as a file, once the decompressed content is read
+	if closer, ok := r.(io.Closer); ok {
+		return struct {
+			io.Reader
+			io.Closer
+		}{gzipReader, closer}, false, nil
+	}
+
+	return gzipReader, false, nil
+}
+
+// ImportUploadedVersion stores the XML read from r as the version of a title for versionDate
+// The content is validated as it is streamed into storage, the insert fails if it is not a CFR title document,
+// in which case the error wraps parser.ErrInvalidTitleXML, or if it is a document of another title, in which case
+// the error wraps parser.ErrTitleMismatch. The title must already be imported.
+func (s *TitleVersionService) ImportUploadedVersion(
+	ctx context.Context,
+	titleNumber int,
+	versionDate time.Time,
+	r io.Reader,
+) (*UploadedVersion, error) {
+	title, err := s.TitleDAO.FindByNumber(ctx, titleNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find title %d: %w", titleNumber, err)
+	}
+
+	// Validate what the insert reads, failing the read ends the insert before anything is stored
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		pw.CloseWithError(parser.ValidateTitleXML(io.TeeReader(r, pw), titleNumber))
+	}()
+
+	// There is no file metadata for an upload, so the version date is also the effective date
+	size, err := s.insertVersion(ctx, title, titleNumber, versionDate, versionDate, pr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert uploaded version of title %d: %w", titleNumber, err)
+	}
+
+	titleVersionLog.Info("Stored uploaded title version", "title", titleNumber, "date", versionDate.Format("2006-01-02"), "bytes", size)
+	return &UploadedVersion{
+		TitleNumber: titleNumber,
+		VersionDate: versionDate,
+		Bytes:       size,
+	}, nil
 }
 
 // processTitleVersionFile processes a single title file for a specific version
@@ -71,17 +285,25 @@ func (s *TitleVersionService) processTitleVersionFile(
 	ctx context.Context,
 	file ecfrdata.AllFilesItem,
 	versionDate time.Time,
-	messages chan<- string,
-	results chan<- int,
+	amendedDates map[int]time.Time,
+	results chan<- titleVersionImport,
 	errors chan<- error,
 ) {
 	titleNumber := file.CFRTitle
-	messages <- fmt.Sprintf("Fetching: Title %d", titleNumber)
+	log := titleVersionLog.With("title", titleNumber, "versionDate", versionDate.Format("2006-01-02"))
+	start := time.Now()
+
+	log.Debug("Fetching title file")
 
 	// Get the title metadata to get the internal ID
 	title, err := s.TitleDAO.FindByNumber(ctx, titleNumber)
 	if err != nil {
-		messages <- fmt.Sprintf("failed to find title %d: %v", titleNumber, err)
+		// The feed lists reserved and removed titles that were never imported, which is not a failure
+		if stderrors.Is(err, dao.ErrTitleNotFound) {
+			log.Info("Skipping title that has not been imported")
+			results <- titleVersionImport{TitleNumber: titleNumber, Skipped: true}
+			return
+		}
 		errors <- fmt.Errorf("title %d: %w", titleNumber, err)
 		return
 	}
@@ -89,23 +311,27 @@ func (s *TitleVersionService) processTitleVersionFile(
 	// Get title file details
 	titleFile, err := s.getTitleFile(ctx, file.Link)
 	if err != nil {
-		messages <- fmt.Sprintf("failed to get title file for %d: %v", titleNumber, err)
 		errors <- fmt.Errorf("title %d: %w", titleNumber, err)
 		return
 	}
 
-	messages <- fmt.Sprintf("Downloading: Title %d", titleNumber)
+	log.Debug("Downloading title")
+
+	// The stored content may not be a snapshot of the requested date
+	effectiveDate := resolveEffectiveDate(amendedDates, titleNumber, versionDate)
+	if !effectiveDate.Equal(versionDate) {
+		log.Warn("Effective date differs from requested date", "effectiveDate", effectiveDate.Format("2006-01-02"))
+	}
 
 	// Download and store the title version
-	err = s.downloadTitleVersion(ctx, title, titleNumber, versionDate, titleFile.Link)
+	err = s.downloadTitleVersion(ctx, title, titleNumber, versionDate, effectiveDate, titleFile.Link)
 	if err != nil {
-		messages <- fmt.Sprintf("failed to download title %d: %v", titleNumber, err)
 		errors <- fmt.Errorf("title %d: %w", titleNumber, err)
 		return
 	}
 
-	messages <- fmt.Sprintf("Success: Title %d", titleNumber)
-	results <- titleNumber
+	log.Info("Imported title version", "durationMs", time.Since(start).Milliseconds())
+	results <- titleVersionImport{TitleNumber: titleNumber}
 }
 
 // getAllFilesForDate retrieves all title files for a specific date
@@ -179,33 +405,151 @@ func (s *TitleVersionService) getTitleFile(
 }
 
 // downloadTitleVersion downloads and stores a title version
+// Returns an error wrapping ErrContentTooLarge, without storing the version, if the content is larger than
+// MaxContentBytes
 func (s *TitleVersionService) downloadTitleVersion(
 	ctx context.Context,
 	title *data.Title,
 	titleNumber int,
 	versionDate time.Time,
+	effectiveDate time.Time,
 	url string,
 ) error {
+	timeout := s.DownloadTimeout
+	if timeout <= 0 {
+		timeout = DefaultDownloadTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	maxBytes := s.MaxContentBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxContentBytes
+	}
+
 	resp, err := s.HttpClient.GetXML(ctx, url)
 	if err != nil {
 		return fmt.Errorf("failed to fetch title XML from %s: %w", url, err)
 	}
 
 	defer resp.Body.Close()
-	content, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read title content: %w", err)
+
+	if resp.ContentLength > maxBytes {
+		return fmt.Errorf("title XML from %s is %d bytes, over %d: %w", url, resp.ContentLength, maxBytes, ErrContentTooLarge)
 	}
 
-	// Store the title version
-	err = s.TitleVersionDAO.Insert(ctx, title.InternalId, titleNumber, versionDate, content)
+	// Stream the response into the compressed insert rather than reading the whole title into memory
+	body := &limitedReader{r: io.LimitReader(resp.Body, maxBytes+1), remaining: maxBytes}
+	size, err := s.insertVersion(ctx, title, titleNumber, versionDate, effectiveDate, body)
 	if err != nil {
 		return fmt.Errorf("failed to insert title version: %w", err)
 	}
+	metrics.ImportBytesDownloaded.WithLabelValues(metrics.ImportTitleVersion).Add(float64(size))
 
+	titleVersionLog.Debug("Stored title version content", "title", titleNumber, "bytes", size)
 	return nil
 }
 
-func (s *TitleVersionService) logInfo(message string) {
-	log.Info(fmt.Sprintf("Title Version Process: %v", message))
+// limitedReader reads from r, failing with ErrContentTooLarge once more than remaining bytes are read
+// r should be limited to one byte past the limit, so an oversized stream is not read further than needed to fail.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, ErrContentTooLarge
+	}
+	return n, err
+}
+
+// insertVersion stores a title version read from r, counting its word and section totals as it is stored
+// A version that cannot be counted is still stored, without totals. Returns the number of bytes read from r.
+func (s *TitleVersionService) insertVersion(
+	ctx context.Context,
+	title *data.Title,
+	titleNumber int,
+	versionDate time.Time,
+	effectiveDate time.Time,
+	r io.Reader,
+) (int64, error) {
+	// Count what the insert reads, the counter drains the pipe when it fails so the insert is never blocked
+	// Only the totals are counted, no structures are built, so the version is never held in memory.
+	// A document of another title fails the read instead, so the insert fails before anything is stored.
+	pr, pw := io.Pipe()
+	var totals *parser.Totals
+	var countErr error
+	counted := make(chan struct{})
+	go func() {
+		totals, countErr = parser.NewCfrParser(title.InternalId, titleNumber).CountTotals(pr)
+		if stderrors.Is(countErr, parser.ErrTitleMismatch) {
+			pr.CloseWithError(countErr)
+		} else {
+			io.Copy(io.Discard, pr)
+		}
+		close(counted)
+	}()
+
+	size, err := s.TitleVersionDAO.InsertStream(
+		ctx, title.InternalId, titleNumber, versionDate, effectiveDate, io.TeeReader(r, pw),
+	)
+	pw.CloseWithError(err)
+	<-counted
+	if stderrors.Is(countErr, parser.ErrTitleMismatch) {
+		return 0, countErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	s.VersionMetricsCache.Invalidate(titleNumber, versionDate)
+
+	if countErr == nil {
+		countErr = s.TitleVersionDAO.UpdateTotals(
+			ctx, titleNumber, versionDate, totals.Words, totals.Sections,
+		)
+	}
+	if countErr != nil {
+		titleVersionLog.Warn("Failed to store title version totals", "title", titleNumber, "error", countErr)
+	}
+
+	return size, nil
+}
+
+// getAmendedDates returns the date each title was last amended, from the versioner title list
+func (s *TitleVersionService) getAmendedDates(ctx context.Context) (map[int]time.Time, error) {
+	resp, err := s.VersionerClient.Get(ctx, "/versioner/v1/titles.json")
+	if err != nil {
+		return nil, fmt.Errorf("titles list HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var titlesResp ecfrdata.VersionerTitlesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&titlesResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal titles list: %w", err)
+	}
+
+	amendedDates := make(map[int]time.Time, len(titlesResp.Titles))
+	for _, title := range titlesResp.Titles {
+		amended, err := time.Parse("2006-01-02", title.LatestAmendedOn)
+		if err != nil {
+			continue
+		}
+		amendedDates[title.Number] = amended
+	}
+
+	return amendedDates, nil
+}
+
+// resolveEffectiveDate determines the date the content of a title file corresponds to
+// The bulk files hold the current content of each title, which is effective from the title's latest amendment.
+// Falls back to the requested date when the amendment date of the title is not known
+func resolveEffectiveDate(amendedDates map[int]time.Time, titleNumber int, versionDate time.Time) time.Time {
+	if amended, ok := amendedDates[titleNumber]; ok {
+		return amended
+	}
+
+	return versionDate
 }
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// VersionMetricsCache keeps the metrics of recently parsed title versions, so change computations over
+// overlapping date ranges parse each version once
+// Entries expire after ttl and the least recently used entry is evicted beyond size entries.
+// A nil cache caches nothing.
+type VersionMetricsCache struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[versionMetricsKey]*list.Element
+	order   *list.List // Most recently used first
+}
+
+type versionMetricsKey struct {
+	titleNumber int
+	versionDate string
+}
+
+type versionMetricsEntry struct {
+	key       versionMetricsKey
+	metrics   VersionMetrics
+	expiresAt time.Time
+}
+
+// NewVersionMetricsCache creates a cache of at most size entries that expire after ttl
+func NewVersionMetricsCache(size int, ttl time.Duration) *VersionMetricsCache {
+	return &VersionMetricsCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[versionMetricsKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func newVersionMetricsKey(titleNumber int, versionDate time.Time) versionMetricsKey {
+	return versionMetricsKey{titleNumber: titleNumber, versionDate: versionDate.Format("2006-01-02")}
+}
+
+// Get returns the cached metrics of a title version, if present and not expired
+func (c *VersionMetricsCache) Get(titleNumber int, versionDate time.Time) (*VersionMetrics, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[newVersionMetricsKey(titleNumber, versionDate)]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*versionMetricsEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.remove(element)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	metrics := entry.metrics
+	return &metrics, true
+}
+
+// Put caches the metrics of a title version, evicting the least recently used entry when full
+func (c *VersionMetricsCache) Put(titleNumber int, versionDate time.Time, metrics *VersionMetrics) {
+	if c == nil || c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := newVersionMetricsKey(titleNumber, versionDate)
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	c.entries[key] = c.order.PushFront(&versionMetricsEntry{
+		key:       key,
+		metrics:   *metrics,
+		expiresAt: time.Now().Add(c.ttl),
+	})
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Invalidate removes the cached metrics of a title version, called when the version is imported again
+func (c *VersionMetricsCache) Invalidate(titleNumber int, versionDate time.Time) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[newVersionMetricsKey(titleNumber, versionDate)]; ok {
+		c.remove(element)
+	}
+}
+
+// remove removes an entry, the caller must hold mu
+func (c *VersionMetricsCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*versionMetricsEntry).key)
+}
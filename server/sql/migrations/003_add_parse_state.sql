@@ -0,0 +1,15 @@
+-- Migration: Add parse state tracking for CFR structure parsing
+-- This table records the content hash of each title at its last successful structure parse
+-- so that unchanged titles can be skipped on subsequent runs
+
+CREATE TABLE parse_state
+(
+    id                SERIAL PRIMARY KEY,
+    title_id          INTEGER UNIQUE NOT NULL REFERENCES title (id) ON DELETE CASCADE,
+    title_number      INTEGER        NOT NULL,
+    content_hash      TEXT           NOT NULL, -- SHA-256 of the title XML content at last parse
+    parsed_timestamp  TIMESTAMP      NOT NULL DEFAULT NOW()
+);
+
+-- Indexes for efficient querying
+CREATE INDEX idx_parse_state_title_number ON parse_state (title_number);
@@ -0,0 +1,13 @@
+-- Migration: Add the effective date of the stored content to title versions
+-- version_date is the date that was requested, effective_date is the date the stored content
+-- actually corresponds to, which can differ when a title has no snapshot for the requested date
+
+ALTER TABLE title_version ADD COLUMN effective_date DATE;
+
+-- Existing versions are assumed to match their requested date
+UPDATE title_version SET effective_date = version_date WHERE effective_date IS NULL;
+
+ALTER TABLE title_version ALTER COLUMN effective_date SET NOT NULL;
+
+-- Composite index for comparing snapshots by effective date
+CREATE INDEX idx_title_version_title_effective_date ON title_version (title_number, effective_date DESC);
@@ -0,0 +1,4 @@
+-- Migration: Store authority, source and editorial notes separately from structure text
+-- Notes are excluded from text_content and word_count so counts reflect substantive text only
+
+ALTER TABLE cfr_structure ADD COLUMN notes_content TEXT;
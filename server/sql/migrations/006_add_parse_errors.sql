@@ -0,0 +1,14 @@
+-- Migration: Add parse error tracking for CFR structure parsing
+-- A row is written each time parsing a title fails, and the rows of a title
+-- are cleared once it parses successfully, so the table lists currently failing titles
+
+CREATE TABLE parse_errors
+(
+    id                 SERIAL PRIMARY KEY,
+    title_number       INTEGER   NOT NULL,
+    error_message      TEXT      NOT NULL,
+    occurred_timestamp TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Indexes for efficient querying
+CREATE INDEX idx_parse_errors_title_number ON parse_errors (title_number);
@@ -0,0 +1,12 @@
+-- Migration: Store historical title version content gzip compressed
+-- Downloads are streamed through a gzip writer, so only the compressed content is held in memory.
+-- Existing rows keep their XML content, new rows store content_gzip and leave content NULL.
+
+ALTER TABLE title_version
+    ADD COLUMN content_gzip BYTEA;
+
+ALTER TABLE title_version
+    ALTER COLUMN content DROP NOT NULL;
+
+ALTER TABLE title_version
+    ADD CONSTRAINT title_version_content_present CHECK (content IS NOT NULL OR content_gzip IS NOT NULL);
@@ -0,0 +1,24 @@
+-- Migration: Add the CFR structure of historical title versions
+-- cfr_structure only holds the structure of the current title content, this table holds the
+-- structure parsed from a stored title_version, so the tree of a past version can be rendered.
+-- Text and notes are not copied, they can be read from the stored version content.
+
+CREATE TABLE cfr_structure_version
+(
+    id                SERIAL PRIMARY KEY,
+    structure_id      UUID UNIQUE NOT NULL,
+    title_id          INTEGER     NOT NULL REFERENCES title (id) ON DELETE CASCADE,
+    title_number      INTEGER     NOT NULL,
+    version_date      DATE        NOT NULL, -- The version date of the title_version the structure was parsed from
+    div_type          TEXT        NOT NULL,
+    div_level         INTEGER     NOT NULL,
+    identifier        TEXT        NOT NULL,
+    node_id           TEXT,
+    heading           TEXT,
+    word_count        INTEGER     NOT NULL DEFAULT 0,
+    path              TEXT        NOT NULL,
+    created_timestamp TIMESTAMP   NOT NULL DEFAULT NOW()
+);
+
+-- Composite index for loading the structure of a version
+CREATE INDEX idx_cfr_structure_version_title_date ON cfr_structure_version (title_number, version_date);
@@ -0,0 +1,12 @@
+-- Migration: Record the document order of CFR structure elements
+-- Identifiers do not sort lexically (e.g., "10" sorts before "2" by path), so structures are ordered by
+-- their position in the XML document instead. Existing rows default to 0 until their title is reparsed.
+
+ALTER TABLE cfr_structure
+    ADD COLUMN sequence_index INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE cfr_structure_version
+    ADD COLUMN sequence_index INTEGER NOT NULL DEFAULT 0;
+
+-- Composite index for loading the structure of a title in document order
+CREATE INDEX idx_cfr_structure_title_sequence ON cfr_structure (title_number, sequence_index);
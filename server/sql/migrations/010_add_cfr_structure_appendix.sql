@@ -0,0 +1,10 @@
+-- Migration: Tag appendices in the CFR structure
+-- Appendices have identifiers like "Appendix A to Part 50" and are sometimes nested under a part other
+-- than the one they belong to. They are tagged so metrics can count them separately, and linked to the
+-- part they refer to, when it can be determined, so agency metrics count them toward that part.
+
+ALTER TABLE cfr_structure
+    ADD COLUMN is_appendix BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE cfr_structure
+    ADD COLUMN appendix_part TEXT; -- Identifier of the part the appendix belongs to (optional)
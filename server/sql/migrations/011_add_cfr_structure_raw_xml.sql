@@ -0,0 +1,4 @@
+-- Migration: Store the raw inner XML of sections
+-- Only captured on request when parsing, the column is left null otherwise to avoid bloating storage
+
+ALTER TABLE cfr_structure ADD COLUMN raw_xml TEXT;
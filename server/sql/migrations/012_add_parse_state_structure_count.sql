@@ -0,0 +1,3 @@
+-- Migration: Record the number of structure elements stored at the last successful parse of each title
+
+ALTER TABLE parse_state ADD COLUMN structure_count INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,20 @@
+-- Migration: Store title version content through a content store selected by ECFR_CONTENT_STORE
+-- title_version keeps the metadata of each version and the key of its content in the store.
+-- Existing rows keep their content and content_gzip, new rows only set content_key.
+-- title_content holds the content when the store is postgres, the default.
+
+CREATE TABLE title_content (
+    content_key       TEXT PRIMARY KEY,
+    content_gzip      BYTEA NOT NULL,
+    created_timestamp TIMESTAMP NOT NULL
+);
+
+ALTER TABLE title_version
+    ADD COLUMN content_key TEXT;
+
+ALTER TABLE title_version
+    DROP CONSTRAINT title_version_content_present;
+
+ALTER TABLE title_version
+    ADD CONSTRAINT title_version_content_present
+        CHECK (content IS NOT NULL OR content_gzip IS NOT NULL OR content_key IS NOT NULL);
@@ -0,0 +1,6 @@
+-- Migration: Support parsing only the sections of a title
+-- Leaves-only parses store no intermediate hierarchy, so each section keeps the headings of its ancestors instead
+
+ALTER TABLE cfr_structure ADD COLUMN heading_path TEXT;
+
+ALTER TABLE parse_state ADD COLUMN leaves_only BOOLEAN NOT NULL DEFAULT FALSE;
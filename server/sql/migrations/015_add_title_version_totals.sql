@@ -0,0 +1,7 @@
+-- Migration: Store the word and section totals of title versions
+-- Totals are counted as a version is imported so listing versions does not parse their content.
+-- Versions imported before this migration have no totals until they are imported again.
+
+ALTER TABLE title_version ADD COLUMN total_words INTEGER;
+
+ALTER TABLE title_version ADD COLUMN total_sections INTEGER;
@@ -0,0 +1,4 @@
+-- Migration: Flag structures whose stored text was truncated
+-- The parser can cap the text stored for a structure, the word count still counts the full text
+
+ALTER TABLE cfr_structure ADD COLUMN text_truncated BOOLEAN NOT NULL DEFAULT FALSE;
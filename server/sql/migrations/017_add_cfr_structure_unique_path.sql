@@ -0,0 +1,12 @@
+-- Migration: Make the path of a CFR structure element unique within its title
+-- Reparses upsert structures by title and path, skipping those whose content is unchanged, so the pair must be
+-- unique. Paths stored before were built from the N attribute alone, so elements without an N, or with an N
+-- repeated among their siblings, can share a path and the constraint could not be added over them. The stored
+-- structures are removed and the parse state cleared, so the next parse of each title stores its structure again.
+
+DELETE FROM cfr_structure;
+
+DELETE FROM parse_state;
+
+ALTER TABLE cfr_structure
+    ADD CONSTRAINT cfr_structure_title_path_unique UNIQUE (title_id, path);
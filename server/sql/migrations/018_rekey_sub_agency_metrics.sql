@@ -0,0 +1,13 @@
+-- Migration: Key sub-agency metrics by sub-agency slug instead of name
+-- Keys were the parent agency id and the sanitized, lower case name of the sub-agency, which changed when a
+-- sub-agency was renamed. Keys whose name no longer matches a sub-agency are left as they are, recompute the
+-- sub-agency metrics to replace them.
+
+UPDATE computed_value cv
+SET key = 'sub-agency-metrics__' || a.agencyId || '__' || (child ->> 'slug')
+FROM agency a, jsonb_array_elements(a.children) child
+WHERE child ->> 'slug' IS NOT NULL
+  AND cv.key = 'sub-agency-metrics__' || a.agencyId || '__' || regexp_replace(
+        regexp_replace(lower(child ->> 'name'), '[^[:alnum:][:space:]]', '', 'g'),
+        '[[:space:]]', '-', 'g'
+    );
@@ -0,0 +1,8 @@
+-- Migration: Reparse every title so stored paths use typed segments
+-- Path segments now include the type of each element and escape "/" in identifiers, e.g., "TITLE:40/PART:60", so
+-- paths stay unique within a title. Clearing the parse state makes the next parse of each title replace its stored
+-- structure even if its content is unchanged. Stored title version structures are removed, as comparing their old
+-- paths with new ones would report every section as changed, parse the versions again to compare them.
+
+DELETE FROM parse_state;
+DELETE FROM cfr_structure_version;
@@ -0,0 +1,12 @@
+-- Migration: Tag reserved sections when they are parsed
+-- Metrics filter on the tag rather than matching the heading and text in SQL, see parser.IsReservedSection
+
+ALTER TABLE cfr_structure ADD COLUMN is_reserved BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Tag the sections stored before the column was added, trimming all whitespace as the parser does
+UPDATE cfr_structure SET is_reserved = TRUE
+WHERE div_type = 'SECTION'
+    AND (
+        LOWER(heading) LIKE '%[reserved]%'
+        OR LOWER(REGEXP_REPLACE(text_content, '^\s+|\s+$', '', 'g')) = '[reserved]'
+    );
@@ -0,0 +1,9 @@
+-- Migration: Store the distinct words of each title found at its last parse
+-- Title metrics read the distinct words of each title and across titles from here instead of tokenizing the text of
+-- every title again. Clearing the parse state makes the next parse of each title record them even if its content is
+-- unchanged.
+
+ALTER TABLE parse_state ADD COLUMN unique_word_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE parse_state ADD COLUMN vocabulary TEXT[] NOT NULL DEFAULT '{}';
+
+DELETE FROM parse_state;
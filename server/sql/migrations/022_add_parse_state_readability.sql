@@ -0,0 +1,10 @@
+-- Migration: Store the readability counts of each title found at its last parse
+-- Title metrics score readability from the sentences, words, and syllables of the text the parser counts words of,
+-- instead of the raw text of every title. Clearing the parse state makes the next parse of each title record them
+-- even if its content is unchanged.
+
+ALTER TABLE parse_state ADD COLUMN sentence_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE parse_state ADD COLUMN readability_word_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE parse_state ADD COLUMN syllable_count INTEGER NOT NULL DEFAULT 0;
+
+DELETE FROM parse_state;
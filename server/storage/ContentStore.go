@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrContentNotFound is returned by ContentStore.Get when nothing is stored under a key
+var ErrContentNotFound = errors.New("content not found")
+
+// ContentStore stores title version content by key, see dao.TitleVersionDAO
+// Content is opaque to a store, title versions are stored gzip compressed. Putting a key that exists replaces it.
+type ContentStore interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// TitleVersionContentKey is the key of the content of a title version, e.g., "title-40/2024-01-01.xml.gz"
+func TitleVersionContentKey(titleNumber int, versionDate time.Time) string {
+	return fmt.Sprintf("title-%d/%s.xml.gz", titleNumber, versionDate.Format("2006-01-02"))
+}
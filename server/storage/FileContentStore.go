@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileContentStore stores content in files under Dir, a key is the file's path relative to Dir
+// Content is streamed to and from the files, so it is never held in memory. Dir may be a mounted object storage
+// bucket, as a file is written under a temporary name and renamed into place once complete.
+type FileContentStore struct {
+	Dir string
+}
+
+func (s *FileContentStore) Put(ctx context.Context, key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("error creating directory for content %s: %w", key, err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating file for content %s: %w", key, err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing content %s: %w", key, err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing content %s: %w", key, err)
+	}
+
+	// Checked before replacing the content, an abandoned put leaves what was stored
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("error storing content %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (s *FileContentStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrContentNotFound, key)
+		}
+		return nil, fmt.Errorf("error opening content %s: %w", key, err)
+	}
+
+	return file, nil
+}
+
+func (s *FileContentStore) Exists(ctx context.Context, key string) (bool, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error checking content %s: %w", key, err)
+	}
+
+	return true, nil
+}
+
+// path returns the file of a key, keys may not refer outside of Dir
+func (s *FileContentStore) path(key string) (string, error) {
+	if !filepath.IsLocal(key) {
+		return "", fmt.Errorf("invalid content key %q", key)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
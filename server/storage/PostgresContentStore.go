@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"time"
+)
+
+// PostgresContentStore stores content in the title_content table
+// The driver sends a parameter as a single message, so content is read into memory to be stored.
+type PostgresContentStore struct {
+	Db *sql.DB
+}
+
+func (s *PostgresContentStore) Put(ctx context.Context, key string, r io.Reader) error {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading content %s: %w", key, err)
+	}
+
+	_, err = s.Db.ExecContext(
+		ctx,
+		`INSERT INTO title_content(content_key, content_gzip, created_timestamp)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (content_key) DO UPDATE
+		SET content_gzip = $2, created_timestamp = $3`,
+		key,
+		content,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("error inserting content %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (s *PostgresContentStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	var content []byte
+	err := s.Db.QueryRowContext(
+		ctx,
+		`SELECT content_gzip FROM title_content WHERE content_key = $1`,
+		key,
+	).Scan(&content)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrContentNotFound, key)
+		}
+		return nil, fmt.Errorf("error finding content %s: %w", key, err)
+	}
+
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (s *PostgresContentStore) Exists(ctx context.Context, key string) (bool, error) {
+	var exists bool
+	err := s.Db.QueryRowContext(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM title_content WHERE content_key = $1)`,
+		key,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking content %s: %w", key, err)
+	}
+
+	return exists, nil
+}
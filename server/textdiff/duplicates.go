@@ -0,0 +1,209 @@
+package textdiff
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash/fnv"
+	"strings"
+)
+
+// ShingleSize is the number of consecutive words in each shingle compared by ClusterDuplicates
+// Texts with fewer words are too short to be meaningful duplicates and are never clustered
+const ShingleSize = 5
+
+// The MinHash signature of a text has minHashCount values, split into minHashBands bands for locality sensitive
+// hashing. Two texts are only compared when all values of one of their bands are equal, which catches most pairs
+// with a similarity above (1/bands)^(1/rows), about 0.42, so thresholds below it miss more of the pairs.
+const (
+	minHashCount = 128
+	minHashBands = 32
+	minHashRows  = minHashCount / minHashBands
+)
+
+// minHashSeeds are the seeds of the minHashCount hash functions, fixed so signatures are reproducible
+var minHashSeeds = func() []uint64 {
+	seeds := make([]uint64, minHashCount)
+	state := uint64(0x2545f4914f6cdd1d)
+	for i := range seeds {
+		state += 0x9e3779b97f4a7c15
+		seeds[i] = mix(state)
+	}
+	return seeds
+}()
+
+// ClusterDuplicates groups texts that are identical or similar, returning the indexes of each group's texts
+//
+// Texts are normalized to lower case words of letters and digits first, so texts that only differ in
+// whitespace, punctuation, or case are identical. Similarity is the Jaccard similarity of the texts' sets of
+// ShingleSize word shingles, estimated by MinHash, and texts at or above threshold are grouped. Grouping is
+// transitive, so a group may hold texts less similar than threshold through a text similar to both.
+// A threshold of 1 or more groups identical texts only. Groups are in order of their first text, and the
+// indexes of each group are ascending.
+func ClusterDuplicates(texts []string, threshold float64) [][]int {
+	sets := newDisjointSets(len(texts))
+
+	// Identical texts are found by the hash of their words, and only the first of them is compared for similarity
+	var representatives []int
+	var representativeWords [][]string
+	firstByHash := make(map[[sha256.Size]byte]int)
+	for i, text := range texts {
+		words := normalize(text)
+		if len(words) < ShingleSize {
+			continue
+		}
+
+		hash := sha256.Sum256([]byte(strings.Join(words, " ")))
+		if first, ok := firstByHash[hash]; ok {
+			sets.union(first, i)
+			continue
+		}
+
+		firstByHash[hash] = i
+		representatives = append(representatives, i)
+		representativeWords = append(representativeWords, words)
+	}
+
+	if threshold < 1 {
+		signatures := make([][]uint64, len(representativeWords))
+		for i, words := range representativeWords {
+			signatures[i] = minHashSignature(words)
+		}
+
+		for band := 0; band < minHashBands; band++ {
+			buckets := make(map[uint64][]int)
+			for i, signature := range signatures {
+				key := bandKey(signature[band*minHashRows : (band+1)*minHashRows])
+				buckets[key] = append(buckets[key], i)
+			}
+
+			for _, bucket := range buckets {
+				for a := 0; a < len(bucket); a++ {
+					for b := a + 1; b < len(bucket); b++ {
+						first, second := representatives[bucket[a]], representatives[bucket[b]]
+						if sets.find(first) == sets.find(second) {
+							continue
+						}
+
+						if estimateSimilarity(signatures[bucket[a]], signatures[bucket[b]]) >= threshold {
+							sets.union(first, second)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	groupByRoot := make(map[int]int)
+	var groups [][]int
+	for i := range texts {
+		root := sets.find(i)
+		if sets.size[root] < 2 {
+			continue
+		}
+
+		group, ok := groupByRoot[root]
+		if !ok {
+			group = len(groups)
+			groupByRoot[root] = group
+			groups = append(groups, nil)
+		}
+		groups[group] = append(groups[group], i)
+	}
+
+	return groups
+}
+
+// minHashSignature computes the MinHash signature of the set of ShingleSize word shingles of words
+func minHashSignature(words []string) []uint64 {
+	signature := make([]uint64, minHashCount)
+	for i := range signature {
+		signature[i] = ^uint64(0)
+	}
+
+	shingle := fnv.New64a()
+	for start := 0; start+ShingleSize <= len(words); start++ {
+		shingle.Reset()
+		for _, word := range words[start : start+ShingleSize] {
+			shingle.Write([]byte(word))
+			shingle.Write([]byte{' '})
+		}
+
+		hash := shingle.Sum64()
+		for i, seed := range minHashSeeds {
+			if value := mix(hash ^ seed); value < signature[i] {
+				signature[i] = value
+			}
+		}
+	}
+
+	return signature
+}
+
+// estimateSimilarity estimates the Jaccard similarity of two shingle sets from their MinHash signatures
+func estimateSimilarity(a []uint64, b []uint64) float64 {
+	equal := 0
+	for i := range a {
+		if a[i] == b[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(a))
+}
+
+// bandKey hashes the values of a band of a MinHash signature into a bucket key
+func bandKey(values []uint64) uint64 {
+	hash := fnv.New64a()
+	var buf [8]byte
+	for _, value := range values {
+		binary.LittleEndian.PutUint64(buf[:], value)
+		hash.Write(buf[:])
+	}
+	return hash.Sum64()
+}
+
+// mix is the splitmix64 finalizer, used to derive independent hash functions from a shingle hash and a seed
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// disjointSets is a union-find of indexes, grouping the indexes of duplicate texts
+type disjointSets struct {
+	parent []int
+	size   []int
+}
+
+func newDisjointSets(n int) *disjointSets {
+	sets := &disjointSets{parent: make([]int, n), size: make([]int, n)}
+	for i := range sets.parent {
+		sets.parent[i] = i
+		sets.size[i] = 1
+	}
+	return sets
+}
+
+// find returns the root of the set of i, halving the path to it
+func (s *disjointSets) find(i int) int {
+	for s.parent[i] != i {
+		s.parent[i] = s.parent[s.parent[i]]
+		i = s.parent[i]
+	}
+	return i
+}
+
+// union merges the sets of a and b, attaching the smaller set to the larger
+func (s *disjointSets) union(a int, b int) {
+	a, b = s.find(a), s.find(b)
+	if a == b {
+		return
+	}
+	if s.size[a] < s.size[b] {
+		a, b = b, a
+	}
+	s.parent[b] = a
+	s.size[a] += s.size[b]
+}
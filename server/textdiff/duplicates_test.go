@@ -0,0 +1,61 @@
+package textdiff
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestClusterDuplicates(t *testing.T) {
+	base := strings.Join(numberedWords(40), " ")
+	nearDuplicate := substituted(numberedWords(40), 1)
+	other := strings.Join(numberedWords(80)[40:], " ")
+
+	texts := []string{
+		base,                                 // 0
+		"Too short to group.",                // 1
+		other,                                // 2
+		strings.ToUpper(base) + ".",          // 3, identical once normalized
+		nearDuplicate,                        // 4
+		"too   SHORT, to group",              // 5, identical to 1 but too short
+		strings.ReplaceAll(other, " ", "\n"), // 6, identical to 2 once normalized
+	}
+
+	tests := []struct {
+		name      string
+		threshold float64
+		expected  [][]int
+	}{
+		{
+			name:      "identical only",
+			threshold: 1,
+			expected:  [][]int{{0, 3}, {2, 6}},
+		},
+		{
+			name:      "similar",
+			threshold: 0.8,
+			expected:  [][]int{{0, 3, 4}, {2, 6}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := ClusterDuplicates(texts, tt.threshold)
+			if !slices.EqualFunc(groups, tt.expected, slices.Equal[[]int]) {
+				t.Errorf("ClusterDuplicates = %v, expected %v", groups, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClusterDuplicatesWithoutDuplicates(t *testing.T) {
+	texts := []string{
+		strings.Join(numberedWords(40), " "),
+		strings.Join(numberedWords(80)[40:], " "),
+		"",
+	}
+
+	if groups := ClusterDuplicates(texts, 0.5); len(groups) != 0 {
+		t.Errorf("expected no groups, got %v", groups)
+	}
+}
@@ -0,0 +1,125 @@
+package textdiff
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// ChangeClass describes how material a change to a text is
+type ChangeClass string
+
+const (
+	ChangeTrivial     ChangeClass = "trivial"     // Only whitespace, punctuation, or letter case changed
+	ChangeMinor       ChangeClass = "minor"       // Less than MinorChangeThreshold of the words changed
+	ChangeSubstantive ChangeClass = "substantive" // Any larger change
+)
+
+// MinorChangeThreshold is the share of changed words below which a change is minor
+var MinorChangeThreshold = 0.10
+
+// ClassifyChange classifies the change from oldText to newText
+//
+// Both texts are normalized to lower case words of letters and digits, so whitespace, punctuation,
+// and case are ignored. The share of changed words is the word-level edit distance (insertions,
+// deletions, and substitutions) divided by the word count of the longer text. The distance is only computed up to
+// the largest minor distance, so a substantive change to a long text costs no more than a minor one.
+func ClassifyChange(oldText string, newText string) ChangeClass {
+	oldWords := normalize(oldText)
+	newWords := normalize(newText)
+
+	limit := minorDistanceLimit(max(len(oldWords), len(newWords)))
+	distance := editDistance(oldWords, newWords, limit)
+	if distance == 0 {
+		return ChangeTrivial
+	}
+
+	if distance <= limit {
+		return ChangeMinor
+	}
+
+	return ChangeSubstantive
+}
+
+// minorDistanceLimit returns the largest edit distance between texts of at most words words that is a minor change,
+// 0 if every change is substantive
+func minorDistanceLimit(words int) int {
+	if words == 0 {
+		return 0
+	}
+
+	limit := int(math.Ceil(MinorChangeThreshold * float64(words)))
+	for limit > 0 && float64(limit)/float64(words) >= MinorChangeThreshold {
+		limit--
+	}
+	return limit
+}
+
+// normalize splits text into lower case words of letters and digits
+func normalize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// editDistance computes the Levenshtein distance between two word sequences, or limit+1 if it is above limit
+// A shared prefix and suffix are skipped first, since most edits to long sections are local. Only the cells of the
+// distance matrix within limit of its diagonal can hold a distance up to limit, so only that band is computed,
+// taking O(limit·n) rather than O(n·m), and it stops early once a whole row is above limit.
+func editDistance(a []string, b []string, limit int) int {
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	over := limit + 1
+	if len(a) == 0 {
+		return min(len(b), over)
+	}
+	if len(b) == 0 {
+		return min(len(a), over)
+	}
+	if len(a)-len(b) > limit || len(b)-len(a) > limit {
+		return over
+	}
+
+	// Only the previous row of the distance matrix is kept, cells outside the band are over the limit
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = min(j, over)
+	}
+
+	for i := 1; i <= len(a); i++ {
+		low := max(1, i-limit)
+		high := min(len(b), i+limit)
+
+		current[0] = min(i, over)
+		rowMin := current[0]
+		if low > 1 {
+			current[low-1] = over
+			rowMin = over
+		}
+
+		for j := low; j <= high; j++ {
+			substitution := previous[j-1]
+			if a[i-1] != b[j-1] {
+				substitution++
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, substitution, over)
+			rowMin = min(rowMin, current[j])
+		}
+		if high < len(b) {
+			current[high+1] = over
+		}
+
+		if rowMin >= over {
+			return over
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
@@ -0,0 +1,169 @@
+package textdiff
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// numberedWords returns n distinct words, "word1" to "wordN"
+func numberedWords(n int) []string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fmt.Sprintf("word%d", i+1)
+	}
+	return words
+}
+
+// substituted returns the words joined into a text with the first count words replaced
+func substituted(words []string, count int) string {
+	changed := append([]string(nil), words...)
+	for i := 0; i < count; i++ {
+		changed[i] = "changed"
+	}
+	return strings.Join(changed, " ")
+}
+
+func TestClassifyChange(t *testing.T) {
+	twenty := numberedWords(20)
+	eleven := numberedWords(11)
+	ten := numberedWords(10)
+
+	tests := []struct {
+		name     string
+		oldText  string
+		newText  string
+		expected ChangeClass
+	}{
+		{
+			name:     "punctuation, case, and whitespace",
+			oldText:  "The Agency shall, within 30 days, respond.",
+			newText:  "the agency shall  within 30 days respond",
+			expected: ChangeTrivial,
+		},
+		{
+			name:     "both empty",
+			oldText:  "",
+			newText:  "§ ()",
+			expected: ChangeTrivial,
+		},
+		{
+			name:     "one of twenty words",
+			oldText:  strings.Join(twenty, " "),
+			newText:  substituted(twenty, 1),
+			expected: ChangeMinor,
+		},
+		{
+			name:     "one of eleven words",
+			oldText:  strings.Join(eleven, " "),
+			newText:  substituted(eleven, 1),
+			expected: ChangeMinor,
+		},
+		{
+			name:     "one of ten words is at the threshold",
+			oldText:  strings.Join(ten, " "),
+			newText:  substituted(ten, 1),
+			expected: ChangeSubstantive,
+		},
+		{
+			name:     "two of twenty words is at the threshold",
+			oldText:  strings.Join(twenty, " "),
+			newText:  substituted(twenty, 2),
+			expected: ChangeSubstantive,
+		},
+		{
+			name:     "one word added to twenty",
+			oldText:  strings.Join(twenty, " "),
+			newText:  strings.Join(twenty, " ") + " more",
+			expected: ChangeMinor,
+		},
+		{
+			name:     "rewritten",
+			oldText:  strings.Join(twenty, " "),
+			newText:  "an entirely different provision",
+			expected: ChangeSubstantive,
+		},
+		{
+			name:     "added text",
+			oldText:  "",
+			newText:  "a new provision",
+			expected: ChangeSubstantive,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyChange(tt.oldText, tt.newText); got != tt.expected {
+				t.Errorf("ClassifyChange = %s, expected %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMinorDistanceLimit(t *testing.T) {
+	tests := []struct {
+		words    int
+		expected int
+	}{
+		{0, 0},
+		{5, 0},
+		{10, 0},
+		{11, 1},
+		{20, 1},
+		{21, 2},
+		{1000, 99},
+	}
+
+	for _, tt := range tests {
+		if got := minorDistanceLimit(tt.words); got != tt.expected {
+			t.Errorf("minorDistanceLimit(%d) = %d, expected %d", tt.words, got, tt.expected)
+		}
+	}
+}
+
+// fullEditDistance is the unbounded Levenshtein distance, computed over the whole matrix
+func fullEditDistance(a []string, b []string) int {
+	distances := make([][]int, len(a)+1)
+	for i := range distances {
+		distances[i] = make([]int, len(b)+1)
+		distances[i][0] = i
+	}
+	for j := range distances[0] {
+		distances[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			substitution := distances[i-1][j-1]
+			if a[i-1] != b[j-1] {
+				substitution++
+			}
+			distances[i][j] = min(distances[i-1][j]+1, distances[i][j-1]+1, substitution)
+		}
+	}
+
+	return distances[len(a)][len(b)]
+}
+
+func TestEditDistanceMatchesFullDistanceUpToLimit(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	vocabulary := []string{"a", "b", "c", "d"}
+	randomWords := func() []string {
+		words := make([]string, random.Intn(12))
+		for i := range words {
+			words[i] = vocabulary[random.Intn(len(vocabulary))]
+		}
+		return words
+	}
+
+	for i := 0; i < 2000; i++ {
+		a, b := randomWords(), randomWords()
+		limit := random.Intn(6)
+
+		expected := min(fullEditDistance(a, b), limit+1)
+		if got := editDistance(a, b, limit); got != expected {
+			t.Fatalf("editDistance(%v, %v, %d) = %d, expected %d", a, b, limit, got, expected)
+		}
+	}
+}